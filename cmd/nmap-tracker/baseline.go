@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const baselineUsage = "baseline command requires subcommand: list|add <ip|cidr>...|rm <baseline-id>|eval (all take --project <name> [--json])"
+
+func runBaseline(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, baselineUsage)
+		return 1
+	}
+	sub, operands := remaining[0], remaining[1:]
+	switch sub {
+	case "list", "eval":
+	case "add":
+		if len(operands) == 0 {
+			fmt.Fprintln(errOut, "baseline add requires at least one IP or CIDR")
+			return 1
+		}
+	case "rm":
+		if len(operands) != 1 {
+			fmt.Fprintln(errOut, "baseline rm requires a baseline id")
+			return 1
+		}
+	default:
+		fmt.Fprintf(errOut, "unknown baseline subcommand: %s\n", sub)
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "baseline "+sub, errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+	if (sub == "add" || sub == "rm") && !checkWritable(project, errOut) {
+		return 1
+	}
+
+	switch sub {
+	case "add":
+		added, items, err := database.BulkAddExpectedAssetBaselines(project.ID, operands)
+		if err != nil {
+			fmt.Fprintf(errOut, "add baseline: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, map[string]any{"added": added, "items": baselineItems(items)})
+		}
+		fmt.Fprintf(out, "added %d baseline definitions\n", added)
+		return 0
+	case "rm":
+		baselineID, err := strconv.ParseInt(operands[0], 10, 64)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid baseline id %q\n", operands[0])
+			return 1
+		}
+		err = database.DeleteExpectedAssetBaseline(project.ID, baselineID)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintf(errOut, "baseline %d not found in project %s\n", baselineID, project.Name)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "remove baseline: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "removed baseline %d\n", baselineID)
+		return 0
+	case "eval":
+		result, err := database.EvaluateExpectedAssetBaseline(project.ID)
+		if err != nil {
+			fmt.Fprintf(errOut, "evaluate baseline: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, result)
+		}
+		summary, lists := result.Summary, result.Lists
+		fmt.Fprintf(out, "%d expected, %d observed\n", summary.ExpectedTotal, summary.ObservedTotal)
+		fmt.Fprintf(out, "expected but unseen: %d\n", summary.ExpectedButUnseen)
+		for _, ip := range lists.ExpectedButUnseen {
+			fmt.Fprintf(out, "  %s\n", ip)
+		}
+		fmt.Fprintf(out, "seen but outside the baseline: %d (%d marked in scope, %d out of scope)\n",
+			summary.SeenButOutOfScope, summary.SeenButOutOfScopeAndMarkedInScope, summary.SeenButOutOfScopeAndMarkedOutOfScope)
+		table := newTable(out)
+		for _, h := range lists.SeenButOutOfScope {
+			scopeLabel := "out"
+			if h.InScope {
+				scopeLabel = "in"
+			}
+			fmt.Fprintf(table, "  %s\t%s\t%s\n", h.IPAddress, h.Hostname, scopeLabel)
+		}
+		table.Flush()
+		return 0
+	}
+
+	items, err := database.ListExpectedAssetBaselines(project.ID)
+	if err != nil {
+		fmt.Fprintf(errOut, "list baseline: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		return writeJSON(out, errOut, map[string]any{"items": baselineItems(items), "total": len(items)})
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "ID\tTYPE\tDEFINITION\tCREATED")
+	for _, item := range items {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", item.ID, item.Type, item.Definition, item.CreatedAt.UTC().Format(tableTimeFormat))
+	}
+	table.Flush()
+	return 0
+}
+
+// baselineItem is the API's JSON shape of a baseline definition.
+type baselineItem struct {
+	ID         int64  `json:"id"`
+	Definition string `json:"definition"`
+	Type       string `json:"type"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func baselineItems(items []db.ExpectedAssetBaseline) []baselineItem {
+	out := make([]baselineItem, 0, len(items))
+	for _, item := range items {
+		out = append(out, baselineItem{
+			ID:         item.ID,
+			Definition: item.Definition,
+			Type:       item.Type,
+			CreatedAt:  item.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return out
+}
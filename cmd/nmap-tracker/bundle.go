@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/bundle"
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const bundleUsage = "bundle command requires subcommand: export --project <name> -o <file>|import <file> [--name <name>] (both take [--json])"
+
+func runBundle(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	outputPath, remaining, err := extractFlag(remaining, "o", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if outputPath == "" {
+		outputPath, remaining, err = extractFlag(remaining, "output", "")
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+	name, remaining, err := extractFlag(remaining, "name", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, bundleUsage)
+		return 1
+	}
+
+	switch remaining[0] {
+	case "export":
+		if len(remaining) > 1 {
+			fmt.Fprintf(errOut, "unexpected arguments: %s\n", strings.Join(remaining[1:], " "))
+			return 1
+		}
+		if outputPath == "" {
+			fmt.Fprintln(errOut, "bundle export requires --output or -o")
+			return 1
+		}
+		return exportBundle(flags, outputPath, out, errOut)
+	case "import":
+		if len(remaining) != 2 {
+			fmt.Fprintln(errOut, "bundle import requires exactly one bundle file")
+			return 1
+		}
+		return importBundle(flags, remaining[1], name, out, errOut)
+	default:
+		fmt.Fprintf(errOut, "unknown bundle subcommand: %s\n", remaining[0])
+		return 1
+	}
+}
+
+// exportBundle writes the project's bundle to path. A failed export removes
+// the partial file.
+func exportBundle(flags projectFlags, path string, out, errOut io.Writer) int {
+	database, project, ok := openProject(flags, "bundle export", errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "create output: %v\n", err)
+		return 1
+	}
+	manifest, err := bundle.Export(database, project.ID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Fprintf(errOut, "export bundle: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		return writeJSON(out, errOut, manifest)
+	}
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	fmt.Fprintf(out, "exported project %s to %s (%d rows in %d tables, %d scan files)\n", project.Name, path, rows, len(manifest.Tables), len(manifest.Scans))
+	return 0
+}
+
+// importBundle loads a bundle file as a new project.
+func importBundle(flags projectFlags, path, name string, out, errOut io.Writer) int {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "open bundle: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	database, err := db.Open(flags.dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "open db: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	result, err := bundle.Import(database, file, name)
+	if errors.Is(err, db.ErrProjectExists) {
+		fmt.Fprintf(errOut, "import bundle: %v; choose another name with --name\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "import bundle: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		skipped := result.SkippedMembers
+		if skipped == nil {
+			skipped = []string{}
+		}
+		return writeJSON(out, errOut, map[string]any{
+			"project": result.Project, "manifest": result.Manifest, "rows": result.Rows, "skipped_members": skipped,
+		})
+	}
+	fmt.Fprintf(out, "imported project %d\t%s (%d imports, %d hosts, %d ports, exported %s)\n",
+		result.Project.ID, result.Project.Name, result.Rows["scan_import"], result.Rows["host"], result.Rows["port"],
+		result.Manifest.ExportedAt.Format(tableTimeFormat))
+	if len(result.SkippedMembers) > 0 {
+		fmt.Fprintf(errOut, "skipped members with no account here: %s\n", strings.Join(result.SkippedMembers, ", "))
+	}
+	return 0
+}
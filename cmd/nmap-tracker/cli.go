@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// tableTimeFormat is how table output renders timestamps; --json keeps RFC 3339.
+const tableTimeFormat = "2006-01-02 15:04:05"
+
+// projectFlags are the flags shared by every project-scoped subcommand.
+type projectFlags struct {
+	dbPath  string
+	project string
+	json    bool
+}
+
+// extractProjectFlags removes --db, --project and --json from args.
+func extractProjectFlags(args []string) (projectFlags, []string, error) {
+	var flags projectFlags
+	var err error
+	flags.dbPath, args, err = extractFlag(args, "db", defaultDBPath)
+	if err != nil {
+		return projectFlags{}, nil, err
+	}
+	flags.project, args, err = extractFlag(args, "project", "")
+	if err != nil {
+		return projectFlags{}, nil, err
+	}
+	flags.json, args = extractBoolFlag(args, "json")
+	return flags, args, nil
+}
+
+// openProject opens the database and resolves the named project, reporting
+// any failure on errOut. The caller closes the database when ok is true.
+func openProject(flags projectFlags, command string, errOut io.Writer) (database *db.DB, project db.Project, ok bool) {
+	if flags.project == "" {
+		fmt.Fprintf(errOut, "%s requires --project\n", command)
+		return nil, db.Project{}, false
+	}
+	database, err := db.Open(flags.dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "open db: %v\n", err)
+		return nil, db.Project{}, false
+	}
+	project, found, err := database.GetProjectByName(flags.project)
+	if err != nil {
+		database.Close()
+		fmt.Fprintf(errOut, "find project: %v\n", err)
+		return nil, db.Project{}, false
+	}
+	if !found {
+		database.Close()
+		fmt.Fprintf(errOut, "project %q not found\n", flags.project)
+		return nil, db.Project{}, false
+	}
+	return database, project, true
+}
+
+// checkWritable reports on errOut and returns false when the project is
+// archived and so rejects changes.
+func checkWritable(project db.Project, errOut io.Writer) bool {
+	if project.Archived() {
+		fmt.Fprintf(errOut, "project %q is archived; unarchive it with projects unarchive first\n", project.Name)
+		return false
+	}
+	return true
+}
+
+// writeJSON prints v as indented JSON, the --json form of command output. The
+// shapes match the corresponding web API responses.
+func writeJSON(out, errOut io.Writer, v any) int {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(errOut, "encode json: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// newTable returns a writer that aligns tab-separated columns; callers Flush it.
+func newTable(out io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+}
+
+func isValidWorkStatus(status string) bool {
+	switch status {
+	case "scanned", "flagged", "in_progress", "done":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const coverageUsage = "coverage requires --project <name> [--json]; coverage missing --segment <key> --intent <intent> lists the hosts of one cell"
+
+func runCoverage(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	segmentKey, remaining, err := extractFlag(remaining, "segment", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	intent, remaining, err := extractFlag(remaining, "intent", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	missing := len(remaining) == 1 && remaining[0] == "missing"
+	if len(remaining) > 0 && !missing {
+		fmt.Fprintln(errOut, coverageUsage)
+		return 1
+	}
+	if missing && (segmentKey == "" || intent == "") {
+		fmt.Fprintln(errOut, "coverage missing requires --segment and --intent")
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "coverage", errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	if missing {
+		// The drill-down is paged for the browser; collect every page.
+		var hosts []db.CoverageMatrixMissingHost
+		var total int
+		for page := 1; page == 1 || len(hosts) < total; page++ {
+			items, n, err := database.ListCoverageMatrixMissingHosts(project.ID, db.CoverageMatrixMissingOptions{
+				SegmentKey: segmentKey, Intent: intent, Page: page, PageSize: 200,
+			})
+			if errors.Is(err, db.ErrCoverageSegmentNotFound) {
+				fmt.Fprintf(errOut, "segment %q not found\n", segmentKey)
+				return 1
+			}
+			if err != nil {
+				fmt.Fprintf(errOut, "coverage missing: %v\n", err)
+				return 1
+			}
+			if len(items) == 0 {
+				break
+			}
+			hosts, total = append(hosts, items...), n
+		}
+		if flags.json {
+			if hosts == nil {
+				hosts = []db.CoverageMatrixMissingHost{}
+			}
+			return writeJSON(out, errOut, map[string]any{
+				"project_id": project.ID, "segment_key": segmentKey, "intent": strings.ToLower(intent), "items": hosts, "total": total,
+			})
+		}
+		table := newTable(out)
+		fmt.Fprintln(table, "HOST_ID\tIP\tHOSTNAME")
+		for _, h := range hosts {
+			fmt.Fprintf(table, "%d\t%s\t%s\n", h.HostID, h.IPAddress, h.Hostname)
+		}
+		table.Flush()
+		return 0
+	}
+
+	matrix, err := database.GetCoverageMatrix(project.ID, db.CoverageMatrixOptions{})
+	if err != nil {
+		fmt.Fprintf(errOut, "coverage matrix: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		return writeJSON(out, errOut, matrix)
+	}
+	table := newTable(out)
+	fmt.Fprintf(table, "SEGMENT\tKEY\tHOSTS\t%s\n", strings.ToUpper(strings.Join(matrix.Intents, "\t")))
+	for _, segment := range matrix.Segments {
+		cells := make([]string, 0, len(matrix.Intents))
+		for _, name := range matrix.Intents {
+			cell := segment.Cells[name]
+			cells = append(cells, fmt.Sprintf("%d%% (%d missing)", cell.CoveragePercent, cell.MissingCount))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", segment.SegmentLabel, segment.SegmentKey, segment.HostTotal, strings.Join(cells, "\t"))
+	}
+	table.Flush()
+	return 0
+}
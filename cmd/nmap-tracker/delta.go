@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const deltaUsage = "delta requires --project <name> --base <import-id> --target <import-id> [--preview <n>] [--json]"
+
+func runDelta(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	baseRaw, remaining, err := extractFlag(remaining, "base", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	targetRaw, remaining, err := extractFlag(remaining, "target", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	previewRaw, remaining, err := extractFlag(remaining, "preview", "50")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if baseRaw == "" || targetRaw == "" || len(remaining) > 0 {
+		fmt.Fprintln(errOut, deltaUsage)
+		return 1
+	}
+	baseID, err := strconv.ParseInt(baseRaw, 10, 64)
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid --base %q\n", baseRaw)
+		return 1
+	}
+	targetID, err := strconv.ParseInt(targetRaw, 10, 64)
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid --target %q\n", targetRaw)
+		return 1
+	}
+	if baseID == targetID {
+		fmt.Fprintln(errOut, "--base and --target must differ")
+		return 1
+	}
+	preview, err := strconv.Atoi(previewRaw)
+	if err != nil || preview < 0 {
+		fmt.Fprintf(errOut, "invalid --preview %q\n", previewRaw)
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "delta", errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	delta, err := database.GetImportDelta(project.ID, baseID, targetID, db.DeltaOptions{PreviewSize: preview, IncludeLists: true})
+	if errors.Is(err, db.ErrDeltaImportNotFound) {
+		fmt.Fprintf(errOut, "import not found in project %s\n", project.Name)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "import delta: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		return writeJSON(out, errOut, delta)
+	}
+
+	fmt.Fprintf(out, "base   %d\t%s\t%s\n", delta.BaseImport.ID, delta.BaseImport.Filename, delta.BaseImport.ScanTime.UTC().Format(tableTimeFormat))
+	fmt.Fprintf(out, "target %d\t%s\t%s\n\n", delta.TargetImport.ID, delta.TargetImport.Filename, delta.TargetImport.ScanTime.UTC().Format(tableTimeFormat))
+	table := newTable(out)
+	fmt.Fprintln(table, "CHANGE\tCOUNT")
+	fmt.Fprintf(table, "net new hosts\t%d\n", delta.Summary.NetNewHosts)
+	fmt.Fprintf(table, "disappeared hosts\t%d\n", delta.Summary.DisappearedHosts)
+	fmt.Fprintf(table, "net new open exposures\t%d\n", delta.Summary.NetNewOpenExposures)
+	fmt.Fprintf(table, "disappeared open exposures\t%d\n", delta.Summary.DisappearedOpenExposures)
+	fmt.Fprintf(table, "changed service fingerprints\t%d\n", delta.Summary.ChangedServiceFingerprints)
+	table.Flush()
+	if delta.Lists == nil {
+		return 0
+	}
+
+	lists := delta.Lists
+	for _, section := range []struct {
+		title string
+		hosts []db.DeltaHost
+	}{{"net new hosts", lists.NetNewHosts}, {"disappeared hosts", lists.DisappearedHosts}} {
+		if len(section.hosts) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", section.title)
+		table := newTable(out)
+		for _, h := range section.hosts {
+			fmt.Fprintf(table, "  %s\t%s\n", h.IPAddress, h.Hostname)
+		}
+		table.Flush()
+	}
+	for _, section := range []struct {
+		title     string
+		exposures []db.DeltaExposure
+	}{{"net new open exposures", lists.NetNewOpenExposures}, {"disappeared open exposures", lists.DisappearedOpenExposures}} {
+		if len(section.exposures) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", section.title)
+		table := newTable(out)
+		for _, e := range section.exposures {
+			fmt.Fprintf(table, "  %s\t%d/%s\t%s\t%s\n", e.IPAddress, e.PortNumber, e.Protocol, e.State, e.Service)
+		}
+		table.Flush()
+	}
+	if len(lists.ChangedServiceFingerprints) > 0 {
+		fmt.Fprintln(out, "\nchanged service fingerprints:")
+		table := newTable(out)
+		for _, c := range lists.ChangedServiceFingerprints {
+			fmt.Fprintf(table, "  %s\t%d/%s\t%s\t->\t%s\n", c.IPAddress, c.PortNumber, c.Protocol, fingerprintLabel(c.Before), fingerprintLabel(c.After))
+		}
+		table.Flush()
+	}
+	return 0
+}
+
+func fingerprintLabel(f db.DeltaFingerprintTuple) string {
+	var parts []string
+	for _, part := range []string{f.Service, f.Product, f.Version, f.ExtraInfo} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
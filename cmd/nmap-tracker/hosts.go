@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const hostsUsage = "hosts command requires subcommand: list --project <name> [--status <s,...>] [--subnet <cidr>] [--in-scope <true|false>] [--sort ip|hostname|ports] [--desc] [--limit <n>] [--json]"
+
+const portsUsage = "ports command requires subcommand: list --project <name> [--state <s,...>] [--status <s,...>] [--limit <n>] [--json]|set-status <scanned|flagged|in_progress|done> <ip|ip:port[/proto]|port-id>... --project <name> [--json]"
+
+func runHosts(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	statusRaw, remaining, err := extractFlag(remaining, "status", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	subnetRaw, remaining, err := extractFlag(remaining, "subnet", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	inScopeRaw, remaining, err := extractFlag(remaining, "in-scope", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	sortBy, remaining, err := extractFlag(remaining, "sort", "ip")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	limit, remaining, err := extractLimitFlag(remaining)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	desc, remaining := extractBoolFlag(remaining, "desc")
+	if len(remaining) != 1 || remaining[0] != "list" {
+		fmt.Fprintln(errOut, hostsUsage)
+		return 1
+	}
+
+	statuses, err := parseStatusList(statusRaw)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	var inScope *bool
+	if inScopeRaw != "" {
+		value, err := strconv.ParseBool(inScopeRaw)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid --in-scope %q\n", inScopeRaw)
+			return 1
+		}
+		inScope = &value
+	}
+	var subnetStart, subnetEnd []byte
+	if subnetRaw != "" {
+		prefix, err := netip.ParsePrefix(subnetRaw)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid --subnet %q\n", subnetRaw)
+			return 1
+		}
+		subnetStart, subnetEnd = db.PrefixKeyRange(prefix)
+	}
+	dir := "asc"
+	if desc {
+		dir = "desc"
+	}
+
+	database, project, ok := openProject(flags, "hosts list", errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	items, total, err := database.ListHostsWithSummaryPaged(project.ID, inScope, statuses, sortBy, dir, subnetStart, subnetEnd, limit, 0)
+	if err != nil {
+		fmt.Fprintf(errOut, "list hosts: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		if items == nil {
+			items = []db.HostListItem{}
+		}
+		return writeJSON(out, errOut, map[string]any{"items": items, "total": total})
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "ID\tIP\tHOSTNAME\tSCOPE\tPORTS\tSCANNED\tFLAGGED\tIN_PROGRESS\tDONE")
+	for _, h := range items {
+		scopeLabel := "out"
+		if h.InScope {
+			scopeLabel = "in"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			h.ID, h.IPAddress, h.Hostname, scopeLabel, h.PortCount, h.Scanned, h.Flagged, h.InProgress, h.Done)
+	}
+	table.Flush()
+	if len(items) < total {
+		fmt.Fprintf(out, "showing %d of %d hosts\n", len(items), total)
+	}
+	return 0
+}
+
+func runPorts(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	stateRaw, remaining, err := extractFlag(remaining, "state", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	statusRaw, remaining, err := extractFlag(remaining, "status", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	limit, remaining, err := extractLimitFlag(remaining)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, portsUsage)
+		return 1
+	}
+
+	switch sub := remaining[0]; sub {
+	case "list":
+		statuses, err := parseStatusList(statusRaw)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		database, project, ok := openProject(flags, "ports list", errOut)
+		if !ok {
+			return 1
+		}
+		defer database.Close()
+		return listPorts(database, project, splitList(stateRaw), statuses, limit, flags.json, out, errOut)
+	case "set-status":
+		if len(remaining) < 3 {
+			fmt.Fprintln(errOut, "ports set-status requires a status and at least one target")
+			return 1
+		}
+		status := remaining[1]
+		if !isValidWorkStatus(status) {
+			fmt.Fprintf(errOut, "invalid status %q (choose scanned, flagged, in_progress or done)\n", status)
+			return 1
+		}
+		database, project, ok := openProject(flags, "ports set-status", errOut)
+		if !ok {
+			return 1
+		}
+		defer database.Close()
+		if !checkWritable(project, errOut) {
+			return 1
+		}
+		return setPortStatus(database, project, status, remaining[2:], flags.json, out, errOut)
+	default:
+		fmt.Fprintf(errOut, "unknown ports subcommand: %s\n", sub)
+		return 1
+	}
+}
+
+func listPorts(database *db.DB, project db.Project, states, statuses []string, limit int, asJSON bool, out, errOut io.Writer) int {
+	if limit == 0 {
+		// SQLite reads a negative LIMIT as no limit.
+		limit = -1
+	}
+	ports, total, err := database.ListProjectPortsPaged(project.ID, states, statuses, limit, 0)
+	if err != nil {
+		fmt.Fprintf(errOut, "list ports: %v\n", err)
+		return 1
+	}
+	if asJSON {
+		if ports == nil {
+			ports = []db.ProjectPort{}
+		}
+		return writeJSON(out, errOut, map[string]any{"items": ports, "total": total})
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "ID\tHOST\tPORT\tSTATE\tSERVICE\tVERSION\tSTATUS\tLAST_SEEN")
+	for _, p := range ports {
+		version := strings.TrimSpace(p.Product + " " + p.Version)
+		fmt.Fprintf(table, "%d\t%s\t%d/%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.ID, p.HostIP, p.PortNumber, p.Protocol, p.State, p.Service, version, p.WorkStatus, p.LastSeen.UTC().Format(tableTimeFormat))
+	}
+	table.Flush()
+	if len(ports) < total {
+		fmt.Fprintf(out, "showing %d of %d ports\n", len(ports), total)
+	}
+	return 0
+}
+
+// setPortStatus sets the work status of every port named by targets: a bare
+// IP selects the host's open ports (as the host page's bulk action does),
+// ip:port[/proto] one port (TCP by default) and a number a port ID.
+func setPortStatus(database *db.DB, project db.Project, status string, targets []string, asJSON bool, out, errOut io.Writer) int {
+	var ids []int64
+	seen := make(map[int64]bool)
+	add := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, target := range targets {
+		resolved, err := resolvePortTarget(database, project, target)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		for _, id := range resolved {
+			add(id)
+		}
+	}
+
+	if err := database.BulkUpdatePortStatusesForProject(project.ID, ids, status); err != nil {
+		fmt.Fprintf(errOut, "set port status: %v\n", err)
+		return 1
+	}
+	if asJSON {
+		if ids == nil {
+			ids = []int64{}
+		}
+		return writeJSON(out, errOut, map[string]any{"status": status, "port_ids": ids, "updated": len(ids)})
+	}
+	fmt.Fprintf(out, "set %d ports to %s\n", len(ids), status)
+	return 0
+}
+
+func resolvePortTarget(database *db.DB, project db.Project, target string) ([]int64, error) {
+	if id, err := strconv.ParseInt(target, 10, 64); err == nil {
+		port, found, err := database.GetPortByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("find port: %w", err)
+		}
+		if found {
+			host, found, err := database.GetHostByID(port.HostID)
+			if err != nil {
+				return nil, fmt.Errorf("find host: %w", err)
+			}
+			if found && host.ProjectID == project.ID {
+				return []int64{id}, nil
+			}
+		}
+		return nil, fmt.Errorf("port %d not found in project %s", id, project.Name)
+	}
+
+	if addr, err := netip.ParseAddr(target); err == nil {
+		host, err := findHost(database, project, addr.String())
+		if err != nil {
+			return nil, err
+		}
+		ports, err := database.ListPorts(host.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list ports: %w", err)
+		}
+		var ids []int64
+		for _, p := range ports {
+			if p.State == "open" {
+				ids = append(ids, p.ID)
+			}
+		}
+		return ids, nil
+	}
+
+	hostPort, protocol, hasProtocol := strings.Cut(target, "/")
+	if !hasProtocol {
+		protocol = "tcp"
+	}
+	ip, portRaw, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q (use ip, ip:port[/proto] or a port id)", target)
+	}
+	number, err := strconv.Atoi(portRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", target)
+	}
+	host, err := findHost(database, project, ip)
+	if err != nil {
+		return nil, err
+	}
+	port, found, err := database.GetPortByKey(host.ID, number, strings.ToLower(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("find port: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("port %s not found", target)
+	}
+	return []int64{port.ID}, nil
+}
+
+func findHost(database *db.DB, project db.Project, ip string) (db.Host, error) {
+	host, found, err := database.GetHostByIP(project.ID, ip)
+	if err != nil {
+		return db.Host{}, fmt.Errorf("find host: %w", err)
+	}
+	if !found {
+		return db.Host{}, fmt.Errorf("host %s not found in project %s", ip, project.Name)
+	}
+	return host, nil
+}
+
+// extractLimitFlag removes --limit; 0 (the default) means no limit.
+func extractLimitFlag(args []string) (int, []string, error) {
+	raw, remaining, err := extractFlag(args, "limit", "")
+	if err != nil || raw == "" {
+		return 0, remaining, err
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return 0, nil, fmt.Errorf("--limit must be a non-negative integer")
+	}
+	return limit, remaining, nil
+}
+
+func parseStatusList(raw string) ([]string, error) {
+	statuses := splitList(raw)
+	for _, status := range statuses {
+		if !isValidWorkStatus(status) {
+			return nil, fmt.Errorf("invalid status %q (choose scanned, flagged, in_progress or done)", status)
+		}
+	}
+	return statuses, nil
+}
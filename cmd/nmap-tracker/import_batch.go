@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// Outcomes of one file in a batch import. Only batchFailed makes the
+// command exit non-zero.
+const (
+	batchImported  = "imported"
+	batchSkipped   = "skipped"
+	batchDuplicate = "duplicate"
+	batchFailed    = "failed"
+)
+
+type batchResult struct {
+	path   string
+	status string
+	hosts  int
+	ports  int
+	detail string
+}
+
+// importBatch imports every scan file the paths name, expanding directories,
+// globs and archives, and prints one row per file. Files that are not scans
+// and files already imported are reported but do not fail the batch.
+func importBatch(database *db.DB, matcher *scope.Matcher, project db.Project, paths []string, options importer.ImportOptions, out, errOut io.Writer) int {
+	var results []batchResult
+	err := importer.WalkScanSources(paths, func(src importer.ScanSource, r io.Reader, err error) error {
+		result := batchResult{path: src.Path}
+		if err != nil {
+			result.status, result.detail = batchFailed, err.Error()
+			results = append(results, result)
+			return nil
+		}
+		stats, err := importer.ImportWithOptions(database, matcher, project.ID, src.Filename, r, options, time.Now().UTC())
+		var duplicate *importer.DuplicateImportError
+		switch {
+		case err == nil:
+			result.status, result.hosts, result.ports = batchImported, stats.HostsFound, stats.PortsFound
+			result.detail = fmt.Sprintf("import %d, %d in scope, %d out of scope", stats.ID, stats.InScope, stats.OutScope)
+			if stats.PortsNotObserved > 0 {
+				result.detail += fmt.Sprintf(", %d ports not observed", stats.PortsNotObserved)
+			}
+			warnMACChanges(stats.MACChanges, errOut)
+		case errors.Is(err, importer.ErrUnrecognizedFormat):
+			result.status, result.detail = batchSkipped, "not a scan file"
+		case errors.As(err, &duplicate):
+			result.status, result.detail = batchDuplicate, fmt.Sprintf("same as import %d (%s)", duplicate.Existing.ID, duplicate.Existing.Filename)
+		default:
+			result.status, result.detail = batchFailed, err.Error()
+		}
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(errOut, "import: %v\n", err)
+		return 1
+	}
+
+	counts := make(map[string]int)
+	table := newTable(out)
+	fmt.Fprintln(table, "FILE\tSTATUS\tHOSTS\tPORTS\tDETAIL")
+	for _, result := range results {
+		counts[result.status]++
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%s\n", result.path, result.status, result.hosts, result.ports, result.detail)
+	}
+	table.Flush()
+	fmt.Fprintf(out, "%d imported, %d skipped, %d duplicate, %d failed into project %s\n",
+		counts[batchImported], counts[batchSkipped], counts[batchDuplicate], counts[batchFailed], project.Name)
+	if counts[batchDuplicate] > 0 {
+		fmt.Fprintln(errOut, "rerun with --force to import duplicates again")
+	}
+	if counts[batchFailed] > 0 {
+		return 1
+	}
+	return 0
+}
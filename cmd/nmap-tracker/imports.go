@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+)
+
+const importsUsage = "imports command requires subcommand: list|delete <import-id>|raw <import-id> [-o <file>]|reparse <import-id>|intents <import-id> [--set <intent,...>] [--add <intent,...>] [--remove <intent,...>] (all take --project <name> [--json])"
+
+func runImports(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	// --set "" clears the intents, so its presence matters, not its value.
+	replace := hasFlag(remaining, "set")
+	setRaw, remaining, err := extractFlag(remaining, "set", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	addRaw, remaining, err := extractFlag(remaining, "add", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	removeRaw, remaining, err := extractFlag(remaining, "remove", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	outputPath, remaining, err := extractFlag(remaining, "o", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if outputPath == "" {
+		outputPath, remaining, err = extractFlag(remaining, "output", "")
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, importsUsage)
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "imports "+remaining[0], errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	switch sub := remaining[0]; sub {
+	case "list":
+		imports, err := database.ListScanImportsWithIntents(project.ID)
+		if err != nil {
+			fmt.Fprintf(errOut, "list imports: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			if imports == nil {
+				imports = []db.ScanImportWithIntents{}
+			}
+			return writeJSON(out, errOut, imports)
+		}
+		for _, imp := range imports {
+			fmt.Fprintf(out, "%d\t%s\t%s\t%d hosts\t%d ports\n",
+				imp.ID, imp.Filename, imp.ScanTime().UTC().Format(tableTimeFormat), imp.HostsFound, imp.PortsFound)
+		}
+		return 0
+	case "delete":
+		if len(remaining) < 2 {
+			fmt.Fprintln(errOut, "imports delete requires an import id")
+			return 1
+		}
+		importID, err := strconv.ParseInt(remaining[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid import id %q\n", remaining[1])
+			return 1
+		}
+		if !checkWritable(project, errOut) {
+			return 1
+		}
+		stats, err := importer.DeleteScanImport(database, project.ID, importID)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(errOut, "import %d not found in project %s\n", importID, project.Name)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "delete import: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, map[string]any{
+				"import_id": importID, "filename": stats.Import.Filename, "hosts_rebuilt": stats.HostsRebuilt,
+				"hosts_removed": stats.HostsRemoved, "ports_removed": stats.PortsRemoved,
+			})
+		}
+		fmt.Fprintf(out, "deleted import %d (%s): %d hosts rebuilt, %d hosts and %d ports removed\n",
+			importID, stats.Import.Filename, stats.HostsRebuilt, stats.HostsRemoved, stats.PortsRemoved)
+		return 0
+	case "raw":
+		if len(remaining) < 2 {
+			fmt.Fprintln(errOut, "imports raw requires an import id")
+			return 1
+		}
+		importID, err := strconv.ParseInt(remaining[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid import id %q\n", remaining[1])
+			return 1
+		}
+		return writeImportRaw(database, project, importID, outputPath, out, errOut)
+	case "reparse":
+		if len(remaining) < 2 {
+			fmt.Fprintln(errOut, "imports reparse requires an import id")
+			return 1
+		}
+		importID, err := strconv.ParseInt(remaining[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid import id %q\n", remaining[1])
+			return 1
+		}
+		if !checkWritable(project, errOut) {
+			return 1
+		}
+		stats, err := importer.ReparseScanImport(database, project.ID, importID)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(errOut, "import %d not found in project %s\n", importID, project.Name)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "reparse import: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, map[string]any{
+				"import_id": importID, "filename": stats.Import.Filename, "format": stats.Format,
+				"hosts_before": stats.Before.HostsFound, "ports_before": stats.Before.PortsFound,
+				"hosts_found": stats.Import.HostsFound, "ports_found": stats.Import.PortsFound,
+				"in_scope": stats.InScope, "out_scope": stats.OutScope, "skipped": stats.Skipped,
+				"hosts_rebuilt": stats.HostsRebuilt, "hosts_removed": stats.HostsRemoved, "ports_removed": stats.PortsRemoved,
+			})
+		}
+		fmt.Fprintf(out, "reparsed import %d (%s, %s): %d hosts and %d ports, was %d and %d; %d hosts rebuilt, %d hosts and %d ports removed\n",
+			importID, stats.Import.Filename, stats.Format, stats.Import.HostsFound, stats.Import.PortsFound,
+			stats.Before.HostsFound, stats.Before.PortsFound, stats.HostsRebuilt, stats.HostsRemoved, stats.PortsRemoved)
+		return 0
+	case "intents":
+		if len(remaining) < 2 {
+			fmt.Fprintln(errOut, "imports intents requires an import id")
+			return 1
+		}
+		importID, err := strconv.ParseInt(remaining[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid import id %q\n", remaining[1])
+			return 1
+		}
+		return editImportIntents(database, project, importID, replace, splitList(setRaw), splitList(addRaw), splitList(removeRaw), flags.json, out, errOut)
+	default:
+		fmt.Fprintf(errOut, "unknown imports subcommand: %s\n", sub)
+		return 1
+	}
+}
+
+// writeImportRaw writes the original file of an import to path, or to out
+// when path is empty. A failed write removes the partial file.
+func writeImportRaw(database *db.DB, project db.Project, importID int64, path string, out, errOut io.Writer) int {
+	record, artifact, err := database.GetScanImportArtifact(project.ID, importID)
+	if err == sql.ErrNoRows {
+		fmt.Fprintf(errOut, "import %d not found in project %s\n", importID, project.Name)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "import %d: %v\n", importID, err)
+		return 1
+	}
+	raw, err := database.ReadScanArtifact(artifact)
+	if err != nil {
+		fmt.Fprintf(errOut, "read raw file: %v\n", err)
+		return 1
+	}
+	defer raw.Close()
+
+	if path == "" {
+		if _, err := io.Copy(out, raw); err != nil {
+			fmt.Fprintf(errOut, "write raw file: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "create output: %v\n", err)
+		return 1
+	}
+	_, err = io.Copy(file, raw)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Fprintf(errOut, "write raw file: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "wrote %s (%d bytes, sha256 %s) to %s\n", record.Filename, artifact.Size, artifact.SHA256, path)
+	return 0
+}
+
+// editImportIntents shows an import's intents after applying any edits:
+// replace swaps the whole list for set, and add and remove adjust it.
+// Intents named here are recorded as manual with full confidence, as the web
+// UI does; untouched ones keep their source.
+func editImportIntents(database *db.DB, project db.Project, importID int64, replace bool, set, add, remove []string, asJSON bool, out, errOut io.Writer) int {
+	imports, err := database.ListScanImportsWithIntents(project.ID)
+	if err != nil {
+		fmt.Fprintf(errOut, "list imports: %v\n", err)
+		return 1
+	}
+	var current *db.ScanImportWithIntents
+	for i := range imports {
+		if imports[i].ID == importID {
+			current = &imports[i]
+			break
+		}
+	}
+	if current == nil {
+		fmt.Fprintf(errOut, "import %d not found in project %s\n", importID, project.Name)
+		return 1
+	}
+
+	intents := current.Intents
+	if replace || len(add) > 0 || len(remove) > 0 {
+		if !checkWritable(project, errOut) {
+			return 1
+		}
+		for _, name := range append(append(append([]string{}, set...), add...), remove...) {
+			if !db.ValidIntent(strings.ToLower(name)) {
+				fmt.Fprintf(errOut, "invalid intent %q (choose %s)\n", name, strings.Join(db.CoverageIntentOrder(), ", "))
+				return 1
+			}
+		}
+		inputs := make(map[string]db.ScanImportIntentInput)
+		if !replace {
+			for _, intent := range intents {
+				inputs[intent.Intent] = db.ScanImportIntentInput{Intent: intent.Intent, Source: intent.Source, Confidence: intent.Confidence}
+			}
+		}
+		for _, name := range append(set, add...) {
+			name = strings.ToLower(name)
+			inputs[name] = db.ScanImportIntentInput{Intent: name, Source: db.IntentSourceManual, Confidence: 1}
+		}
+		for _, name := range remove {
+			delete(inputs, strings.ToLower(name))
+		}
+		list := make([]db.ScanImportIntentInput, 0, len(inputs))
+		for _, input := range inputs {
+			list = append(list, input)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Intent < list[j].Intent })
+		if err := database.SetScanImportIntents(project.ID, importID, list); err != nil {
+			fmt.Fprintf(errOut, "set intents: %v\n", err)
+			return 1
+		}
+		updated, err := database.ListScanImportsWithIntents(project.ID)
+		if err != nil {
+			fmt.Fprintf(errOut, "list imports: %v\n", err)
+			return 1
+		}
+		for _, imp := range updated {
+			if imp.ID == importID {
+				intents = imp.Intents
+			}
+		}
+	}
+
+	if asJSON {
+		if intents == nil {
+			intents = []db.ScanImportIntent{}
+		}
+		return writeJSON(out, errOut, map[string]any{"import_id": importID, "intents": intents})
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "INTENT\tSOURCE\tCONFIDENCE")
+	for _, intent := range intents {
+		fmt.Fprintf(table, "%s\t%s\t%.2f\n", intent.Intent, intent.Source, intent.Confidence)
+	}
+	table.Flush()
+	return 0
+}
+
+// hasFlag reports whether --name or -name appears in args.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--"+name || arg == "-"+name {
+			return true
+		}
+	}
+	return false
+}
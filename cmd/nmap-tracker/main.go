@@ -1,12 +1,12 @@
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,13 +14,12 @@ import (
 	"github.com/sloppy/nmaptracker/internal/export"
 	"github.com/sloppy/nmaptracker/internal/importer"
 	"github.com/sloppy/nmaptracker/internal/scope"
-	"github.com/sloppy/nmaptracker/internal/web"
 )
 
 const defaultDBPath = "nmap-tracker.db"
 
 func usage() string {
-	return "Usage: nmap-tracker <serve|import|export|projects>"
+	return "Usage: nmap-tracker <serve|import|imports|rebuild|export|bundle|projects|users|scope|hosts|ports|delta|coverage|baseline|queue>"
 }
 
 func main() {
@@ -41,8 +40,30 @@ func run(args []string, out, errOut io.Writer) int {
 		return runProjects(args[2:], out, errOut)
 	case "import":
 		return runImport(args[2:], out, errOut)
+	case "imports":
+		return runImports(args[2:], out, errOut)
+	case "rebuild":
+		return runRebuild(args[2:], out, errOut)
 	case "export":
 		return runExport(args[2:], out, errOut)
+	case "bundle":
+		return runBundle(args[2:], out, errOut)
+	case "users":
+		return runUsers(args[2:], out, errOut)
+	case "scope":
+		return runScope(args[2:], out, errOut)
+	case "hosts":
+		return runHosts(args[2:], out, errOut)
+	case "ports":
+		return runPorts(args[2:], out, errOut)
+	case "delta":
+		return runDelta(args[2:], out, errOut)
+	case "coverage":
+		return runCoverage(args[2:], out, errOut)
+	case "baseline":
+		return runBaseline(args[2:], out, errOut)
+	case "queue":
+		return runQueue(args[2:], out, errOut)
 	case "help", "-h", "--help":
 		fmt.Fprintln(out, usage())
 		return 0
@@ -53,123 +74,97 @@ func run(args []string, out, errOut io.Writer) int {
 	}
 }
 
-func runServe(args []string, out, errOut io.Writer) int {
-	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
-	fs.SetOutput(errOut)
-	dbPath := fs.String("db", defaultDBPath, "path to database file")
-	port := fs.Int("port", 8080, "port to listen on")
-	if err := fs.Parse(args); err != nil {
-		return 1
-	}
-	database, err := db.Open(*dbPath)
+func runImport(args []string, out, errOut io.Writer) int {
+	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
 	if err != nil {
-		fmt.Fprintf(errOut, "open db: %v\n", err)
-		return 1
-	}
-	defer database.Close()
-
-	server := web.NewServer(database)
-	addr := fmt.Sprintf("127.0.0.1:%d", *port)
-	fmt.Fprintf(out, "listening on http://127.0.0.1:%d\n", *port)
-	if err := http.ListenAndServe(addr, server.Handler()); err != nil {
-		fmt.Fprintf(errOut, "serve: %v\n", err)
+		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	return 0
-}
-
-func runProjects(args []string, out, errOut io.Writer) int {
-	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
+	projectName, remaining, err := extractFlag(remaining, "project", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	if len(remaining) < 1 {
-		fmt.Fprintln(errOut, "projects command requires subcommand: list|create <name>")
+	if projectName == "" {
+		fmt.Fprintln(errOut, "import requires --project")
 		return 1
 	}
-	sub := remaining[0]
-	switch sub {
-	case "list":
-		database, err := db.Open(dbPath)
-		if err != nil {
-			fmt.Fprintf(errOut, "open db: %v\n", err)
-			return 1
-		}
-		defer database.Close()
-		projects, err := database.ListProjects()
-		if err != nil {
-			fmt.Fprintf(errOut, "list projects: %v\n", err)
-			return 1
-		}
-		for _, p := range projects {
-			fmt.Fprintf(out, "%d\t%s\n", p.ID, p.Name)
-		}
-		return 0
-	case "create":
-		if len(remaining) < 2 {
-			fmt.Fprintln(errOut, "projects create requires a project name")
-			return 1
-		}
-		name := strings.Join(remaining[1:], " ")
-		database, err := db.Open(dbPath)
-		if err != nil {
-			fmt.Fprintf(errOut, "open db: %v\n", err)
-			return 1
-		}
-		defer database.Close()
-		p, err := database.CreateProject(name)
-		if err != nil {
-			fmt.Fprintf(errOut, "create project: %v\n", err)
-			return 1
-		}
-		fmt.Fprintf(out, "created project %d\t%s\n", p.ID, p.Name)
-		return 0
-	default:
-		fmt.Fprintf(errOut, "unknown projects subcommand: %s\n", sub)
+	scannerLabel, remaining, err := extractFlag(remaining, "scanner-label", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
 		return 1
 	}
-}
-
-func runImport(args []string, out, errOut io.Writer) int {
-	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
+	sourceIP, remaining, err := extractFlag(remaining, "source-ip", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	projectName, remaining, err := extractFlag(remaining, "project", "")
+	sourcePort, remaining, err := extractFlag(remaining, "source-port", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	if projectName == "" {
-		fmt.Fprintln(errOut, "import requires --project")
+	scanArgs, remaining, err := extractFlag(remaining, "scan-args", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	scannerLabel, remaining, err := extractFlag(remaining, "scanner-label", "")
+	batchSizeRaw, remaining, err := extractFlag(remaining, "batch-size", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	sourceIP, remaining, err := extractFlag(remaining, "source-ip", "")
+	batchSize := 0
+	if batchSizeRaw != "" {
+		batchSize, err = strconv.Atoi(batchSizeRaw)
+		if err != nil || batchSize < 1 {
+			fmt.Fprintln(errOut, "--batch-size must be a positive integer")
+			return 1
+		}
+	}
+	serverURL, remaining, err := extractFlag(remaining, "server", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
-	sourcePort, remaining, err := extractFlag(remaining, "source-port", "")
+	token, remaining, err := extractFlag(remaining, "token", "")
 	if err != nil {
 		fmt.Fprintln(errOut, err)
 		return 1
 	}
+	ignoreScope, remaining := extractBoolFlag(remaining, "ignore-scope")
+	noWait, remaining := extractBoolFlag(remaining, "no-wait")
+	force, remaining := extractBoolFlag(remaining, "force")
 	if len(remaining) < 1 {
-		fmt.Fprintln(errOut, "import requires an nmap XML file path")
+		fmt.Fprintln(errOut, "import requires a scan file path (nmap XML/greppable, masscan, naabu or rustscan), directory or glob")
 		return 1
 	}
-	filePath := remaining[0]
-	if !filepath.IsAbs(filePath) {
-		if abs, err := filepath.Abs(filePath); err == nil {
-			filePath = abs
+
+	if serverURL != "" {
+		if ignoreScope || batchSize != 0 {
+			fmt.Fprintln(errOut, "--ignore-scope and --batch-size are not available with --server")
+			return 1
+		}
+		if len(remaining) != 1 {
+			fmt.Fprintln(errOut, "--server uploads one scan file at a time")
+			return 1
+		}
+		filePath := remaining[0]
+		if !filepath.IsAbs(filePath) {
+			if abs, err := filepath.Abs(filePath); err == nil {
+				filePath = abs
+			}
 		}
+		fields := map[string]string{
+			"scanner_label": scannerLabel,
+			"source_ip":     sourceIP,
+			"source_port":   sourcePort,
+			"scan_args":     scanArgs,
+		}
+		if force {
+			fields["force"] = "true"
+		}
+		return runRemoteImport(serverURL, token, projectName, filePath, fields, noWait, out, errOut)
 	}
 
 	database, err := db.Open(dbPath)
@@ -188,31 +183,79 @@ func runImport(args []string, out, errOut io.Writer) int {
 		fmt.Fprintf(errOut, "project %q not found; create it first via projects create\n", projectName)
 		return 1
 	}
-
-	matcher, err := scope.NewMatcher(nil)
-	if err != nil {
-		fmt.Fprintf(errOut, "scope matcher: %v\n", err)
+	if !checkWritable(project, errOut) {
 		return 1
 	}
 
+	// A nil matcher makes the importer apply the project's stored scope.
+	var matcher *scope.Matcher
+	if ignoreScope {
+		matcher, err = scope.NewMatcher(nil)
+		if err != nil {
+			fmt.Fprintf(errOut, "scope matcher: %v\n", err)
+			return 1
+		}
+	}
+
 	options := importer.ImportOptions{
+		BatchSize:        batchSize,
+		ScanArgs:         scanArgs,
 		ScannerLabel:     scannerLabel,
 		ManualSourceIP:   sourceIP,
 		ManualSourcePort: sourcePort,
+		Force:            force,
 	}
 	if err := importer.ValidateImportOptions(options); err != nil {
 		fmt.Fprintf(errOut, "import options: %v\n", err)
 		return 1
 	}
 
-	if _, err := importer.ImportXMLFileWithOptions(database, matcher, project.ID, filePath, options, time.Now().UTC()); err != nil {
+	// A lone plain file keeps the single-import output and its errors.
+	if len(remaining) == 1 {
+		if info, err := os.Stat(remaining[0]); err == nil && info.Mode().IsRegular() {
+			if archive, err := importer.IsArchiveFile(remaining[0]); err == nil && !archive {
+				return importOneFile(database, matcher, project, remaining[0], options, out, errOut)
+			}
+		}
+	}
+	return importBatch(database, matcher, project, remaining, options, out, errOut)
+}
+
+// importOneFile imports a single named scan file.
+func importOneFile(database *db.DB, matcher *scope.Matcher, project db.Project, filePath string, options importer.ImportOptions, out, errOut io.Writer) int {
+	stats, err := importer.ImportFileWithOptions(database, matcher, project.ID, filePath, options, time.Now().UTC())
+	if errors.Is(err, importer.ErrDuplicateImport) {
+		// As in a batch, a file the project already has is skipped, not failed.
+		fmt.Fprintf(errOut, "skipped: %v\n", err)
+		fmt.Fprintln(errOut, "rerun with --force to import it again")
+		return 0
+	}
+	if err != nil {
 		fmt.Fprintf(errOut, "import: %v\n", err)
 		return 1
 	}
-	fmt.Fprintf(out, "imported %s into project %s\n", filepath.Base(filePath), project.Name)
+	fmt.Fprintf(out, "imported %s into project %s (%d in scope, %d out of scope)\n", filepath.Base(filePath), project.Name, stats.InScope, stats.OutScope)
+	if stats.PortsNotObserved > 0 {
+		fmt.Fprintf(out, "%d previously seen ports were not observed by this scan\n", stats.PortsNotObserved)
+	}
+	warnMACChanges(stats.MACChanges, errOut)
 	return 0
 }
 
+func warnMACChanges(changes []importer.MACChange, errOut io.Writer) {
+	for _, change := range changes {
+		fmt.Fprintf(errOut, "warning: %s MAC changed from %s to %s\n",
+			change.IPAddress, formatMAC(change.PreviousMAC, change.PreviousVendor), formatMAC(change.MACAddress, change.MACVendor))
+	}
+}
+
+func formatMAC(mac, vendor string) string {
+	if vendor == "" {
+		return mac
+	}
+	return fmt.Sprintf("%s (%s)", mac, vendor)
+}
+
 func runExport(args []string, out, errOut io.Writer) int {
 	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
 	if err != nil {
@@ -298,6 +341,21 @@ func runExport(args []string, out, errOut io.Writer) int {
 	return 0
 }
 
+// extractBoolFlag removes every occurrence of a value-less --name/-name switch
+// and reports whether it was present.
+func extractBoolFlag(args []string, name string) (bool, []string) {
+	found := false
+	var remaining []string
+	for _, arg := range args {
+		if arg == "--"+name || arg == "-"+name {
+			found = true
+			continue
+		}
+		remaining = append(remaining, arg)
+	}
+	return found, remaining
+}
+
 // extractFlag finds a string flag (e.g., --db value) anywhere in args and returns its value and remaining args.
 func extractFlag(args []string, name string, defaultVal string) (string, []string, error) {
 	val := defaultVal
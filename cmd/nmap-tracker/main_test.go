@@ -1,15 +1,25 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sloppy/nmaptracker/internal/db"
 	"github.com/sloppy/nmaptracker/internal/testutil"
+	"github.com/sloppy/nmaptracker/internal/web"
 )
 
 func TestProjectsCLI(t *testing.T) {
@@ -176,7 +186,780 @@ func TestImportCLIRejectsInvalidSourceIPFlag(t *testing.T) {
 	}
 }
 
+func TestImportCLIRejectsReimportUnlessForced(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+
+	if exit := run([]string{"nmap-tracker", "projects", "create", "DupProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+	xmlPath := filepath.Join(tmp, "dup.xml")
+	xmlContent := `<?xml version="1.0"?><nmaprun><host><address addr="198.51.100.30" addrtype="ipv4"/></host></nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xmlContent), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+
+	args := []string{"nmap-tracker", "import", "--project", "DupProj", "--db", dbPath, xmlPath}
+	if exit := run(args, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("first import exit %d", exit)
+	}
+	// A duplicate is skipped, not a failure.
+	var stderr bytes.Buffer
+	if exit := run(args, ioDiscard{}, &stderr); exit != 0 {
+		t.Fatalf("expected skipped re-import to exit 0, got %d", exit)
+	}
+	if !strings.Contains(stderr.String(), "duplicate import") || !strings.Contains(stderr.String(), "--force") {
+		t.Fatalf("expected duplicate error with --force hint, got %q", stderr.String())
+	}
+	if exit := run(append(args[:2:2], append([]string{"--force"}, args[2:]...)...), ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("import --force exit %d", exit)
+	}
+}
+
+func TestImportsCLIListAndDelete(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+
+	if exit := run([]string{"nmap-tracker", "projects", "create", "UndoProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+	xmlPath := filepath.Join(tmp, "undo.xml")
+	xmlContent := `<?xml version="1.0"?><nmaprun><host><address addr="198.51.100.31" addrtype="ipv4"/>` +
+		`<ports><port protocol="tcp" portid="80"><state state="open"/></port></ports></host></nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xmlContent), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+	if exit := run([]string{"nmap-tracker", "import", "--project", "UndoProj", "--db", dbPath, xmlPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("import exit %d", exit)
+	}
+
+	var out bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "imports", "list", "--project", "UndoProj", "--db", dbPath}, &out, ioDiscard{}); exit != 0 {
+		t.Fatalf("imports list exit %d", exit)
+	}
+	fields := strings.Split(strings.TrimSpace(out.String()), "\t")
+	if len(fields) != 5 || fields[1] != "undo.xml" || fields[3] != "1 hosts" {
+		t.Fatalf("unexpected imports list output: %q", out.String())
+	}
+
+	out.Reset()
+	if exit := run([]string{"nmap-tracker", "imports", "delete", fields[0], "--project", "UndoProj", "--db", dbPath}, &out, ioDiscard{}); exit != 0 {
+		t.Fatalf("imports delete exit %d", exit)
+	}
+	if !strings.Contains(out.String(), "1 hosts and 1 ports removed") {
+		t.Fatalf("unexpected imports delete output: %q", out.String())
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	project, _, _ := database.GetProjectByName("UndoProj")
+	if _, found, _ := database.GetHostByIP(project.ID, "198.51.100.31"); found {
+		t.Fatalf("expected host to be removed with its only import")
+	}
+	database.Close()
+
+	var stderr bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "imports", "delete", fields[0], "--project", "UndoProj", "--db", dbPath}, ioDiscard{}, &stderr); exit == 0 {
+		t.Fatalf("expected deleting a missing import to fail")
+	}
+	if !strings.Contains(stderr.String(), "not found") {
+		t.Fatalf("unexpected error output: %q", stderr.String())
+	}
+}
+
+func TestImportsRawAndReparseCLI(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+	if exit := run([]string{"nmap-tracker", "projects", "create", "RawProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+	xmlPath := filepath.Join(tmp, "evidence.xml")
+	xmlContent := `<?xml version="1.0"?><nmaprun args="nmap -p 80 198.51.100.40"><host><address addr="198.51.100.40" addrtype="ipv4"/>` +
+		`<ports><port protocol="tcp" portid="80"><state state="open"/></port></ports></host></nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xmlContent), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+	if exit := run([]string{"nmap-tracker", "import", "--project", "RawProj", "--db", dbPath, xmlPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("import exit %d", exit)
+	}
+
+	var out bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "imports", "raw", "1", "--project", "RawProj", "--db", dbPath}, &out, ioDiscard{}); exit != 0 {
+		t.Fatalf("imports raw exit %d", exit)
+	}
+	if out.String() != xmlContent {
+		t.Fatalf("raw output differs from the imported file: %q", out.String())
+	}
+	copyPath := filepath.Join(tmp, "copy.xml")
+	if exit := run([]string{"nmap-tracker", "imports", "raw", "1", "-o", copyPath, "--project", "RawProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("imports raw -o exit %d", exit)
+	}
+	if copied, err := os.ReadFile(copyPath); err != nil || string(copied) != xmlContent {
+		t.Fatalf("unexpected raw copy: %q %v", copied, err)
+	}
+
+	out.Reset()
+	if exit := run([]string{"nmap-tracker", "imports", "reparse", "1", "--project", "RawProj", "--db", dbPath}, &out, ioDiscard{}); exit != 0 {
+		t.Fatalf("imports reparse exit %d", exit)
+	}
+	if !strings.Contains(out.String(), "reparsed import 1 (evidence.xml, nmap_xml): 1 hosts and 1 ports") {
+		t.Fatalf("unexpected reparse output: %q", out.String())
+	}
+
+	var stderr bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "imports", "raw", "7", "--project", "RawProj", "--db", dbPath}, ioDiscard{}, &stderr); exit == 0 {
+		t.Fatalf("expected raw of a missing import to fail")
+	}
+	if !strings.Contains(stderr.String(), "not found") {
+		t.Fatalf("unexpected error output: %q", stderr.String())
+	}
+}
+
+func TestRebuildCLI(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+
+	if exit := run([]string{"nmap-tracker", "projects", "create", "ReplayProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+	xmlPath := filepath.Join(tmp, "replay.xml")
+	xmlContent := `<?xml version="1.0"?><nmaprun><host><address addr="198.51.100.32" addrtype="ipv4"/>` +
+		`<ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh" product="OpenSSH"/></port></ports></host></nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xmlContent), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+	if exit := run([]string{"nmap-tracker", "import", "--project", "ReplayProj", "--db", dbPath, xmlPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("import exit %d", exit)
+	}
+
+	var out bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "rebuild", "--project", "ReplayProj", "--policy", "most-specific-wins", "--db", dbPath}, &out, ioDiscard{}); exit != 0 {
+		t.Fatalf("rebuild exit %d", exit)
+	}
+	if !strings.Contains(out.String(), "rebuilt 1 hosts with most-specific-wins") {
+		t.Fatalf("unexpected rebuild output: %q", out.String())
+	}
+
+	var stderr bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "rebuild", "--project", "ReplayProj", "--policy", "oldest-wins", "--db", dbPath}, ioDiscard{}, &stderr); exit == 0 {
+		t.Fatalf("expected unknown policy to fail")
+	}
+	if !strings.Contains(stderr.String(), "never-overwrite-manual-edits") {
+		t.Fatalf("expected policy choices in error, got %q", stderr.String())
+	}
+}
+
+func TestWorkflowCLI(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+	cli := func(args ...string) string {
+		t.Helper()
+		var out, stderr bytes.Buffer
+		if exit := run(append([]string{"nmap-tracker"}, append(args, "--db", dbPath)...), &out, &stderr); exit != 0 {
+			t.Fatalf("%s exit %d: %s", strings.Join(args, " "), exit, stderr.String())
+		}
+		return out.String()
+	}
+	decode := func(raw string, v any) {
+		t.Helper()
+		if err := json.Unmarshal([]byte(raw), v); err != nil {
+			t.Fatalf("decode %q: %v", raw, err)
+		}
+	}
+	importScan := func(name string, start int64, hosts string) {
+		t.Helper()
+		path := filepath.Join(tmp, name)
+		content := fmt.Sprintf(`<?xml version="1.0"?><nmaprun args="nmap -p 22,445 10.1.0.0/24" start="%d">%s</nmaprun>`, start, hosts)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write xml: %v", err)
+		}
+		cli("import", "--project", "Flow", path)
+	}
+	host := func(ip string, ports ...int) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<host><address addr="%s" addrtype="ipv4"/><ports>`, ip)
+		for _, p := range ports {
+			service := map[int]string{22: "ssh", 445: "microsoft-ds"}[p]
+			fmt.Fprintf(&b, `<port protocol="tcp" portid="%d"><state state="open"/><service name="%s"/></port>`, p, service)
+		}
+		return b.String() + `</ports></host>`
+	}
+
+	cli("projects", "create", "Flow")
+	if out := strings.TrimSpace(cli("scope", "list", "--project", "Flow", "--json")); out != "[]" {
+		t.Fatalf("expected empty scope list as [], got %q", out)
+	}
+	if out := cli("scope", "add", "10.1.0.0/24", "--project", "Flow"); !strings.Contains(out, "added include rule") {
+		t.Fatalf("unexpected scope add output: %q", out)
+	}
+	cli("scope", "add", "10.1.0.9", "--exclude", "--project", "Flow")
+	var rules []db.ScopeDefinition
+	decode(cli("scope", "list", "--project", "Flow", "--json"), &rules)
+	if len(rules) != 2 || rules[1].Type != "exclude" {
+		t.Fatalf("unexpected scope rules: %+v", rules)
+	}
+
+	importScan("first.xml", 1700000000, host("10.1.0.1", 22, 445)+host("10.1.0.9", 22))
+	importScan("second.xml", 1700086400, host("10.1.0.1", 22, 445)+host("10.1.0.2", 445))
+
+	var hosts struct {
+		Items []db.HostListItem `json:"items"`
+		Total int               `json:"total"`
+	}
+	decode(cli("hosts", "list", "--project", "Flow", "--subnet", "10.1.0.0/30", "--json"), &hosts)
+	if hosts.Total != 2 || hosts.Items[0].IPAddress != "10.1.0.1" {
+		t.Fatalf("unexpected subnet hosts: %+v", hosts)
+	}
+
+	if out := cli("ports", "set-status", "flagged", "10.1.0.1:445", "10.1.0.2", "--project", "Flow"); !strings.Contains(out, "set 2 ports to flagged") {
+		t.Fatalf("unexpected set-status output: %q", out)
+	}
+	decode(cli("hosts", "list", "--project", "Flow", "--status", "flagged", "--json"), &hosts)
+	if hosts.Total != 2 || hosts.Items[0].Flagged != 1 || hosts.Items[0].Scanned != 1 {
+		t.Fatalf("unexpected flagged hosts: %+v", hosts)
+	}
+	if out := cli("hosts", "list", "--project", "Flow"); !strings.Contains(out, "IN_PROGRESS") || !strings.Contains(out, "10.1.0.9") {
+		t.Fatalf("unexpected hosts table: %q", out)
+	}
+
+	if out := cli("queue", "smb", "--ips", "--project", "Flow"); out != "10.1.0.1\n10.1.0.2\n" {
+		t.Fatalf("unexpected smb queue: %q", out)
+	}
+
+	var imports []db.ScanImportWithIntents
+	decode(cli("imports", "list", "--project", "Flow", "--json"), &imports)
+	if len(imports) != 2 {
+		t.Fatalf("expected 2 imports, got %d", len(imports))
+	}
+	base, target := fmt.Sprint(imports[1].ID), fmt.Sprint(imports[0].ID)
+	var delta db.ImportDeltaResponse
+	decode(cli("delta", "--base", base, "--target", target, "--project", "Flow", "--json"), &delta)
+	if delta.Summary.NetNewHosts != 1 || delta.Summary.DisappearedHosts != 1 {
+		t.Fatalf("unexpected delta summary: %+v", delta.Summary)
+	}
+	if out := cli("delta", "--base", base, "--target", target, "--project", "Flow"); !strings.Contains(out, "net new hosts:") {
+		t.Fatalf("unexpected delta table: %q", out)
+	}
+
+	var intents struct {
+		Intents []db.ScanImportIntent `json:"intents"`
+	}
+	decode(cli("imports", "intents", target, "--set", "all_tcp,vuln_nse", "--project", "Flow", "--json"), &intents)
+	if len(intents.Intents) != 2 || intents.Intents[0].Source != db.IntentSourceManual {
+		t.Fatalf("unexpected intents after set: %+v", intents)
+	}
+	decode(cli("imports", "intents", target, "--remove", "vuln_nse", "--project", "Flow", "--json"), &intents)
+	if len(intents.Intents) != 1 || intents.Intents[0].Intent != db.IntentAllTCP {
+		t.Fatalf("unexpected intents after remove: %+v", intents)
+	}
+
+	var matrix db.CoverageMatrixResponse
+	decode(cli("coverage", "--project", "Flow", "--json"), &matrix)
+	if len(matrix.Segments) == 0 || matrix.Segments[0].Cells[db.IntentAllTCP].CoveredCount == 0 {
+		t.Fatalf("expected all_tcp coverage, got %+v", matrix.Segments)
+	}
+
+	cli("baseline", "add", "10.1.0.1", "10.1.0.50", "--project", "Flow")
+	var eval db.BaselineEvaluation
+	decode(cli("baseline", "eval", "--project", "Flow", "--json"), &eval)
+	if eval.Summary.ExpectedButUnseen != 1 || eval.Lists.ExpectedButUnseen[0] != "10.1.0.50" {
+		t.Fatalf("unexpected baseline evaluation: %+v", eval.Summary)
+	}
+
+	if out := cli("scope", "rm", fmt.Sprint(rules[1].ID), "--project", "Flow"); !strings.Contains(out, "1 hosts changed scope") {
+		t.Fatalf("unexpected scope rm output: %q", out)
+	}
+
+	var stderr bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "ports", "set-status", "pwned", "10.1.0.1", "--project", "Flow", "--db", dbPath}, ioDiscard{}, &stderr); exit == 0 {
+		t.Fatalf("expected invalid status to fail")
+	}
+}
+
+func TestProjectsLifecycleCLI(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "lifecycle.db")
+	runCLI := func(args ...string) (int, string, string) {
+		t.Helper()
+		var out, stderr bytes.Buffer
+		exit := run(append([]string{"nmap-tracker"}, append(args, "--db", dbPath)...), &out, &stderr)
+		return exit, out.String(), stderr.String()
+	}
+	cli := func(args ...string) string {
+		t.Helper()
+		exit, out, stderr := runCLI(args...)
+		if exit != 0 {
+			t.Fatalf("%s exit %d: %s", strings.Join(args, " "), exit, stderr)
+		}
+		return out
+	}
+	importScan := func(project, name, ip string, port int) {
+		t.Helper()
+		path := filepath.Join(tmp, name)
+		content := fmt.Sprintf(`<?xml version="1.0"?><nmaprun args="nmap -p %d %s" start="1700000000"><host><address addr="%s" addrtype="ipv4"/><ports><port protocol="tcp" portid="%d"><state state="open"/></port></ports></host></nmaprun>`, port, ip, ip, port)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write xml: %v", err)
+		}
+		cli("import", "--project", project, path)
+	}
+
+	cli("projects", "create", "Ext")
+	cli("scope", "add", "10.2.0.0/24", "--project", "Ext")
+	cli("baseline", "add", "10.2.0.1", "--project", "Ext")
+	importScan("Ext", "ext.xml", "10.2.0.1", 22)
+	cli("projects", "create", "Ext", "split")
+	importScan("Ext split", "split.xml", "10.2.0.1", 443)
+	cli("ports", "set-status", "done", "10.2.0.1:443", "--project", "Ext split")
+
+	if out := cli("projects", "clone", "Ext", "retest", "--project", "Ext"); !strings.Contains(out, "cloned project Ext") {
+		t.Fatalf("unexpected clone output: %q", out)
+	}
+	var rules []db.ScopeDefinition
+	if err := json.Unmarshal([]byte(cli("scope", "list", "--project", "Ext retest", "--json")), &rules); err != nil || len(rules) != 1 {
+		t.Fatalf("expected the clone to copy scope: %+v %v", rules, err)
+	}
+	if out := cli("hosts", "list", "--project", "Ext retest"); strings.Contains(out, "10.2.0.1") {
+		t.Fatalf("expected the clone to have no hosts: %q", out)
+	}
+
+	var merged map[string]any
+	if err := json.Unmarshal([]byte(cli("projects", "merge", "--project", "Ext", "--from", "Ext split", "--json")), &merged); err != nil {
+		t.Fatalf("decode merge: %v", err)
+	}
+	if merged["imports"] != float64(1) || merged["hosts_merged"] != float64(1) || merged["ports_moved"] != float64(1) {
+		t.Fatalf("unexpected merge result: %v", merged)
+	}
+	if out := cli("ports", "list", "--project", "Ext", "--status", "done"); !strings.Contains(out, "443/tcp") {
+		t.Fatalf("expected the split project's port work to survive the merge: %q", out)
+	}
+
+	cli("projects", "archive", "--project", "Ext")
+	if out := cli("projects", "list"); !strings.Contains(out, "Ext\tarchived") {
+		t.Fatalf("expected archived marker in list: %q", out)
+	}
+	for _, args := range [][]string{
+		{"ports", "set-status", "flagged", "10.2.0.1", "--project", "Ext"},
+		{"scope", "add", "10.3.0.0/24", "--project", "Ext"},
+		{"projects", "rename", "Renamed", "--project", "Ext"},
+		{"import", "--project", "Ext", filepath.Join(tmp, "ext.xml")},
+	} {
+		exit, _, stderr := runCLI(args...)
+		if exit != 1 || !strings.Contains(stderr, "is archived") {
+			t.Fatalf("%s on an archived project: exit %d, stderr %q", strings.Join(args, " "), exit, stderr)
+		}
+	}
+	cli("hosts", "list", "--project", "Ext")
+	cli("projects", "unarchive", "--project", "Ext")
+	cli("projects", "rename", "Ext", "2024", "--project", "Ext")
+	if out := cli("projects", "delete", "--project", "Ext 2024"); !strings.Contains(out, "deleted project") {
+		t.Fatalf("unexpected delete output: %q", out)
+	}
+	if out := cli("projects", "list"); strings.Contains(out, "Ext 2024") || strings.Contains(out, "Ext split") {
+		t.Fatalf("expected only the clone to remain: %q", out)
+	}
+}
+
+func TestBundleCLIMovesProjectBetweenDatabases(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	laptop := filepath.Join(tmp, "laptop.db")
+	desktop := filepath.Join(tmp, "desktop.db")
+	bundlePath := filepath.Join(tmp, "ext.tar.gz")
+	runCLI := func(dbPath string, args ...string) (int, string, string) {
+		t.Helper()
+		var out, stderr bytes.Buffer
+		exit := run(append([]string{"nmap-tracker"}, append(args, "--db", dbPath)...), &out, &stderr)
+		return exit, out.String(), stderr.String()
+	}
+	cli := func(dbPath string, args ...string) string {
+		t.Helper()
+		exit, out, stderr := runCLI(dbPath, args...)
+		if exit != 0 {
+			t.Fatalf("%s exit %d: %s", strings.Join(args, " "), exit, stderr)
+		}
+		return out
+	}
+
+	xmlPath := filepath.Join(tmp, "scan.xml")
+	xml := `<?xml version="1.0"?><nmaprun args="nmap -sV 10.4.0.0/24" start="1700000000"><host><address addr="10.4.0.7" addrtype="ipv4"/><ports><port protocol="tcp" portid="3389"><state state="open"/><service name="ms-wbt-server"/></port></ports></host></nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xml), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+	cli(laptop, "projects", "create", "Ext")
+	cli(laptop, "scope", "add", "10.4.0.0/24", "--project", "Ext")
+	cli(laptop, "import", "--project", "Ext", xmlPath)
+	cli(laptop, "ports", "set-status", "flagged", "10.4.0.7:3389", "--project", "Ext")
+
+	if out := cli(laptop, "bundle", "export", "--project", "Ext", "-o", bundlePath); !strings.Contains(out, "exported project Ext to "+bundlePath) {
+		t.Fatalf("unexpected export output: %q", out)
+	}
+	out := cli(desktop, "bundle", "import", bundlePath)
+	if !strings.Contains(out, "\tExt (1 imports, 1 hosts, 1 ports") {
+		t.Fatalf("unexpected import output: %q", out)
+	}
+	if out := cli(desktop, "ports", "list", "--project", "Ext", "--status", "flagged"); !strings.Contains(out, "3389/tcp") {
+		t.Fatalf("expected the flagged port to travel: %q", out)
+	}
+	if out := cli(desktop, "imports", "list", "--project", "Ext"); !strings.Contains(out, "scan.xml") {
+		t.Fatalf("expected the import to travel: %q", out)
+	}
+
+	exit, _, stderr := runCLI(desktop, "bundle", "import", bundlePath)
+	if exit != 1 || !strings.Contains(stderr, "choose another name with --name") {
+		t.Fatalf("expected a second import to need --name: exit %d, %q", exit, stderr)
+	}
+	var result struct {
+		Project db.Project
+		Rows    map[string]int `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(cli(desktop, "bundle", "import", bundlePath, "--name", "Ext retest", "--json")), &result); err != nil {
+		t.Fatalf("decode import: %v", err)
+	}
+	if result.Project.Name != "Ext retest" || result.Rows["port_observation"] != 1 {
+		t.Fatalf("unexpected json import: %+v", result)
+	}
+}
+
+func TestImportCLIAppliesProjectScope(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+
+	for _, name := range []string{"ScopedProj", "IgnoredProj"} {
+		if exit := run([]string{"nmap-tracker", "projects", "create", name, "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+			t.Fatalf("projects create %s exit %d", name, exit)
+		}
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	for _, name := range []string{"ScopedProj", "IgnoredProj"} {
+		project, _, err := database.GetProjectByName(name)
+		if err != nil {
+			t.Fatalf("get project: %v", err)
+		}
+		if _, err := database.AddScopeDefinition(project.ID, "10.0.0.0/24", "include"); err != nil {
+			t.Fatalf("add scope: %v", err)
+		}
+	}
+
+	xmlPath := filepath.Join(tmp, "scoped.xml")
+	xmlContent := `<?xml version="1.0"?>
+<nmaprun args="nmap -sn 10.0.0.0/23">
+  <host><status state="up"/><address addr="10.0.0.5" addrtype="ipv4"/></host>
+  <host><status state="up"/><address addr="10.0.1.5" addrtype="ipv4"/></host>
+</nmaprun>`
+	if err := os.WriteFile(xmlPath, []byte(xmlContent), 0o600); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "import", "--project", "ScopedProj", "--db", dbPath, xmlPath}, &stdout, ioDiscard{}); exit != 0 {
+		t.Fatalf("import exit %d", exit)
+	}
+	if !strings.Contains(stdout.String(), "1 in scope, 1 out of scope") {
+		t.Fatalf("expected scope counts in output, got %q", stdout.String())
+	}
+	if exit := run([]string{"nmap-tracker", "import", "--project", "IgnoredProj", "--ignore-scope", "--db", dbPath, xmlPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("import --ignore-scope exit %d", exit)
+	}
+
+	for name, want := range map[string]map[string]bool{
+		"ScopedProj":  {"10.0.0.5": true, "10.0.1.5": false},
+		"IgnoredProj": {"10.0.0.5": true, "10.0.1.5": true},
+	} {
+		project, _, err := database.GetProjectByName(name)
+		if err != nil {
+			t.Fatalf("get project: %v", err)
+		}
+		for ip, inScope := range want {
+			host, found, err := database.GetHostByIP(project.ID, ip)
+			if err != nil || !found {
+				t.Fatalf("get host %s in %s: found=%v err=%v", ip, name, found, err)
+			}
+			if host.InScope != inScope {
+				t.Fatalf("%s %s: expected in_scope=%v, got %v", name, ip, inScope, host.InScope)
+			}
+		}
+	}
+}
+
 // ioDiscard is a minimal io.Writer to drop output without importing io once more.
 type ioDiscard struct{}
 
 func (ioDiscard) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestUsersCLI(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+
+	if exit := run([]string{"nmap-tracker", "projects", "create", "Team", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+	for _, name := range []string{"lead", "analyst1"} {
+		if exit := run([]string{"nmap-tracker", "users", "add", name, "--password", name + "-password", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+			t.Fatalf("users add %s exit %d", name, exit)
+		}
+	}
+	if exit := run([]string{"nmap-tracker", "users", "grant", "analyst1", "--project", "Team", "--role", "analyst", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("users grant exit %d", exit)
+	}
+	if exit := run([]string{"nmap-tracker", "users", "grant", "analyst1", "--project", "Team", "--role", "owner", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit == 0 {
+		t.Fatalf("expected an unknown role to fail")
+	}
+
+	var stdout bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "users", "list", "--db", dbPath}, &stdout, ioDiscard{}); exit != 0 {
+		t.Fatalf("users list exit %d", exit)
+	}
+	if !strings.Contains(stdout.String(), "lead\tadmin") || !strings.Contains(stdout.String(), "analyst1\tuser") {
+		t.Fatalf("expected the first user to be a site admin, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if exit := run([]string{"nmap-tracker", "users", "token", "analyst1", "--name", "ci", "--db", dbPath}, &stdout, ioDiscard{}); exit != 0 {
+		t.Fatalf("users token exit %d", exit)
+	}
+	secret := strings.TrimSpace(stdout.String())
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	user, found, err := database.GetAPITokenUser(secret)
+	if err != nil || !found || user.Username != "analyst1" {
+		t.Fatalf("token user: %+v found=%v err=%v", user, found, err)
+	}
+	project, _, err := database.GetProjectByName("Team")
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	if role, _, err := database.ProjectRole(user, project.ID); err != nil || role != db.RoleAnalyst {
+		t.Fatalf("analyst1 role: %q %v", role, err)
+	}
+}
+
+func TestServeFlagValidation(t *testing.T) {
+	dbPath := filepath.Join(testutil.TempDir(t), "cli.db")
+	for _, args := range [][]string{
+		{"--tls-cert", "cert.pem"},
+		{"--tls-self-signed", "--tls-cert", "cert.pem", "--tls-key", "key.pem"},
+		{"--listen", "no-port"},
+	} {
+		var stderr bytes.Buffer
+		if exit := run(append([]string{"nmap-tracker", "serve", "--db", dbPath}, args...), ioDiscard{}, &stderr); exit != 1 {
+			t.Fatalf("serve %v: expected exit 1, got %d", args, exit)
+		}
+		if stderr.Len() == 0 {
+			t.Fatalf("serve %v: expected an error message", args)
+		}
+	}
+}
+
+func TestServeUntilDoneDrainsRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serveUntilDone(ctx, srv, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Fatalf("expected the in-flight request to finish: %+v", res)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatalf("expected the listener to be closed after shutdown")
+	}
+}
+
+func TestImportCLIServer(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	database, err := db.Open(filepath.Join(tmp, "server.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	project, err := database.CreateProject("Remote")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	user, err := database.CreateUser("ci", "password1", true)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	_, secret, err := database.CreateAPIToken(user.ID, "ci")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	server, err := web.NewServerWithOptions(database, web.Options{SpoolDir: filepath.Join(tmp, "spool")})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	defer server.Close(context.Background())
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	_, filename, _, _ := runtime.Caller(0)
+	samplePath := filepath.Join(filepath.Dir(filepath.Dir(filepath.Dir(filename))), "sampleNmap1.xml")
+
+	var stderr bytes.Buffer
+	if exit := run([]string{"nmap-tracker", "import", "--server", ts.URL, "--project", "Remote", samplePath}, ioDiscard{}, &stderr); exit != 1 {
+		t.Fatalf("expected import without a token to fail, got %d", exit)
+	}
+	if exit := run([]string{"nmap-tracker", "import", "--server", ts.URL, "--ignore-scope", "--token", secret, "--project", "Remote", samplePath}, ioDiscard{}, ioDiscard{}); exit != 1 {
+		t.Fatalf("expected --ignore-scope with --server to be rejected, got %d", exit)
+	}
+
+	var stdout bytes.Buffer
+	stderr.Reset()
+	exit := run([]string{"nmap-tracker", "import", "--server", ts.URL, "--token", secret, "--project", "Remote", "--scanner-label", "remote", samplePath}, &stdout, &stderr)
+	if exit != 0 {
+		t.Fatalf("remote import exit %d: %s", exit, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "queued import job") || !strings.Contains(stdout.String(), "imported sampleNmap1.xml into project Remote") {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil || len(imports) != 1 || imports[0].ScannerLabel != "remote" {
+		t.Fatalf("expected one remote import: %+v %v", imports, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Close(ctx); err != nil {
+		t.Fatalf("close server: %v", err)
+	}
+}
+
+func TestImportCLIBatch(t *testing.T) {
+	tmp := testutil.TempDir(t)
+	dbPath := filepath.Join(tmp, "cli.db")
+	if exit := run([]string{"nmap-tracker", "projects", "create", "BatchProj", "--db", dbPath}, ioDiscard{}, ioDiscard{}); exit != 0 {
+		t.Fatalf("projects create exit %d", exit)
+	}
+
+	scanXML := func(ip string) string {
+		return `<?xml version="1.0"?><nmaprun><host><address addr="` + ip + `" addrtype="ipv4"/><ports><port protocol="tcp" portid="22"><state state="open"/></port></ports></host></nmaprun>`
+	}
+	scans := filepath.Join(tmp, "scans")
+	files := map[string]string{
+		"a.xml":            scanXML("198.51.100.1"),
+		"copy/a-copy.xml":  scanXML("198.51.100.1"),
+		"sub/b.gnmap":      "Host: 198.51.100.2 ()\tPorts: 80/open/tcp//http///\n",
+		"sub/notes.txt":    "not a scan\n",
+		"conf/config.json": `{"name":"x","port":1}`,
+		"conf/notes.json":  `[1,2,3]`,
+	}
+	for name, content := range files {
+		path := filepath.Join(scans, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create("c.xml")
+	w.Write([]byte(scanXML("198.51.100.3")))
+	zw.Close()
+	zipPath := filepath.Join(tmp, "more.zip")
+	if err := os.WriteFile(zipPath, zipped.Bytes(), 0o600); err != nil {
+		t.Fatalf("write zip: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"nmap-tracker", "import", "--project", "BatchProj", "--db", dbPath, scans, filepath.Join(tmp, "*.zip")}
+	if exit := run(args, &stdout, &stderr); exit != 0 {
+		t.Fatalf("batch import exit %d: %s", exit, stderr.String())
+	}
+	rows := make(map[string]string)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.HasPrefix(fields[0], tmp) {
+			rel, _ := filepath.Rel(tmp, fields[0])
+			rows[filepath.ToSlash(rel)] = fields[1]
+		}
+	}
+	want := map[string]string{
+		"scans/a.xml":            "imported",
+		"scans/copy/a-copy.xml":  "duplicate",
+		"scans/sub/b.gnmap":      "imported",
+		"scans/sub/notes.txt":    "skipped",
+		"scans/conf/config.json": "skipped",
+		"scans/conf/notes.json":  "skipped",
+		"more.zip:c.xml":         "imported",
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v\n%s", rows, want, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "3 imported, 3 skipped, 1 duplicate, 0 failed") {
+		t.Fatalf("expected totals line, got %q", stdout.String())
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	var hostCount int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM host`).Scan(&hostCount); err != nil {
+		t.Fatalf("count hosts: %v", err)
+	}
+	var importCount int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM scan_import`).Scan(&importCount); err != nil {
+		t.Fatalf("count imports: %v", err)
+	}
+	database.Close()
+	if hostCount != 3 || importCount != 3 {
+		t.Fatalf("expected 3 hosts and 3 imports, got %d and %d", hostCount, importCount)
+	}
+
+	// A file that looks like a scan but does not parse fails the batch.
+	broken := filepath.Join(tmp, "broken.xml")
+	if err := os.WriteFile(broken, []byte(`<?xml version="1.0"?><nmaprun><host><address addr=`), 0o600); err != nil {
+		t.Fatalf("write broken: %v", err)
+	}
+	stdout.Reset()
+	args = []string{"nmap-tracker", "import", "--project", "BatchProj", "--db", dbPath, filepath.Join(scans, "sub"), broken}
+	if exit := run(args, &stdout, ioDiscard{}); exit != 1 {
+		t.Fatalf("expected exit 1 with a broken file, got %d\n%s", exit, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "0 imported, 1 skipped, 1 duplicate, 1 failed") {
+		t.Fatalf("expected failure in totals, got %q", stdout.String())
+	}
+}
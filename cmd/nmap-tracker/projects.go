@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+)
+
+const projectsUsage = "projects command requires subcommand: list|create <name>|rename <new-name>|clone <new-name>|merge --from <source>|archive|unarchive|delete (all but list and create take --project <name>; all take [--json])"
+
+func runProjects(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	from, remaining, err := extractFlag(remaining, "from", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, projectsUsage)
+		return 1
+	}
+	sub, operands := remaining[0], remaining[1:]
+	name := strings.TrimSpace(strings.Join(operands, " "))
+	switch sub {
+	case "list", "archive", "unarchive", "delete":
+	case "create", "rename", "clone":
+		if name == "" {
+			fmt.Fprintf(errOut, "projects %s requires a project name\n", sub)
+			return 1
+		}
+	case "merge":
+		if from == "" {
+			fmt.Fprintln(errOut, "projects merge requires --from <source project>")
+			return 1
+		}
+	default:
+		fmt.Fprintf(errOut, "unknown projects subcommand: %s\n", sub)
+		return 1
+	}
+
+	if sub == "list" || sub == "create" {
+		database, err := db.Open(flags.dbPath)
+		if err != nil {
+			fmt.Fprintf(errOut, "open db: %v\n", err)
+			return 1
+		}
+		defer database.Close()
+		if sub == "create" {
+			p, err := database.CreateProject(name)
+			if err != nil {
+				fmt.Fprintf(errOut, "create project: %v\n", err)
+				return 1
+			}
+			if flags.json {
+				return writeJSON(out, errOut, p)
+			}
+			fmt.Fprintf(out, "created project %d\t%s\n", p.ID, p.Name)
+			return 0
+		}
+		projects, err := database.ListProjects()
+		if err != nil {
+			fmt.Fprintf(errOut, "list projects: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			if projects == nil {
+				projects = []db.Project{}
+			}
+			return writeJSON(out, errOut, projects)
+		}
+		for _, p := range projects {
+			if p.Archived() {
+				fmt.Fprintf(out, "%d\t%s\tarchived\n", p.ID, p.Name)
+				continue
+			}
+			fmt.Fprintf(out, "%d\t%s\n", p.ID, p.Name)
+		}
+		return 0
+	}
+
+	database, project, ok := openProject(flags, "projects "+sub, errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	switch sub {
+	case "rename":
+		err := database.UpdateProject(project.ID, name)
+		if errors.Is(err, db.ErrProjectArchived) {
+			checkWritable(project, errOut)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "rename project: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, map[string]any{"project_id": project.ID, "name": name})
+		}
+		fmt.Fprintf(out, "renamed project %d from %s to %s\n", project.ID, project.Name, name)
+		return 0
+	case "archive", "unarchive":
+		updated, err := database.SetProjectArchived(project.ID, sub == "archive")
+		if err != nil {
+			fmt.Fprintf(errOut, "%s project: %v\n", sub, err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, updated)
+		}
+		fmt.Fprintf(out, "%sd project %d\t%s\n", sub, updated.ID, updated.Name)
+		return 0
+	case "clone":
+		clone, err := database.CloneProject(project.ID, name)
+		if err != nil {
+			fmt.Fprintf(errOut, "clone project: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, clone)
+		}
+		fmt.Fprintf(out, "cloned project %s to %d\t%s (scope, baseline and members; no scan data)\n", project.Name, clone.ID, clone.Name)
+		return 0
+	case "merge":
+		source, found, err := database.GetProjectByName(from)
+		if err != nil {
+			fmt.Fprintf(errOut, "find project: %v\n", err)
+			return 1
+		}
+		if !found {
+			fmt.Fprintf(errOut, "project %q not found\n", from)
+			return 1
+		}
+		return mergeProjects(database, project, source, flags.json, out, errOut)
+	}
+
+	err = database.DeleteProject(project.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(errOut, "project %q not found\n", project.Name)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "delete project: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		return writeJSON(out, errOut, map[string]any{"project_id": project.ID, "name": project.Name})
+	}
+	fmt.Fprintf(out, "deleted project %d\t%s\n", project.ID, project.Name)
+	return 0
+}
+
+// mergeProjects merges source into target and reports what moved.
+func mergeProjects(database *db.DB, target, source db.Project, asJSON bool, out, errOut io.Writer) int {
+	stats, err := importer.MergeProjects(database, target.ID, source.ID)
+	if errors.Is(err, db.ErrMergeSameProject) {
+		fmt.Fprintln(errOut, "--from and --project name the same project")
+		return 1
+	}
+	if errors.Is(err, db.ErrProjectArchived) {
+		fmt.Fprintf(errOut, "merge projects: %v; unarchive it with projects unarchive first\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "merge projects: %v\n", err)
+		return 1
+	}
+	if asJSON {
+		mergedIPs := stats.MergedIPs
+		if mergedIPs == nil {
+			mergedIPs = []string{}
+		}
+		return writeJSON(out, errOut, map[string]any{
+			"project_id": target.ID, "source_project_id": source.ID, "imports": stats.Imports,
+			"hosts_moved": stats.HostsMoved, "hosts_merged": stats.HostsMerged,
+			"ports_moved": stats.PortsMoved, "ports_merged": stats.PortsMerged, "merged_ips": mergedIPs,
+			"hosts_rebuilt": stats.HostsRebuilt, "hosts_removed": stats.HostsRemoved, "ports_removed": stats.PortsRemoved,
+		})
+	}
+	fmt.Fprintf(out, "merged project %s into %s: %d imports, %d hosts moved, %d hosts merged (%d ports moved, %d ports merged)\n",
+		source.Name, target.Name, stats.Imports, stats.HostsMoved, stats.HostsMerged, stats.PortsMoved, stats.PortsMerged)
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const queueUsage = "queue requires a campaign (smb, ldap, rdp, http, ssh; comma-separate several) and --project <name> [--limit <n>] [--ips] [--json]"
+
+func runQueue(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	limit, remaining, err := extractLimitFlag(remaining)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	ipsOnly, remaining := extractBoolFlag(remaining, "ips")
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, queueUsage)
+		return 1
+	}
+	campaigns, err := db.NormalizeServiceCampaigns(remaining)
+	if err != nil || len(campaigns) == 0 {
+		fmt.Fprintf(errOut, "invalid campaign: %s\n", strings.Join(remaining, " "))
+		fmt.Fprintln(errOut, queueUsage)
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "queue", errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	// Without --limit, page through the whole queue.
+	pageSize := limit
+	if pageSize == 0 {
+		pageSize = 500
+	}
+	var items []db.ServiceCampaignHost
+	var total int
+	sourceImportIDs := []int64{}
+	seenSources := make(map[int64]bool)
+	for {
+		page, n, sources, err := database.ListServiceCampaignQueue(project.ID, campaigns, pageSize, len(items))
+		if err != nil {
+			fmt.Fprintf(errOut, "service queue: %v\n", err)
+			return 1
+		}
+		items, total = append(items, page...), n
+		for _, id := range sources {
+			if !seenSources[id] {
+				seenSources[id] = true
+				sourceImportIDs = append(sourceImportIDs, id)
+			}
+		}
+		if limit > 0 || len(page) == 0 || len(items) >= total {
+			break
+		}
+	}
+	if flags.json {
+		if items == nil {
+			items = []db.ServiceCampaignHost{}
+		}
+		return writeJSON(out, errOut, map[string]any{
+			"project_id": project.ID, "campaigns": campaigns, "total_hosts": total,
+			"items": items, "source_import_ids": sourceImportIDs,
+		})
+	}
+	// --ips prints the newline-delimited host list the queue page exports.
+	if ipsOnly {
+		for _, item := range items {
+			fmt.Fprintln(out, item.IPAddress)
+		}
+		return 0
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "IP\tHOSTNAME\tPORTS\tSCANNED\tFLAGGED\tIN_PROGRESS\tDONE")
+	for _, item := range items {
+		ports := make([]string, 0, len(item.MatchingPorts))
+		for _, p := range item.MatchingPorts {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.PortNumber, p.Protocol))
+		}
+		s := item.StatusSummary
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			item.IPAddress, item.Hostname, strings.Join(ports, ","), s.Scanned, s.Flagged, s.InProgress, s.Done)
+	}
+	table.Flush()
+	if len(items) < total {
+		fmt.Fprintf(out, "showing %d of %d hosts\n", len(items), total)
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+)
+
+func runRebuild(args []string, out, errOut io.Writer) int {
+	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	projectName, remaining, err := extractFlag(remaining, "project", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	policyName, remaining, err := extractFlag(remaining, "policy", string(importer.PolicyLatestWins))
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if projectName == "" || len(remaining) > 0 {
+		fmt.Fprintln(errOut, "rebuild requires --project <name> [--policy <policy>]")
+		return 1
+	}
+	policy, err := importer.ParseMergePolicy(policyName)
+	if err != nil {
+		names := make([]string, 0, len(importer.MergePolicies))
+		for _, p := range importer.MergePolicies {
+			names = append(names, string(p))
+		}
+		fmt.Fprintf(errOut, "%v (choose %s)\n", err, strings.Join(names, ", "))
+		return 1
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "open db: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+	project, found, err := database.GetProjectByName(projectName)
+	if err != nil {
+		fmt.Fprintf(errOut, "find project: %v\n", err)
+		return 1
+	}
+	if !found {
+		fmt.Fprintf(errOut, "project %q not found\n", projectName)
+		return 1
+	}
+	if !checkWritable(project, errOut) {
+		return 1
+	}
+
+	stats, err := importer.RebuildProject(database, project.ID, policy)
+	if err != nil {
+		fmt.Fprintf(errOut, "rebuild project: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "rebuilt %d hosts with %s: %d hosts and %d ports removed\n",
+		stats.HostsRebuilt, policy, stats.HostsRemoved, stats.PortsRemoved)
+	return 0
+}
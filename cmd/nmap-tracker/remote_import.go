@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tokenEnv supplies an API token to commands that talk to a running server.
+const tokenEnv = "NMAPTRACKER_TOKEN"
+
+// remotePollInterval is how often import --server checks on its job.
+const remotePollInterval = 500 * time.Millisecond
+
+// remoteJob mirrors the import job JSON returned by the server.
+type remoteJob struct {
+	ID             int64  `json:"id"`
+	Status         string `json:"status"`
+	HostsProcessed int    `json:"hosts_processed"`
+	PortsProcessed int    `json:"ports_processed"`
+	HostsInScope   int    `json:"hosts_in_scope"`
+	HostsOutScope  int    `json:"hosts_out_scope"`
+	Error          string `json:"error"`
+	MACChanges     []struct {
+		IPAddress      string `json:"ip_address"`
+		PreviousMAC    string `json:"previous_mac"`
+		PreviousVendor string `json:"previous_vendor"`
+		MACAddress     string `json:"mac_address"`
+		MACVendor      string `json:"mac_vendor"`
+	} `json:"mac_changes"`
+}
+
+// remoteClient calls the JSON API of a running nmap-tracker server.
+type remoteClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newRemoteClient(server, token string) *remoteClient {
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	return &remoteClient{base: strings.TrimRight(server, "/"), token: token, http: &http.Client{}}
+}
+
+func (c *remoteClient) do(method, path, contentType string, body io.Reader, into any) error {
+	req, err := http.NewRequest(method, c.base+"/api"+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if into == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+func (c *remoteClient) projectID(name string) (int64, error) {
+	var projects []struct {
+		ID   int64
+		Name string
+	}
+	if err := c.do(http.MethodGet, "/projects", "", nil, &projects); err != nil {
+		return 0, err
+	}
+	for _, p := range projects {
+		if p.Name == name {
+			return p.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("project %q not found on server", name)
+}
+
+// submitImport streams a scan file to the server's import job endpoint.
+func (c *remoteClient) submitImport(projectID int64, path string, fields map[string]string) (remoteJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return remoteJob{}, fmt.Errorf("open scan file: %w", err)
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		for name, value := range fields {
+			if value == "" {
+				continue
+			}
+			if err := form.WriteField(name, value); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		part, err := form.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var job remoteJob
+	err = c.do(http.MethodPost, fmt.Sprintf("/projects/%d/imports/jobs", projectID), form.FormDataContentType(), pr, &job)
+	pr.Close()
+	return job, err
+}
+
+// runRemoteImport submits a file to a running server and, unless noWait,
+// follows the job until it finishes.
+func runRemoteImport(server, token, projectName, filePath string, fields map[string]string, noWait bool, out, errOut io.Writer) int {
+	client := newRemoteClient(server, token)
+	projectID, err := client.projectID(projectName)
+	if err != nil {
+		fmt.Fprintf(errOut, "find project: %v\n", err)
+		return 1
+	}
+	job, err := client.submitImport(projectID, filePath, fields)
+	if err != nil {
+		fmt.Fprintf(errOut, "submit import: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "queued import job %d for %s\n", job.ID, filepath.Base(filePath))
+	if noWait {
+		return 0
+	}
+
+	lastStatus := job.Status
+	for job.Status != "done" && job.Status != "failed" {
+		time.Sleep(remotePollInterval)
+		if err := client.do(http.MethodGet, fmt.Sprintf("/projects/%d/imports/jobs/%d", projectID, job.ID), "", nil, &job); err != nil {
+			fmt.Fprintf(errOut, "check import job: %v\n", err)
+			return 1
+		}
+		if job.Status != lastStatus {
+			fmt.Fprintf(out, "job %d %s (%d hosts, %d ports)\n", job.ID, job.Status, job.HostsProcessed, job.PortsProcessed)
+			lastStatus = job.Status
+		}
+	}
+	if job.Status == "failed" {
+		fmt.Fprintf(errOut, "import: %s\n", job.Error)
+		return 1
+	}
+	fmt.Fprintf(out, "imported %s into project %s (%d in scope, %d out of scope)\n", filepath.Base(filePath), projectName, job.HostsInScope, job.HostsOutScope)
+	for _, change := range job.MACChanges {
+		fmt.Fprintf(errOut, "warning: %s MAC changed from %s to %s\n",
+			change.IPAddress, formatMAC(change.PreviousMAC, change.PreviousVendor), formatMAC(change.MACAddress, change.MACVendor))
+	}
+	return 0
+}
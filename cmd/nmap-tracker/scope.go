@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+const scopeUsage = "scope command requires subcommand: list|add <definition>... [--exclude]|rm <scope-id>...|evaluate (all take --project <name> [--json])"
+
+func runScope(args []string, out, errOut io.Writer) int {
+	flags, remaining, err := extractProjectFlags(args)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	exclude, remaining := extractBoolFlag(remaining, "exclude")
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, scopeUsage)
+		return 1
+	}
+	sub, operands := remaining[0], remaining[1:]
+	switch sub {
+	case "list", "add", "rm", "evaluate":
+	default:
+		fmt.Fprintf(errOut, "unknown scope subcommand: %s\n", sub)
+		return 1
+	}
+	if sub == "add" && len(operands) == 0 {
+		fmt.Fprintln(errOut, "scope add requires at least one definition")
+		return 1
+	}
+	if sub == "rm" && len(operands) == 0 {
+		fmt.Fprintln(errOut, "scope rm requires at least one scope id")
+		return 1
+	}
+
+	database, project, ok := openProject(flags, "scope "+sub, errOut)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+	if sub != "list" && !checkWritable(project, errOut) {
+		return 1
+	}
+
+	switch sub {
+	case "add":
+		typ := scope.RuleInclude
+		if exclude {
+			typ = scope.RuleExclude
+		}
+		version, err := database.BulkAddScopeDefinitions(project.ID, operands, typ)
+		if err != nil {
+			fmt.Fprintf(errOut, "add scope: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			rules, err := database.ListScopeDefinitions(project.ID)
+			if err != nil {
+				fmt.Fprintf(errOut, "list scope: %v\n", err)
+				return 1
+			}
+			return writeJSON(out, errOut, map[string]any{
+				"added": len(version.Changes), "rules": rules, "version": version.Version, "updated": version.HostsUpdated,
+			})
+		}
+		for _, change := range version.Changes {
+			fmt.Fprintf(out, "added %s rule %d\t%s\n", change.Type, change.ID, change.Definition)
+		}
+		fmt.Fprintf(out, "scope version %d: %d hosts changed scope\n", version.Version, version.HostsUpdated)
+		return 0
+	case "rm":
+		type removal struct {
+			ID      int64 `json:"id"`
+			Version int   `json:"version"`
+			Updated int   `json:"updated"`
+		}
+		var removed []removal
+		for _, raw := range operands {
+			scopeID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				fmt.Fprintf(errOut, "invalid scope id %q\n", raw)
+				return 1
+			}
+			version, err := database.DeleteScopeDefinitionForProject(project.ID, scopeID)
+			if errors.Is(err, sql.ErrNoRows) {
+				fmt.Fprintf(errOut, "scope rule %d not found in project %s\n", scopeID, project.Name)
+				return 1
+			}
+			if err != nil {
+				fmt.Fprintf(errOut, "remove scope: %v\n", err)
+				return 1
+			}
+			removed = append(removed, removal{ID: scopeID, Version: version.Version, Updated: version.HostsUpdated})
+		}
+		if flags.json {
+			return writeJSON(out, errOut, removed)
+		}
+		for _, r := range removed {
+			fmt.Fprintf(out, "removed scope rule %d (scope version %d: %d hosts changed scope)\n", r.ID, r.Version, r.Updated)
+		}
+		return 0
+	case "evaluate":
+		eval, err := database.EvaluateScope(project.ID)
+		if err != nil {
+			fmt.Fprintf(errOut, "evaluate scope: %v\n", err)
+			return 1
+		}
+		if flags.json {
+			return writeJSON(out, errOut, map[string]int{
+				"updated": eval.Updated, "in_scope": eval.InScope, "out_of_scope": eval.OutOfScope,
+			})
+		}
+		fmt.Fprintf(out, "%d hosts updated: %d in scope, %d out of scope\n", eval.Updated, eval.InScope, eval.OutOfScope)
+		return 0
+	}
+
+	rules, err := database.ListScopeDefinitions(project.ID)
+	if err != nil {
+		fmt.Fprintf(errOut, "list scope: %v\n", err)
+		return 1
+	}
+	if flags.json {
+		if rules == nil {
+			rules = []db.ScopeDefinition{}
+		}
+		return writeJSON(out, errOut, rules)
+	}
+	table := newTable(out)
+	fmt.Fprintln(table, "ID\tTYPE\tDEFINITION\tCREATED")
+	for _, rule := range rules {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", rule.ID, rule.Type, rule.Definition, rule.CreatedAt.UTC().Format(tableTimeFormat))
+	}
+	table.Flush()
+	return 0
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/web"
+)
+
+// shutdownTimeout bounds how long in-flight requests may run after SIGTERM.
+const shutdownTimeout = 15 * time.Second
+
+func runServe(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	dbPath := fs.String("db", defaultDBPath, "path to database file")
+	port := fs.Int("port", 8080, "port to listen on at 127.0.0.1 (ignored with --listen)")
+	listen := fs.String("listen", "", "address to listen on, e.g. 0.0.0.0:8443 (default 127.0.0.1:<port>)")
+	tlsCert := fs.String("tls-cert", "", "PEM certificate file for HTTPS")
+	tlsKey := fs.String("tls-key", "", "PEM private key file for HTTPS")
+	selfSigned := fs.Bool("tls-self-signed", false, "serve HTTPS with a generated self-signed certificate")
+	trustedOrigins := fs.String("trusted-origins", "", "comma-separated browser origins allowed to make changes, e.g. https://jumpbox:8443")
+	trustedProxies := fs.String("trusted-proxies", "", "comma-separated proxy IPs/CIDRs whose X-Forwarded-* headers are trusted")
+	spoolDir := fs.String("spool-dir", "", "directory for uploads awaiting background import (default <db>.spool)")
+	importWorkers := fs.Int("import-workers", web.DefaultImportWorkers, "number of background imports run at once")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *importWorkers < 1 {
+		fmt.Fprintln(errOut, "--import-workers must be at least 1")
+		return 1
+	}
+	if *spoolDir == "" {
+		*spoolDir = *dbPath + ".spool"
+	}
+
+	addr := *listen
+	if addr == "" {
+		addr = fmt.Sprintf("127.0.0.1:%d", *port)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid --listen %q: %v\n", addr, err)
+		return 1
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(errOut, "--tls-cert and --tls-key must be given together")
+		return 1
+	}
+	if *selfSigned && *tlsCert != "" {
+		fmt.Fprintln(errOut, "use either --tls-self-signed or --tls-cert/--tls-key")
+		return 1
+	}
+
+	var tlsConfig *tls.Config
+	switch {
+	case *tlsCert != "":
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			fmt.Fprintf(errOut, "load tls certificate: %v\n", err)
+			return 1
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case *selfSigned:
+		cert, err := web.SelfSignedCertificate([]string{host}, time.Now())
+		if err != nil {
+			fmt.Fprintf(errOut, "generate certificate: %v\n", err)
+			return 1
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		fmt.Fprintf(out, "self-signed certificate SHA-256 fingerprint: %s\n", web.CertificateFingerprint(cert))
+	}
+
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "open db: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	server, err := web.NewServerWithOptions(database, web.Options{
+		TrustedOrigins: splitList(*trustedOrigins),
+		TrustedProxies: splitList(*trustedProxies),
+		SpoolDir:       *spoolDir,
+		ImportWorkers:  *importWorkers,
+	})
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if !isLoopbackHost(host) {
+		if enabled, err := database.HasUsers(); err == nil && !enabled {
+			fmt.Fprintln(errOut, "warning: listening beyond localhost with no user accounts; anyone who can reach the port has full access (see `users add`)")
+		}
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(errOut, "serve: %v\n", err)
+		return 1
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+		scheme = "https"
+	}
+	fmt.Fprintf(out, "listening on %s://%s\n", scheme, ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	httpServer := &http.Server{Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	// Live event streams never finish on their own; end them on shutdown.
+	httpServer.RegisterOnShutdown(server.Events.Close)
+	if err := serveUntilDone(ctx, httpServer, ln); err != nil {
+		fmt.Fprintf(errOut, "serve: %v\n", err)
+		return 1
+	}
+	// Running imports get the same grace period as requests; anything cut
+	// short is re-queued on the next start.
+	closeCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Close(closeCtx); err != nil {
+		fmt.Fprintln(errOut, "import still running at shutdown; it will be retried on next start")
+	}
+	fmt.Fprintln(out, "server stopped")
+	return 0
+}
+
+// serveUntilDone serves on ln until ctx is cancelled, then stops accepting
+// connections and lets in-flight requests finish within shutdownTimeout.
+func serveUntilDone(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// passwordEnv supplies a password to users add/passwd without putting it on
+// the command line.
+const passwordEnv = "NMAPTRACKER_PASSWORD"
+
+const usersUsage = "users command requires subcommand: list|add <username> [--admin]|passwd <username>|delete <username>|grant <username> --project <name> --role <viewer|analyst|admin>|revoke <username> --project <name>|token <username> --name <label>"
+
+func runUsers(args []string, out, errOut io.Writer) int {
+	dbPath, remaining, err := extractFlag(args, "db", defaultDBPath)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	password, remaining, err := extractFlag(remaining, "password", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	projectName, remaining, err := extractFlag(remaining, "project", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	role, remaining, err := extractFlag(remaining, "role", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	tokenName, remaining, err := extractFlag(remaining, "name", "")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	isAdmin, remaining := extractBoolFlag(remaining, "admin")
+	if len(remaining) < 1 {
+		fmt.Fprintln(errOut, usersUsage)
+		return 1
+	}
+	sub := remaining[0]
+	if sub != "list" && len(remaining) < 2 {
+		fmt.Fprintf(errOut, "users %s requires a username\n", sub)
+		return 1
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "open db: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	if sub == "list" {
+		users, err := database.ListUsers()
+		if err != nil {
+			fmt.Fprintf(errOut, "list users: %v\n", err)
+			return 1
+		}
+		for _, u := range users {
+			kind := "user"
+			if u.IsAdmin {
+				kind = "admin"
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\n", u.ID, u.Username, kind)
+		}
+		return 0
+	}
+
+	username := remaining[1]
+	if sub == "add" {
+		if password == "" {
+			if password, err = readPassword(out); err != nil {
+				fmt.Fprintf(errOut, "read password: %v\n", err)
+				return 1
+			}
+		}
+		// The first account always administers the site, since creating it
+		// turns on authentication for the web server.
+		enabled, err := database.HasUsers()
+		if err != nil {
+			fmt.Fprintf(errOut, "count users: %v\n", err)
+			return 1
+		}
+		u, err := database.CreateUser(username, password, isAdmin || !enabled)
+		if err != nil {
+			fmt.Fprintf(errOut, "create user: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "created user %d\t%s\n", u.ID, u.Username)
+		return 0
+	}
+
+	user, found, err := database.GetUserByUsername(username)
+	if err != nil {
+		fmt.Fprintf(errOut, "find user: %v\n", err)
+		return 1
+	}
+	if !found {
+		fmt.Fprintf(errOut, "user %q not found\n", username)
+		return 1
+	}
+
+	switch sub {
+	case "passwd":
+		if password == "" {
+			if password, err = readPassword(out); err != nil {
+				fmt.Fprintf(errOut, "read password: %v\n", err)
+				return 1
+			}
+		}
+		if err := database.SetUserPassword(user.ID, password); err != nil {
+			fmt.Fprintf(errOut, "set password: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "updated password for %s\n", user.Username)
+		return 0
+	case "delete":
+		if err := database.DeleteUser(user.ID); err != nil {
+			fmt.Fprintf(errOut, "delete user: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "deleted user %s\n", user.Username)
+		return 0
+	case "grant", "revoke":
+		if projectName == "" {
+			fmt.Fprintf(errOut, "users %s requires --project\n", sub)
+			return 1
+		}
+		project, found, err := database.GetProjectByName(projectName)
+		if err != nil {
+			fmt.Fprintf(errOut, "find project: %v\n", err)
+			return 1
+		}
+		if !found {
+			fmt.Fprintf(errOut, "project %q not found\n", projectName)
+			return 1
+		}
+		if sub == "revoke" {
+			if err := database.RemoveProjectMember(project.ID, user.ID); err != nil {
+				fmt.Fprintf(errOut, "revoke: %v\n", err)
+				return 1
+			}
+			fmt.Fprintf(out, "revoked %s on %s\n", user.Username, project.Name)
+			return 0
+		}
+		if err := database.SetProjectMember(project.ID, user.ID, role); err != nil {
+			fmt.Fprintf(errOut, "grant: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "granted %s %s on %s\n", user.Username, role, project.Name)
+		return 0
+	case "token":
+		if strings.TrimSpace(tokenName) == "" {
+			fmt.Fprintln(errOut, "users token requires --name")
+			return 1
+		}
+		_, secret, err := database.CreateAPIToken(user.ID, tokenName)
+		if err != nil {
+			fmt.Fprintf(errOut, "create token: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(out, secret)
+		return 0
+	default:
+		fmt.Fprintf(errOut, "unknown users subcommand: %s\n", sub)
+		return 1
+	}
+}
+
+// readPassword takes the password from NMAPTRACKER_PASSWORD or, failing
+// that, the first line of stdin.
+func readPassword(out io.Writer) (string, error) {
+	if password := os.Getenv(passwordEnv); password != "" {
+		return password, nil
+	}
+	fmt.Fprint(out, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -4,6 +4,8 @@ go 1.24.12
 
 require modernc.org/sqlite v1.44.3
 
+require golang.org/x/crypto v0.43.0
+
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-chi/chi/v5 v5.0.10
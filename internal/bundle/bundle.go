@@ -0,0 +1,349 @@
+// Package bundle writes and reads portable project bundles: a gzipped tar
+// holding a manifest, one NDJSON file per table and the original scan files
+// of the project's imports, which reloads into another database with every
+// id remapped.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const (
+	// FormatName identifies a project bundle in its manifest.
+	FormatName = "nmap-tracker-bundle"
+	// FormatVersion is the bundle layout this build writes and the newest it
+	// reads. Version 2 added the original scan files.
+	FormatVersion = 2
+
+	manifestName = "manifest.json"
+	tablesDir    = "tables/"
+	scansDir     = "scans/"
+)
+
+// Manifest is the first entry of a bundle.
+type Manifest struct {
+	Format     string      `json:"format"`
+	Version    int         `json:"version"`
+	ExportedAt time.Time   `json:"exported_at"`
+	Project    string      `json:"project"`
+	Tables     []TableInfo `json:"tables"`
+	Scans      []ScanInfo  `json:"scans,omitempty"`
+}
+
+// TableInfo names one table file of a bundle and its row count.
+type TableInfo struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Rows int    `json:"rows"`
+}
+
+// ScanInfo names one original scan file of a bundle, stored gzipped, with
+// the size and SHA-256 of its uncompressed content.
+type ScanInfo struct {
+	SHA256 string `json:"sha256"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+}
+
+// ImportResult reports a loaded bundle.
+type ImportResult struct {
+	Project  db.Project
+	Manifest Manifest
+	// Rows counts the rows loaded per table.
+	Rows map[string]int
+	// SkippedMembers lists bundled members with no account of the same
+	// username in this database.
+	SkippedMembers []string
+}
+
+// Export writes a bundle of the project to w. Tables are spooled to a
+// temporary directory first so the manifest, which leads the archive, can
+// carry their row counts.
+func Export(database *db.DB, projectID int64, w io.Writer) (Manifest, error) {
+	project, found, err := database.GetProjectByID(projectID)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("get project: %w", err)
+	}
+	if !found {
+		return Manifest{}, fmt.Errorf("project not found")
+	}
+
+	dir, err := os.MkdirTemp("", "nmap-tracker-bundle-")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("create spool dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := Manifest{
+		Format:     FormatName,
+		Version:    FormatVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Project:    project.Name,
+	}
+	files := make(map[string]*os.File)
+	encoders := make(map[string]*json.Encoder)
+	writers := make(map[string]*bufio.Writer)
+	for _, name := range db.BundleTables() {
+		f, err := os.Create(filepath.Join(dir, name+".ndjson"))
+		if err != nil {
+			return Manifest{}, fmt.Errorf("create spool file: %w", err)
+		}
+		defer f.Close()
+		files[name] = f
+		writers[name] = bufio.NewWriter(f)
+		encoders[name] = json.NewEncoder(writers[name])
+		manifest.Tables = append(manifest.Tables, TableInfo{Name: name, File: tablesDir + name + ".ndjson"})
+	}
+	counts := make(map[string]int)
+	err = database.DumpProject(projectID, func(table string, row db.BundleRow) error {
+		counts[table]++
+		if err := encoders[table].Encode(row); err != nil {
+			return fmt.Errorf("encode %s: %w", table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	for i := range manifest.Tables {
+		manifest.Tables[i].Rows = counts[manifest.Tables[i].Name]
+	}
+	artifacts, err := database.ListProjectScanArtifacts(projectID)
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, a := range artifacts {
+		manifest.Scans = append(manifest.Scans, ScanInfo{SHA256: a.SHA256, File: scansDir + a.SHA256 + ".gz", Size: a.Size})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := writeEntry(tw, manifestName, int64(len(manifestJSON)), manifest.ExportedAt, bytes.NewReader(manifestJSON)); err != nil {
+		return Manifest{}, err
+	}
+	for _, table := range manifest.Tables {
+		f := files[table.Name]
+		if err := writers[table.Name].Flush(); err != nil {
+			return Manifest{}, fmt.Errorf("write spool file: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return Manifest{}, fmt.Errorf("stat spool file: %w", err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return Manifest{}, fmt.Errorf("rewind spool file: %w", err)
+		}
+		if err := writeEntry(tw, table.File, info.Size(), manifest.ExportedAt, f); err != nil {
+			return Manifest{}, err
+		}
+	}
+	for i, scan := range manifest.Scans {
+		if err := writeScan(database, tw, artifacts[i], scan.File, manifest.ExportedAt); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("close gzip: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeScan copies a stored scan file, still gzipped, into the bundle.
+func writeScan(database *db.DB, tw *tar.Writer, a db.ScanArtifact, name string, modTime time.Time) error {
+	stored, err := database.OpenScanArtifact(a)
+	if err != nil {
+		return err
+	}
+	defer stored.Close()
+	return writeEntry(tw, name, a.StoredSize, modTime, stored)
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write %s header: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import loads a bundle into a new project, in one transaction. A non-empty
+// name replaces the bundled project's name; either way a project of that
+// name must not exist yet (db.ErrProjectExists).
+func Import(database *db.DB, r io.Reader, name string) (ImportResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("read bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("read bundle: %w", err)
+	}
+	if hdr.Name != manifestName {
+		return ImportResult{}, fmt.Errorf("read bundle: first entry is %s, not %s", hdr.Name, manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return ImportResult{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.Format != FormatName {
+		return ImportResult{}, fmt.Errorf("not a project bundle (format %q)", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > FormatVersion {
+		return ImportResult{}, fmt.Errorf("bundle version %d is not supported; this build reads up to version %d", manifest.Version, FormatVersion)
+	}
+	expected := make(map[string]TableInfo, len(manifest.Tables))
+	for _, table := range manifest.Tables {
+		expected[table.File] = table
+	}
+	scans := make(map[string]ScanInfo, len(manifest.Scans))
+	for _, scan := range manifest.Scans {
+		scans[scan.File] = scan
+	}
+
+	load, err := database.BeginProjectLoad(name)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer load.Rollback()
+
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("read bundle: %w", err)
+		}
+		if scan, ok := scans[hdr.Name]; ok {
+			if err := loadScan(database, load, scan, tr); err != nil {
+				return ImportResult{}, err
+			}
+			seen[scan.File] = true
+			continue
+		}
+		table, ok := expected[hdr.Name]
+		if !ok {
+			return ImportResult{}, fmt.Errorf("read bundle: unexpected entry %s", hdr.Name)
+		}
+		rows, err := loadTable(load, table.Name, tr)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if rows != table.Rows {
+			return ImportResult{}, fmt.Errorf("read bundle: %s has %d rows, manifest says %d", table.File, rows, table.Rows)
+		}
+		seen[table.File] = true
+	}
+	for _, table := range manifest.Tables {
+		if !seen[table.File] {
+			return ImportResult{}, fmt.Errorf("read bundle: %s is missing", table.File)
+		}
+	}
+	for _, scan := range manifest.Scans {
+		if !seen[scan.File] {
+			return ImportResult{}, fmt.Errorf("read bundle: %s is missing", scan.File)
+		}
+	}
+
+	project, err := load.Commit()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("load bundle: %w", err)
+	}
+	return ImportResult{Project: project, Manifest: manifest, Rows: load.Rows, SkippedMembers: load.SkippedMembers}, nil
+}
+
+// loadScan stores one original scan file after checking its content against
+// the manifest.
+func loadScan(database *db.DB, load *db.ProjectLoad, scan ScanInfo, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("read bundle %s: %w", scan.File, err)
+	}
+	defer gz.Close()
+	w, err := database.NewScanArtifactWriter()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err := io.Copy(w, gz); err != nil {
+		return fmt.Errorf("read bundle %s: %w", scan.File, err)
+	}
+	if w.SHA256() != scan.SHA256 {
+		return fmt.Errorf("read bundle: %s does not match its sha256 %s", scan.File, scan.SHA256)
+	}
+	if _, err := load.StoreScanArtifact(w); err != nil {
+		return fmt.Errorf("load bundle: %w", err)
+	}
+	return nil
+}
+
+// loadTable loads one NDJSON table file and returns its row count.
+func loadTable(load *db.ProjectLoad, table string, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	rows := 0
+	for {
+		var raw map[string]any
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, fmt.Errorf("decode %s row %d: %w", table, rows+1, err)
+		}
+		row := make(db.BundleRow, len(raw))
+		for col, v := range raw {
+			value, err := rowValue(v)
+			if err != nil {
+				return rows, fmt.Errorf("decode %s row %d %s: %w", table, rows+1, col, err)
+			}
+			row[col] = value
+		}
+		if err := load.Load(table, row); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+}
+
+// rowValue turns a decoded JSON value back into the SQLite value it was
+// dumped from.
+func rowValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, string:
+		return v, nil
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return v.Int64()
+		}
+		return v.Float64()
+	default:
+		return nil, fmt.Errorf("unexpected %T", v)
+	}
+}
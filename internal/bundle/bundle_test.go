@@ -0,0 +1,374 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+	"github.com/sloppy/nmaptracker/internal/scope"
+	"github.com/sloppy/nmaptracker/internal/testutil"
+)
+
+func newTestDB(t *testing.T, name string) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(testutil.TempDir(t), name))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// seedProject builds a project with something in every bundled table.
+func seedProject(t *testing.T, database *db.DB) db.Project {
+	t.Helper()
+	// A throwaway project first, so ids in the source and a fresh database
+	// differ.
+	if _, err := database.CreateProject("padding"); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	project, err := database.CreateProject("Ext <2024>")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, err := database.AddScopeDefinition(project.ID, "10.0.0.0/24", "include"); err != nil {
+		t.Fatalf("add scope: %v", err)
+	}
+	dropped, err := database.AddScopeDefinition(project.ID, "10.0.0.9", "exclude")
+	if err != nil {
+		t.Fatalf("add scope: %v", err)
+	}
+	if _, err := database.DeleteScopeDefinitionForProject(project.ID, dropped.ID); err != nil {
+		t.Fatalf("delete scope: %v", err)
+	}
+	if _, _, err := database.BulkAddExpectedAssetBaselines(project.ID, []string{"10.0.0.1", "10.0.0.0/30"}); err != nil {
+		t.Fatalf("add baseline: %v", err)
+	}
+	user, err := database.CreateUser("alice", "correct horse battery", false)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := database.SetProjectMember(project.ID, user.ID, "analyst"); err != nil {
+		t.Fatalf("set member: %v", err)
+	}
+
+	matcher, err := scope.NewMatcher([]string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("new matcher: %v", err)
+	}
+	scanned := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+	obs := importer.Observations{Hosts: []importer.HostObservation{
+		{
+			IPAddress: "10.0.0.1", Hostname: "alpha", MACAddress: "00:11:22:33:44:55",
+			Ports: []importer.PortObservation{
+				{PortNumber: 22, Protocol: "tcp", State: "open", Service: "ssh", Product: "OpenSSH", Version: "9.6"},
+				{
+					PortNumber: 443, Protocol: "tcp", State: "open", Service: "https",
+					Scripts: []importer.ScriptResult{{ScriptID: "ssl-cert", Output: "CN=alpha & co", Elements: json.RawMessage(`{"subject":{"commonName":"alpha"}}`)}},
+				},
+			},
+		},
+		{IPAddress: "10.0.0.2", Ports: []importer.PortObservation{{PortNumber: 53, Protocol: "udp", State: "open|filtered"}}},
+		{IPAddress: "2001:db8::1", Ports: []importer.PortObservation{{PortNumber: 80, Protocol: "tcp", State: "open"}}},
+	}}
+	if _, err := importer.ImportObservationsWithOptions(database, matcher, project.ID, "full.xml", obs,
+		importer.ParseMetadata{NmapArgs: "nmap -sV -p- 10.0.0.0/24", ScanStartedAt: scanned}, importer.ImportOptions{}, scanned); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	host, _, err := database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if err := database.UpdateHostNotes(host.ID, "jump box\nsee ticket #12"); err != nil {
+		t.Fatalf("host notes: %v", err)
+	}
+	ssh, _, _ := database.GetPortByKey(host.ID, 22, "tcp")
+	if err := database.UpdateWorkStatus(ssh.ID, "in_progress"); err != nil {
+		t.Fatalf("work status: %v", err)
+	}
+	if err := database.UpdatePortNotes(ssh.ID, "weak kex"); err != nil {
+		t.Fatalf("port notes: %v", err)
+	}
+	if _, err := database.AddScopeDefinition(project.ID, "10.0.0.2", "exclude"); err != nil {
+		t.Fatalf("add scope: %v", err)
+	}
+	archived, err := database.SetProjectArchived(project.ID, true)
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	return archived
+}
+
+// dumpWithoutIDs dumps a project with ids and references blanked, so two
+// copies of a project compare equal.
+func dumpWithoutIDs(t *testing.T, database *db.DB, projectID int64) map[string][]db.BundleRow {
+	t.Helper()
+	ids := map[string]bool{"id": true, "project_id": true, "host_id": true, "port_id": true, "scan_import_id": true,
+		"scope_version_id": true, "user_id": true, "entity_id": true, "changes": true, "rules": true}
+	tables := map[string][]db.BundleRow{}
+	err := database.DumpProject(projectID, func(table string, row db.BundleRow) error {
+		for col := range row {
+			if ids[col] {
+				delete(row, col)
+			}
+		}
+		tables[table] = append(tables[table], row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dump project: %v", err)
+	}
+	return tables
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	source := newTestDB(t, "source.db")
+	project := seedProject(t, source)
+
+	var buf bytes.Buffer
+	manifest, err := Export(source, project.ID, &buf)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if manifest.Project != project.Name || manifest.Version != FormatVersion || len(manifest.Tables) != len(db.BundleTables()) {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	for _, table := range manifest.Tables {
+		if table.Rows == 0 {
+			t.Fatalf("expected the seeded project to have %s rows", table.Name)
+		}
+	}
+
+	target := newTestDB(t, "target.db")
+	if _, err := target.CreateUser("alice", "another password", false); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	result, err := Import(target, bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	loaded := result.Project
+	if loaded.Name != project.Name || !loaded.Archived() || !loaded.CreatedAt.Equal(project.CreatedAt) {
+		t.Fatalf("unexpected loaded project: %+v (source %+v)", loaded, project)
+	}
+	if loaded.ID == project.ID {
+		t.Fatalf("expected a new project id, got %d", loaded.ID)
+	}
+	if len(result.SkippedMembers) != 0 || result.Rows["project_member"] != 1 {
+		t.Fatalf("expected alice to be matched by username: %+v", result)
+	}
+
+	want := dumpWithoutIDs(t, source, project.ID)
+	got := dumpWithoutIDs(t, target, loaded.ID)
+	imported := got["audit_event"][len(got["audit_event"])-1]
+	if imported["action"] != db.AuditProjectImport {
+		t.Fatalf("expected a trailing project.import audit event, got %v", imported)
+	}
+	got["audit_event"] = got["audit_event"][:len(got["audit_event"])-1]
+	for _, table := range db.BundleTables() {
+		if !reflect.DeepEqual(got[table], want[table]) {
+			t.Fatalf("%s differs after the round trip\nwant %v\ngot  %v", table, want[table], got[table])
+		}
+	}
+
+	// References must point at the loaded rows.
+	host, found, err := target.GetHostByIP(loaded.ID, "10.0.0.1")
+	if err != nil || !found {
+		t.Fatalf("get loaded host: %v %v", found, err)
+	}
+	events, err := target.ListAuditEvents(loaded.ID, db.AuditQuery{HostID: host.ID})
+	if err != nil || len(events) != 3 {
+		t.Fatalf("expected the host's notes, status and port notes events: %+v %v", events, err)
+	}
+	ssh, _, _ := target.GetPortByKey(host.ID, 22, "tcp")
+	transitions, err := target.ListPortStatusTransitions(ssh.ID)
+	if err != nil || len(transitions) != 1 || transitions[0].ToStatus != "in_progress" {
+		t.Fatalf("unexpected loaded transitions: %+v %v", transitions, err)
+	}
+	tx, err := target.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	history, err := tx.ListHostHistory(loaded.ID, "10.0.0.1")
+	tx.Rollback()
+	if err != nil || len(history) != 1 || len(history[0].Ports) != 2 || history[0].Import.NmapArgs != "nmap -sV -p- 10.0.0.0/24" {
+		t.Fatalf("unexpected loaded history: %+v %v", history, err)
+	}
+	rules, err := target.ListScopeDefinitions(loaded.ID)
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("unexpected loaded scope: %+v %v", rules, err)
+	}
+	versions, err := target.ListScopeVersions(loaded.ID)
+	if err != nil || len(versions) != 4 {
+		t.Fatalf("unexpected loaded scope versions: %+v %v", versions, err)
+	}
+	latest := versions[0].Rules
+	if len(latest) != 2 || latest[0].ID != rules[0].ID || latest[1].ID != rules[1].ID {
+		t.Fatalf("expected scope snapshots to name the loaded rule ids: %+v, rules %+v", latest, rules)
+	}
+	start, end := db.PrefixKeyRange(netip.MustParsePrefix("2001:db8::/64"))
+	hosts, _, err := target.ListHostsWithSummaryPaged(loaded.ID, nil, nil, "", "", start, end, 50, 0)
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("expected ip keys to be rebuilt for subnet filters: %+v %v", hosts, err)
+	}
+
+	// The same bundle cannot be loaded twice under one name.
+	if _, err := Import(target, bytes.NewReader(buf.Bytes()), ""); !errors.Is(err, db.ErrProjectExists) {
+		t.Fatalf("expected ErrProjectExists, got %v", err)
+	}
+	renamed, err := Import(source, bytes.NewReader(buf.Bytes()), "Ext copy")
+	if err != nil {
+		t.Fatalf("import under a new name: %v", err)
+	}
+	if renamed.Project.Name != "Ext copy" || renamed.Rows["host"] != 3 {
+		t.Fatalf("unexpected renamed import: %+v", renamed)
+	}
+}
+
+func TestBundleCarriesScanFiles(t *testing.T) {
+	source := newTestDB(t, "source.db")
+	project, err := source.CreateProject("Evidence")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	raw := "# Nmap 7.94 scan initiated Mon Mar  4 10:00:00 2024 as: nmap -p 22 -oG - 192.0.2.70\n" +
+		"Host: 192.0.2.70 ()\tPorts: 22/open/tcp//ssh///\n"
+	stats, err := importer.ImportWithOptions(source, nil, project.ID, "sweep.gnmap", strings.NewReader(raw), importer.ImportOptions{}, time.Now())
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	var buf bytes.Buffer
+	manifest, err := Export(source, project.ID, &buf)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(manifest.Scans) != 1 || manifest.Scans[0].SHA256 != stats.RawSHA256 || manifest.Scans[0].Size != int64(len(raw)) {
+		t.Fatalf("unexpected manifest scans: %+v", manifest.Scans)
+	}
+
+	// The target keeps its scan files in a directory next to the database.
+	targetPath := filepath.Join(testutil.TempDir(t), "target.db")
+	if err := os.Mkdir(db.ArtifactDirFor(targetPath), 0o755); err != nil {
+		t.Fatalf("create artifact dir: %v", err)
+	}
+	target, err := db.Open(targetPath)
+	if err != nil {
+		t.Fatalf("open target: %v", err)
+	}
+	defer target.Close()
+	result, err := Import(target, bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		t.Fatalf("import bundle: %v", err)
+	}
+	imports, err := target.ListScanImports(result.Project.ID)
+	if err != nil || len(imports) != 1 {
+		t.Fatalf("list imports: %+v %v", imports, err)
+	}
+	_, artifact, err := target.GetScanImportArtifact(result.Project.ID, imports[0].ID)
+	if err != nil || !artifact.InDir {
+		t.Fatalf("expected the scan file stored in the target's directory: %+v %v", artifact, err)
+	}
+	r, err := target.ReadScanArtifact(artifact)
+	if err != nil {
+		t.Fatalf("read scan file: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != raw {
+		t.Fatalf("scan file changed in the bundle: %q %v", got, err)
+	}
+	if _, err := importer.ReparseScanImport(target, result.Project.ID, imports[0].ID); err != nil {
+		t.Fatalf("reparse loaded import: %v", err)
+	}
+}
+
+func TestBundleImportRejectsBadBundles(t *testing.T) {
+	database := newTestDB(t, "bad.db")
+	bundleOf := func(entries map[string]string, order ...string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, name := range order {
+			body := entries[name]
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body))}); err != nil {
+				t.Fatalf("write header: %v", err)
+			}
+			io.WriteString(tw, body)
+		}
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	cases := map[string]struct {
+		bundle []byte
+		want   string
+	}{
+		"newer version": {
+			bundle: bundleOf(map[string]string{manifestName: `{"format":"nmap-tracker-bundle","version":99}`}, manifestName),
+			want:   "bundle version 99 is not supported",
+		},
+		"wrong format": {
+			bundle: bundleOf(map[string]string{manifestName: `{"format":"other","version":1}`}, manifestName),
+			want:   "not a project bundle",
+		},
+		"unknown column": {
+			bundle: bundleOf(map[string]string{
+				manifestName:            `{"format":"nmap-tracker-bundle","version":1,"tables":[{"name":"project","file":"tables/project.ndjson","rows":1}]}`,
+				"tables/project.ndjson": `{"id":1,"name":"future","colour":"blue"}` + "\n",
+			}, manifestName, "tables/project.ndjson"),
+			want: "bundle column project.colour is not in this database",
+		},
+		"scan checksum": {
+			bundle: bundleOf(map[string]string{
+				manifestName: `{"format":"nmap-tracker-bundle","version":2,"tables":[],` +
+					`"scans":[{"sha256":"0000000000000000000000000000000000000000000000000000000000000000","file":"scans/0000.gz","size":8}]}`,
+				"scans/0000.gz": gzipString(t, "tampered"),
+			}, manifestName, "scans/0000.gz"),
+			want: "scans/0000.gz does not match its sha256",
+		},
+		"dangling reference": {
+			bundle: bundleOf(map[string]string{
+				manifestName: `{"format":"nmap-tracker-bundle","version":1,"tables":[` +
+					`{"name":"project","file":"tables/project.ndjson","rows":1},{"name":"port","file":"tables/port.ndjson","rows":1}]}`,
+				"tables/project.ndjson": `{"id":1,"name":"dangling"}` + "\n",
+				"tables/port.ndjson":    `{"id":1,"host_id":7,"port_number":22,"protocol":"tcp","state":"open"}` + "\n",
+			}, manifestName, "tables/project.ndjson", "tables/port.ndjson"),
+			want: "host_id 7 is not in the bundle",
+		},
+	}
+	for name, tc := range cases {
+		_, err := Import(database, bytes.NewReader(tc.bundle), "")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %q, got %v", name, tc.want, err)
+		}
+	}
+	projects, err := database.ListProjects()
+	if err != nil || len(projects) != 0 {
+		t.Fatalf("expected failed imports to leave no project: %+v %v", projects, err)
+	}
+}
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(gz, s); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	gz.Close()
+	return buf.String()
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Audit entity types.
+const (
+	AuditEntityProject    = "project"
+	AuditEntityHost       = "host"
+	AuditEntityPort       = "port"
+	AuditEntityScope      = "scope_definition"
+	AuditEntityScanImport = "scan_import"
+	AuditEntityBaseline   = "expected_asset_baseline"
+	AuditEntityMember     = "project_member"
+)
+
+// Audit actions.
+const (
+	AuditProjectUpdate    = "project.update"
+	AuditProjectDelete    = "project.delete"
+	AuditProjectArchive   = "project.archive"
+	AuditProjectUnarchive = "project.unarchive"
+	AuditProjectClone     = "project.clone"
+	AuditProjectMerge     = "project.merge"
+	AuditProjectImport    = "project.import"
+	AuditHostNotes        = "host.notes"
+	AuditHostLatestScan   = "host.latest_scan"
+	AuditHostScope        = "host.scope"
+	AuditHostDelete       = "host.delete"
+	AuditPortWorkStatus   = "port.work_status"
+	AuditPortNotes        = "port.notes"
+	AuditPortDelete       = "port.delete"
+	AuditScopeAdd         = "scope.add"
+	AuditScopeDelete      = "scope.delete"
+	AuditImportIntents    = "import.intents"
+	AuditImportDelete     = "import.delete"
+	AuditImportReparse    = "import.reparse"
+	AuditBaselineAdd      = "baseline.add"
+	AuditBaselineDelete   = "baseline.delete"
+	AuditMemberSet        = "member.set"
+	AuditMemberRemove     = "member.remove"
+)
+
+// AuditEvent is one analyst change. Before and After are JSON snapshots of
+// the fields the action touched; either is null for creations and deletions.
+type AuditEvent struct {
+	ID         int64
+	ProjectID  int64
+	HostID     *int64
+	PortID     *int64
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   int64
+	Before     json.RawMessage
+	After      json.RawMessage
+	CreatedAt  time.Time
+}
+
+// AuditQuery filters ListAuditEvents. Zero fields match everything.
+type AuditQuery struct {
+	HostID int64
+	// BeforeID pages backwards: only events with a smaller id are returned.
+	BeforeID int64
+	Limit    int
+}
+
+// InsertAuditEvent appends an event within a transaction. An empty Actor is
+// filled from the handle the transaction was started on.
+func (tx *Tx) InsertAuditEvent(e AuditEvent) error {
+	if e.Actor == "" {
+		e.Actor = tx.actor
+	}
+	before, after := string(e.Before), string(e.After)
+	if before == "" {
+		before = "null"
+	}
+	if after == "" {
+		after = "null"
+	}
+	_, err := tx.Exec(
+		`INSERT INTO audit_event (project_id, host_id, port_id, actor, action, entity_type, entity_id, before_state, after_state)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ProjectID, nullableID(e.HostID), nullableID(e.PortID), e.Actor, e.Action, e.EntityType, e.EntityID, before, after,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit_event: %w", err)
+	}
+	return nil
+}
+
+// audit records an event, marshalling before and after. Nil snapshots are
+// stored as JSON null.
+func (tx *Tx) audit(e AuditEvent, before, after any) error {
+	var err error
+	if e.Before, err = json.Marshal(before); err != nil {
+		return fmt.Errorf("encode audit before: %w", err)
+	}
+	if e.After, err = json.Marshal(after); err != nil {
+		return fmt.Errorf("encode audit after: %w", err)
+	}
+	return tx.InsertAuditEvent(e)
+}
+
+func nullableID(id *int64) any {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// ListAuditEvents returns a project's audit events, newest first.
+func (db *DB) ListAuditEvents(projectID int64, q AuditQuery) ([]AuditEvent, error) {
+	where := []string{"project_id = ?"}
+	args := []any{projectID}
+	if q.HostID > 0 {
+		where = append(where, "host_id = ?")
+		args = append(args, q.HostID)
+	}
+	if q.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(
+		`SELECT id, project_id, host_id, port_id, actor, action, entity_type, entity_id, before_state, after_state, created_at
+		   FROM audit_event
+		  WHERE `+strings.Join(where, " AND ")+`
+		  ORDER BY id DESC
+		  LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list audit_event: %w", err)
+	}
+	defer rows.Close()
+
+	var items []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var hostID, portID sql.NullInt64
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.ProjectID, &hostID, &portID, &e.Actor, &e.Action, &e.EntityType, &e.EntityID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan audit_event: %w", err)
+		}
+		if hostID.Valid {
+			e.HostID = int64Ptr(hostID.Int64)
+		}
+		if portID.Valid {
+			e.PortID = int64Ptr(portID.Int64)
+		}
+		e.Before = json.RawMessage(before)
+		e.After = json.RawMessage(after)
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list audit_event rows: %w", err)
+	}
+	return items, nil
+}
+
+// Host timeline entry kinds.
+const (
+	TimelineAudit       = "audit"
+	TimelineObservation = "observation"
+	TimelineScope       = "scope"
+)
+
+// TimelineEntry is one item on a host timeline. Exactly one of Audit,
+// Observation and ScopeTransition is set, according to Kind.
+type TimelineEntry struct {
+	Time            time.Time
+	Kind            string
+	Audit           *AuditEvent              `json:",omitempty"`
+	Observation     *HostTimelineObservation `json:",omitempty"`
+	ScopeTransition *HostScopeTransition     `json:",omitempty"`
+}
+
+// HostTimelineObservation summarises one completed import that saw the host.
+type HostTimelineObservation struct {
+	ScanImportID int64
+	Filename     string
+	HostState    string
+	OpenPorts    int
+}
+
+// HostTimeline merges a host's audit events, scan observations and scope
+// transitions into one list, newest first.
+func (db *DB) HostTimeline(projectID, hostID int64) ([]TimelineEntry, error) {
+	host, found, err := db.GetHostByID(hostID)
+	if err != nil {
+		return nil, err
+	}
+	if !found || host.ProjectID != projectID {
+		return nil, sql.ErrNoRows
+	}
+
+	events, err := db.ListAuditEvents(projectID, AuditQuery{HostID: hostID, Limit: 1000})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TimelineEntry, 0, len(events))
+	for i := range events {
+		entries = append(entries, TimelineEntry{Time: events[i].CreatedAt, Kind: TimelineAudit, Audit: &events[i]})
+	}
+
+	rows, err := db.Query(
+		`SELECT si.id, si.filename, si.import_time, si.scan_started_at, si.scan_finished_at,
+		        ho.scan_started_at, ho.scan_ended_at, ho.host_state,
+		        (SELECT COUNT(*) FROM port_observation po
+		          WHERE po.scan_import_id = ho.scan_import_id AND po.ip_address = ho.ip_address AND po.state = 'open')
+		   FROM host_observation ho
+		   JOIN scan_import si ON si.id = ho.scan_import_id
+		  WHERE ho.project_id = ? AND ho.ip_address = ? AND si.status = ?`,
+		projectID, host.IPAddress, ScanImportStatusComplete,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list host timeline observations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var si ScanImport
+		var importStarted, importFinished, hostStarted, hostEnded sql.NullTime
+		obs := &HostTimelineObservation{}
+		if err := rows.Scan(&si.ID, &si.Filename, &si.ImportTime, &importStarted, &importFinished, &hostStarted, &hostEnded, &obs.HostState, &obs.OpenPorts); err != nil {
+			return nil, fmt.Errorf("scan host timeline observation: %w", err)
+		}
+		si.ScanStartedAt = ptrTimeFromNull(importStarted)
+		si.ScanFinishedAt = ptrTimeFromNull(importFinished)
+		obs.ScanImportID = si.ID
+		obs.Filename = si.Filename
+		at := si.ScanTime()
+		switch {
+		case hostEnded.Valid:
+			at = hostEnded.Time
+		case hostStarted.Valid:
+			at = hostStarted.Time
+		}
+		entries = append(entries, TimelineEntry{Time: at.UTC(), Kind: TimelineObservation, Observation: obs})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list host timeline observations rows: %w", err)
+	}
+
+	transitions, err := db.ListHostScopeTransitions(projectID, hostID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(transitions) - 1; i >= 0; i-- {
+		entries = append(entries, TimelineEntry{Time: transitions[i].CreatedAt, Kind: TimelineScope, ScopeTransition: &transitions[i]})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	return entries, nil
+}
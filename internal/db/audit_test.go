@@ -0,0 +1,97 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMutationsWriteAuditEvents(t *testing.T) {
+	db := newWorkflowDB(t)
+	defer db.Close()
+	projectID, ports := seedPorts(t, db)
+	alice := db.WithActor("alice")
+
+	if err := alice.UpdateWorkStatus(ports[0].ID, "flagged"); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	if err := alice.BulkUpdateByHost(ports[0].HostID, "done"); err != nil {
+		t.Fatalf("bulk update: %v", err)
+	}
+	// Re-applying the same status changes nothing and is not audited.
+	if err := alice.BulkUpdateByHost(ports[0].HostID, "done"); err != nil {
+		t.Fatalf("bulk update again: %v", err)
+	}
+	if err := db.WithActor("bob").UpdateHostNotes(ports[0].HostID, "jump box"); err != nil {
+		t.Fatalf("update host notes: %v", err)
+	}
+
+	events, err := db.ListAuditEvents(projectID, AuditQuery{})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action+"/"+e.Actor)
+	}
+	want := []string{
+		AuditHostNotes + "/bob",
+		AuditPortWorkStatus + "/alice",
+		AuditPortWorkStatus + "/alice",
+		AuditPortWorkStatus + "/alice",
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("unexpected events: %v", actions)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("unexpected events: %v", actions)
+		}
+	}
+
+	first := events[len(events)-1]
+	var before, after map[string]string
+	if err := json.Unmarshal(first.Before, &before); err != nil {
+		t.Fatalf("decode before: %v", err)
+	}
+	if err := json.Unmarshal(first.After, &after); err != nil {
+		t.Fatalf("decode after: %v", err)
+	}
+	if before["work_status"] != "scanned" || after["work_status"] != "flagged" || after["port"] != "80/tcp" {
+		t.Fatalf("unexpected snapshots: before=%v after=%v", before, after)
+	}
+	if first.PortID == nil || *first.PortID != ports[0].ID || first.HostID == nil || *first.HostID != ports[0].HostID {
+		t.Fatalf("unexpected entity refs: %+v", first)
+	}
+
+	hostEvents, err := db.ListAuditEvents(projectID, AuditQuery{HostID: ports[0].HostID, BeforeID: events[0].ID, Limit: 2})
+	if err != nil {
+		t.Fatalf("list host audit events: %v", err)
+	}
+	if len(hostEvents) != 2 || hostEvents[0].ID != events[1].ID {
+		t.Fatalf("unexpected paged events: %+v", hostEvents)
+	}
+
+	if _, err := db.Exec(`DELETE FROM audit_event`); err == nil {
+		t.Fatalf("expected audit_event to reject deletes")
+	}
+	if _, err := db.Exec(`UPDATE audit_event SET actor = 'mallory'`); err == nil {
+		t.Fatalf("expected audit_event to reject updates")
+	}
+}
+
+func TestDeleteHostKeepsAuditTrail(t *testing.T) {
+	db := newWorkflowDB(t)
+	defer db.Close()
+	projectID, ports := seedPorts(t, db)
+
+	if err := db.WithActor("carol").DeleteHost(ports[0].HostID); err != nil {
+		t.Fatalf("delete host: %v", err)
+	}
+	events, err := db.ListAuditEvents(projectID, AuditQuery{HostID: ports[0].HostID})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != AuditHostDelete || events[0].Actor != "carol" || string(events[0].After) != "null" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
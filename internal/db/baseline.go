@@ -11,14 +11,16 @@ import (
 )
 
 var (
-	// ErrInvalidBaselineDefinition is returned when a baseline definition is not valid IPv4 IP/CIDR syntax.
+	// ErrInvalidBaselineDefinition is returned when a baseline definition is not valid IP/CIDR syntax.
 	ErrInvalidBaselineDefinition = errors.New("invalid baseline definition")
-	// ErrBaselineIPv6Unsupported is returned when callers submit IPv6 baseline definitions.
-	ErrBaselineIPv6Unsupported = errors.New("ipv6 baseline definitions are not supported")
-	// ErrBaselineCIDRTooBroad is returned when a CIDR is broader than /16.
-	ErrBaselineCIDRTooBroad = errors.New("cidr broader than /16 is not allowed")
+	// ErrBaselineCIDRTooBroad is returned when a CIDR covers more than 65,536
+	// addresses (broader than /16 for IPv4 or /112 for IPv6).
+	ErrBaselineCIDRTooBroad = errors.New("cidr broader than /16 (ipv4) or /112 (ipv6) is not allowed")
 )
 
+// maxBaselineHostBits caps baseline CIDR expansion at 2^16 addresses.
+const maxBaselineHostBits = 16
+
 // BaselineSeenHost represents an observed host that is outside the expected baseline.
 type BaselineSeenHost struct {
 	HostID    int64  `json:"host_id"`
@@ -119,6 +121,14 @@ func (db *DB) BulkAddExpectedAssetBaselines(projectID int64, defs []string) (int
 		if rows, _ := res.RowsAffected(); rows > 0 {
 			added++
 			addedDefs = append(addedDefs, def)
+			id, err := res.LastInsertId()
+			if err != nil {
+				return added, nil, fmt.Errorf("expected asset baseline id: %w", err)
+			}
+			event := AuditEvent{ProjectID: projectID, Action: AuditBaselineAdd, EntityType: AuditEntityBaseline, EntityID: id}
+			if err := tx.audit(event, nil, map[string]string{"definition": def, "type": typ}); err != nil {
+				return added, nil, err
+			}
 		}
 	}
 
@@ -138,14 +148,28 @@ func (db *DB) BulkAddExpectedAssetBaselines(projectID int64, defs []string) (int
 
 // DeleteExpectedAssetBaseline removes one baseline, scoped by project.
 func (db *DB) DeleteExpectedAssetBaseline(projectID, baselineID int64) error {
-	res, err := db.Exec(`DELETE FROM expected_asset_baseline WHERE id = ? AND project_id = ?`, baselineID, projectID)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete expected asset baseline: %w", err)
+		return err
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
+	defer tx.Rollback()
+
+	var def, typ string
+	err = tx.QueryRow(
+		`DELETE FROM expected_asset_baseline WHERE id = ? AND project_id = ? RETURNING definition, type`,
+		baselineID, projectID,
+	).Scan(&def, &typ)
+	if err == sql.ErrNoRows {
 		return sql.ErrNoRows
 	}
-	return nil
+	if err != nil {
+		return fmt.Errorf("delete expected asset baseline: %w", err)
+	}
+	event := AuditEvent{ProjectID: projectID, Action: AuditBaselineDelete, EntityType: AuditEntityBaseline, EntityID: baselineID}
+	if err := tx.audit(event, map[string]string{"definition": def, "type": typ}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // EvaluateExpectedAssetBaseline evaluates expected-vs-observed drift for a project.
@@ -159,7 +183,7 @@ func (db *DB) EvaluateExpectedAssetBaseline(projectID int64) (BaselineEvaluation
 		return BaselineEvaluation{}, err
 	}
 
-	expected := make(map[uint32]struct{})
+	expected := make(map[netip.Addr]struct{})
 	for _, baseline := range baselines {
 		definition, typ, err := normalizeBaselineDefinition(baseline.Definition)
 		if err != nil {
@@ -170,31 +194,32 @@ func (db *DB) EvaluateExpectedAssetBaseline(projectID int64) (BaselineEvaluation
 		}
 		if typ == "ip" {
 			addr, _ := netip.ParseAddr(definition)
-			expected[ipToUint32(addr)] = struct{}{}
+			expected[addr] = struct{}{}
 			continue
 		}
 
 		prefix, _ := netip.ParsePrefix(definition)
-		base := ipToUint32(prefix.Addr())
-		hostCount := uint32(1) << uint32(32-prefix.Bits())
-		for i := uint32(0); i < hostCount; i++ {
-			expected[base+i] = struct{}{}
+		addr := prefix.Addr()
+		hostCount := 1 << (addr.BitLen() - prefix.Bits())
+		for i := 0; i < hostCount; i++ {
+			expected[addr] = struct{}{}
+			addr = addr.Next()
 		}
 	}
 
-	observed := make(map[uint32]struct{}, len(hosts))
+	observed := make(map[netip.Addr]struct{}, len(hosts))
 	seenButOut := make([]BaselineSeenHost, 0)
 	seenButOutMarkedInScope := make([]BaselineSeenHost, 0)
 	seenButOutMarkedOutScope := make([]BaselineSeenHost, 0)
 
 	for _, host := range hosts {
-		ipInt, ok := parseIPv4String(host.IPAddress)
+		addr, ok := parseBaselineAddr(host.IPAddress)
 		if !ok {
 			continue
 		}
-		observed[ipInt] = struct{}{}
+		observed[addr] = struct{}{}
 
-		if _, expectedHost := expected[ipInt]; expectedHost {
+		if _, expectedHost := expected[addr]; expectedHost {
 			continue
 		}
 
@@ -206,27 +231,30 @@ func (db *DB) EvaluateExpectedAssetBaseline(projectID int64) (BaselineEvaluation
 		}
 	}
 
-	expectedButUnseen := make([]string, 0)
-	for ipInt := range expected {
-		if _, found := observed[ipInt]; !found {
-			expectedButUnseen = append(expectedButUnseen, uint32ToIPv4(ipInt))
+	unseen := make([]netip.Addr, 0)
+	for addr := range expected {
+		if _, found := observed[addr]; !found {
+			unseen = append(unseen, addr)
 		}
 	}
-	sort.Slice(expectedButUnseen, func(i, j int) bool {
-		left, _ := parseIPv4String(expectedButUnseen[i])
-		right, _ := parseIPv4String(expectedButUnseen[j])
-		return left < right
+	// Addr.Compare orders IPv4 before IPv6, then numerically.
+	sort.Slice(unseen, func(i, j int) bool {
+		return unseen[i].Compare(unseen[j]) < 0
 	})
+	expectedButUnseen := make([]string, 0, len(unseen))
+	for _, addr := range unseen {
+		expectedButUnseen = append(expectedButUnseen, addr.String())
+	}
 
 	byIP := func(items []BaselineSeenHost) {
 		sort.Slice(items, func(i, j int) bool {
-			left, okLeft := parseIPv4String(items[i].IPAddress)
-			right, okRight := parseIPv4String(items[j].IPAddress)
+			left, okLeft := parseBaselineAddr(items[i].IPAddress)
+			right, okRight := parseBaselineAddr(items[j].IPAddress)
 			if okLeft != okRight {
 				return okLeft
 			}
 			if okLeft && okRight && left != right {
-				return left < right
+				return left.Compare(right) < 0
 			}
 			return items[i].IPAddress < items[j].IPAddress
 		})
@@ -301,7 +329,7 @@ func (db *DB) listBaselineObservedHosts(projectID int64) ([]BaselineSeenHost, er
 		`SELECT id, ip_address, hostname, in_scope
 		   FROM host
 		  WHERE project_id = ?
-		  ORDER BY CASE WHEN ip_int IS NULL THEN 1 ELSE 0 END, ip_int, ip_address`,
+		  ORDER BY CASE WHEN ip_key IS NULL THEN 1 ELSE 0 END, ip_key, ip_address`,
 		projectID,
 	)
 	if err != nil {
@@ -331,44 +359,26 @@ func normalizeBaselineDefinition(raw string) (string, string, error) {
 	}
 
 	if addr, err := netip.ParseAddr(definition); err == nil {
-		if !addr.Is4() {
-			return "", "", fmt.Errorf("%w: %q", ErrBaselineIPv6Unsupported, raw)
+		if addr.Zone() != "" {
+			return "", "", fmt.Errorf("%w: %q", ErrInvalidBaselineDefinition, raw)
 		}
-		return addr.String(), "ip", nil
+		return addr.Unmap().String(), "ip", nil
 	}
 
 	prefix, err := netip.ParsePrefix(definition)
 	if err != nil {
 		return "", "", fmt.Errorf("%w: %q", ErrInvalidBaselineDefinition, raw)
 	}
-	if !prefix.Addr().Is4() {
-		return "", "", fmt.Errorf("%w: %q", ErrBaselineIPv6Unsupported, raw)
-	}
-	if prefix.Bits() < 16 {
+	if prefix.Addr().BitLen()-prefix.Bits() > maxBaselineHostBits {
 		return "", "", fmt.Errorf("%w: %q", ErrBaselineCIDRTooBroad, raw)
 	}
 	return prefix.Masked().String(), "cidr", nil
 }
 
-func parseIPv4String(raw string) (uint32, bool) {
+func parseBaselineAddr(raw string) (netip.Addr, bool) {
 	addr, err := netip.ParseAddr(raw)
-	if err != nil || !addr.Is4() {
-		return 0, false
+	if err != nil {
+		return netip.Addr{}, false
 	}
-	return ipToUint32(addr), true
-}
-
-func ipToUint32(addr netip.Addr) uint32 {
-	octets := addr.As4()
-	return uint32(octets[0])<<24 | uint32(octets[1])<<16 | uint32(octets[2])<<8 | uint32(octets[3])
-}
-
-func uint32ToIPv4(value uint32) string {
-	addr := netip.AddrFrom4([4]byte{
-		byte(value >> 24),
-		byte(value >> 16),
-		byte(value >> 8),
-		byte(value),
-	})
-	return addr.String()
+	return addr.WithZone("").Unmap(), true
 }
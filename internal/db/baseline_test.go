@@ -33,10 +33,28 @@ func TestNormalizeBaselineDefinition(t *testing.T) {
 		}
 	})
 
-	t.Run("ipv6 rejected", func(t *testing.T) {
-		_, _, err := normalizeBaselineDefinition("2001:db8::1")
-		if !errors.Is(err, ErrBaselineIPv6Unsupported) {
-			t.Fatalf("expected ErrBaselineIPv6Unsupported, got %v", err)
+	t.Run("ipv6 ip and cidr canonicalization", func(t *testing.T) {
+		definition, typ, err := normalizeBaselineDefinition("2001:DB8:0::1")
+		if err != nil {
+			t.Fatalf("normalize baseline ipv6 ip: %v", err)
+		}
+		if definition != "2001:db8::1" || typ != "ip" {
+			t.Fatalf("unexpected normalized ipv6 ip: %q %q", definition, typ)
+		}
+
+		definition, typ, err = normalizeBaselineDefinition("2001:db8::1:99/120")
+		if err != nil {
+			t.Fatalf("normalize baseline ipv6 cidr: %v", err)
+		}
+		if definition != "2001:db8::1:0/120" || typ != "cidr" {
+			t.Fatalf("unexpected normalized ipv6 cidr: %q %q", definition, typ)
+		}
+	})
+
+	t.Run("ipv6 cidr broader than /112 rejected", func(t *testing.T) {
+		_, _, err := normalizeBaselineDefinition("2001:db8::/64")
+		if !errors.Is(err, ErrBaselineCIDRTooBroad) {
+			t.Fatalf("expected ErrBaselineCIDRTooBroad, got %v", err)
 		}
 	})
 }
@@ -142,3 +160,41 @@ func TestEvaluateExpectedAssetBaselineSetDiffs(t *testing.T) {
 		t.Fatalf("unexpected marked-out-of-scope list: %+v", result.Lists.SeenButOutOfScopeAndMarkedOutOfScope)
 	}
 }
+
+func TestEvaluateExpectedAssetBaselineIPv6(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	project, err := db.CreateProject("baseline-v6")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, _, err := db.BulkAddExpectedAssetBaselines(project.ID, []string{"2001:db8::/126", "10.0.0.1"}); err != nil {
+		t.Fatalf("seed baseline definitions: %v", err)
+	}
+	for _, ip := range []string{"2001:db8::1", "2001:db8::ff", "10.0.0.1"} {
+		if _, err := db.UpsertHost(Host{ProjectID: project.ID, IPAddress: ip, InScope: true}); err != nil {
+			t.Fatalf("insert host %s: %v", ip, err)
+		}
+	}
+
+	result, err := db.EvaluateExpectedAssetBaseline(project.ID)
+	if err != nil {
+		t.Fatalf("evaluate baseline: %v", err)
+	}
+	if result.Summary.ExpectedTotal != 5 || result.Summary.ObservedTotal != 3 {
+		t.Fatalf("unexpected summary: %+v", result.Summary)
+	}
+	wantUnseen := []string{"2001:db8::", "2001:db8::2", "2001:db8::3"}
+	if len(result.Lists.ExpectedButUnseen) != len(wantUnseen) {
+		t.Fatalf("unexpected unseen list: %v", result.Lists.ExpectedButUnseen)
+	}
+	for i, ip := range wantUnseen {
+		if result.Lists.ExpectedButUnseen[i] != ip {
+			t.Fatalf("unexpected unseen list: %v", result.Lists.ExpectedButUnseen)
+		}
+	}
+	if len(result.Lists.SeenButOutOfScope) != 1 || result.Lists.SeenButOutOfScope[0].IPAddress != "2001:db8::ff" {
+		t.Fatalf("unexpected seen-but-out list: %+v", result.Lists.SeenButOutOfScope)
+	}
+}
@@ -0,0 +1,511 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrProjectExists is returned when a loaded project's name is already taken.
+var ErrProjectExists = errors.New("project already exists")
+
+// BundleRow is one table row of a project bundle, keyed by column name.
+// Values are int64, float64, string or nil, exactly as SQLite stores them, so
+// timestamps keep their stored text.
+type BundleRow map[string]any
+
+// bundleRef names the table whose ids a column holds. Optional references to
+// rows that no longer exist in the source (audit events of deleted hosts) are
+// cleared instead of failing the load.
+type bundleRef struct {
+	table    string
+	optional bool
+}
+
+// bundleTable describes how one table of a project is dumped and loaded.
+type bundleTable struct {
+	name string
+	// where selects the project's rows; ? is the project id.
+	where string
+	// skip lists derived columns that are recomputed on load.
+	skip []string
+	refs map[string]bundleRef
+}
+
+var projectRef = map[string]bundleRef{"project_id": {table: "project"}}
+
+// bundleTables lists the tables of a project bundle in load order: every
+// table comes after the tables its ids refer to. Import jobs are not carried;
+// their spool files are local and finished jobs live on as scan imports.
+var bundleTables = []bundleTable{
+	{name: "project", where: "id = ?"},
+	{name: "scope_definition", where: "project_id = ?", refs: projectRef},
+	{name: "scope_version", where: "project_id = ?", refs: projectRef},
+	{name: "scan_import", where: "project_id = ?", refs: projectRef},
+	{
+		name:  "scan_import_intent",
+		where: "scan_import_id IN (SELECT id FROM scan_import WHERE project_id = ?)",
+		refs:  map[string]bundleRef{"scan_import_id": {table: "scan_import"}},
+	},
+	{name: "host", where: "project_id = ?", skip: []string{"ip_int", "ip_key"}, refs: projectRef},
+	{
+		name:  "port",
+		where: "host_id IN (SELECT id FROM host WHERE project_id = ?)",
+		refs:  map[string]bundleRef{"host_id": {table: "host"}},
+	},
+	{name: "host_observation", where: "project_id = ?", refs: observationRefs},
+	{name: "port_observation", where: "project_id = ?", refs: observationRefs},
+	{name: "script_result", where: "project_id = ?", refs: observationRefs},
+	{name: "expected_asset_baseline", where: "project_id = ?", refs: projectRef},
+	{
+		name:  "host_scope_transition",
+		where: "project_id = ?",
+		refs: map[string]bundleRef{
+			"project_id":       {table: "project"},
+			"host_id":          {table: "host"},
+			"scope_version_id": {table: "scope_version", optional: true},
+		},
+	},
+	{
+		name:  "port_status_transition",
+		where: "project_id = ?",
+		refs: map[string]bundleRef{
+			"project_id": {table: "project"},
+			"host_id":    {table: "host"},
+			"port_id":    {table: "port"},
+		},
+	},
+	{name: "project_member", where: "project_id = ?", refs: projectRef},
+	{
+		name:  "audit_event",
+		where: "project_id = ?",
+		refs: map[string]bundleRef{
+			"project_id": {table: "project"},
+			"host_id":    {table: "host", optional: true},
+			"port_id":    {table: "port", optional: true},
+		},
+	},
+}
+
+var observationRefs = map[string]bundleRef{
+	"project_id":     {table: "project"},
+	"scan_import_id": {table: "scan_import"},
+}
+
+// auditEntityTables maps audit entity types to the tables their ids refer to.
+var auditEntityTables = map[string]string{
+	AuditEntityProject:    "project",
+	AuditEntityHost:       "host",
+	AuditEntityPort:       "port",
+	AuditEntityScope:      "scope_definition",
+	AuditEntityScanImport: "scan_import",
+	AuditEntityBaseline:   "expected_asset_baseline",
+	AuditEntityMember:     "app_user",
+}
+
+// BundleTables returns the names of the tables in a project bundle, in the
+// order ProjectLoad expects them.
+func BundleTables() []string {
+	names := make([]string, len(bundleTables))
+	for i, t := range bundleTables {
+		names[i] = t.name
+	}
+	return names
+}
+
+func findBundleTable(name string) (bundleTable, bool) {
+	for _, t := range bundleTables {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return bundleTable{}, false
+}
+
+// tableColumns returns a table's column names in schema order.
+func tableColumns(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}, table string) ([]string, error) {
+	rows, err := q.Query(`SELECT name FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, fmt.Errorf("list %s columns: %w", table, err)
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan %s column: %w", table, err)
+		}
+		cols = append(cols, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list %s columns rows: %w", table, err)
+	}
+	return cols, nil
+}
+
+// DumpProject calls emit with every row of a project, table by table in
+// BundleTables order, from one read transaction. Every column is dumped, so
+// columns added by later migrations travel without changes here. Members
+// carry their username, since user ids differ between databases.
+func (db *DB) DumpProject(projectID int64, emit func(table string, row BundleRow) error) error {
+	tx, err := db.BeginRead()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM project WHERE id = ?)`, projectID).Scan(&exists); err != nil {
+		return fmt.Errorf("get project: %w", err)
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	for _, t := range bundleTables {
+		cols, err := tableColumns(tx, t.name)
+		if err != nil {
+			return err
+		}
+		selected := make([]string, 0, len(cols)+1)
+		for _, c := range cols {
+			if !containsString(t.skip, c) {
+				// Unary plus drops the declared type, so the driver returns
+				// the stored value rather than parsing timestamps.
+				selected = append(selected, fmt.Sprintf("+t.%s AS %s", c, c))
+			}
+		}
+		query := `SELECT ` + strings.Join(selected, ", ")
+		from := ` FROM ` + t.name + ` t`
+		if t.name == "project_member" {
+			query += `, u.username AS username`
+			from += ` JOIN app_user u ON u.id = t.user_id`
+		}
+		if err := dumpTable(tx, t.name, query+from+` WHERE t.`+t.where+` ORDER BY t.rowid`, projectID, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpTable(tx *Tx, table, query string, projectID int64, emit func(string, BundleRow) error) error {
+	rows, err := tx.Query(query, projectID)
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", table, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", table, err)
+	}
+	values := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scan %s: %w", table, err)
+		}
+		row := make(BundleRow, len(cols))
+		for i, c := range cols {
+			if _, ok := values[i].([]byte); ok {
+				return fmt.Errorf("dump %s: column %s holds a blob", table, c)
+			}
+			row[c] = values[i]
+		}
+		if err := emit(table, row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("dump %s rows: %w", table, err)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectLoad loads the rows of a project bundle into a new project inside
+// one transaction, giving every row a new id and rewriting the references
+// between them. Rows must arrive in BundleTables order.
+type ProjectLoad struct {
+	tx      *Tx
+	name    string
+	project Project
+	source  BundleRow
+	ids     map[string]map[int64]int64
+	columns map[string]map[string]bool
+	// Rows counts the rows loaded per table.
+	Rows map[string]int
+	// SkippedMembers lists members whose username has no account here.
+	SkippedMembers []string
+}
+
+// BeginProjectLoad starts loading a bundle. A non-empty name replaces the
+// bundled project's name.
+func (db *DB) BeginProjectLoad(name string) (*ProjectLoad, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &ProjectLoad{
+		tx:      tx,
+		name:    strings.TrimSpace(name),
+		ids:     map[string]map[int64]int64{},
+		columns: map[string]map[string]bool{},
+		Rows:    map[string]int{},
+	}, nil
+}
+
+// Load inserts one bundle row.
+func (l *ProjectLoad) Load(table string, row BundleRow) error {
+	t, ok := findBundleTable(table)
+	if !ok {
+		return fmt.Errorf("unknown bundle table %q", table)
+	}
+	if table != "project" && l.project.ID == 0 {
+		return fmt.Errorf("bundle %s row before the project row", table)
+	}
+	if table == "project" && l.project.ID != 0 {
+		return errors.New("bundle has more than one project row")
+	}
+	known, err := l.tableColumns(table)
+	if err != nil {
+		return err
+	}
+
+	oldID, hasID := row["id"].(int64)
+	values := make(map[string]any, len(row))
+	for col, v := range row {
+		if col == "id" {
+			continue
+		}
+		if table == "project_member" && col == "username" {
+			continue
+		}
+		if !known[col] {
+			return fmt.Errorf("bundle column %s.%s is not in this database; it was written by a newer nmap-tracker", table, col)
+		}
+		values[col] = v
+	}
+	for col, ref := range t.refs {
+		v, present := values[col]
+		if !present || v == nil {
+			continue
+		}
+		id, ok := l.mapID(ref.table, v)
+		switch {
+		case ok:
+			values[col] = id
+		case ref.optional:
+			values[col] = nil
+		default:
+			return fmt.Errorf("bundle %s row %d: %s %v is not in the bundle", table, oldID, col, v)
+		}
+	}
+
+	switch table {
+	case "project":
+		if err := l.prepareProject(row, values); err != nil {
+			return err
+		}
+	case "host":
+		ip, _ := values["ip_address"].(string)
+		if v, ok := ipv4ToInt(ip); ok {
+			values["ip_int"] = v
+		}
+		if v, ok := ipKey(ip); ok {
+			values["ip_key"] = v
+		}
+	case "scope_version":
+		for _, col := range []string{"changes", "rules"} {
+			rewritten, err := l.remapScopeSnapshots(values[col])
+			if err != nil {
+				return fmt.Errorf("bundle scope_version row %d %s: %w", oldID, col, err)
+			}
+			values[col] = rewritten
+		}
+	case "project_member":
+		username, _ := row["username"].(string)
+		var userID int64
+		err := l.tx.QueryRow(`SELECT id FROM app_user WHERE username = ?`, username).Scan(&userID)
+		if err == sql.ErrNoRows {
+			l.SkippedMembers = append(l.SkippedMembers, username)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get user: %w", err)
+		}
+		if old, ok := values["user_id"].(int64); ok {
+			l.remember("app_user", old, userID)
+		}
+		values["user_id"] = userID
+	case "audit_event":
+		if target, ok := auditEntityTables[fmt.Sprint(values["entity_type"])]; ok {
+			if id, ok := l.mapID(target, values["entity_id"]); ok {
+				values["entity_id"] = id
+			}
+		}
+	}
+
+	cols := make([]string, 0, len(values))
+	args := make([]any, 0, len(values))
+	for _, c := range orderedColumns(known, values) {
+		cols = append(cols, c)
+		args = append(args, values[c])
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table, strings.Join(cols, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+	if !known["id"] {
+		if _, err := l.tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("load %s: %w", table, err)
+		}
+		l.Rows[table]++
+		return nil
+	}
+	var newID int64
+	if err := l.tx.QueryRow(query+` RETURNING id`, args...).Scan(&newID); err != nil {
+		return fmt.Errorf("load %s: %w", table, err)
+	}
+	if hasID {
+		l.remember(table, oldID, newID)
+	}
+	if table == "project" {
+		l.project.ID = newID
+	}
+	l.Rows[table]++
+	return nil
+}
+
+func (l *ProjectLoad) prepareProject(row BundleRow, values map[string]any) error {
+	l.source = row
+	if l.name != "" {
+		values["name"] = l.name
+	}
+	name, _ := values["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		return errors.New("bundle project has no name")
+	}
+	var exists bool
+	if err := l.tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM project WHERE name = ?)`, name).Scan(&exists); err != nil {
+		return fmt.Errorf("get project by name: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrProjectExists, name)
+	}
+	return nil
+}
+
+// remapScopeSnapshots rewrites the rule ids inside a scope_version snapshot.
+// Rules deleted before the export keep their old ids; they only label history.
+func (l *ProjectLoad) remapScopeSnapshots(v any) (any, error) {
+	text, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	var snaps []ScopeRuleSnapshot
+	if err := json.Unmarshal([]byte(text), &snaps); err != nil {
+		return nil, err
+	}
+	for i, snap := range snaps {
+		if id, ok := l.mapID("scope_definition", snap.ID); ok {
+			snaps[i].ID = id
+		}
+	}
+	if snaps == nil {
+		snaps = []ScopeRuleSnapshot{}
+	}
+	out, err := json.Marshal(snaps)
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+func (l *ProjectLoad) tableColumns(table string) (map[string]bool, error) {
+	if cols, ok := l.columns[table]; ok {
+		return cols, nil
+	}
+	names, err := tableColumns(l.tx, table)
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]bool, len(names))
+	for _, n := range names {
+		cols[n] = true
+	}
+	l.columns[table] = cols
+	return cols, nil
+}
+
+func (l *ProjectLoad) remember(table string, oldID, newID int64) {
+	if l.ids[table] == nil {
+		l.ids[table] = map[int64]int64{}
+	}
+	l.ids[table][oldID] = newID
+}
+
+func (l *ProjectLoad) mapID(table string, v any) (int64, bool) {
+	old, ok := v.(int64)
+	if !ok {
+		return 0, false
+	}
+	id, ok := l.ids[table][old]
+	return id, ok
+}
+
+// orderedColumns returns the keys of values in sorted order, for stable
+// INSERT statements.
+func orderedColumns(known map[string]bool, values map[string]any) []string {
+	cols := make([]string, 0, len(values))
+	for c := range values {
+		if known[c] {
+			cols = append(cols, c)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// StoreScanArtifact stores an original scan file carried by the bundle, for
+// the loaded imports that name it.
+func (l *ProjectLoad) StoreScanArtifact(w *ScanArtifactWriter) (ScanArtifact, error) {
+	return l.tx.StoreScanArtifact(w)
+}
+
+// Commit records a project.import audit event and commits the load.
+func (l *ProjectLoad) Commit() (Project, error) {
+	if l.project.ID == 0 {
+		return Project{}, errors.New("bundle has no project row")
+	}
+	before := map[string]any{"project_id": l.source["id"], "name": l.source["name"]}
+	event := AuditEvent{ProjectID: l.project.ID, Action: AuditProjectImport, EntityType: AuditEntityProject, EntityID: l.project.ID}
+	if err := l.tx.audit(event, before, l.Rows); err != nil {
+		return Project{}, err
+	}
+	p, err := scanProject(l.tx.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id = ?`, l.project.ID))
+	if err != nil {
+		return Project{}, fmt.Errorf("get project: %w", err)
+	}
+	if err := l.tx.Commit(); err != nil {
+		return Project{}, err
+	}
+	return p, nil
+}
+
+// Rollback abandons the load. It is safe to call after Commit.
+func (l *ProjectLoad) Rollback() error {
+	return l.tx.Rollback()
+}
@@ -7,6 +7,8 @@ import (
 	"net/netip"
 	"strings"
 	"time"
+
+	"github.com/sloppy/nmaptracker/internal/scope"
 )
 
 var ErrCoverageSegmentNotFound = errors.New("coverage segment not found")
@@ -68,24 +70,6 @@ type coverageSegment struct {
 	hosts []coverageSegmentHost
 }
 
-type parsedScopeRule struct {
-	definition string
-	prefix     netip.Prefix
-	addr       netip.Addr
-	isPrefix   bool
-	isAddr     bool
-}
-
-func (r parsedScopeRule) matches(addr netip.Addr) bool {
-	if r.isPrefix {
-		return r.prefix.Contains(addr)
-	}
-	if r.isAddr {
-		return r.addr == addr
-	}
-	return false
-}
-
 // GetCoverageMatrix returns coverage by segment and intent for a project.
 func (db *DB) GetCoverageMatrix(projectID int64, opts CoverageMatrixOptions) (CoverageMatrixResponse, error) {
 	opts = normalizeCoverageMatrixOptions(opts)
@@ -239,17 +223,25 @@ func (db *DB) resolveCoverageSegments(projectID int64) ([]coverageSegment, strin
 	if err != nil {
 		return nil, "", fmt.Errorf("list scope definitions: %w", err)
 	}
-	if len(scopeDefs) > 0 {
-		segments := make([]coverageSegment, 0, len(scopeDefs)+1)
-		rules := make([]parsedScopeRule, 0, len(scopeDefs))
-		for _, def := range scopeDefs {
-			segments = append(segments, coverageSegment{
-				key:   fmt.Sprintf("scope:%d", def.ID),
-				label: def.Definition,
-				hosts: make([]coverageSegmentHost, 0),
-			})
-			rules = append(rules, parseScopeRule(def.Definition))
+	scopeRules, err := ParseScopeRules(scopeDefs)
+	if err != nil {
+		return nil, "", err
+	}
+	// Exclude rules never hold in-scope hosts, so only includes get segments.
+	segments := make([]coverageSegment, 0, len(scopeDefs)+1)
+	rules := make([]scope.Rule, 0, len(scopeDefs))
+	for i, def := range scopeDefs {
+		if scopeRules[i].Type != scope.RuleInclude {
+			continue
 		}
+		segments = append(segments, coverageSegment{
+			key:   fmt.Sprintf("scope:%d", def.ID),
+			label: def.Definition,
+			hosts: make([]coverageSegmentHost, 0),
+		})
+		rules = append(rules, scopeRules[i])
+	}
+	if len(rules) > 0 {
 		unmapped := coverageSegment{
 			key:   "scope:unmapped",
 			label: "In-scope (unmapped)",
@@ -259,7 +251,7 @@ func (db *DB) resolveCoverageSegments(projectID int64) ([]coverageSegment, strin
 		for _, host := range hosts {
 			matched := false
 			for idx, rule := range rules {
-				if rule.matches(host.addr) {
+				if rule.Matches(host.addr, host.Hostname) {
 					segments[idx].hosts = append(segments[idx].hosts, host)
 					matched = true
 				}
@@ -273,10 +265,10 @@ func (db *DB) resolveCoverageSegments(projectID int64) ([]coverageSegment, strin
 		return segments, "scope_rules", nil
 	}
 
-	segments := make([]coverageSegment, 0)
+	segments = make([]coverageSegment, 0)
 	byKey := make(map[string]int)
 	for _, host := range hosts {
-		cidr := fallbackCIDR24(host.addr)
+		cidr := fallbackSegmentCIDR(host.addr)
 		if cidr == "" {
 			continue
 		}
@@ -301,7 +293,7 @@ func (db *DB) listCoverageInScopeHosts(projectID int64) ([]coverageSegmentHost,
 		`SELECT id, ip_address, hostname
 		   FROM host
 		  WHERE project_id = ? AND in_scope = 1
-		  ORDER BY ip_address`,
+		  ORDER BY ip_key, ip_address`,
 		projectID,
 	)
 	if err != nil {
@@ -320,7 +312,7 @@ func (db *DB) listCoverageInScopeHosts(projectID int64) ([]coverageSegmentHost,
 			return nil, fmt.Errorf("scan in-scope host: %w", err)
 		}
 		addr, err := netip.ParseAddr(ip)
-		if err != nil || !addr.Is4() {
+		if err != nil {
 			continue
 		}
 		hosts = append(hosts, coverageSegmentHost{
@@ -392,26 +384,17 @@ func (db *DB) loadCoveredHostsByIntent(projectID int64) (map[string]map[string]s
 	return covered, nil
 }
 
-func parseScopeRule(definition string) parsedScopeRule {
-	def := strings.TrimSpace(definition)
-	rule := parsedScopeRule{definition: def}
-	if prefix, err := netip.ParsePrefix(def); err == nil {
-		rule.prefix = prefix
-		rule.isPrefix = true
-		return rule
-	}
-	if addr, err := netip.ParseAddr(def); err == nil {
-		rule.addr = addr
-		rule.isAddr = true
-		return rule
+// fallbackSegmentCIDR groups hosts without scope rules into /24 networks for
+// IPv4 and /64 networks for IPv6. The segment mode keeps its historical
+// "fallback_24" name.
+func fallbackSegmentCIDR(addr netip.Addr) string {
+	if addr.Is4() {
+		octets := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.0/24", octets[0], octets[1], octets[2])
 	}
-	return rule
-}
-
-func fallbackCIDR24(addr netip.Addr) string {
-	if !addr.Is4() {
+	prefix, err := addr.WithZone("").Prefix(64)
+	if err != nil {
 		return ""
 	}
-	octets := addr.As4()
-	return fmt.Sprintf("%d.%d.%d.0/24", octets[0], octets[1], octets[2])
+	return prefix.String()
 }
@@ -159,6 +159,39 @@ func TestCoverageMatrixFallbackAndMissingPagination(t *testing.T) {
 	_ = h3
 }
 
+func TestCoverageMatrixFallbackGroupsIPv6By64(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	project, err := db.CreateProject("coverage-v6")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	for _, ip := range []string{"2001:db8::1", "2001:db8::ffff:1", "2001:db8:0:1::1", "10.1.1.5"} {
+		if _, err := db.UpsertHost(Host{ProjectID: project.ID, IPAddress: ip, InScope: true}); err != nil {
+			t.Fatalf("upsert host %s: %v", ip, err)
+		}
+	}
+
+	matrix, err := db.GetCoverageMatrix(project.ID, CoverageMatrixOptions{MissingPreviewSize: 5})
+	if err != nil {
+		t.Fatalf("get coverage matrix: %v", err)
+	}
+	rows := matrixSegmentsByKey(matrix.Segments)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 fallback segments, got %d", len(rows))
+	}
+	if row, ok := rows["fallback:2001:db8::/64"]; !ok || row.HostTotal != 2 {
+		t.Fatalf("expected 2 hosts in 2001:db8::/64, got %+v (present=%v)", row, ok)
+	}
+	if row, ok := rows["fallback:2001:db8:0:1::/64"]; !ok || row.HostTotal != 1 {
+		t.Fatalf("expected 1 host in 2001:db8:0:1::/64, got %+v (present=%v)", row, ok)
+	}
+	if _, ok := rows["fallback:10.1.1.0/24"]; !ok {
+		t.Fatalf("expected ipv4 /24 fallback segment alongside ipv6 segments")
+	}
+}
+
 func insertCoverageImport(db *DB, projectID int64, filename, intent string, hosts []HostObservation) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -54,6 +57,94 @@ func TestProjectCRUD(t *testing.T) {
 	}
 }
 
+func TestProjectArchiveAndClone(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	source, err := db.CreateProject("Q1 external")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, err := db.BulkAddScopeDefinitions(source.ID, []string{"10.0.0.0/24", "web.example.com"}, "include"); err != nil {
+		t.Fatalf("add scope: %v", err)
+	}
+	if _, err := db.BulkAddScopeDefinitions(source.ID, []string{"10.0.0.5"}, "exclude"); err != nil {
+		t.Fatalf("add exclude: %v", err)
+	}
+	if _, _, err := db.BulkAddExpectedAssetBaselines(source.ID, []string{"10.0.0.1", "10.0.0.0/30"}); err != nil {
+		t.Fatalf("add baseline: %v", err)
+	}
+	if _, err := db.UpsertHost(Host{ProjectID: source.ID, IPAddress: "10.0.0.1", InScope: true}); err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+
+	archived, err := db.SetProjectArchived(source.ID, true)
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if !archived.Archived() {
+		t.Fatalf("expected project to be archived: %+v", archived)
+	}
+	got, _, err := db.GetProjectByID(source.ID)
+	if err != nil || !got.Archived() {
+		t.Fatalf("expected stored archive time, got %+v (%v)", got, err)
+	}
+	if err := db.UpdateProject(source.ID, "renamed"); !errors.Is(err, ErrProjectArchived) {
+		t.Fatalf("expected ErrProjectArchived renaming an archived project, got %v", err)
+	}
+
+	// Archived projects can still be cloned for a retest.
+	clone, err := db.CloneProject(source.ID, "Q2 external")
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if clone.Name != "Q2 external" || clone.Archived() {
+		t.Fatalf("unexpected clone: %+v", clone)
+	}
+	rules, err := db.ListScopeDefinitions(clone.ID)
+	if err != nil {
+		t.Fatalf("list clone scope: %v", err)
+	}
+	var defs []string
+	for _, rule := range rules {
+		defs = append(defs, rule.Type+" "+rule.Definition)
+	}
+	if want := []string{"include 10.0.0.0/24", "include web.example.com", "exclude 10.0.0.5"}; !reflect.DeepEqual(defs, want) {
+		t.Fatalf("clone scope = %q, want %q", defs, want)
+	}
+	versions, err := db.ListScopeVersions(clone.ID)
+	if err != nil {
+		t.Fatalf("list scope versions: %v", err)
+	}
+	if len(versions) != 1 || len(versions[0].Rules) != 3 {
+		t.Fatalf("expected the copied rules as one scope version, got %+v", versions)
+	}
+	baseline, err := db.ListExpectedAssetBaselines(clone.ID)
+	if err != nil {
+		t.Fatalf("list clone baseline: %v", err)
+	}
+	if len(baseline) != 2 {
+		t.Fatalf("expected 2 baseline definitions, got %+v", baseline)
+	}
+	hosts, err := db.ListHosts(clone.ID)
+	if err != nil {
+		t.Fatalf("list clone hosts: %v", err)
+	}
+	if len(hosts) != 0 {
+		t.Fatalf("clone must not copy hosts, got %d", len(hosts))
+	}
+
+	if _, err := db.SetProjectArchived(source.ID, false); err != nil {
+		t.Fatalf("unarchive: %v", err)
+	}
+	if err := db.UpdateProject(source.ID, "Q1 external (done)"); err != nil {
+		t.Fatalf("rename after unarchive: %v", err)
+	}
+	if _, err := db.SetProjectArchived(9999, true); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing project, got %v", err)
+	}
+}
+
 func TestScopeCRUD(t *testing.T) {
 	db := newTestDB(t)
 	defer db.Close()
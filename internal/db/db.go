@@ -5,6 +5,7 @@ import (
 	"embed"
 	"fmt"
 	"io/fs"
+	"os"
 	"sort"
 	"strings"
 
@@ -17,12 +18,35 @@ var migrationFiles embed.FS
 // DB wraps sql.DB for future expansion.
 type DB struct {
 	*sql.DB
+	actor string
+	// artifactDir holds original scan files when it exists; see
+	// ArtifactDirFor.
+	artifactDir string
+}
+
+// WithActor returns a handle on the same database whose changes are
+// attributed to actor in the audit log and scope history. Both handles share
+// one connection pool, so closing either closes both.
+func (db *DB) WithActor(actor string) *DB {
+	return &DB{DB: db.DB, actor: actor, artifactDir: db.artifactDir}
+}
+
+// Actor reports who changes made through this handle are attributed to.
+func (db *DB) Actor() string {
+	return db.actor
 }
 
 // Open opens (or creates) a SQLite database at the given path, enables WAL and
-// foreign keys, and runs embedded migrations in order.
+// foreign keys, and runs embedded migrations in order. Original scan files are
+// stored in ArtifactDirFor(path) when that directory exists, else in the
+// database.
 func Open(path string) (*DB, error) {
-	dsn := fmt.Sprintf("file:%s", path)
+	// The pragmas in the DSN apply to every pooled connection; background
+	// import workers write on connections other than the first. Transactions
+	// take the write lock at BEGIN so two writers queue on busy_timeout
+	// instead of one failing with SQLITE_BUSY when it upgrades from a read;
+	// BeginRead starts a transaction that only reads.
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate", path)
 
 	sqlDB, err := sql.Open("sqlite", dsn)
 	if err != nil {
@@ -59,7 +83,21 @@ func Open(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{sqlDB}, nil
+	if err := ensureHostIPKeyIndex(sqlDB); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	if err := backfillHostIPKey(sqlDB); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	database := &DB{DB: sqlDB}
+	if info, err := os.Stat(ArtifactDirFor(path)); err == nil && info.IsDir() {
+		database.artifactDir = ArtifactDirFor(path)
+	}
+	return database, nil
 }
 
 func runMigrations(sqlDB *sql.DB) error {
@@ -177,6 +215,80 @@ func ensureHostIPIntIndex(sqlDB *sql.DB) error {
 	return nil
 }
 
+func backfillHostIPKey(sqlDB *sql.DB) error {
+	exists, err := columnExists(sqlDB, "host", "ip_key")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := sqlDB.Query(`SELECT id, ip_address FROM host WHERE ip_key IS NULL`)
+	if err != nil {
+		return fmt.Errorf("backfill ip_key select: %w", err)
+	}
+	defer rows.Close()
+
+	type update struct {
+		id  int64
+		key []byte
+	}
+	var updates []update
+	for rows.Next() {
+		var id int64
+		var ip string
+		if err := rows.Scan(&id, &ip); err != nil {
+			return fmt.Errorf("backfill ip_key scan: %w", err)
+		}
+		if key, ok := ipKey(ip); ok {
+			updates = append(updates, update{id: id, key: key})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("backfill ip_key rows: %w", err)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return fmt.Errorf("backfill ip_key begin: %w", err)
+	}
+	stmt, err := tx.Prepare(`UPDATE host SET ip_key = ? WHERE id = ?`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("backfill ip_key prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, upd := range updates {
+		if _, err := stmt.Exec(upd.key, upd.id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("backfill ip_key update: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("backfill ip_key commit: %w", err)
+	}
+	return nil
+}
+
+func ensureHostIPKeyIndex(sqlDB *sql.DB) error {
+	exists, err := columnExists(sqlDB, "host", "ip_key")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if _, err := sqlDB.Exec(`CREATE INDEX IF NOT EXISTS idx_host_ip_key ON host(project_id, ip_key)`); err != nil {
+		return fmt.Errorf("create ip_key index: %w", err)
+	}
+	return nil
+}
+
 func columnExists(sqlDB *sql.DB, table, column string) (bool, error) {
 	rows, err := sqlDB.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
 	if err != nil {
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math/rand"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -209,6 +212,61 @@ func TestMigrationsConvertParkingLotToFlagged(t *testing.T) {
 
 // Helpers
 
+func TestScanArtifactKeptInChunks(t *testing.T) {
+	db, err := Open(filepath.Join(testutil.TempDir(t), "artifact.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	// Random bytes do not compress, so the stored file spans several chunks.
+	raw := make([]byte, 5*artifactChunkSize/2)
+	rand.New(rand.NewSource(1)).Read(raw)
+	w, err := db.NewScanArtifactWriter()
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	defer w.Close()
+	if _, err := w.Write(raw); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	artifact, err := tx.StoreScanArtifact(w)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	var chunks int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM scan_artifact_chunk WHERE sha256 = ?`, artifact.SHA256).Scan(&chunks); err != nil {
+		t.Fatalf("count chunks: %v", err)
+	}
+	if chunks != 3 {
+		t.Fatalf("expected 3 chunks, got %d", chunks)
+	}
+	r, err := db.ReadScanArtifact(artifact)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("read back %d bytes (%v), want %d", len(got), err, len(raw))
+	}
+
+	if removed, err := db.PruneScanArtifacts(); err != nil || removed != 1 {
+		t.Fatalf("prune = %d, %v", removed, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM scan_artifact_chunk`).Scan(&chunks); err != nil || chunks != 0 {
+		t.Fatalf("expected chunks pruned, got %d (%v)", chunks, err)
+	}
+}
+
 func mustListStrings(t *testing.T, db *DB, query string) map[string]struct{} {
 	t.Helper()
 	rows, err := db.Query(query)
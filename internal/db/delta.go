@@ -23,6 +23,9 @@ type DeltaImportRef struct {
 	ID         int64     `json:"id"`
 	Filename   string    `json:"filename"`
 	ImportTime time.Time `json:"import_time"`
+	// ScanTime is when the scan ran according to the scanner, falling back
+	// to ImportTime.
+	ScanTime time.Time `json:"scan_time"`
 }
 
 // ImportDeltaSummary captures aggregate change counts.
@@ -210,11 +213,13 @@ func (db *DB) GetImportDelta(projectID, baseImportID, targetImportID int64, opts
 			ID:         baseImport.ID,
 			Filename:   baseImport.Filename,
 			ImportTime: baseImport.ImportTime,
+			ScanTime:   baseImport.ScanTime(),
 		},
 		TargetImport: DeltaImportRef{
 			ID:         targetImport.ID,
 			Filename:   targetImport.Filename,
 			ImportTime: targetImport.ImportTime,
+			ScanTime:   targetImport.ScanTime(),
 		},
 		Summary: ImportDeltaSummary{
 			NetNewHosts:                len(netNewHosts),
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HostHistoryEntry is one completed import's observation of a host, with the
+// ports it reported and the import's own times.
+type HostHistoryEntry struct {
+	Import      ScanImport
+	Observation HostObservation
+	Ports       []PortObservation
+}
+
+// ObservedAt returns when the scanner saw the host: its own end or start time,
+// else the run's start or finish time, else the import time.
+func (e HostHistoryEntry) ObservedAt() time.Time {
+	switch {
+	case e.Observation.ScanEndedAt != nil:
+		return *e.Observation.ScanEndedAt
+	case e.Observation.ScanStartedAt != nil:
+		return *e.Observation.ScanStartedAt
+	}
+	return e.Import.ScanTime()
+}
+
+// ListHostHistory returns every completed observation of a host IP in a
+// project, oldest scan first. Ties are broken by import id so replaying the
+// history is deterministic.
+func (tx *Tx) ListHostHistory(projectID int64, ip string) ([]HostHistoryEntry, error) {
+	rows, err := tx.Query(
+		`SELECT si.id, si.filename, si.import_time, si.nmap_args, si.scanner_type, si.scan_started_at, si.scan_finished_at,
+		        ho.id, ho.hostname, ho.os_guess, ho.mac_address, ho.mac_vendor, ho.in_scope, ho.host_state, ho.scan_started_at, ho.scan_ended_at
+		   FROM host_observation ho
+		   JOIN scan_import si ON si.id = ho.scan_import_id
+		  WHERE ho.project_id = ? AND ho.ip_address = ? AND si.status = ?
+		  ORDER BY COALESCE(ho.scan_ended_at, ho.scan_started_at, `+scanImportTimeSQL+`), si.id`,
+		projectID, ip, ScanImportStatusComplete,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list host history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HostHistoryEntry
+	byImport := make(map[int64]int)
+	for rows.Next() {
+		var e HostHistoryEntry
+		var importStarted, importFinished, hostStarted, hostEnded sql.NullTime
+		if err := rows.Scan(
+			&e.Import.ID, &e.Import.Filename, &e.Import.ImportTime, &e.Import.NmapArgs, &e.Import.ScannerType, &importStarted, &importFinished,
+			&e.Observation.ID, &e.Observation.Hostname, &e.Observation.OSGuess, &e.Observation.MACAddress, &e.Observation.MACVendor,
+			&e.Observation.InScope, &e.Observation.HostState, &hostStarted, &hostEnded,
+		); err != nil {
+			return nil, fmt.Errorf("scan host history: %w", err)
+		}
+		e.Import.ProjectID = projectID
+		e.Import.Status = ScanImportStatusComplete
+		e.Import.ScanStartedAt = ptrTimeFromNull(importStarted)
+		e.Import.ScanFinishedAt = ptrTimeFromNull(importFinished)
+		e.Observation.ScanImportID = e.Import.ID
+		e.Observation.ProjectID = projectID
+		e.Observation.IPAddress = ip
+		e.Observation.ScanStartedAt = ptrTimeFromNull(hostStarted)
+		e.Observation.ScanEndedAt = ptrTimeFromNull(hostEnded)
+		byImport[e.Import.ID] = len(entries)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list host history rows: %w", err)
+	}
+	rows.Close()
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	portRows, err := tx.Query(
+		`SELECT id, scan_import_id, port_number, protocol, state, service, version, product, extra_info, script_output, created_at
+		   FROM port_observation
+		  WHERE project_id = ? AND ip_address = ?
+		  ORDER BY scan_import_id, port_number, protocol`,
+		projectID, ip,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list host port history: %w", err)
+	}
+	defer portRows.Close()
+	for portRows.Next() {
+		obs := PortObservation{ProjectID: projectID, IPAddress: ip}
+		if err := portRows.Scan(
+			&obs.ID, &obs.ScanImportID, &obs.PortNumber, &obs.Protocol, &obs.State,
+			&obs.Service, &obs.Version, &obs.Product, &obs.ExtraInfo, &obs.ScriptOutput, &obs.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan host port history: %w", err)
+		}
+		// Ports of staging imports have no entry and are skipped.
+		if i, ok := byImport[obs.ScanImportID]; ok {
+			entries[i].Ports = append(entries[i].Ports, obs)
+		}
+	}
+	if err := portRows.Err(); err != nil {
+		return nil, fmt.Errorf("list host port history rows: %w", err)
+	}
+	return entries, nil
+}
+
+// ListHostIPs returns the IP of every current host in a project.
+func (tx *Tx) ListHostIPs(projectID int64) ([]string, error) {
+	rows, err := tx.Query(`SELECT ip_address FROM host WHERE project_id = ? ORDER BY ip_address`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("list host ips: %w", err)
+	}
+	defer rows.Close()
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("scan host ip: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list host ips rows: %w", err)
+	}
+	return ips, nil
+}
+
+// analystPortSQL matches ports an analyst has worked on; pruning keeps them.
+const analystPortSQL = `(COALESCE(notes, '') != '' OR work_status != 'scanned')`
+
+// PruneHostPorts deletes the ports of a host whose ids are not in keep,
+// except ports an analyst has annotated or moved past "scanned". It returns
+// how many were deleted.
+func (tx *Tx) PruneHostPorts(hostID int64, keep []int64) (int64, error) {
+	query := `DELETE FROM port WHERE host_id = ? AND NOT ` + analystPortSQL
+	args := []any{hostID}
+	if len(keep) > 0 {
+		query += ` AND id NOT IN (` + strings.TrimSuffix(strings.Repeat("?,", len(keep)), ",") + `)`
+		for _, id := range keep {
+			args = append(args, id)
+		}
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("prune host ports: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune host ports rows: %w", err)
+	}
+	return affected, nil
+}
+
+// PruneHost deletes a host that has no ports and no notes left, reporting
+// whether it did.
+func (tx *Tx) PruneHost(hostID int64) (bool, error) {
+	res, err := tx.Exec(
+		`DELETE FROM host
+		  WHERE id = ? AND COALESCE(notes, '') = ''
+		    AND NOT EXISTS (SELECT 1 FROM port WHERE port.host_id = host.id)`,
+		hostID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("prune host: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("prune host rows: %w", err)
+	}
+	return affected > 0, nil
+}
@@ -20,19 +20,26 @@ func (db *DB) UpsertHost(h Host) (Host, error) {
 	if value, ok := ipv4ToInt(h.IPAddress); ok {
 		ipInt = value
 	}
+	var key any
+	if value, ok := ipKey(h.IPAddress); ok {
+		key = value
+	}
 	err := db.QueryRow(
-		`INSERT INTO host (project_id, ip_address, hostname, os_guess, in_scope, notes, ip_int)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		`INSERT INTO host (project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, notes, ip_int, ip_key)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(project_id, ip_address) DO UPDATE SET
 		   hostname=excluded.hostname,
 		   os_guess=excluded.os_guess,
+		   mac_address=excluded.mac_address,
+		   mac_vendor=excluded.mac_vendor,
 		   in_scope=excluded.in_scope,
 		   notes=excluded.notes,
 		   ip_int=excluded.ip_int,
+		   ip_key=excluded.ip_key,
 		   updated_at=CURRENT_TIMESTAMP
-		 RETURNING id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at`,
-		h.ProjectID, h.IPAddress, h.Hostname, h.OSGuess, h.InScope, h.Notes, ipInt,
-	).Scan(&out.ID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.OSGuess, &out.LatestScan, &out.InScope, &out.Notes, &out.CreatedAt, &out.UpdatedAt)
+		 RETURNING id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at`,
+		h.ProjectID, h.IPAddress, h.Hostname, h.OSGuess, h.MACAddress, h.MACVendor, h.InScope, h.Notes, ipInt, key,
+	).Scan(&out.ID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.OSGuess, &out.MACAddress, &out.MACVendor, &out.LatestScan, &out.InScope, &out.Notes, &out.CreatedAt, &out.UpdatedAt)
 	if err != nil {
 		return Host{}, fmt.Errorf("upsert host: %w", err)
 	}
@@ -43,10 +50,10 @@ func (db *DB) UpsertHost(h Host) (Host, error) {
 func (db *DB) GetHostByIP(projectID int64, ip string) (Host, bool, error) {
 	var h Host
 	err := db.QueryRow(
-		`SELECT id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at
+		`SELECT id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at
 		 FROM host WHERE project_id = ? AND ip_address = ?`,
 		projectID, ip,
-	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
+	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.MACAddress, &h.MACVendor, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Host{}, false, nil
@@ -60,10 +67,10 @@ func (db *DB) GetHostByIP(projectID int64, ip string) (Host, bool, error) {
 func (db *DB) GetHostByID(id int64) (Host, bool, error) {
 	var h Host
 	err := db.QueryRow(
-		`SELECT id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at
+		`SELECT id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at
 		 FROM host WHERE id = ?`,
 		id,
-	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
+	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.MACAddress, &h.MACVendor, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Host{}, false, nil
@@ -76,7 +83,7 @@ func (db *DB) GetHostByID(id int64) (Host, bool, error) {
 // ListHosts returns hosts for a project ordered by ip_address.
 func (db *DB) ListHosts(projectID int64) ([]Host, error) {
 	rows, err := db.Query(
-		`SELECT id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at
+		`SELECT id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at
 		 FROM host WHERE project_id = ? ORDER BY ip_address`,
 		projectID,
 	)
@@ -88,7 +95,7 @@ func (db *DB) ListHosts(projectID int64) ([]Host, error) {
 	var hosts []Host
 	for rows.Next() {
 		var h Host
-		if err := rows.Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		if err := rows.Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.MACAddress, &h.MACVendor, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan host: %w", err)
 		}
 		hosts = append(hosts, h)
@@ -101,32 +108,87 @@ func (db *DB) ListHosts(projectID int64) ([]Host, error) {
 
 // DeleteHost removes a host by ID.
 func (db *DB) DeleteHost(id int64) error {
-	res, err := db.Exec(`DELETE FROM host WHERE id = ?`, id)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete host: %w", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	host, found, err := tx.getHostByID(id)
+	if err != nil {
+		return err
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
+	if !found {
 		return sql.ErrNoRows
 	}
-	return nil
+	if _, err := tx.Exec(`DELETE FROM host WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete host: %w", err)
+	}
+	if err := tx.audit(hostAuditEvent(host, AuditHostDelete), host, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // UpdateHostNotes updates the notes for a host.
 func (db *DB) UpdateHostNotes(id int64, notes string) error {
-	_, err := db.Exec(`UPDATE host SET notes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, notes, id)
-	if err != nil {
-		return fmt.Errorf("update host notes: %w", err)
-	}
-	return nil
+	return db.updateHostField(id, AuditHostNotes, "notes", notes, func(h Host) any { return h.Notes })
 }
 
 // UpdateHostScope updates the in_scope status for a host.
 func (db *DB) UpdateHostScope(id int64, inScope bool) error {
-	_, err := db.Exec(`UPDATE host SET in_scope = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, inScope, id)
+	return db.updateHostField(id, AuditHostScope, "in_scope", inScope, func(h Host) any { return h.InScope })
+}
+
+// updateHostField sets one host column and audits the old and new values.
+// Unknown hosts are a no-op, matching the plain UPDATE it replaces.
+func (db *DB) updateHostField(id int64, action, column string, value any, current func(Host) any) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("update host scope: %w", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	host, found, err := tx.getHostByID(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE host SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, value, id); err != nil {
+		return fmt.Errorf("update host %s: %w", strings.ReplaceAll(column, "_", " "), err)
+	}
+	if err := tx.audit(hostAuditEvent(host, action), map[string]any{column: current(host)}, map[string]any{column: value}); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+func hostAuditEvent(h Host, action string) AuditEvent {
+	return AuditEvent{
+		ProjectID:  h.ProjectID,
+		HostID:     int64Ptr(h.ID),
+		Action:     action,
+		EntityType: AuditEntityHost,
+		EntityID:   h.ID,
+	}
+}
+
+func (tx *Tx) getHostByID(id int64) (Host, bool, error) {
+	var h Host
+	err := tx.QueryRow(
+		`SELECT id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at
+		 FROM host WHERE id = ?`,
+		id,
+	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.MACAddress, &h.MACVendor, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Host{}, false, nil
+		}
+		return Host{}, false, fmt.Errorf("get host: %w", err)
+	}
+	return h, true, nil
 }
 
 // ValidHostLatestScan reports whether latest_scan uses a supported value.
@@ -151,11 +213,7 @@ func (db *DB) UpdateHostLatestScan(id int64, value string) error {
 		return fmt.Errorf("invalid latest scan")
 	}
 
-	_, err := db.Exec(`UPDATE host SET latest_scan = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, normalized, id)
-	if err != nil {
-		return fmt.Errorf("update host latest scan: %w", err)
-	}
-	return nil
+	return db.updateHostField(id, AuditHostLatestScan, "latest_scan", normalized, func(h Host) any { return h.LatestScan })
 }
 
 func normalizeHostLatestScan(value string) string {
@@ -27,7 +27,7 @@ type hostListQuery struct {
 }
 
 // ListHostsWithSummary returns hosts with aggregated port counts for list view.
-func (db *DB) ListHostsWithSummary(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd *int64) ([]HostListItem, error) {
+func (db *DB) ListHostsWithSummary(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd []byte) ([]HostListItem, error) {
 	query, err := buildHostListQuery(projectID, inScope, statusFilters, sortBy, sortDir, subnetStart, subnetEnd)
 	if err != nil {
 		return nil, err
@@ -36,7 +36,7 @@ func (db *DB) ListHostsWithSummary(projectID int64, inScope *bool, statusFilters
 }
 
 // ListHostsWithSummaryPaged returns hosts with aggregated port counts and total count.
-func (db *DB) ListHostsWithSummaryPaged(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd *int64, limit, offset int) ([]HostListItem, int, error) {
+func (db *DB) ListHostsWithSummaryPaged(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd []byte, limit, offset int) ([]HostListItem, int, error) {
 	query, err := buildHostListQuery(projectID, inScope, statusFilters, sortBy, sortDir, subnetStart, subnetEnd)
 	if err != nil {
 		return nil, 0, err
@@ -52,7 +52,7 @@ func (db *DB) ListHostsWithSummaryPaged(projectID int64, inScope *bool, statusFi
 	return items, total, nil
 }
 
-func buildHostListQuery(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd *int64) (hostListQuery, error) {
+func buildHostListQuery(projectID int64, inScope *bool, statusFilters []string, sortBy, sortDir string, subnetStart, subnetEnd []byte) (hostListQuery, error) {
 	var where []string
 	var args []any
 
@@ -69,18 +69,18 @@ func buildHostListQuery(projectID int64, inScope *bool, statusFilters []string,
 	}
 
 	if subnetStart != nil && subnetEnd != nil {
-		where = append(where, "h.ip_int BETWEEN ? AND ?")
-		args = append(args, *subnetStart, *subnetEnd)
+		where = append(where, "h.ip_key BETWEEN ? AND ?")
+		args = append(args, subnetStart, subnetEnd)
 	}
 
-	orderBy := "h.ip_address"
+	orderBy := "h.ip_key"
 	switch sortBy {
 	case "hostname":
 		orderBy = "h.hostname"
 	case "ports":
 		orderBy = "port_count"
 	case "ip", "":
-		orderBy = "h.ip_address"
+		orderBy = "h.ip_key"
 	default:
 		return hostListQuery{}, fmt.Errorf("invalid sort column")
 	}
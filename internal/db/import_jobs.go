@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Import job states. A job is queued when the upload is spooled, parsing
+// while hosts are read and staged, writing while staged hosts are merged into
+// current state, and ends done or failed.
+const (
+	ImportJobQueued  = "queued"
+	ImportJobParsing = "parsing"
+	ImportJobWriting = "writing"
+	ImportJobDone    = "done"
+	ImportJobFailed  = "failed"
+)
+
+// ImportJob is a background import of a spooled upload.
+type ImportJob struct {
+	ID             int64  `json:"id"`
+	ProjectID      int64  `json:"project_id"`
+	Filename       string `json:"filename"`
+	SpoolPath      string `json:"-"`
+	Options        string `json:"-"`
+	Status         string `json:"status"`
+	HostsProcessed int    `json:"hosts_processed"`
+	PortsProcessed int    `json:"ports_processed"`
+	HostsInScope   int    `json:"hosts_in_scope"`
+	HostsOutScope  int    `json:"hosts_out_scope"`
+	HostsSkipped   int    `json:"hosts_skipped"`
+	ScanImportID   *int64 `json:"scan_import_id"`
+	// MACChanges is the JSON list of known hosts whose MAC address changed,
+	// in the same shape as the synchronous import response.
+	MACChanges json.RawMessage `json:"mac_changes"`
+	Error      string          `json:"error,omitempty"`
+	// DuplicateOf is the existing import a failed job duplicated.
+	DuplicateOf *int64     `json:"duplicate_of"`
+	Actor       string     `json:"actor"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// ImportJobResult records the outcome counts of a finished job.
+type ImportJobResult struct {
+	ScanImportID  int64
+	Hosts         int
+	Ports         int
+	HostsInScope  int
+	HostsOutScope int
+	HostsSkipped  int
+	MACChanges    string
+}
+
+const importJobColumns = `id, project_id, filename, spool_path, options, status, hosts_processed, ports_processed,
+	hosts_in_scope, hosts_out_scope, hosts_skipped, scan_import_id, mac_changes, error, duplicate_of, actor, created_at, started_at, finished_at`
+
+// CreateImportJob queues an import of a spooled file, attributed to the
+// handle's actor.
+func (db *DB) CreateImportJob(projectID int64, filename, spoolPath, options string) (ImportJob, error) {
+	row := db.QueryRow(
+		`INSERT INTO import_job (project_id, filename, spool_path, options, actor) VALUES (?, ?, ?, ?, ?)
+		 RETURNING `+importJobColumns,
+		projectID, filename, spoolPath, options, db.actor,
+	)
+	job, err := scanImportJob(row)
+	if err != nil {
+		return ImportJob{}, fmt.Errorf("insert import_job: %w", err)
+	}
+	return job, nil
+}
+
+// GetImportJob returns one job of a project.
+func (db *DB) GetImportJob(projectID, jobID int64) (ImportJob, bool, error) {
+	row := db.QueryRow(`SELECT `+importJobColumns+` FROM import_job WHERE project_id = ? AND id = ?`, projectID, jobID)
+	job, err := scanImportJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ImportJob{}, false, nil
+		}
+		return ImportJob{}, false, fmt.Errorf("get import_job: %w", err)
+	}
+	return job, true, nil
+}
+
+// ListImportJobs returns a project's jobs, newest first.
+func (db *DB) ListImportJobs(projectID int64, limit int) ([]ImportJob, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := db.Query(
+		`SELECT `+importJobColumns+` FROM import_job WHERE project_id = ? ORDER BY id DESC LIMIT ?`,
+		projectID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list import_job: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ImportJob
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan import_job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimNextImportJob moves the oldest queued job to parsing and returns it.
+// It reports false when nothing is queued. Claims are atomic, so concurrent
+// workers never pick the same job.
+func (db *DB) ClaimNextImportJob() (ImportJob, bool, error) {
+	row := db.QueryRow(
+		`UPDATE import_job SET status = ?, started_at = ?
+		  WHERE id = (SELECT id FROM import_job WHERE status = ? ORDER BY id LIMIT 1) AND status = ?
+		 RETURNING `+importJobColumns,
+		ImportJobParsing, time.Now().UTC().Format("2006-01-02 15:04:05"), ImportJobQueued, ImportJobQueued,
+	)
+	job, err := scanImportJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ImportJob{}, false, nil
+		}
+		return ImportJob{}, false, fmt.Errorf("claim import_job: %w", err)
+	}
+	return job, true, nil
+}
+
+// UpdateImportJobProgress records the phase and running counts of a job.
+func (db *DB) UpdateImportJobProgress(jobID int64, status string, hosts, ports int) error {
+	if _, err := db.Exec(
+		`UPDATE import_job SET status = ?, hosts_processed = ?, ports_processed = ? WHERE id = ?`,
+		status, hosts, ports, jobID,
+	); err != nil {
+		return fmt.Errorf("update import_job progress: %w", err)
+	}
+	return nil
+}
+
+// FinishImportJob marks a job done with its import and final counts.
+func (db *DB) FinishImportJob(jobID int64, result ImportJobResult) error {
+	macChanges := result.MACChanges
+	if macChanges == "" {
+		macChanges = "[]"
+	}
+	var scanImportID interface{}
+	if result.ScanImportID != 0 {
+		scanImportID = result.ScanImportID
+	}
+	if _, err := db.Exec(
+		`UPDATE import_job
+		    SET status = ?, scan_import_id = ?, hosts_processed = ?, ports_processed = ?,
+		        hosts_in_scope = ?, hosts_out_scope = ?, hosts_skipped = ?, mac_changes = ?, finished_at = ?
+		  WHERE id = ?`,
+		ImportJobDone, scanImportID, result.Hosts, result.Ports,
+		result.HostsInScope, result.HostsOutScope, result.HostsSkipped, macChanges,
+		time.Now().UTC().Format("2006-01-02 15:04:05"), jobID,
+	); err != nil {
+		return fmt.Errorf("finish import_job: %w", err)
+	}
+	return nil
+}
+
+// FailImportJob marks a job failed with the error that stopped it.
+func (db *DB) FailImportJob(jobID int64, cause error) error {
+	if _, err := db.Exec(
+		`UPDATE import_job SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+		ImportJobFailed, cause.Error(), time.Now().UTC().Format("2006-01-02 15:04:05"), jobID,
+	); err != nil {
+		return fmt.Errorf("fail import_job: %w", err)
+	}
+	return nil
+}
+
+// FailDuplicateImportJob marks a job failed because its file was already
+// imported as existingID.
+func (db *DB) FailDuplicateImportJob(jobID, existingID int64, cause error) error {
+	if _, err := db.Exec(
+		`UPDATE import_job SET status = ?, error = ?, duplicate_of = ?, finished_at = ? WHERE id = ?`,
+		ImportJobFailed, cause.Error(), existingID, time.Now().UTC().Format("2006-01-02 15:04:05"), jobID,
+	); err != nil {
+		return fmt.Errorf("fail import_job: %w", err)
+	}
+	return nil
+}
+
+// RequeueInterruptedImportJobs puts jobs a stopped server left in parsing or
+// writing back in the queue. Their partial staged import was never
+// published, so running them again is safe.
+func (db *DB) RequeueInterruptedImportJobs() (int64, error) {
+	res, err := db.Exec(
+		`UPDATE import_job SET status = ?, hosts_processed = 0, ports_processed = 0, started_at = NULL
+		  WHERE status IN (?, ?)`,
+		ImportJobQueued, ImportJobParsing, ImportJobWriting,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("requeue import_job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("requeue import_job rows: %w", err)
+	}
+	return affected, nil
+}
+
+func scanImportJob(row interface{ Scan(...any) error }) (ImportJob, error) {
+	var job ImportJob
+	var scanImportID, duplicateOf sql.NullInt64
+	var macChanges string
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(
+		&job.ID, &job.ProjectID, &job.Filename, &job.SpoolPath, &job.Options, &job.Status,
+		&job.HostsProcessed, &job.PortsProcessed, &job.HostsInScope, &job.HostsOutScope, &job.HostsSkipped,
+		&scanImportID, &macChanges, &job.Error, &duplicateOf, &job.Actor, &job.CreatedAt, &startedAt, &finishedAt,
+	); err != nil {
+		return ImportJob{}, err
+	}
+	if scanImportID.Valid {
+		job.ScanImportID = &scanImportID.Int64
+	}
+	if duplicateOf.Valid {
+		job.DuplicateOf = &duplicateOf.Int64
+	}
+	job.MACChanges = json.RawMessage(macChanges)
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
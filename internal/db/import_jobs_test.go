@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestImportJobLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	p, err := db.CreateProject("jobs")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	first, err := db.WithActor("alice").CreateImportJob(p.ID, "a.xml", "/spool/a", "{}")
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	if first.Status != ImportJobQueued || first.Actor != "alice" || first.StartedAt != nil {
+		t.Fatalf("unexpected new job: %+v", first)
+	}
+	second, err := db.CreateImportJob(p.ID, "b.xml", "/spool/b", "{}")
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+
+	claimed, found, err := db.ClaimNextImportJob()
+	if err != nil || !found || claimed.ID != first.ID || claimed.Status != ImportJobParsing || claimed.StartedAt == nil {
+		t.Fatalf("claim: %+v found=%v err=%v", claimed, found, err)
+	}
+	if err := db.UpdateImportJobProgress(claimed.ID, ImportJobWriting, 10, 30); err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	imported, err := db.InsertScanImport(ScanImport{ProjectID: p.ID, Filename: "a.xml"})
+	if err != nil {
+		t.Fatalf("insert import: %v", err)
+	}
+	if err := db.FinishImportJob(claimed.ID, ImportJobResult{ScanImportID: imported.ID, Hosts: 12, Ports: 31, HostsInScope: 11, HostsOutScope: 1}); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	done, _, err := db.GetImportJob(p.ID, claimed.ID)
+	if err != nil || done.Status != ImportJobDone || done.HostsProcessed != 12 || done.FinishedAt == nil || done.ScanImportID == nil || *done.ScanImportID != imported.ID || string(done.MACChanges) != "[]" {
+		t.Fatalf("finished job: %+v %v", done, err)
+	}
+
+	// A server that stops mid-import leaves the job running; restarting puts
+	// it back in the queue.
+	if _, _, err := db.ClaimNextImportJob(); err != nil {
+		t.Fatalf("claim second: %v", err)
+	}
+	if n, err := db.RequeueInterruptedImportJobs(); err != nil || n != 1 {
+		t.Fatalf("requeue: n=%d err=%v", n, err)
+	}
+	again, found, err := db.ClaimNextImportJob()
+	if err != nil || !found || again.ID != second.ID {
+		t.Fatalf("reclaim: %+v found=%v err=%v", again, found, err)
+	}
+	if err := db.FailImportJob(again.ID, errors.New("bad file")); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if _, found, err := db.ClaimNextImportJob(); err != nil || found {
+		t.Fatalf("expected empty queue: found=%v err=%v", found, err)
+	}
+
+	jobs, err := db.ListImportJobs(p.ID, 0)
+	if err != nil || len(jobs) != 2 || jobs[0].ID != second.ID || jobs[0].Status != ImportJobFailed || jobs[0].Error != "bad file" {
+		t.Fatalf("list jobs: %+v %v", jobs, err)
+	}
+	if _, found, err := db.GetImportJob(p.ID+1, first.ID); err != nil || found {
+		t.Fatalf("expected job to be scoped to its project: found=%v err=%v", found, err)
+	}
+}
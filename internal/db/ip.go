@@ -1,6 +1,9 @@
 package db
 
-import "net/netip"
+import (
+	"bytes"
+	"net/netip"
+)
 
 func ipv4ToInt(ip string) (int64, bool) {
 	addr, err := netip.ParseAddr(ip)
@@ -11,3 +14,39 @@ func ipv4ToInt(ip string) (int64, bool) {
 	value := uint32(octets[0])<<24 | uint32(octets[1])<<16 | uint32(octets[2])<<8 | uint32(octets[3])
 	return int64(value), true
 }
+
+// ipKey returns the sortable 128-bit key stored in host.ip_key. IPv4
+// addresses use their IPv4-mapped form, so they sort together ahead of
+// global IPv6 space and a byte-wise BETWEEN matches numeric order.
+func ipKey(ip string) ([]byte, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, false
+	}
+	return addrKey(addr), true
+}
+
+func addrKey(addr netip.Addr) []byte {
+	key := addr.WithZone("").As16()
+	return key[:]
+}
+
+// PrefixKeyRange returns the inclusive ip_key bounds covered by prefix, for
+// use as the subnet filter of ListHostsWithSummaryPaged.
+func PrefixKeyRange(prefix netip.Prefix) ([]byte, []byte) {
+	prefix = prefix.Masked()
+	start := addrKey(prefix.Addr())
+	end := bytes.Clone(start)
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	for i := len(end) - 1; i >= 0 && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			end[i] = 0xff
+			hostBits -= 8
+			continue
+		}
+		end[i] |= byte(1<<hostBits) - 1
+		hostBits = 0
+	}
+	return start, end
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestPrefixKeyRange(t *testing.T) {
+	tests := []struct {
+		prefix string
+		first  string
+		last   string
+	}{
+		{"10.0.0.0/24", "10.0.0.0", "10.0.0.255"},
+		{"10.1.2.3/20", "10.1.0.0", "10.1.15.255"},
+		{"2001:db8::/64", "2001:db8::", "2001:db8::ffff:ffff:ffff:ffff"},
+		{"2001:db8::/61", "2001:db8::", "2001:db8:0:7:ffff:ffff:ffff:ffff"},
+		{"2001:db8::1/128", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tc := range tests {
+		start, end := PrefixKeyRange(netip.MustParsePrefix(tc.prefix))
+		if want := addrKey(netip.MustParseAddr(tc.first)); !bytes.Equal(start, want) {
+			t.Errorf("%s start = %x, want %x", tc.prefix, start, want)
+		}
+		if want := addrKey(netip.MustParseAddr(tc.last)); !bytes.Equal(end, want) {
+			t.Errorf("%s end = %x, want %x", tc.prefix, end, want)
+		}
+	}
+}
+
+func TestListHostsWithSummaryMixedFamilies(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	project, err := db.CreateProject("dual-stack")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	for _, ip := range []string{"2001:db8::10", "10.0.0.10", "2001:db8:0:1::5", "10.0.0.9", "2001:db8::9"} {
+		if _, err := db.UpsertHost(Host{ProjectID: project.ID, IPAddress: ip, InScope: true}); err != nil {
+			t.Fatalf("upsert host %s: %v", ip, err)
+		}
+	}
+
+	items, err := db.ListHostsWithSummary(project.ID, nil, nil, "ip", "asc", nil, nil)
+	if err != nil {
+		t.Fatalf("list hosts: %v", err)
+	}
+	var order []string
+	for _, item := range items {
+		order = append(order, item.IPAddress)
+	}
+	want := []string{"10.0.0.9", "10.0.0.10", "2001:db8::9", "2001:db8::10", "2001:db8:0:1::5"}
+	if len(order) != len(want) {
+		t.Fatalf("unexpected hosts: %v", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("unexpected ip ordering: got %v want %v", order, want)
+		}
+	}
+
+	start, end := PrefixKeyRange(netip.MustParsePrefix("2001:db8::/64"))
+	items, total, err := db.ListHostsWithSummaryPaged(project.ID, nil, nil, "ip", "asc", start, end, 10, 0)
+	if err != nil {
+		t.Fatalf("list hosts by ipv6 subnet: %v", err)
+	}
+	if total != 2 || len(items) != 2 || items[0].IPAddress != "2001:db8::9" {
+		t.Fatalf("unexpected ipv6 subnet result: total=%d items=%+v", total, items)
+	}
+
+	start, end = PrefixKeyRange(netip.MustParsePrefix("10.0.0.0/8"))
+	if _, total, err = db.ListHostsWithSummaryPaged(project.ID, nil, nil, "ip", "asc", start, end, 10, 0); err != nil || total != 2 {
+		t.Fatalf("expected 2 ipv4 hosts in 10.0.0.0/8, got total=%d err=%v", total, err)
+	}
+}
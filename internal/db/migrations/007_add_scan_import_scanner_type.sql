@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE scan_import ADD COLUMN scanner_type TEXT NOT NULL DEFAULT 'nmap';
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE scan_import ADD COLUMN status TEXT NOT NULL DEFAULT 'complete';
+ALTER TABLE host_observation ADD COLUMN os_guess TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_scan_import_status ON scan_import(status);
+
+COMMIT;
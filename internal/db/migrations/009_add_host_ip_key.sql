@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE host ADD COLUMN ip_key BLOB;
+
+COMMIT;
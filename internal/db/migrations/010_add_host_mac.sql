@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE host ADD COLUMN mac_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE host ADD COLUMN mac_vendor TEXT NOT NULL DEFAULT '';
+ALTER TABLE host_observation ADD COLUMN mac_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE host_observation ADD COLUMN mac_vendor TEXT NOT NULL DEFAULT '';
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS script_result (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scan_import_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    ip_address TEXT NOT NULL,
+    port_number INTEGER NOT NULL DEFAULT 0,
+    protocol TEXT NOT NULL DEFAULT '',
+    script_id TEXT NOT NULL,
+    output TEXT NOT NULL DEFAULT '',
+    elements TEXT NOT NULL DEFAULT 'null',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(scan_import_id) REFERENCES scan_import(id) ON DELETE CASCADE,
+    FOREIGN KEY(project_id) REFERENCES project(id) ON DELETE CASCADE,
+    UNIQUE(scan_import_id, ip_address, port_number, protocol, script_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_script_result_project_script ON script_result(project_id, script_id);
+CREATE INDEX IF NOT EXISTS idx_script_result_project_ip ON script_result(project_id, ip_address);
+
+COMMIT;
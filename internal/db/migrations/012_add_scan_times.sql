@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE scan_import ADD COLUMN scan_started_at TIMESTAMP;
+ALTER TABLE scan_import ADD COLUMN scan_finished_at TIMESTAMP;
+ALTER TABLE host_observation ADD COLUMN scan_started_at TIMESTAMP;
+ALTER TABLE host_observation ADD COLUMN scan_ended_at TIMESTAMP;
+
+COMMIT;
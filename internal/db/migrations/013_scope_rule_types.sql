@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+-- scope_definition.type now holds the rule type (include/exclude). Older rows
+-- recorded the rule kind (ip/cidr) there; every such rule was an include.
+UPDATE scope_definition SET type = 'include' WHERE type NOT IN ('include', 'exclude');
+
+COMMIT;
@@ -0,0 +1,51 @@
+BEGIN TRANSACTION;
+
+-- One row per scope mutation. changes holds the rules added or removed and
+-- rules the full rule set after the change, both as JSON arrays of
+-- {"ID","Definition","Type"} objects.
+CREATE TABLE IF NOT EXISTS scope_version (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    changes TEXT NOT NULL DEFAULT '[]',
+    rules TEXT NOT NULL DEFAULT '[]',
+    hosts_updated INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(project_id) REFERENCES project(id) ON DELETE CASCADE,
+    UNIQUE(project_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scope_version_project_time ON scope_version(project_id, created_at);
+
+CREATE TABLE IF NOT EXISTS host_scope_transition (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    host_id INTEGER NOT NULL,
+    ip_address TEXT NOT NULL,
+    from_in_scope BOOLEAN NOT NULL,
+    to_in_scope BOOLEAN NOT NULL,
+    scope_version_id INTEGER,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(project_id) REFERENCES project(id) ON DELETE CASCADE,
+    FOREIGN KEY(host_id) REFERENCES host(id) ON DELETE CASCADE,
+    FOREIGN KEY(scope_version_id) REFERENCES scope_version(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_scope_transition_host ON host_scope_transition(host_id, id);
+
+-- Projects that already have scope rules start from a baseline version so
+-- as-of lookups have something to return for the time before this migration.
+-- Migrations run on every open, so only projects without history are seeded.
+INSERT INTO scope_version (project_id, version, action, actor, changes, rules, created_at)
+SELECT p.id, 1, 'baseline', '', '[]',
+       (SELECT json_group_array(json_object('ID', sd.id, 'Definition', sd.definition, 'Type', sd.type))
+          FROM scope_definition sd WHERE sd.project_id = p.id),
+       (SELECT MIN(sd.created_at) FROM scope_definition sd WHERE sd.project_id = p.id)
+  FROM project p
+ WHERE EXISTS (SELECT 1 FROM scope_definition sd WHERE sd.project_id = p.id)
+   AND NOT EXISTS (SELECT 1 FROM scope_version sv WHERE sv.project_id = p.id);
+
+COMMIT;
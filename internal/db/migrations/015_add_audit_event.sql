@@ -0,0 +1,35 @@
+BEGIN TRANSACTION;
+
+-- Append-only record of analyst changes. There are deliberately no foreign
+-- keys: events must outlive the hosts, ports and projects they describe.
+-- before_state/after_state hold JSON snapshots of the changed fields.
+CREATE TABLE IF NOT EXISTS audit_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    host_id INTEGER,
+    port_id INTEGER,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id INTEGER NOT NULL,
+    before_state TEXT NOT NULL DEFAULT 'null',
+    after_state TEXT NOT NULL DEFAULT 'null',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_event_project ON audit_event(project_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_event_host ON audit_event(host_id, id);
+
+CREATE TRIGGER IF NOT EXISTS audit_event_no_update
+BEFORE UPDATE ON audit_event
+BEGIN
+    SELECT RAISE(ABORT, 'audit_event is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_event_no_delete
+BEFORE DELETE ON audit_event
+BEGIN
+    SELECT RAISE(ABORT, 'audit_event is append-only');
+END;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN TRANSACTION;
+
+-- One row per work_status change on a port, written alongside the audit
+-- event by UpdateWorkStatus and the BulkUpdate* methods. Ports created by an
+-- import start in 'scanned' at port.created_at and have no row for that.
+CREATE TABLE IF NOT EXISTS port_status_transition (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    host_id INTEGER NOT NULL,
+    port_id INTEGER NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(port_id) REFERENCES port(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_port_status_transition_project ON port_status_transition(project_id, port_id, id);
+
+COMMIT;
@@ -0,0 +1,33 @@
+BEGIN TRANSACTION;
+
+-- Uploads accepted by the web server are spooled to disk and imported by a
+-- background worker. Status moves queued -> parsing -> writing -> done, or to
+-- failed with the error recorded. Jobs left in parsing/writing by a server
+-- that stopped mid-import are re-queued when the workers start.
+CREATE TABLE IF NOT EXISTS import_job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    spool_path TEXT NOT NULL,
+    options TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'parsing', 'writing', 'done', 'failed')),
+    hosts_processed INTEGER NOT NULL DEFAULT 0,
+    ports_processed INTEGER NOT NULL DEFAULT 0,
+    hosts_in_scope INTEGER NOT NULL DEFAULT 0,
+    hosts_out_scope INTEGER NOT NULL DEFAULT 0,
+    hosts_skipped INTEGER NOT NULL DEFAULT 0,
+    scan_import_id INTEGER,
+    mac_changes TEXT NOT NULL DEFAULT '[]',
+    error TEXT NOT NULL DEFAULT '',
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    FOREIGN KEY(project_id) REFERENCES project(id) ON DELETE CASCADE,
+    FOREIGN KEY(scan_import_id) REFERENCES scan_import(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_job_project ON import_job(project_id, id);
+CREATE INDEX IF NOT EXISTS idx_import_job_status ON import_job(status, id);
+
+COMMIT;
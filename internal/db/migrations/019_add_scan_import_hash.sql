@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+
+-- SHA-256 of the normalised scan file, used to reject re-imports of the same
+-- file into a project. Imports made before this migration have no hash.
+ALTER TABLE scan_import ADD COLUMN content_sha256 TEXT;
+-- Import jobs rejected as (near-)duplicates point at the existing import so
+-- the UI can offer to import anyway.
+ALTER TABLE import_job ADD COLUMN duplicate_of INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_scan_import_content_sha256 ON scan_import(project_id, content_sha256);
+
+COMMIT;
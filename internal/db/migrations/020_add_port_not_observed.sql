@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+
+-- When a rescan that covered a port no longer reports it, import
+-- reconciliation sets port.state to 'not_observed' and records the scan time
+-- here. Any later observation of the port clears it.
+ALTER TABLE port ADD COLUMN not_observed_at TIMESTAMP;
+-- The port list the scanner recorded probing (nmap <scaninfo services>, or
+-- the gnmap "Ports scanned" header) as an nmap -p spec, so reconciliation can
+-- be replayed. Empty when the file does not say.
+ALTER TABLE scan_import ADD COLUMN scanned_ports TEXT NOT NULL DEFAULT '';
+
+COMMIT;
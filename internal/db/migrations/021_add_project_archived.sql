@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+-- Set while a project is archived. Archived projects stay readable but
+-- reject imports and analyst changes until they are unarchived.
+ALTER TABLE project ADD COLUMN archived_at TIMESTAMP;
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN TRANSACTION;
+
+-- Original scan files, gzipped and keyed by the SHA-256 of their raw bytes so
+-- a file imported into several projects is kept once. in_dir is set when the
+-- file lives in the artifact directory next to the database; otherwise it is
+-- kept in scan_artifact_chunk.
+CREATE TABLE IF NOT EXISTS scan_artifact (
+    sha256 TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    stored_size INTEGER NOT NULL,
+    in_dir INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Files kept in the database are split into chunks so storing or reading one
+-- never holds the whole file in memory.
+CREATE TABLE IF NOT EXISTS scan_artifact_chunk (
+    sha256 TEXT NOT NULL REFERENCES scan_artifact(sha256) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    data BLOB NOT NULL,
+    PRIMARY KEY (sha256, seq)
+);
+
+-- Imports made before this migration, and observations imported without a
+-- file, have no artifact.
+ALTER TABLE scan_import ADD COLUMN artifact_sha256 TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_scan_import_artifact ON scan_import(artifact_sha256);
+
+COMMIT;
@@ -1,13 +1,23 @@
 package db
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
-// Project represents the top-level grouping.
+// Project represents the top-level grouping. ArchivedAt is set while the
+// project is archived and read-only.
 type Project struct {
-	ID        int64
-	Name      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID         int64
+	Name       string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ArchivedAt *time.Time
+}
+
+// Archived reports whether the project is read-only.
+func (p Project) Archived() bool {
+	return p.ArchivedAt != nil
 }
 
 // ScopeDefinition captures includes/excludes.
@@ -28,10 +38,28 @@ type ScanImport struct {
 	HostsFound    int
 	PortsFound    int
 	NmapArgs      string
+	ScannerType   string
 	ScannerLabel  string
 	SourceIP      *string
 	SourcePort    *int
 	SourcePortRaw *string
+	Status        string
+	// ScanStartedAt and ScanFinishedAt are the scanner's own run times
+	// (nmaprun@start, runstats/finished@time), when the format records them.
+	ScanStartedAt  *time.Time
+	ScanFinishedAt *time.Time
+}
+
+// ScanTime returns when the scan ran: the recorded start or finish time,
+// falling back to the import time for formats without run times.
+func (s ScanImport) ScanTime() time.Time {
+	if s.ScanStartedAt != nil {
+		return *s.ScanStartedAt
+	}
+	if s.ScanFinishedAt != nil {
+		return *s.ScanFinishedAt
+	}
+	return s.ImportTime
 }
 
 // ScanImportIntent stores intent tags for one scan import.
@@ -55,6 +83,9 @@ type ScanImportIntentInput struct {
 type ScanImportWithIntents struct {
 	ScanImport
 	Intents []ScanImportIntent
+	// ArtifactSHA256 names the stored original file, empty when none was
+	// kept.
+	ArtifactSHA256 string
 }
 
 // Host represents a scanned host.
@@ -64,6 +95,8 @@ type Host struct {
 	IPAddress  string
 	Hostname   string
 	OSGuess    string
+	MACAddress string
+	MACVendor  string
 	LatestScan string
 	InScope    bool
 	Notes      string
@@ -86,8 +119,11 @@ type Port struct {
 	ScriptOutput string
 	Notes        string
 	LastSeen     time.Time
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// NotObservedAt is when a scan covering the port last failed to report
+	// it; State is PortStateNotObserved while it is set.
+	NotObservedAt *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
 // HostObservation stores the host state for one import.
@@ -97,9 +133,15 @@ type HostObservation struct {
 	ProjectID    int64
 	IPAddress    string
 	Hostname     string
+	OSGuess      string
+	MACAddress   string
+	MACVendor    string
 	InScope      bool
 	HostState    string
-	CreatedAt    time.Time
+	// ScanStartedAt and ScanEndedAt are the host's starttime/endtime.
+	ScanStartedAt *time.Time
+	ScanEndedAt   *time.Time
+	CreatedAt     time.Time
 }
 
 // PortObservation stores the port state for one import.
@@ -119,6 +161,23 @@ type PortObservation struct {
 	CreatedAt    time.Time
 }
 
+// ScriptResult stores one NSE script result for one import. Host-level
+// scripts (<hostscript>) have PortNumber 0 and an empty Protocol. Elements is
+// the script's <elem>/<table> tree as JSON, or null when the script emitted
+// only text output.
+type ScriptResult struct {
+	ID           int64
+	ScanImportID int64
+	ProjectID    int64
+	IPAddress    string
+	PortNumber   int
+	Protocol     string
+	ScriptID     string
+	Output       string
+	Elements     json.RawMessage
+	CreatedAt    time.Time
+}
+
 // ExpectedAssetBaseline stores expected asset definitions per project.
 type ExpectedAssetBaseline struct {
 	ID         int64
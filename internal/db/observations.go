@@ -1,19 +1,26 @@
 package db
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+)
 
 // InsertHostObservation stores one host observation row within a transaction.
 func (tx *Tx) InsertHostObservation(obs HostObservation) (HostObservation, error) {
 	var out HostObservation
+	var startedAt, endedAt sql.NullTime
 	err := tx.QueryRow(
-		`INSERT INTO host_observation (scan_import_id, project_id, ip_address, hostname, in_scope, host_state)
-		 VALUES (?, ?, ?, ?, ?, ?)
-		 RETURNING id, scan_import_id, project_id, ip_address, hostname, in_scope, host_state, created_at`,
-		obs.ScanImportID, obs.ProjectID, obs.IPAddress, obs.Hostname, obs.InScope, obs.HostState,
-	).Scan(&out.ID, &out.ScanImportID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.InScope, &out.HostState, &out.CreatedAt)
+		`INSERT INTO host_observation (scan_import_id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, host_state, scan_started_at, scan_ended_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id, scan_import_id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, host_state, scan_started_at, scan_ended_at, created_at`,
+		obs.ScanImportID, obs.ProjectID, obs.IPAddress, obs.Hostname, obs.OSGuess, obs.MACAddress, obs.MACVendor, obs.InScope, obs.HostState,
+		nullableTimeValue(obs.ScanStartedAt), nullableTimeValue(obs.ScanEndedAt),
+	).Scan(&out.ID, &out.ScanImportID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.OSGuess, &out.MACAddress, &out.MACVendor, &out.InScope, &out.HostState, &startedAt, &endedAt, &out.CreatedAt)
 	if err != nil {
 		return HostObservation{}, fmt.Errorf("insert host observation: %w", err)
 	}
+	out.ScanStartedAt = ptrTimeFromNull(startedAt)
+	out.ScanEndedAt = ptrTimeFromNull(endedAt)
 	return out, nil
 }
 
@@ -42,7 +49,7 @@ func (tx *Tx) InsertPortObservation(obs PortObservation) (PortObservation, error
 // ListHostObservationsByImport returns host observations for one project/import pair.
 func (db *DB) ListHostObservationsByImport(projectID, importID int64) ([]HostObservation, error) {
 	rows, err := db.Query(
-		`SELECT id, scan_import_id, project_id, ip_address, hostname, in_scope, host_state, created_at
+		`SELECT id, scan_import_id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, host_state, scan_started_at, scan_ended_at, created_at
 		   FROM host_observation
 		  WHERE project_id = ? AND scan_import_id = ?
 		  ORDER BY ip_address`,
@@ -56,9 +63,12 @@ func (db *DB) ListHostObservationsByImport(projectID, importID int64) ([]HostObs
 	var items []HostObservation
 	for rows.Next() {
 		var obs HostObservation
-		if err := rows.Scan(&obs.ID, &obs.ScanImportID, &obs.ProjectID, &obs.IPAddress, &obs.Hostname, &obs.InScope, &obs.HostState, &obs.CreatedAt); err != nil {
+		var startedAt, endedAt sql.NullTime
+		if err := rows.Scan(&obs.ID, &obs.ScanImportID, &obs.ProjectID, &obs.IPAddress, &obs.Hostname, &obs.OSGuess, &obs.MACAddress, &obs.MACVendor, &obs.InScope, &obs.HostState, &startedAt, &endedAt, &obs.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan host observation: %w", err)
 		}
+		obs.ScanStartedAt = ptrTimeFromNull(startedAt)
+		obs.ScanEndedAt = ptrTimeFromNull(endedAt)
 		items = append(items, obs)
 	}
 	if err := rows.Err(); err != nil {
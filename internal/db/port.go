@@ -15,8 +15,8 @@ func (db *DB) UpsertPort(p Port) (Port, error) {
 
 	var out Port
 	err := db.QueryRow(
-		`INSERT INTO port (host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))
+		`INSERT INTO port (host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?)
 		 ON CONFLICT(host_id, port_number, protocol) DO UPDATE SET
 		   state=excluded.state,
 		   service=excluded.service,
@@ -27,10 +27,11 @@ func (db *DB) UpsertPort(p Port) (Port, error) {
 		   script_output=excluded.script_output,
 		   notes=excluded.notes,
 		   last_seen=COALESCE(excluded.last_seen, port.last_seen, CURRENT_TIMESTAMP),
+		   not_observed_at=excluded.not_observed_at,
 		   updated_at=CURRENT_TIMESTAMP
-		 RETURNING id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at`,
-		p.HostID, p.PortNumber, p.Protocol, p.State, p.Service, p.Version, p.Product, p.ExtraInfo, p.WorkStatus, p.ScriptOutput, p.Notes, lastSeen,
-	).Scan(&out.ID, &out.HostID, &out.PortNumber, &out.Protocol, &out.State, &out.Service, &out.Version, &out.Product, &out.ExtraInfo, &out.WorkStatus, &out.ScriptOutput, &out.Notes, &out.LastSeen, &out.CreatedAt, &out.UpdatedAt)
+		 RETURNING id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at`,
+		p.HostID, p.PortNumber, p.Protocol, p.State, p.Service, p.Version, p.Product, p.ExtraInfo, p.WorkStatus, p.ScriptOutput, p.Notes, lastSeen, p.NotObservedAt,
+	).Scan(&out.ID, &out.HostID, &out.PortNumber, &out.Protocol, &out.State, &out.Service, &out.Version, &out.Product, &out.ExtraInfo, &out.WorkStatus, &out.ScriptOutput, &out.Notes, &out.LastSeen, &out.NotObservedAt, &out.CreatedAt, &out.UpdatedAt)
 	if err != nil {
 		return Port{}, fmt.Errorf("upsert port: %w", err)
 	}
@@ -40,19 +41,36 @@ func (db *DB) UpsertPort(p Port) (Port, error) {
 // ListPorts returns ports for a host ordered by port_number then protocol.
 func (db *DB) ListPorts(hostID int64) ([]Port, error) {
 	rows, err := db.Query(
-		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at
+		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at
 		 FROM port WHERE host_id = ? ORDER BY port_number, protocol`,
 		hostID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("list ports: %w", err)
 	}
+	return scanPorts(rows)
+}
+
+// ListPorts returns ports for a host within a transaction, ordered like DB.ListPorts.
+func (tx *Tx) ListPorts(hostID int64) ([]Port, error) {
+	rows, err := tx.Query(
+		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at
+		 FROM port WHERE host_id = ? ORDER BY port_number, protocol`,
+		hostID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list ports: %w", err)
+	}
+	return scanPorts(rows)
+}
+
+func scanPorts(rows *sql.Rows) ([]Port, error) {
 	defer rows.Close()
 
 	var ports []Port
 	for rows.Next() {
 		var p Port
-		if err := rows.Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.NotObservedAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan port: %w", err)
 		}
 		ports = append(ports, p)
@@ -74,7 +92,7 @@ type ProjectPort struct {
 func (db *DB) ListProjectPorts(projectID int64) ([]ProjectPort, error) {
 	query := `
 		SELECT 
-			p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.created_at, p.updated_at,
+			p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.not_observed_at, p.created_at, p.updated_at,
 			h.ip_address, h.hostname
 		FROM port p
 		JOIN host h ON p.host_id = h.id
@@ -91,7 +109,7 @@ func (db *DB) ListProjectPorts(projectID int64) ([]ProjectPort, error) {
 	for rows.Next() {
 		var pp ProjectPort
 		if err := rows.Scan(
-			&pp.ID, &pp.HostID, &pp.PortNumber, &pp.Protocol, &pp.State, &pp.Service, &pp.Version, &pp.Product, &pp.ExtraInfo, &pp.WorkStatus, &pp.ScriptOutput, &pp.Notes, &pp.LastSeen, &pp.CreatedAt, &pp.UpdatedAt,
+			&pp.ID, &pp.HostID, &pp.PortNumber, &pp.Protocol, &pp.State, &pp.Service, &pp.Version, &pp.Product, &pp.ExtraInfo, &pp.WorkStatus, &pp.ScriptOutput, &pp.Notes, &pp.LastSeen, &pp.NotObservedAt, &pp.CreatedAt, &pp.UpdatedAt,
 			&pp.HostIP, &pp.Hostname,
 		); err != nil {
 			return nil, fmt.Errorf("scan project port: %w", err)
@@ -139,7 +157,7 @@ func (db *DB) ListProjectPortsPaged(projectID int64, states, statuses []string,
 
 	query := fmt.Sprintf(
 		`SELECT 
-			p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.created_at, p.updated_at,
+			p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.not_observed_at, p.created_at, p.updated_at,
 			h.ip_address, h.hostname
 		FROM port p
 		JOIN host h ON p.host_id = h.id
@@ -159,7 +177,7 @@ func (db *DB) ListProjectPortsPaged(projectID int64, states, statuses []string,
 	for rows.Next() {
 		var pp ProjectPort
 		if err := rows.Scan(
-			&pp.ID, &pp.HostID, &pp.PortNumber, &pp.Protocol, &pp.State, &pp.Service, &pp.Version, &pp.Product, &pp.ExtraInfo, &pp.WorkStatus, &pp.ScriptOutput, &pp.Notes, &pp.LastSeen, &pp.CreatedAt, &pp.UpdatedAt,
+			&pp.ID, &pp.HostID, &pp.PortNumber, &pp.Protocol, &pp.State, &pp.Service, &pp.Version, &pp.Product, &pp.ExtraInfo, &pp.WorkStatus, &pp.ScriptOutput, &pp.Notes, &pp.LastSeen, &pp.NotObservedAt, &pp.CreatedAt, &pp.UpdatedAt,
 			&pp.HostIP, &pp.Hostname,
 		); err != nil {
 			return nil, 0, fmt.Errorf("scan project port: %w", err)
@@ -175,7 +193,7 @@ func (db *DB) ListProjectPortsPaged(projectID int64, states, statuses []string,
 // ListPortsByProject returns all ports for a project.
 func (db *DB) ListPortsByProject(projectID int64) ([]Port, error) {
 	query := `
-		SELECT p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.created_at, p.updated_at
+		SELECT p.id, p.host_id, p.port_number, p.protocol, p.state, p.service, p.version, p.product, p.extra_info, p.work_status, p.script_output, p.notes, p.last_seen, p.not_observed_at, p.created_at, p.updated_at
 		  FROM port p
 		  JOIN host h ON p.host_id = h.id
 		 WHERE h.project_id = ?
@@ -189,7 +207,7 @@ func (db *DB) ListPortsByProject(projectID int64) ([]Port, error) {
 	var ports []Port
 	for rows.Next() {
 		var p Port
-		if err := rows.Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.NotObservedAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan port: %w", err)
 		}
 		ports = append(ports, p)
@@ -202,24 +220,37 @@ func (db *DB) ListPortsByProject(projectID int64) ([]Port, error) {
 
 // DeletePort removes a port by ID.
 func (db *DB) DeletePort(id int64) error {
-	res, err := db.Exec(`DELETE FROM port WHERE id = ?`, id)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete port: %w", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	ports, err := tx.listPortsForAudit("state", "id = ?", []any{id})
+	if err != nil {
+		return err
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
+	if len(ports) == 0 {
 		return sql.ErrNoRows
 	}
-	return nil
+	if _, err := tx.Exec(`DELETE FROM port WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete port: %w", err)
+	}
+	p := ports[0]
+	if err := tx.audit(p.event(AuditPortDelete), p.snapshot("state", p.value), nil); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetPortByID fetches a port by ID.
 func (db *DB) GetPortByID(id int64) (Port, bool, error) {
 	var p Port
 	err := db.QueryRow(
-		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at
+		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at
 		 FROM port WHERE id = ?`,
 		id,
-	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.CreatedAt, &p.UpdatedAt)
+	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.NotObservedAt, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Port{}, false, nil
@@ -233,10 +264,10 @@ func (db *DB) GetPortByID(id int64) (Port, bool, error) {
 func (db *DB) GetPortByKey(hostID int64, portNumber int, protocol string) (Port, bool, error) {
 	var p Port
 	err := db.QueryRow(
-		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at
+		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at
 		 FROM port WHERE host_id = ? AND port_number = ? AND protocol = ?`,
 		hostID, portNumber, protocol,
-	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.CreatedAt, &p.UpdatedAt)
+	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.NotObservedAt, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Port{}, false, nil
@@ -248,8 +279,7 @@ func (db *DB) GetPortByKey(hostID int64, portNumber int, protocol string) (Port,
 
 // UpdateWorkStatus sets work_status for a single port id.
 func (db *DB) UpdateWorkStatus(portID int64, status string) error {
-	_, err := db.Exec(`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, portID)
-	if err != nil {
+	if err := db.updatePortField("work_status", status, "id = ?", portID); err != nil {
 		return fmt.Errorf("update work_status: %w", err)
 	}
 	return nil
@@ -257,8 +287,7 @@ func (db *DB) UpdateWorkStatus(portID int64, status string) error {
 
 // UpdatePortNotes updates the notes for a port.
 func (db *DB) UpdatePortNotes(portID int64, notes string) error {
-	_, err := db.Exec(`UPDATE port SET notes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, notes, portID)
-	if err != nil {
+	if err := db.updatePortField("notes", notes, "id = ?", portID); err != nil {
 		return fmt.Errorf("update port notes: %w", err)
 	}
 	return nil
@@ -266,76 +295,48 @@ func (db *DB) UpdatePortNotes(portID int64, notes string) error {
 
 // BulkUpdateByHost sets work_status for all ports on a host in a transaction.
 func (db *DB) BulkUpdateByHost(hostID int64, status string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	if _, err := tx.Exec(`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE host_id = ?`, status, hostID); err != nil {
-		tx.Rollback()
+	if err := db.updatePortField("work_status", status, "host_id = ?", hostID); err != nil {
 		return fmt.Errorf("bulk update host: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdateOpenByHost sets work_status for open ports on a host.
 func (db *DB) BulkUpdateOpenByHost(hostID int64, status string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	if _, err := tx.Exec(`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE host_id = ? AND state = 'open'`, status, hostID); err != nil {
-		tx.Rollback()
+	if err := db.updatePortField("work_status", status, "host_id = ? AND state = 'open'", hostID); err != nil {
 		return fmt.Errorf("bulk update open host: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdateByPortNumber sets work_status for all ports with a given number across a project.
 func (db *DB) BulkUpdateByPortNumber(projectID int64, portNumber int, status string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	_, err = tx.Exec(
-		`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE port_number = ? AND host_id IN (SELECT id FROM host WHERE project_id = ?)`,
-		status, portNumber, projectID,
+	err := db.updatePortField("work_status", status,
+		`port_number = ? AND host_id IN (SELECT id FROM host WHERE project_id = ?)`,
+		portNumber, projectID,
 	)
 	if err != nil {
-		tx.Rollback()
 		return fmt.Errorf("bulk update port number: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdateOpenByPortNumber sets work_status for open ports with a given number across a project.
 func (db *DB) BulkUpdateOpenByPortNumber(projectID int64, portNumber int, status string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	_, err = tx.Exec(
-		`UPDATE port
-		    SET work_status = ?, updated_at = CURRENT_TIMESTAMP
-		  WHERE state = 'open'
+	err := db.updatePortField("work_status", status,
+		`state = 'open'
 		    AND port_number = ?
 		    AND host_id IN (SELECT id FROM host WHERE project_id = ?)`,
-		status, portNumber, projectID,
+		portNumber, projectID,
 	)
 	if err != nil {
-		tx.Rollback()
 		return fmt.Errorf("bulk update open port number: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdateByFilter sets work_status for ports that match provided filters (protocol optional).
 func (db *DB) BulkUpdateByFilter(projectID int64, hostIDs []int64, portNumbers []int, protocols []string, status string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	defer tx.Rollback()
-
 	var conditions []string
 	var args []any
 
@@ -364,13 +365,10 @@ func (db *DB) BulkUpdateByFilter(projectID int64, hostIDs []int64, portNumbers [
 		}
 	}
 
-	where := strings.Join(conditions, " AND ")
-	args = append([]any{status}, args...)
-	query := fmt.Sprintf(`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE %s`, where)
-	if _, err := tx.Exec(query, args...); err != nil {
+	if err := db.updatePortField("work_status", status, strings.Join(conditions, " AND "), args...); err != nil {
 		return fmt.Errorf("bulk update filter: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdateOpenByHostIDs sets work_status for open ports on a set of hosts within a project.
@@ -378,28 +376,21 @@ func (db *DB) BulkUpdateOpenByHostIDs(projectID int64, hostIDs []int64, status s
 	if len(hostIDs) == 0 {
 		return nil
 	}
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
 	placeholders := makePlaceholders(len(hostIDs))
-	args := []any{status, projectID}
+	args := []any{projectID}
 	for _, id := range hostIDs {
 		args = append(args, id)
 	}
-	query := fmt.Sprintf(
-		`UPDATE port
-		    SET work_status = ?, updated_at = CURRENT_TIMESTAMP
-		  WHERE state = 'open'
+	where := fmt.Sprintf(
+		`state = 'open'
 		    AND host_id IN (SELECT id FROM host WHERE project_id = ?)
 		    AND host_id IN (%s)`,
 		placeholders,
 	)
-	if _, err := tx.Exec(query, args...); err != nil {
-		tx.Rollback()
+	if err := db.updatePortField("work_status", status, where, args...); err != nil {
 		return fmt.Errorf("bulk update open host ids: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 func makePlaceholders(n int) string {
@@ -415,23 +406,15 @@ func (db *DB) BulkUpdatePortStatuses(ids []int64, status string) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	// no placeholders helper exposed? It's unexported at bottom. fine.
-	placeholders := makePlaceholders(len(ids))
-	args := []any{status}
+	args := make([]any, 0, len(ids))
 	for _, id := range ids {
 		args = append(args, id)
 	}
-
-	query := fmt.Sprintf(`UPDATE port SET work_status = ?, updated_at = CURRENT_TIMESTAMP WHERE id IN (%s)`, placeholders)
-	if _, err := tx.Exec(query, args...); err != nil {
-		tx.Rollback()
+	where := fmt.Sprintf(`id IN (%s)`, makePlaceholders(len(ids)))
+	if err := db.updatePortField("work_status", status, where, args...); err != nil {
 		return fmt.Errorf("bulk update statuses: %w", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 // BulkUpdatePortStatusesForProject sets work_status for port IDs scoped to a project.
@@ -439,27 +422,120 @@ func (db *DB) BulkUpdatePortStatusesForProject(projectID int64, ids []int64, sta
 	if len(ids) == 0 {
 		return nil
 	}
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	placeholders := makePlaceholders(len(ids))
-	args := []any{status}
+	args := make([]any, 0, len(ids)+1)
 	for _, id := range ids {
 		args = append(args, id)
 	}
 	args = append(args, projectID)
-
-	query := fmt.Sprintf(
-		`UPDATE port
-		    SET work_status = ?, updated_at = CURRENT_TIMESTAMP
-		  WHERE id IN (%s)
+	where := fmt.Sprintf(
+		`id IN (%s)
 		    AND host_id IN (SELECT id FROM host WHERE project_id = ?)`,
-		placeholders,
+		makePlaceholders(len(ids)),
 	)
-	if _, err := tx.Exec(query, args...); err != nil {
-		tx.Rollback()
+	if err := db.updatePortField("work_status", status, where, args...); err != nil {
 		return fmt.Errorf("bulk update statuses scoped: %w", err)
 	}
+	return nil
+}
+
+// updatePortField sets one analyst-owned port column (work_status or notes)
+// on every port matching where, in one transaction, and audits each port
+// whose value actually changed. Work status changes are also appended to
+// port_status_transition for the throughput metrics.
+func (db *DB) updatePortField(column, value, where string, args ...any) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ports, err := tx.listPortsForAudit(column, where, args)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE port SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP WHERE `+where,
+		append([]any{value}, args...)...,
+	); err != nil {
+		return err
+	}
+
+	action := AuditPortWorkStatus
+	if column == "notes" {
+		action = AuditPortNotes
+	}
+	for _, p := range ports {
+		if p.value == value {
+			continue
+		}
+		if err := tx.audit(p.event(action), p.snapshot(column, p.value), p.snapshot(column, value)); err != nil {
+			return err
+		}
+		if column != "work_status" {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO port_status_transition (project_id, host_id, port_id, from_status, to_status, actor) VALUES (?, ?, ?, ?, ?, ?)`,
+			p.projectID, p.hostID, p.id, p.value, value, tx.actor,
+		); err != nil {
+			return fmt.Errorf("insert port_status_transition: %w", err)
+		}
+	}
 	return tx.Commit()
 }
+
+// auditPort is the slice of a port row an audit event needs.
+type auditPort struct {
+	id        int64
+	hostID    int64
+	projectID int64
+	number    int
+	protocol  string
+	value     string
+}
+
+func (p auditPort) event(action string) AuditEvent {
+	return AuditEvent{
+		ProjectID:  p.projectID,
+		HostID:     int64Ptr(p.hostID),
+		PortID:     int64Ptr(p.id),
+		Action:     action,
+		EntityType: AuditEntityPort,
+		EntityID:   p.id,
+	}
+}
+
+func (p auditPort) snapshot(column, value string) map[string]any {
+	return map[string]any{
+		"port": fmt.Sprintf("%d/%s", p.number, p.protocol),
+		column: value,
+	}
+}
+
+// listPortsForAudit reads column from the ports matching where, which is
+// written against unqualified port columns.
+func (tx *Tx) listPortsForAudit(column, where string, args []any) ([]auditPort, error) {
+	rows, err := tx.Query(
+		`SELECT id, host_id, (SELECT project_id FROM host WHERE host.id = port.host_id), port_number, protocol, `+column+`
+		   FROM port
+		  WHERE `+where,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list ports for audit: %w", err)
+	}
+	defer rows.Close()
+
+	var ports []auditPort
+	for rows.Next() {
+		var p auditPort
+		if err := rows.Scan(&p.id, &p.hostID, &p.projectID, &p.number, &p.protocol, &p.value); err != nil {
+			return nil, fmt.Errorf("scan port for audit: %w", err)
+		}
+		ports = append(ports, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list ports for audit rows: %w", err)
+	}
+	return ports, nil
+}
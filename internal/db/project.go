@@ -2,37 +2,180 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 )
 
+// ErrProjectArchived is returned for changes to an archived project.
+var ErrProjectArchived = errors.New("project is archived")
+
+const projectColumns = `id, name, created_at, updated_at, archived_at`
+
+func scanProject(row interface{ Scan(...any) error }) (Project, error) {
+	var p Project
+	var archivedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt, &archivedAt); err != nil {
+		return Project{}, err
+	}
+	if archivedAt.Valid {
+		p.ArchivedAt = &archivedAt.Time
+	}
+	return p, nil
+}
+
 // CreateProject inserts a new project.
 func (db *DB) CreateProject(name string) (Project, error) {
-	var p Project
-	err := db.QueryRow(
-		`INSERT INTO project (name) VALUES (?) RETURNING id, name, created_at, updated_at`,
-		name,
-	).Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	p, err := scanProject(db.QueryRow(`INSERT INTO project (name) VALUES (?) RETURNING `+projectColumns, name))
 	if err != nil {
 		return Project{}, fmt.Errorf("insert project: %w", err)
 	}
 	return p, nil
 }
 
-// UpdateProject updates an existing project's name.
+// UpdateProject updates an existing project's name. Archived projects return
+// ErrProjectArchived.
 func (db *DB) UpdateProject(id int64, name string) error {
-	res, err := db.Exec(`UPDATE project SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, name, id)
+	tx, err := db.Begin()
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before string
+	var archivedAt sql.NullTime
+	if err := tx.QueryRow(`SELECT name, archived_at FROM project WHERE id = ?`, id).Scan(&before, &archivedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return sql.ErrNoRows
+		}
+		return fmt.Errorf("get project: %w", err)
+	}
+	if archivedAt.Valid {
+		return ErrProjectArchived
+	}
+	if _, err := tx.Exec(`UPDATE project SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, name, id); err != nil {
 		return fmt.Errorf("update project: %w", err)
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return sql.ErrNoRows
+	event := AuditEvent{ProjectID: id, Action: AuditProjectUpdate, EntityType: AuditEntityProject, EntityID: id}
+	if err := tx.audit(event, map[string]string{"name": before}, map[string]string{"name": name}); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+// SetProjectArchived archives or unarchives a project and returns it.
+// Archiving an archived project keeps its original archive time.
+func (db *DB) SetProjectArchived(id int64, archived bool) (Project, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := scanProject(tx.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return Project{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return Project{}, fmt.Errorf("get project: %w", err)
+	}
+	if before.Archived() == archived {
+		return before, nil
+	}
+
+	query := `UPDATE project SET archived_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING ` + projectColumns
+	action := AuditProjectUnarchive
+	if archived {
+		query = `UPDATE project SET archived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING ` + projectColumns
+		action = AuditProjectArchive
+	}
+	p, err := scanProject(tx.QueryRow(query, id))
+	if err != nil {
+		return Project{}, fmt.Errorf("update project archive: %w", err)
+	}
+	event := AuditEvent{ProjectID: id, Action: action, EntityType: AuditEntityProject, EntityID: id}
+	if err := tx.audit(event, map[string]bool{"archived": before.Archived()}, map[string]bool{"archived": archived}); err != nil {
+		return Project{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Project{}, err
+	}
+	return p, nil
+}
+
+// CloneProject creates a project named name with the scope rules, baseline
+// definitions and members of an existing one, for a retest of the same
+// environment. Hosts, ports, imports and history are not copied, so neither
+// are the intent tags, which belong to imports. The copied rules are
+// recorded as the clone's first scope version. A missing source returns
+// sql.ErrNoRows.
+func (db *DB) CloneProject(sourceID int64, name string) (Project, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+
+	source, err := scanProject(tx.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id = ?`, sourceID))
+	if err == sql.ErrNoRows {
+		return Project{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return Project{}, fmt.Errorf("get project: %w", err)
+	}
+	clone, err := scanProject(tx.QueryRow(`INSERT INTO project (name) VALUES (?) RETURNING `+projectColumns, name))
+	if err != nil {
+		return Project{}, fmt.Errorf("insert project: %w", err)
+	}
+
+	defs, err := tx.listScopeDefinitions(sourceID)
+	if err != nil {
+		return Project{}, err
+	}
+	changes := make([]ScopeRuleSnapshot, 0, len(defs))
+	for _, def := range defs {
+		snap := ScopeRuleSnapshot{Definition: def.Definition, Type: def.Type}
+		err := tx.QueryRow(
+			`INSERT INTO scope_definition (project_id, definition, type) VALUES (?, ?, ?) RETURNING id`,
+			clone.ID, def.Definition, def.Type,
+		).Scan(&snap.ID)
+		if err != nil {
+			return Project{}, fmt.Errorf("insert scope_definition: %w", err)
+		}
+		changes = append(changes, snap)
+	}
+	if len(changes) > 0 {
+		if _, _, err := tx.recordScopeChange(clone.ID, ScopeActionAdd, changes); err != nil {
+			return Project{}, err
+		}
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO expected_asset_baseline (project_id, definition, type, created_at)
+		 SELECT ?, definition, type, created_at FROM expected_asset_baseline WHERE project_id = ? ORDER BY id`,
+		clone.ID, sourceID,
+	); err != nil {
+		return Project{}, fmt.Errorf("copy baseline: %w", err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO project_member (project_id, user_id, role) SELECT ?, user_id, role FROM project_member WHERE project_id = ?`,
+		clone.ID, sourceID,
+	); err != nil {
+		return Project{}, fmt.Errorf("copy members: %w", err)
+	}
+
+	event := AuditEvent{ProjectID: clone.ID, Action: AuditProjectClone, EntityType: AuditEntityProject, EntityID: clone.ID}
+	before := map[string]any{"project_id": source.ID, "name": source.Name}
+	if err := tx.audit(event, before, map[string]string{"name": clone.Name}); err != nil {
+		return Project{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Project{}, err
+	}
+	return clone, nil
 }
 
 // ListProjects returns all projects ordered by name.
 func (db *DB) ListProjects() ([]Project, error) {
-	rows, err := db.Query(`SELECT id, name, created_at, updated_at FROM project ORDER BY name`)
+	rows, err := db.Query(`SELECT ` + projectColumns + ` FROM project ORDER BY name`)
 	if err != nil {
 		return nil, fmt.Errorf("list projects: %w", err)
 	}
@@ -40,8 +183,8 @@ func (db *DB) ListProjects() ([]Project, error) {
 
 	var projects []Project
 	for rows.Next() {
-		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan project: %w", err)
 		}
 		projects = append(projects, p)
@@ -52,23 +195,39 @@ func (db *DB) ListProjects() ([]Project, error) {
 	return projects, nil
 }
 
-// DeleteProject removes a project by ID.
+// DeleteProject removes a project by ID, archived or not. Its audit events
+// are kept.
 func (db *DB) DeleteProject(id int64) error {
-	res, err := db.Exec(`DELETE FROM project WHERE id = ?`, id)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete project: %w", err)
+		return err
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(`DELETE FROM project WHERE id = ? RETURNING name`, id).Scan(&name)
+	if err == sql.ErrNoRows {
 		return sql.ErrNoRows
 	}
+	if err != nil {
+		return fmt.Errorf("delete project: %w", err)
+	}
+	event := AuditEvent{ProjectID: id, Action: AuditProjectDelete, EntityType: AuditEntityProject, EntityID: id}
+	if err := tx.audit(event, map[string]string{"name": name}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// Files still referenced by other projects stay; a failed prune leaves
+	// the rest for the next one.
+	db.PruneScanArtifacts()
 	return nil
 }
 
 // GetProjectByName returns a project by exact name.
 func (db *DB) GetProjectByName(name string) (Project, bool, error) {
-	var p Project
-	err := db.QueryRow(`SELECT id, name, created_at, updated_at FROM project WHERE name = ?`, name).
-		Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	p, err := scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM project WHERE name = ?`, name))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Project{}, false, nil
@@ -80,9 +239,7 @@ func (db *DB) GetProjectByName(name string) (Project, bool, error) {
 
 // GetProjectByID returns a project by ID.
 func (db *DB) GetProjectByID(id int64) (Project, bool, error) {
-	var p Project
-	err := db.QueryRow(`SELECT id, name, created_at, updated_at FROM project WHERE id = ?`, id).
-		Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	p, err := scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id = ?`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Project{}, false, nil
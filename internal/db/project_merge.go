@@ -0,0 +1,287 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// ErrMergeSameProject is returned when a project is merged into itself.
+var ErrMergeSameProject = errors.New("cannot merge a project into itself")
+
+// ProjectMergeStats counts what MergeProjectInto moved from the source
+// project. Merged hosts and ports are those the target already had;
+// MergedIPs lists the merged hosts.
+type ProjectMergeStats struct {
+	Imports     int
+	HostsMoved  int
+	HostsMerged int
+	PortsMoved  int
+	PortsMerged int
+	MergedIPs   []string
+}
+
+// workStatusRank orders work statuses by progress, for merge conflicts.
+var workStatusRank = map[string]int{"scanned": 0, "flagged": 1, "in_progress": 2, "done": 3}
+
+// MergeProjectInto moves everything in the source project into the target
+// and deletes the source. Imports, with their intents, observations and
+// script results, and import jobs move as they are. Hosts are re-keyed by
+// IP: a host the target lacks moves with its ports, and a host both have is
+// folded into the target's row, port by port. Conflicts resolve as:
+//
+//   - work_status: the furthest along of scanned, flagged, in_progress and
+//     done wins.
+//   - notes: equal or one-sided notes are kept; otherwise the source's notes
+//     are appended to the target's under a "merged from <source>" line.
+//
+// Status and scope transitions follow their host and port. Baseline
+// definitions and members are combined, the target's role winning. The
+// target's scope rules apply to every host afterwards; the source's are
+// dropped with it. Observed fields of merged hosts are left for the caller
+// to replay from the combined history. Audit events stay under the source
+// project's id. Either project being archived returns ErrProjectArchived and
+// a missing one sql.ErrNoRows.
+func (tx *Tx) MergeProjectInto(targetID, sourceID int64) (ProjectMergeStats, error) {
+	if targetID == sourceID {
+		return ProjectMergeStats{}, ErrMergeSameProject
+	}
+	var projects [2]Project
+	for i, id := range []int64{targetID, sourceID} {
+		p, err := scanProject(tx.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id = ?`, id))
+		if err == sql.ErrNoRows {
+			return ProjectMergeStats{}, sql.ErrNoRows
+		}
+		if err != nil {
+			return ProjectMergeStats{}, fmt.Errorf("get project: %w", err)
+		}
+		if p.Archived() {
+			return ProjectMergeStats{}, fmt.Errorf("%w: %s", ErrProjectArchived, p.Name)
+		}
+		projects[i] = p
+	}
+	target, source := projects[0], projects[1]
+
+	var stats ProjectMergeStats
+	for _, table := range []string{"scan_import", "host_observation", "port_observation", "script_result", "import_job"} {
+		res, err := tx.Exec(`UPDATE `+table+` SET project_id = ? WHERE project_id = ?`, targetID, sourceID)
+		if err != nil {
+			return ProjectMergeStats{}, fmt.Errorf("move %s: %w", table, err)
+		}
+		if table == "scan_import" {
+			n, err := res.RowsAffected()
+			if err != nil {
+				return ProjectMergeStats{}, fmt.Errorf("move scan_import: %w", err)
+			}
+			stats.Imports = int(n)
+		}
+	}
+
+	hosts, err := tx.listProjectHosts(sourceID)
+	if err != nil {
+		return ProjectMergeStats{}, err
+	}
+	for _, host := range hosts {
+		existing, found, err := tx.GetHostByIP(targetID, host.IPAddress)
+		if err != nil {
+			return ProjectMergeStats{}, err
+		}
+		if !found {
+			moved, err := tx.moveHost(host.ID, targetID)
+			if err != nil {
+				return ProjectMergeStats{}, err
+			}
+			stats.HostsMoved++
+			stats.PortsMoved += moved
+			continue
+		}
+		moved, merged, err := tx.foldHost(existing, host, source.Name)
+		if err != nil {
+			return ProjectMergeStats{}, err
+		}
+		stats.HostsMerged++
+		stats.MergedIPs = append(stats.MergedIPs, host.IPAddress)
+		stats.PortsMoved += moved
+		stats.PortsMerged += merged
+	}
+
+	if _, err := tx.Exec(
+		`INSERT OR IGNORE INTO expected_asset_baseline (project_id, definition, type, created_at)
+		 SELECT ?, definition, type, created_at FROM expected_asset_baseline WHERE project_id = ? ORDER BY id`,
+		targetID, sourceID,
+	); err != nil {
+		return ProjectMergeStats{}, fmt.Errorf("merge baseline: %w", err)
+	}
+	if _, err := tx.Exec(
+		`INSERT OR IGNORE INTO project_member (project_id, user_id, role) SELECT ?, user_id, role FROM project_member WHERE project_id = ?`,
+		targetID, sourceID,
+	); err != nil {
+		return ProjectMergeStats{}, fmt.Errorf("merge members: %w", err)
+	}
+
+	defs, err := tx.listScopeDefinitions(targetID)
+	if err != nil {
+		return ProjectMergeStats{}, err
+	}
+	rules, err := ParseScopeRules(defs)
+	if err != nil {
+		return ProjectMergeStats{}, err
+	}
+	if _, err := tx.reevaluateHostScope(targetID, scope.NewMatcherFromRules(rules), nil, ScopeTransitionMerge); err != nil {
+		return ProjectMergeStats{}, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM project WHERE id = ?`, sourceID); err != nil {
+		return ProjectMergeStats{}, fmt.Errorf("delete merged project: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE project SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, targetID); err != nil {
+		return ProjectMergeStats{}, fmt.Errorf("update project: %w", err)
+	}
+	sourceRef := map[string]any{"project_id": source.ID, "name": source.Name}
+	targetRef := map[string]any{"project_id": target.ID, "name": target.Name}
+	event := AuditEvent{ProjectID: targetID, Action: AuditProjectMerge, EntityType: AuditEntityProject, EntityID: targetID}
+	if err := tx.audit(event, sourceRef, stats); err != nil {
+		return ProjectMergeStats{}, err
+	}
+	event = AuditEvent{ProjectID: sourceID, Action: AuditProjectMerge, EntityType: AuditEntityProject, EntityID: sourceID}
+	if err := tx.audit(event, sourceRef, targetRef); err != nil {
+		return ProjectMergeStats{}, err
+	}
+	return stats, nil
+}
+
+func (tx *Tx) listProjectHosts(projectID int64) ([]Host, error) {
+	rows, err := tx.Query(`SELECT id, ip_address FROM host WHERE project_id = ? ORDER BY id`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("list hosts: %w", err)
+	}
+	defer rows.Close()
+	var hosts []Host
+	for rows.Next() {
+		h := Host{ProjectID: projectID}
+		if err := rows.Scan(&h.ID, &h.IPAddress); err != nil {
+			return nil, fmt.Errorf("scan host: %w", err)
+		}
+		hosts = append(hosts, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list hosts rows: %w", err)
+	}
+	return hosts, nil
+}
+
+// moveHost reassigns a host, its ports and their transitions to another
+// project and returns how many ports came with it.
+func (tx *Tx) moveHost(hostID, projectID int64) (int, error) {
+	for _, stmt := range []string{
+		`UPDATE host SET project_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		`UPDATE host_scope_transition SET project_id = ? WHERE host_id = ?`,
+		`UPDATE port_status_transition SET project_id = ? WHERE host_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, projectID, hostID); err != nil {
+			return 0, fmt.Errorf("move host: %w", err)
+		}
+	}
+	var ports int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM port WHERE host_id = ?`, hostID).Scan(&ports); err != nil {
+		return 0, fmt.Errorf("count ports: %w", err)
+	}
+	return ports, nil
+}
+
+// foldHost merges the source host of a project merge into the target's host
+// with the same IP, then deletes it. It returns the number of ports moved
+// over and the number merged into existing ports.
+func (tx *Tx) foldHost(target, source Host, sourceName string) (moved, merged int, err error) {
+	var sourceNotes string
+	if err := tx.QueryRow(`SELECT COALESCE(notes, '') FROM host WHERE id = ?`, source.ID).Scan(&sourceNotes); err != nil {
+		return 0, 0, fmt.Errorf("get host notes: %w", err)
+	}
+	if notes := mergeNotes(target.Notes, sourceNotes, sourceName); notes != target.Notes {
+		if _, err := tx.Exec(`UPDATE host SET notes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, notes, target.ID); err != nil {
+			return 0, 0, fmt.Errorf("merge host notes: %w", err)
+		}
+	}
+
+	targetPorts, err := tx.ListPorts(target.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	byKey := make(map[string]Port, len(targetPorts))
+	for _, p := range targetPorts {
+		byKey[fmt.Sprintf("%d/%s", p.PortNumber, p.Protocol)] = p
+	}
+	sourcePorts, err := tx.ListPorts(source.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, sp := range sourcePorts {
+		tp, found := byKey[fmt.Sprintf("%d/%s", sp.PortNumber, sp.Protocol)]
+		if !found {
+			if _, err := tx.Exec(`UPDATE port SET host_id = ? WHERE id = ?`, target.ID, sp.ID); err != nil {
+				return 0, 0, fmt.Errorf("move port: %w", err)
+			}
+			if _, err := tx.Exec(
+				`UPDATE port_status_transition SET project_id = ?, host_id = ? WHERE port_id = ?`,
+				target.ProjectID, target.ID, sp.ID,
+			); err != nil {
+				return 0, 0, fmt.Errorf("move port transitions: %w", err)
+			}
+			moved++
+			continue
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE port_status_transition SET project_id = ?, host_id = ?, port_id = ? WHERE port_id = ?`,
+			target.ProjectID, target.ID, tp.ID, sp.ID,
+		); err != nil {
+			return 0, 0, fmt.Errorf("move port transitions: %w", err)
+		}
+		status := tp.WorkStatus
+		if workStatusRank[sp.WorkStatus] > workStatusRank[status] {
+			status = sp.WorkStatus
+		}
+		notes := mergeNotes(tp.Notes, sp.Notes, sourceName)
+		if _, err := tx.Exec(
+			`UPDATE port SET work_status = ?, notes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			status, notes, tp.ID,
+		); err != nil {
+			return 0, 0, fmt.Errorf("merge port: %w", err)
+		}
+		if status != tp.WorkStatus {
+			if _, err := tx.Exec(
+				`INSERT INTO port_status_transition (project_id, host_id, port_id, from_status, to_status, actor) VALUES (?, ?, ?, ?, ?, ?)`,
+				target.ProjectID, target.ID, tp.ID, tp.WorkStatus, status, tx.actor,
+			); err != nil {
+				return 0, 0, fmt.Errorf("insert port_status_transition: %w", err)
+			}
+		}
+		merged++
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE host_scope_transition SET project_id = ?, host_id = ? WHERE host_id = ?`,
+		target.ProjectID, target.ID, source.ID,
+	); err != nil {
+		return 0, 0, fmt.Errorf("move scope transitions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM host WHERE id = ?`, source.ID); err != nil {
+		return 0, 0, fmt.Errorf("delete merged host: %w", err)
+	}
+	return moved, merged, nil
+}
+
+// mergeNotes combines the notes of two merged records.
+func mergeNotes(target, source, sourceName string) string {
+	switch {
+	case strings.TrimSpace(source) == "" || source == target:
+		return target
+	case strings.TrimSpace(target) == "":
+		return source
+	default:
+		return target + "\n\n[merged from " + sourceName + "]\n" + source
+	}
+}
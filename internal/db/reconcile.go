@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PortStateNotObserved marks a port that a later scan covering it did not
+// report. Unlike nmap's own states it is never read from a scan file.
+const PortStateNotObserved = "not_observed"
+
+// SetScanImportScannedPorts records the port list a scan probed, as an nmap
+// -p spec. An empty spec is a no-op.
+func (tx *Tx) SetScanImportScannedPorts(importID int64, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE scan_import SET scanned_ports = ? WHERE id = ?`, spec, importID); err != nil {
+		return fmt.Errorf("set scan_import scanned ports: %w", err)
+	}
+	return nil
+}
+
+// UnobservedPort is a current port that one import did not report, with
+// whether and when that import saw the port's host.
+type UnobservedPort struct {
+	PortID       int64
+	IPAddress    string
+	PortNumber   int
+	Protocol     string
+	LastSeen     time.Time
+	HostObserved bool
+	// HostSeenAt is the import's own scan time for the host, if recorded.
+	HostSeenAt *time.Time
+}
+
+// ListUnobservedPorts returns the project's ports that are neither closed nor
+// already not observed and that the import has no observation of.
+func (tx *Tx) ListUnobservedPorts(projectID, importID int64) ([]UnobservedPort, error) {
+	rows, err := tx.Query(
+		`SELECT p.id, h.ip_address, p.port_number, p.protocol, p.last_seen,
+		        ho.id IS NOT NULL, ho.scan_ended_at, ho.scan_started_at
+		   FROM port p
+		   JOIN host h ON h.id = p.host_id
+		   LEFT JOIN host_observation ho ON ho.scan_import_id = ? AND ho.ip_address = h.ip_address
+		  WHERE h.project_id = ? AND p.state NOT IN ('closed', ?)
+		    AND NOT EXISTS (
+		        SELECT 1 FROM port_observation po
+		         WHERE po.scan_import_id = ? AND po.ip_address = h.ip_address
+		           AND po.port_number = p.port_number AND po.protocol = p.protocol)
+		  ORDER BY h.ip_address, p.port_number, p.protocol`,
+		importID, projectID, PortStateNotObserved, importID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list unobserved ports: %w", err)
+	}
+	defer rows.Close()
+
+	var out []UnobservedPort
+	for rows.Next() {
+		var p UnobservedPort
+		// The scan times are read separately: COALESCE over the columns
+		// yields text the driver does not convert to a time.
+		var hostEndedAt, hostStartedAt sql.NullTime
+		if err := rows.Scan(&p.PortID, &p.IPAddress, &p.PortNumber, &p.Protocol, &p.LastSeen, &p.HostObserved, &hostEndedAt, &hostStartedAt); err != nil {
+			return nil, fmt.Errorf("scan unobserved port: %w", err)
+		}
+		p.HostSeenAt = ptrTimeFromNull(hostEndedAt)
+		if p.HostSeenAt == nil {
+			p.HostSeenAt = ptrTimeFromNull(hostStartedAt)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list unobserved ports rows: %w", err)
+	}
+	return out, nil
+}
+
+// MarkPortNotObserved sets a port's state to PortStateNotObserved as of at.
+func (tx *Tx) MarkPortNotObserved(portID int64, at time.Time) error {
+	if _, err := tx.Exec(
+		`UPDATE port SET state = ?, not_observed_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		PortStateNotObserved, at, portID,
+	); err != nil {
+		return fmt.Errorf("mark port not observed: %w", err)
+	}
+	return nil
+}
+
+// ImportCoverage is what reconciliation needs to know about a completed
+// import: its arguments, recorded port list and scan time.
+type ImportCoverage struct {
+	ImportID     int64
+	NmapArgs     string
+	ScannedPorts string
+	ScanTime     time.Time
+}
+
+// ListImportCoverage returns every completed import of a project, oldest
+// scan first.
+func (tx *Tx) ListImportCoverage(projectID int64) ([]ImportCoverage, error) {
+	rows, err := tx.Query(
+		`SELECT si.id, si.nmap_args, si.scanned_ports, si.import_time, si.scan_started_at, si.scan_finished_at
+		   FROM scan_import si
+		  WHERE si.project_id = ? AND si.status = ?
+		  ORDER BY `+scanImportTimeSQL+`, si.id`,
+		projectID, ScanImportStatusComplete,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list import coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ImportCoverage
+	for rows.Next() {
+		var c ImportCoverage
+		var record ScanImport
+		var started, finished sql.NullTime
+		if err := rows.Scan(&c.ImportID, &c.NmapArgs, &c.ScannedPorts, &record.ImportTime, &started, &finished); err != nil {
+			return nil, fmt.Errorf("scan import coverage: %w", err)
+		}
+		record.ScanStartedAt = ptrTimeFromNull(started)
+		record.ScanFinishedAt = ptrTimeFromNull(finished)
+		c.ScanTime = record.ScanTime()
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list import coverage rows: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,363 @@
+package db
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNoScanArtifact is returned for imports whose original file was not kept:
+// imports made before files were stored, or observations imported directly.
+var ErrNoScanArtifact = errors.New("original scan file not stored")
+
+// artifactChunkSize bounds the rows a file kept in the database is split
+// into, and so the memory storing or reading it takes.
+const artifactChunkSize = 1 << 20
+
+// ScanArtifact is an original scan file kept as evidence. It is stored
+// gzipped and keyed by the SHA-256 of its raw bytes.
+type ScanArtifact struct {
+	SHA256     string
+	Size       int64
+	StoredSize int64
+	// InDir reports that the file is in the artifact directory rather than
+	// the database.
+	InDir     bool
+	CreatedAt time.Time
+}
+
+// ArtifactDirFor returns the directory next to a database that, when it
+// exists, holds its original scan files instead of the database itself.
+func ArtifactDirFor(dbPath string) string {
+	return dbPath + ".artifacts"
+}
+
+// ArtifactDir returns the directory original scan files are written to, or ""
+// when they are stored in the database.
+func (db *DB) ArtifactDir() string {
+	return db.artifactDir
+}
+
+func artifactPath(dir, sha string) string {
+	return filepath.Join(dir, sha[:2], sha+".gz")
+}
+
+// ScanArtifactWriter compresses a scan file to a temporary file as it is
+// written, for AttachScanArtifact to store once the import commits. Close
+// removes the temporary file.
+type ScanArtifactWriter struct {
+	dir  string
+	tmp  *os.File
+	gz   *gzip.Writer
+	hash hash.Hash
+	size int64
+	done bool
+}
+
+// NewScanArtifactWriter starts capturing an original scan file.
+func (db *DB) NewScanArtifactWriter() (*ScanArtifactWriter, error) {
+	tmpDir := db.artifactDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	// Temporary files live in the artifact directory itself so storing one
+	// is a rename.
+	tmp, err := os.CreateTemp(tmpDir, "scan-*.gz.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create scan artifact: %w", err)
+	}
+	return &ScanArtifactWriter{dir: db.artifactDir, tmp: tmp, gz: gzip.NewWriter(tmp), hash: sha256.New()}, nil
+}
+
+// Write compresses p into the artifact.
+func (w *ScanArtifactWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	w.size += int64(len(p))
+	return w.gz.Write(p)
+}
+
+// SHA256 returns the hex SHA-256 of the bytes written so far.
+func (w *ScanArtifactWriter) SHA256() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// Close discards the temporary file, whether or not it was stored.
+func (w *ScanArtifactWriter) Close() error {
+	w.tmp.Close()
+	err := os.Remove(w.tmp.Name())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// AttachScanArtifact stores the captured file, unless an identical file is
+// already stored, and links it to the import.
+func (tx *Tx) AttachScanArtifact(importID int64, w *ScanArtifactWriter) (ScanArtifact, error) {
+	artifact, err := tx.StoreScanArtifact(w)
+	if err != nil {
+		return ScanArtifact{}, err
+	}
+	if _, err := tx.Exec(`UPDATE scan_import SET artifact_sha256 = ? WHERE id = ?`, artifact.SHA256, importID); err != nil {
+		return ScanArtifact{}, fmt.Errorf("link scan artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// StoreScanArtifact stores the captured file unless an identical file is
+// already stored. Files stored in the artifact directory are moved into place
+// before the transaction commits; one left by a rolled-back transaction is
+// overwritten by the next store of the same file. Files kept in the database
+// are copied in chunks.
+func (tx *Tx) StoreScanArtifact(w *ScanArtifactWriter) (ScanArtifact, error) {
+	if !w.done {
+		if err := w.gz.Close(); err != nil {
+			return ScanArtifact{}, fmt.Errorf("compress scan artifact: %w", err)
+		}
+		w.done = true
+	}
+	info, err := w.tmp.Stat()
+	if err != nil {
+		return ScanArtifact{}, fmt.Errorf("stat scan artifact: %w", err)
+	}
+	artifact := ScanArtifact{
+		SHA256:     w.SHA256(),
+		Size:       w.size,
+		StoredSize: info.Size(),
+		InDir:      w.dir != "",
+	}
+
+	existing, found, err := tx.getScanArtifact(artifact.SHA256)
+	if err != nil {
+		return ScanArtifact{}, err
+	}
+	if found {
+		return existing, nil
+	}
+	err = tx.QueryRow(
+		`INSERT INTO scan_artifact (sha256, size, stored_size, in_dir) VALUES (?, ?, ?, ?) RETURNING created_at`,
+		artifact.SHA256, artifact.Size, artifact.StoredSize, artifact.InDir,
+	).Scan(&artifact.CreatedAt)
+	if err != nil {
+		return ScanArtifact{}, fmt.Errorf("insert scan_artifact: %w", err)
+	}
+	if artifact.InDir {
+		path := artifactPath(w.dir, artifact.SHA256)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return ScanArtifact{}, fmt.Errorf("store scan artifact: %w", err)
+		}
+		if err := os.Rename(w.tmp.Name(), path); err != nil {
+			return ScanArtifact{}, fmt.Errorf("store scan artifact: %w", err)
+		}
+		return artifact, nil
+	}
+	if err := tx.insertArtifactChunks(artifact.SHA256, io.NewSectionReader(w.tmp, 0, artifact.StoredSize)); err != nil {
+		return ScanArtifact{}, err
+	}
+	return artifact, nil
+}
+
+func (tx *Tx) insertArtifactChunks(sha string, r io.Reader) error {
+	buf := make([]byte, artifactChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := tx.Exec(`INSERT INTO scan_artifact_chunk (sha256, seq, data) VALUES (?, ?, ?)`, sha, seq, buf[:n]); err != nil {
+				return fmt.Errorf("insert scan_artifact_chunk: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read scan artifact: %w", err)
+		}
+	}
+}
+
+func (tx *Tx) getScanArtifact(sha string) (ScanArtifact, bool, error) {
+	a := ScanArtifact{SHA256: sha}
+	err := tx.QueryRow(
+		`SELECT size, stored_size, in_dir, created_at FROM scan_artifact WHERE sha256 = ?`, sha,
+	).Scan(&a.Size, &a.StoredSize, &a.InDir, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ScanArtifact{}, false, nil
+	}
+	if err != nil {
+		return ScanArtifact{}, false, fmt.Errorf("get scan artifact: %w", err)
+	}
+	return a, true, nil
+}
+
+// GetScanImportArtifact returns the stored original file of a completed
+// import. A missing import returns sql.ErrNoRows and an import without a
+// stored file ErrNoScanArtifact.
+func (db *DB) GetScanImportArtifact(projectID, importID int64) (ScanImport, ScanArtifact, error) {
+	var item ScanImport
+	var sha sql.NullString
+	err := db.QueryRow(
+		`SELECT id, project_id, filename, import_time, artifact_sha256 FROM scan_import WHERE id = ? AND project_id = ? AND status = ?`,
+		importID, projectID, ScanImportStatusComplete,
+	).Scan(&item.ID, &item.ProjectID, &item.Filename, &item.ImportTime, &sha)
+	if err == sql.ErrNoRows {
+		return ScanImport{}, ScanArtifact{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return ScanImport{}, ScanArtifact{}, fmt.Errorf("get scan import: %w", err)
+	}
+	if !sha.Valid {
+		return item, ScanArtifact{}, ErrNoScanArtifact
+	}
+	a := ScanArtifact{SHA256: sha.String}
+	err = db.QueryRow(
+		`SELECT size, stored_size, in_dir, created_at FROM scan_artifact WHERE sha256 = ?`, sha.String,
+	).Scan(&a.Size, &a.StoredSize, &a.InDir, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return item, ScanArtifact{}, ErrNoScanArtifact
+	}
+	if err != nil {
+		return ScanImport{}, ScanArtifact{}, fmt.Errorf("get scan artifact: %w", err)
+	}
+	return item, a, nil
+}
+
+// ListProjectScanArtifacts returns the stored files of a project's imports.
+func (db *DB) ListProjectScanArtifacts(projectID int64) ([]ScanArtifact, error) {
+	rows, err := db.Query(
+		`SELECT a.sha256, a.size, a.stored_size, a.in_dir, a.created_at
+		   FROM scan_artifact a
+		  WHERE a.sha256 IN (SELECT artifact_sha256 FROM scan_import WHERE project_id = ?)
+		  ORDER BY a.sha256`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scan artifacts: %w", err)
+	}
+	defer rows.Close()
+	var out []ScanArtifact
+	for rows.Next() {
+		var a ScanArtifact
+		if err := rows.Scan(&a.SHA256, &a.Size, &a.StoredSize, &a.InDir, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan scan artifact: %w", err)
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list scan artifacts rows: %w", err)
+	}
+	return out, nil
+}
+
+// OpenScanArtifact returns the stored, still gzipped, bytes of an artifact.
+func (db *DB) OpenScanArtifact(a ScanArtifact) (io.ReadCloser, error) {
+	if a.InDir {
+		if db.artifactDir == "" {
+			return nil, fmt.Errorf("open scan artifact %s: stored in an artifact directory this database was not opened with", a.SHA256)
+		}
+		f, err := os.Open(artifactPath(db.artifactDir, a.SHA256))
+		if err != nil {
+			return nil, fmt.Errorf("open scan artifact: %w", err)
+		}
+		return f, nil
+	}
+	return &chunkReader{db: db, sha: a.SHA256}, nil
+}
+
+// chunkReader reads an artifact kept in the database one chunk at a time.
+type chunkReader struct {
+	db   *DB
+	sha  string
+	seq  int
+	data []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		err := r.db.QueryRow(`SELECT data FROM scan_artifact_chunk WHERE sha256 = ? AND seq = ?`, r.sha, r.seq).Scan(&r.data)
+		if err == sql.ErrNoRows {
+			if r.seq == 0 {
+				return 0, fmt.Errorf("read scan artifact %s: no stored data", r.sha)
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read scan artifact: %w", err)
+		}
+		r.seq++
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// ReadScanArtifact returns a reader over the original, uncompressed file.
+func (db *DB) ReadScanArtifact(a ScanArtifact) (io.ReadCloser, error) {
+	stored, err := db.OpenScanArtifact(a)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(stored)
+	if err != nil {
+		stored.Close()
+		return nil, fmt.Errorf("decompress scan artifact: %w", err)
+	}
+	return &artifactReader{Reader: gz, stored: stored}, nil
+}
+
+type artifactReader struct {
+	*gzip.Reader
+	stored io.Closer
+}
+
+func (r *artifactReader) Close() error {
+	r.Reader.Close()
+	return r.stored.Close()
+}
+
+// PruneScanArtifacts removes stored files that no import refers to any more,
+// after imports or projects are deleted, and returns how many it removed.
+func (db *DB) PruneScanArtifacts() (int, error) {
+	rows, err := db.Query(
+		`DELETE FROM scan_artifact
+		  WHERE NOT EXISTS (SELECT 1 FROM scan_import si WHERE si.artifact_sha256 = scan_artifact.sha256)
+		  RETURNING sha256, in_dir`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune scan artifacts: %w", err)
+	}
+	defer rows.Close()
+	removed := 0
+	var files []string
+	for rows.Next() {
+		var sha string
+		var inDir bool
+		if err := rows.Scan(&sha, &inDir); err != nil {
+			return removed, fmt.Errorf("scan pruned artifact: %w", err)
+		}
+		if inDir && db.artifactDir != "" {
+			files = append(files, artifactPath(db.artifactDir, sha))
+		}
+		removed++
+	}
+	if err := rows.Err(); err != nil {
+		return removed, fmt.Errorf("prune scan artifacts rows: %w", err)
+	}
+	for _, path := range files {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("remove scan artifact: %w", err)
+		}
+	}
+	return removed, nil
+}
@@ -6,27 +6,79 @@ import (
 	"strings"
 )
 
+const (
+	ScannerTypeNmap     = "nmap"
+	ScannerTypeMasscan  = "masscan"
+	ScannerTypeNaabu    = "naabu"
+	ScannerTypeRustscan = "rustscan"
+)
+
+// Scan import lifecycle states. Streaming imports stay in staging while their
+// observations are written in batches and only become visible once complete.
+const (
+	ScanImportStatusStaging  = "staging"
+	ScanImportStatusComplete = "complete"
+)
+
+// scanImportTimeSQL is the SQL form of ScanImport.ScanTime for a scan_import
+// aliased as si.
+const scanImportTimeSQL = "COALESCE(si.scan_started_at, si.scan_finished_at, si.import_time)"
+
+// ValidScannerType reports whether the scanner type is supported.
+func ValidScannerType(value string) bool {
+	switch normalizeScannerType(value) {
+	case ScannerTypeNmap, ScannerTypeMasscan, ScannerTypeNaabu, ScannerTypeRustscan:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeScannerType canonicalizes scanner types, defaulting to nmap.
+func normalizeScannerType(value string) string {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	if normalized == "" {
+		return ScannerTypeNmap
+	}
+	return normalized
+}
+
+// normalizeScanImportStatus canonicalizes import status, defaulting to complete.
+func normalizeScanImportStatus(value string) string {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	if normalized == "" {
+		return ScanImportStatusComplete
+	}
+	return normalized
+}
+
 // InsertScanImport records import metadata.
 func (db *DB) InsertScanImport(s ScanImport) (ScanImport, error) {
 	var out ScanImport
 	var sourceIP sql.NullString
 	var sourcePort sql.NullInt64
 	var sourcePortRaw sql.NullString
+	var scanStartedAt, scanFinishedAt sql.NullTime
 	err := db.QueryRow(
 		`INSERT INTO scan_import (
-			project_id, filename, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw
+			project_id, filename, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status,
+			scan_started_at, scan_finished_at
 		 )
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		 RETURNING id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw`,
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status, scan_started_at, scan_finished_at`,
 		s.ProjectID,
 		s.Filename,
 		s.HostsFound,
 		s.PortsFound,
 		s.NmapArgs,
+		normalizeScannerType(s.ScannerType),
 		s.ScannerLabel,
 		nullableStringValue(s.SourceIP),
 		nullableIntValue(s.SourcePort),
 		nullableStringValue(s.SourcePortRaw),
+		normalizeScanImportStatus(s.Status),
+		nullableTimeValue(s.ScanStartedAt),
+		nullableTimeValue(s.ScanFinishedAt),
 	).Scan(
 		&out.ID,
 		&out.ProjectID,
@@ -35,10 +87,14 @@ func (db *DB) InsertScanImport(s ScanImport) (ScanImport, error) {
 		&out.HostsFound,
 		&out.PortsFound,
 		&out.NmapArgs,
+		&out.ScannerType,
 		&out.ScannerLabel,
 		&sourceIP,
 		&sourcePort,
 		&sourcePortRaw,
+		&out.Status,
+		&scanStartedAt,
+		&scanFinishedAt,
 	)
 	if err != nil {
 		return ScanImport{}, fmt.Errorf("insert scan_import: %w", err)
@@ -46,15 +102,17 @@ func (db *DB) InsertScanImport(s ScanImport) (ScanImport, error) {
 	out.SourceIP = ptrStringFromNull(sourceIP)
 	out.SourcePort = ptrIntFromNull(sourcePort)
 	out.SourcePortRaw = ptrStringFromNull(sourcePortRaw)
+	out.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+	out.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
 	return out, nil
 }
 
 // ListScanImports returns scan imports for a project ordered by id.
 func (db *DB) ListScanImports(projectID int64) ([]ScanImport, error) {
 	rows, err := db.Query(
-		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw
-		 FROM scan_import WHERE project_id = ? ORDER BY id`,
-		projectID,
+		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status, scan_started_at, scan_finished_at
+		 FROM scan_import WHERE project_id = ? AND status = ? ORDER BY id`,
+		projectID, ScanImportStatusComplete,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("list scan_import: %w", err)
@@ -67,6 +125,7 @@ func (db *DB) ListScanImports(projectID int64) ([]ScanImport, error) {
 		var sourceIP sql.NullString
 		var sourcePort sql.NullInt64
 		var sourcePortRaw sql.NullString
+		var scanStartedAt, scanFinishedAt sql.NullTime
 		if err := rows.Scan(
 			&s.ID,
 			&s.ProjectID,
@@ -75,16 +134,22 @@ func (db *DB) ListScanImports(projectID int64) ([]ScanImport, error) {
 			&s.HostsFound,
 			&s.PortsFound,
 			&s.NmapArgs,
+			&s.ScannerType,
 			&s.ScannerLabel,
 			&sourceIP,
 			&sourcePort,
 			&sourcePortRaw,
+			&s.Status,
+			&scanStartedAt,
+			&scanFinishedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan scan_import: %w", err)
 		}
 		s.SourceIP = ptrStringFromNull(sourceIP)
 		s.SourcePort = ptrIntFromNull(sourcePort)
 		s.SourcePortRaw = ptrStringFromNull(sourcePortRaw)
+		s.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+		s.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
 		imports = append(imports, s)
 	}
 	if err := rows.Err(); err != nil {
@@ -99,11 +164,12 @@ func (db *DB) GetScanImportForProject(projectID, importID int64) (ScanImport, bo
 	var sourceIP sql.NullString
 	var sourcePort sql.NullInt64
 	var sourcePortRaw sql.NullString
+	var scanStartedAt, scanFinishedAt sql.NullTime
 	err := db.QueryRow(
-		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw
+		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status, scan_started_at, scan_finished_at
 		   FROM scan_import
-		  WHERE id = ? AND project_id = ?`,
-		importID, projectID,
+		  WHERE id = ? AND project_id = ? AND status = ?`,
+		importID, projectID, ScanImportStatusComplete,
 	).Scan(
 		&item.ID,
 		&item.ProjectID,
@@ -112,10 +178,14 @@ func (db *DB) GetScanImportForProject(projectID, importID int64) (ScanImport, bo
 		&item.HostsFound,
 		&item.PortsFound,
 		&item.NmapArgs,
+		&item.ScannerType,
 		&item.ScannerLabel,
 		&sourceIP,
 		&sourcePort,
 		&sourcePortRaw,
+		&item.Status,
+		&scanStartedAt,
+		&scanFinishedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -126,20 +196,122 @@ func (db *DB) GetScanImportForProject(projectID, importID int64) (ScanImport, bo
 	item.SourceIP = ptrStringFromNull(sourceIP)
 	item.SourcePort = ptrIntFromNull(sourcePort)
 	item.SourcePortRaw = ptrStringFromNull(sourcePortRaw)
+	item.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+	item.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
 	return item, true, nil
 }
 
+// DeleteScanImport removes a completed import of a project within a
+// transaction and returns it with the host IPs it observed. Its observations,
+// intents and script results go with it; current host/port state is left for
+// the caller to rebuild. A missing import returns sql.ErrNoRows.
+func (tx *Tx) DeleteScanImport(projectID, importID int64) (ScanImport, []string, error) {
+	var item ScanImport
+	var scanStartedAt, scanFinishedAt sql.NullTime
+	err := tx.QueryRow(
+		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, status, scan_started_at, scan_finished_at
+		   FROM scan_import
+		  WHERE id = ? AND project_id = ? AND status = ?`,
+		importID, projectID, ScanImportStatusComplete,
+	).Scan(&item.ID, &item.ProjectID, &item.Filename, &item.ImportTime, &item.HostsFound, &item.PortsFound,
+		&item.NmapArgs, &item.ScannerType, &item.Status, &scanStartedAt, &scanFinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ScanImport{}, nil, sql.ErrNoRows
+		}
+		return ScanImport{}, nil, fmt.Errorf("get scan import for delete: %w", err)
+	}
+	item.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+	item.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
+
+	ips, err := tx.listImportHostIPs(projectID, importID)
+	if err != nil {
+		return ScanImport{}, nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM scan_import WHERE id = ?`, importID); err != nil {
+		return ScanImport{}, nil, fmt.Errorf("delete scan import: %w", err)
+	}
+	before := map[string]any{
+		"filename": item.Filename, "hosts_found": item.HostsFound, "ports_found": item.PortsFound,
+		"nmap_args": item.NmapArgs, "import_time": item.ImportTime,
+	}
+	event := AuditEvent{ProjectID: projectID, Action: AuditImportDelete, EntityType: AuditEntityScanImport, EntityID: importID}
+	if err := tx.audit(event, before, nil); err != nil {
+		return ScanImport{}, nil, err
+	}
+	return item, ips, nil
+}
+
+// ClearScanImportObservations removes the host, port and script observations
+// of a completed import so it can be parsed again, and returns the import
+// with the host IPs it had observed. The import row and its intents are kept.
+// A missing import returns sql.ErrNoRows.
+func (tx *Tx) ClearScanImportObservations(projectID, importID int64) (ScanImport, []string, error) {
+	var item ScanImport
+	var scanStartedAt, scanFinishedAt sql.NullTime
+	err := tx.QueryRow(
+		`SELECT id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, status, scan_started_at, scan_finished_at
+		   FROM scan_import
+		  WHERE id = ? AND project_id = ? AND status = ?`,
+		importID, projectID, ScanImportStatusComplete,
+	).Scan(&item.ID, &item.ProjectID, &item.Filename, &item.ImportTime, &item.HostsFound, &item.PortsFound,
+		&item.NmapArgs, &item.ScannerType, &item.Status, &scanStartedAt, &scanFinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ScanImport{}, nil, sql.ErrNoRows
+		}
+		return ScanImport{}, nil, fmt.Errorf("get scan import for reparse: %w", err)
+	}
+	item.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+	item.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
+
+	ips, err := tx.listImportHostIPs(projectID, importID)
+	if err != nil {
+		return ScanImport{}, nil, err
+	}
+	for _, table := range []string{"script_result", "port_observation", "host_observation"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE scan_import_id = ?`, importID); err != nil {
+			return ScanImport{}, nil, fmt.Errorf("clear %s: %w", table, err)
+		}
+	}
+	return item, ips, nil
+}
+
+// FinishScanImportReparse records the metadata of a reparsed import and
+// audits the change from before.
+func (tx *Tx) FinishScanImportReparse(before, after ScanImport, scannedPorts string) error {
+	_, err := tx.Exec(
+		`UPDATE scan_import
+		    SET nmap_args = ?, scanner_type = ?, scan_started_at = ?, scan_finished_at = ?, hosts_found = ?, ports_found = ?, scanned_ports = ?
+		  WHERE id = ?`,
+		after.NmapArgs, after.ScannerType, nullableTimeValue(after.ScanStartedAt), nullableTimeValue(after.ScanFinishedAt),
+		after.HostsFound, after.PortsFound, scannedPorts, after.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update reparsed scan import: %w", err)
+	}
+	snapshot := func(item ScanImport) map[string]any {
+		return map[string]any{
+			"hosts_found": item.HostsFound, "ports_found": item.PortsFound,
+			"nmap_args": item.NmapArgs, "scanner_type": item.ScannerType,
+		}
+	}
+	event := AuditEvent{ProjectID: after.ProjectID, Action: AuditImportReparse, EntityType: AuditEntityScanImport, EntityID: after.ID}
+	return tx.audit(event, snapshot(before), snapshot(after))
+}
+
 // ListScanImportsWithIntents returns scan imports with their intent tags.
 func (db *DB) ListScanImportsWithIntents(projectID int64) ([]ScanImportWithIntents, error) {
 	rows, err := db.Query(
 		`SELECT si.id, si.project_id, si.filename, si.import_time, si.hosts_found, si.ports_found,
-		        si.nmap_args, si.scanner_label, si.source_ip, si.source_port, si.source_port_raw,
+		        si.nmap_args, si.scanner_type, si.scanner_label, si.source_ip, si.source_port, si.source_port_raw, si.status, si.scan_started_at, si.scan_finished_at,
+		        COALESCE(si.artifact_sha256, ''),
 		        sii.id, sii.scan_import_id, sii.intent, sii.source, sii.confidence, sii.created_at
 		   FROM scan_import si
 		   LEFT JOIN scan_import_intent sii ON sii.scan_import_id = si.id
-		  WHERE si.project_id = ?
+		  WHERE si.project_id = ? AND si.status = ?
 		  ORDER BY si.id, sii.id`,
-		projectID,
+		projectID, ScanImportStatusComplete,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("list scan imports with intents: %w", err)
@@ -153,6 +325,7 @@ func (db *DB) ListScanImportsWithIntents(projectID int64) ([]ScanImportWithInten
 		var sourceIP sql.NullString
 		var sourcePort sql.NullInt64
 		var sourcePortRaw sql.NullString
+		var scanStartedAt, scanFinishedAt sql.NullTime
 		var intentID sql.NullInt64
 		var intentScanImportID sql.NullInt64
 		var intent sql.NullString
@@ -167,10 +340,15 @@ func (db *DB) ListScanImportsWithIntents(projectID int64) ([]ScanImportWithInten
 			&item.HostsFound,
 			&item.PortsFound,
 			&item.NmapArgs,
+			&item.ScannerType,
 			&item.ScannerLabel,
 			&sourceIP,
 			&sourcePort,
 			&sourcePortRaw,
+			&item.Status,
+			&scanStartedAt,
+			&scanFinishedAt,
+			&item.ArtifactSHA256,
 			&intentID,
 			&intentScanImportID,
 			&intent,
@@ -183,6 +361,8 @@ func (db *DB) ListScanImportsWithIntents(projectID int64) ([]ScanImportWithInten
 		item.SourceIP = ptrStringFromNull(sourceIP)
 		item.SourcePort = ptrIntFromNull(sourcePort)
 		item.SourcePortRaw = ptrStringFromNull(sourcePortRaw)
+		item.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+		item.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
 
 		idx, ok := byID[item.ID]
 		if !ok {
@@ -217,17 +397,22 @@ func (db *DB) SetScanImportIntents(projectID, importID int64, intents []ScanImpo
 	defer tx.Rollback()
 
 	var exists int
-	if err := tx.QueryRow(`SELECT 1 FROM scan_import WHERE id = ? AND project_id = ?`, importID, projectID).Scan(&exists); err != nil {
+	if err := tx.QueryRow(`SELECT 1 FROM scan_import WHERE id = ? AND project_id = ? AND status = ?`, importID, projectID, ScanImportStatusComplete).Scan(&exists); err != nil {
 		if err == sql.ErrNoRows {
 			return sql.ErrNoRows
 		}
 		return fmt.Errorf("check scan import ownership: %w", err)
 	}
 
+	before, err := tx.listIntentInputs(importID)
+	if err != nil {
+		return err
+	}
 	if _, err := tx.Exec(`DELETE FROM scan_import_intent WHERE scan_import_id = ?`, importID); err != nil {
 		return fmt.Errorf("delete scan import intents: %w", err)
 	}
 
+	after := make([]ScanImportIntentInput, 0, len(intents))
 	seen := make(map[string]struct{})
 	for _, input := range intents {
 		intent := strings.TrimSpace(strings.ToLower(input.Intent))
@@ -253,11 +438,16 @@ func (db *DB) SetScanImportIntents(projectID, importID int64, intents []ScanImpo
 		); err != nil {
 			return fmt.Errorf("insert scan import intent: %w", err)
 		}
+		after = append(after, ScanImportIntentInput{Intent: intent, Source: source, Confidence: confidence})
 	}
 
 	if err := syncHostLatestScanForImport(tx, projectID, importID); err != nil {
 		return fmt.Errorf("sync host latest scan for import intents: %w", err)
 	}
+	event := AuditEvent{ProjectID: projectID, Action: AuditImportIntents, EntityType: AuditEntityScanImport, EntityID: importID}
+	if err := tx.audit(event, before, after); err != nil {
+		return err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("commit set scan import intents: %w", err)
@@ -266,6 +456,15 @@ func (db *DB) SetScanImportIntents(projectID, importID int64, intents []ScanImpo
 }
 
 func syncHostLatestScanForImport(tx *Tx, projectID, importID int64) error {
+	ips, err := tx.listImportHostIPs(projectID, importID)
+	if err != nil {
+		return err
+	}
+	return tx.SyncHostLatestScan(projectID, ips)
+}
+
+// listImportHostIPs returns the distinct host IPs an import observed.
+func (tx *Tx) listImportHostIPs(projectID, importID int64) ([]string, error) {
 	rows, err := tx.Query(
 		`SELECT DISTINCT ip_address
 		   FROM host_observation
@@ -273,7 +472,7 @@ func syncHostLatestScanForImport(tx *Tx, projectID, importID int64) error {
 		projectID, importID,
 	)
 	if err != nil {
-		return fmt.Errorf("list observed host ips for import: %w", err)
+		return nil, fmt.Errorf("list observed host ips for import: %w", err)
 	}
 	defer rows.Close()
 
@@ -281,14 +480,19 @@ func syncHostLatestScanForImport(tx *Tx, projectID, importID int64) error {
 	for rows.Next() {
 		var ip string
 		if err := rows.Scan(&ip); err != nil {
-			return fmt.Errorf("scan observed host ip for import: %w", err)
+			return nil, fmt.Errorf("scan observed host ip for import: %w", err)
 		}
 		ips = append(ips, ip)
 	}
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("iterate observed host ips for import: %w", err)
+		return nil, fmt.Errorf("iterate observed host ips for import: %w", err)
 	}
+	return ips, nil
+}
 
+// SyncHostLatestScan re-derives latest_scan for the given host IPs from the
+// intents of the import that most recently observed each one.
+func (tx *Tx) SyncHostLatestScan(projectID int64, ips []string) error {
 	for _, ip := range ips {
 		host, found, err := tx.GetHostByIP(projectID, ip)
 		if err != nil {
@@ -322,16 +526,18 @@ func syncHostLatestScanForImport(tx *Tx, projectID, importID int64) error {
 	return nil
 }
 
+// latestObservedImportForHost returns the import that most recently observed
+// the host by scan time, so importing an older scan later does not win.
 func latestObservedImportForHost(tx *Tx, projectID int64, ip string) (int64, bool, error) {
 	var importID int64
 	err := tx.QueryRow(
 		`SELECT ho.scan_import_id
 		   FROM host_observation ho
 		   JOIN scan_import si ON si.id = ho.scan_import_id
-		  WHERE ho.project_id = ? AND ho.ip_address = ?
-		  ORDER BY si.import_time DESC, ho.scan_import_id DESC
+		  WHERE ho.project_id = ? AND ho.ip_address = ? AND si.status = ?
+		  ORDER BY COALESCE(ho.scan_ended_at, ho.scan_started_at, `+scanImportTimeSQL+`) DESC, ho.scan_import_id DESC
 		  LIMIT 1`,
-		projectID, ip,
+		projectID, ip, ScanImportStatusComplete,
 	).Scan(&importID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -370,3 +576,24 @@ func deriveLatestScanForImport(tx *Tx, importID int64) (string, error) {
 	}
 	return HostLatestScanNone, nil
 }
+
+func (tx *Tx) listIntentInputs(importID int64) ([]ScanImportIntentInput, error) {
+	rows, err := tx.Query(`SELECT intent, source, confidence FROM scan_import_intent WHERE scan_import_id = ? ORDER BY intent`, importID)
+	if err != nil {
+		return nil, fmt.Errorf("list scan import intents: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ScanImportIntentInput{}
+	for rows.Next() {
+		var in ScanImportIntentInput
+		if err := rows.Scan(&in.Intent, &in.Source, &in.Confidence); err != nil {
+			return nil, fmt.Errorf("scan scan import intent: %w", err)
+		}
+		items = append(items, in)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list scan import intents rows: %w", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Reasons two imports are considered the same scan.
+const (
+	// DuplicateContent means the files have the same normalised SHA-256.
+	DuplicateContent = "content"
+	// DuplicateNear means the scans share nmap arguments and start time but
+	// the files differ, e.g. the same run saved twice.
+	DuplicateNear = "near"
+)
+
+// DuplicateImportGroup is a set of completed imports of one project that
+// look like the same scan.
+type DuplicateImportGroup struct {
+	Reason  string            `json:"reason"`
+	Key     string            `json:"key"`
+	Imports []DuplicateImport `json:"imports"`
+}
+
+// DuplicateImport is the summary of an import within a duplicate group.
+type DuplicateImport struct {
+	ID         int64     `json:"id"`
+	Filename   string    `json:"filename"`
+	ImportTime time.Time `json:"import_time"`
+	HostsFound int       `json:"hosts_found"`
+	PortsFound int       `json:"ports_found"`
+}
+
+// FindDuplicateScanImport looks for a completed import of the project other
+// than excludeID that has the same content hash or, failing that, the same
+// nmap arguments and scan start time. It returns the match and which of the
+// two it was. Empty hashes, arguments or a nil start time never match.
+func (tx *Tx) FindDuplicateScanImport(projectID, excludeID int64, contentSHA256, nmapArgs string, startedAt *time.Time) (DuplicateImport, string, bool, error) {
+	if contentSHA256 != "" {
+		match, found, err := scanDuplicateImport(tx.QueryRow(
+			`SELECT id, filename, import_time, hosts_found, ports_found
+			   FROM scan_import
+			  WHERE project_id = ? AND id != ? AND status = ? AND content_sha256 = ?
+			  ORDER BY id LIMIT 1`,
+			projectID, excludeID, ScanImportStatusComplete, contentSHA256,
+		))
+		if err != nil || found {
+			return match, DuplicateContent, found, err
+		}
+	}
+	if nmapArgs == "" || startedAt == nil || startedAt.IsZero() {
+		return DuplicateImport{}, "", false, nil
+	}
+	match, found, err := scanDuplicateImport(tx.QueryRow(
+		`SELECT id, filename, import_time, hosts_found, ports_found
+		   FROM scan_import
+		  WHERE project_id = ? AND id != ? AND status = ? AND nmap_args = ? AND scan_started_at = ?
+		  ORDER BY id LIMIT 1`,
+		projectID, excludeID, ScanImportStatusComplete, nmapArgs, nullableTimeValue(startedAt),
+	))
+	if err != nil || !found {
+		return match, "", found, err
+	}
+	return match, DuplicateNear, true, nil
+}
+
+// FindScanImportByHash returns the first completed import of the project
+// with the given content hash.
+func (db *DB) FindScanImportByHash(projectID int64, contentSHA256 string) (DuplicateImport, bool, error) {
+	return scanDuplicateImport(db.QueryRow(
+		`SELECT id, filename, import_time, hosts_found, ports_found
+		   FROM scan_import
+		  WHERE project_id = ? AND status = ? AND content_sha256 = ?
+		  ORDER BY id LIMIT 1`,
+		projectID, ScanImportStatusComplete, contentSHA256,
+	))
+}
+
+// SetScanImportContentHash records the content hash of an import.
+func (tx *Tx) SetScanImportContentHash(importID int64, contentSHA256 string) error {
+	if contentSHA256 == "" {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE scan_import SET content_sha256 = ? WHERE id = ?`, contentSHA256, importID); err != nil {
+		return fmt.Errorf("set scan_import content hash: %w", err)
+	}
+	return nil
+}
+
+// ListDuplicateImportGroups reports completed imports of a project that share
+// a content hash, or nmap arguments and start time with differing content.
+// Content groups come first; an import may appear in one group of each kind.
+func (db *DB) ListDuplicateImportGroups(projectID int64) ([]DuplicateImportGroup, error) {
+	rows, err := db.Query(
+		`SELECT ?, content_sha256, id, filename, import_time, hosts_found, ports_found
+		   FROM scan_import
+		  WHERE project_id = ? AND status = ? AND content_sha256 IN (
+		        SELECT content_sha256 FROM scan_import
+		         WHERE project_id = ? AND status = ? AND content_sha256 IS NOT NULL
+		         GROUP BY content_sha256 HAVING COUNT(*) > 1)
+		 UNION ALL
+		 SELECT ?, nmap_args || ' @ ' || scan_started_at, id, filename, import_time, hosts_found, ports_found
+		   FROM scan_import
+		  WHERE project_id = ? AND status = ? AND nmap_args != '' AND scan_started_at IS NOT NULL
+		    AND (nmap_args, scan_started_at) IN (
+		        SELECT nmap_args, scan_started_at FROM scan_import
+		         WHERE project_id = ? AND status = ? AND nmap_args != '' AND scan_started_at IS NOT NULL
+		         GROUP BY nmap_args, scan_started_at HAVING COUNT(DISTINCT COALESCE(content_sha256, id)) > 1)
+		  ORDER BY 1, 2, 3`,
+		DuplicateContent, projectID, ScanImportStatusComplete, projectID, ScanImportStatusComplete,
+		DuplicateNear, projectID, ScanImportStatusComplete, projectID, ScanImportStatusComplete,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list duplicate imports: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []DuplicateImportGroup
+	for rows.Next() {
+		var reason, key string
+		var item DuplicateImport
+		if err := rows.Scan(&reason, &key, &item.ID, &item.Filename, &item.ImportTime, &item.HostsFound, &item.PortsFound); err != nil {
+			return nil, fmt.Errorf("scan duplicate import: %w", err)
+		}
+		if n := len(groups); n > 0 && groups[n-1].Reason == reason && groups[n-1].Key == key {
+			groups[n-1].Imports = append(groups[n-1].Imports, item)
+			continue
+		}
+		groups = append(groups, DuplicateImportGroup{Reason: reason, Key: key, Imports: []DuplicateImport{item}})
+	}
+	return groups, rows.Err()
+}
+
+func scanDuplicateImport(row *sql.Row) (DuplicateImport, bool, error) {
+	var item DuplicateImport
+	if err := row.Scan(&item.ID, &item.Filename, &item.ImportTime, &item.HostsFound, &item.PortsFound); err != nil {
+		if err == sql.ErrNoRows {
+			return DuplicateImport{}, false, nil
+		}
+		return DuplicateImport{}, false, fmt.Errorf("find duplicate scan_import: %w", err)
+	}
+	return item, true, nil
+}
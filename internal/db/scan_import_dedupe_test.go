@@ -0,0 +1,72 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateScanImports(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	p, err := db.CreateProject("dupes")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	started := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	insert := func(filename, hash string) ScanImport {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		defer tx.Rollback()
+		record, err := tx.InsertScanImport(ScanImport{ProjectID: p.ID, Filename: filename, NmapArgs: "nmap -sV 10.0.0.0/24", ScanStartedAt: &started})
+		if err != nil {
+			t.Fatalf("insert import: %v", err)
+		}
+		if err := tx.SetScanImportContentHash(record.ID, hash); err != nil {
+			t.Fatalf("set hash: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		return record
+	}
+	a := insert("a.xml", "aaa")
+	b := insert("b.xml", "aaa")
+	c := insert("c.xml", "ccc")
+
+	match, found, err := db.FindScanImportByHash(p.ID, "aaa")
+	if err != nil || !found || match.ID != a.ID {
+		t.Fatalf("find by hash: %+v found=%v err=%v", match, found, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	match, reason, found, err := tx.FindDuplicateScanImport(p.ID, 0, "zzz", "nmap -sV 10.0.0.0/24", &started)
+	if err != nil || !found || reason != DuplicateNear || match.ID != a.ID {
+		t.Fatalf("near duplicate: %+v reason=%q found=%v err=%v", match, reason, found, err)
+	}
+	if _, _, found, err := tx.FindDuplicateScanImport(p.ID, 0, "zzz", "nmap -sV 10.0.0.0/24", nil); err != nil || found {
+		t.Fatalf("expected no match without a start time, found=%v err=%v", found, err)
+	}
+	tx.Rollback()
+
+	groups, err := db.ListDuplicateImportGroups(p.ID)
+	if err != nil {
+		t.Fatalf("list groups: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected content and near groups, got %+v", groups)
+	}
+	if groups[0].Reason != DuplicateContent || groups[0].Key != "aaa" || len(groups[0].Imports) != 2 || groups[0].Imports[1].ID != b.ID {
+		t.Fatalf("unexpected content group: %+v", groups[0])
+	}
+	if groups[1].Reason != DuplicateNear || len(groups[1].Imports) != 3 || groups[1].Imports[2].ID != c.ID {
+		t.Fatalf("unexpected near group: %+v", groups[1])
+	}
+}
@@ -1,6 +1,9 @@
 package db
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 func nullableStringValue(value *string) any {
 	if value == nil {
@@ -31,3 +34,20 @@ func ptrIntFromNull(value sql.NullInt64) *int {
 	v := int(value.Int64)
 	return &v
 }
+
+// nullableTimeValue stores times in UTC using SQLite's CURRENT_TIMESTAMP
+// layout so they compare correctly against import_time and created_at.
+func nullableTimeValue(value *time.Time) any {
+	if value == nil || value.IsZero() {
+		return nil
+	}
+	return value.UTC().Format("2006-01-02 15:04:05")
+}
+
+func ptrTimeFromNull(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	v := value.Time.UTC()
+	return &v
+}
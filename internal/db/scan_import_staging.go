@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MarkScanImportComplete publishes a staged import within a transaction.
+func (tx *Tx) MarkScanImportComplete(id int64) error {
+	res, err := tx.Exec(
+		`UPDATE scan_import SET status = ? WHERE id = ? AND status = ?`,
+		ScanImportStatusComplete, id, ScanImportStatusStaging,
+	)
+	if err != nil {
+		return fmt.Errorf("mark scan_import complete: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("mark scan_import complete rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("mark scan_import complete: import %d is not staging", id)
+	}
+	return nil
+}
+
+// DiscardStagingScanImport deletes a staged import and its observations.
+// Completed imports are left untouched.
+func (db *DB) DiscardStagingScanImport(id int64) error {
+	if _, err := db.Exec(`DELETE FROM scan_import WHERE id = ? AND status = ?`, id, ScanImportStatusStaging); err != nil {
+		return fmt.Errorf("discard staging scan_import: %w", err)
+	}
+	return nil
+}
+
+// PurgeStaleStagingScanImports removes staged imports older than maxAge.
+// These are left behind when an import process dies before publishing.
+func (db *DB) PurgeStaleStagingScanImports(maxAge time.Duration) (int64, error) {
+	res, err := db.Exec(
+		`DELETE FROM scan_import WHERE status = ? AND import_time < datetime('now', ?)`,
+		ScanImportStatusStaging, fmt.Sprintf("-%d seconds", int64(maxAge/time.Second)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("purge staging scan_imports: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge staging scan_imports rows: %w", err)
+	}
+	return affected, nil
+}
+
+// ListHostObservationsAfter pages through the host observations of one import
+// in insertion order, returning at most limit rows with id greater than afterID.
+func (tx *Tx) ListHostObservationsAfter(importID, afterID int64, limit int) ([]HostObservation, error) {
+	rows, err := tx.Query(
+		`SELECT id, scan_import_id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, host_state, scan_started_at, scan_ended_at, created_at
+		   FROM host_observation
+		  WHERE scan_import_id = ? AND id > ?
+		  ORDER BY id
+		  LIMIT ?`,
+		importID, afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("page host observations: %w", err)
+	}
+	defer rows.Close()
+
+	var items []HostObservation
+	for rows.Next() {
+		var obs HostObservation
+		var startedAt, endedAt sql.NullTime
+		if err := rows.Scan(&obs.ID, &obs.ScanImportID, &obs.ProjectID, &obs.IPAddress, &obs.Hostname, &obs.OSGuess, &obs.MACAddress, &obs.MACVendor, &obs.InScope, &obs.HostState, &startedAt, &endedAt, &obs.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan host observation: %w", err)
+		}
+		obs.ScanStartedAt = ptrTimeFromNull(startedAt)
+		obs.ScanEndedAt = ptrTimeFromNull(endedAt)
+		items = append(items, obs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("page host observations rows: %w", err)
+	}
+	return items, nil
+}
+
+// ListPortObservationsForHost returns the port observations recorded for one
+// host within one import. Ordering by the unique key keeps the lookup on the
+// (scan_import_id, ip_address, ...) index rather than scanning the import.
+func (tx *Tx) ListPortObservationsForHost(importID int64, ip string) ([]PortObservation, error) {
+	rows, err := tx.Query(
+		`SELECT id, scan_import_id, project_id, ip_address, port_number, protocol, state,
+		        service, version, product, extra_info, script_output, created_at
+		   FROM port_observation
+		  WHERE scan_import_id = ? AND ip_address = ?
+		  ORDER BY port_number, protocol`,
+		importID, ip,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list host port observations: %w", err)
+	}
+	defer rows.Close()
+
+	var items []PortObservation
+	for rows.Next() {
+		var obs PortObservation
+		if err := rows.Scan(
+			&obs.ID, &obs.ScanImportID, &obs.ProjectID, &obs.IPAddress, &obs.PortNumber, &obs.Protocol, &obs.State,
+			&obs.Service, &obs.Version, &obs.Product, &obs.ExtraInfo, &obs.ScriptOutput, &obs.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan port observation: %w", err)
+		}
+		items = append(items, obs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list host port observations rows: %w", err)
+	}
+	return items, nil
+}
@@ -3,68 +3,100 @@ package db
 import (
 	"database/sql"
 	"fmt"
+
+	"github.com/sloppy/nmaptracker/internal/scope"
 )
 
-// AddScopeDefinition creates a scope entry for a project.
+// AddScopeDefinition validates and creates a scope entry for a project. typ
+// is the rule type ("include" or "exclude"); errors for unparseable
+// definitions wrap scope.ErrInvalidRule. The change is versioned and the
+// project's hosts are re-evaluated in the same transaction.
 func (db *DB) AddScopeDefinition(projectID int64, definition, typ string) (ScopeDefinition, error) {
+	rule, err := scope.ParseRule(definition, typ)
+	if err != nil {
+		return ScopeDefinition{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ScopeDefinition{}, err
+	}
+	defer tx.Rollback()
+
 	var s ScopeDefinition
-	err := db.QueryRow(
+	err = tx.QueryRow(
 		`INSERT INTO scope_definition (project_id, definition, type) VALUES (?, ?, ?) RETURNING id, project_id, definition, type, created_at`,
-		projectID, definition, typ,
+		projectID, rule.Definition, rule.Type,
 	).Scan(&s.ID, &s.ProjectID, &s.Definition, &s.Type, &s.CreatedAt)
 	if err != nil {
 		return ScopeDefinition{}, fmt.Errorf("insert scope_definition: %w", err)
 	}
+	if _, _, err := tx.recordScopeChange(projectID, ScopeActionAdd, snapshotScopeDefinitions([]ScopeDefinition{s})); err != nil {
+		return ScopeDefinition{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ScopeDefinition{}, fmt.Errorf("commit: %w", err)
+	}
 	return s, nil
 }
 
-// BulkAddScopeDefinitions adds multiple scope definitions in a transaction.
-func (db *DB) BulkAddScopeDefinitions(projectID int64, definitions []string) (int, error) {
+// BulkAddScopeDefinitions adds multiple scope definitions of one rule type in
+// a transaction. Every definition is validated before anything is written.
+// The additions are recorded as one scope version, and the project's hosts
+// are re-evaluated before the transaction commits.
+func (db *DB) BulkAddScopeDefinitions(projectID int64, definitions []string, typ string) (ScopeVersion, error) {
+	rules := make([]scope.Rule, 0, len(definitions))
+	for _, def := range definitions {
+		rule, err := scope.ParseRule(def, typ)
+		if err != nil {
+			return ScopeVersion{}, err
+		}
+		rules = append(rules, rule)
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("begin tx: %w", err)
+		return ScopeVersion{}, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO scope_definition (project_id, definition, type) VALUES (?, ?, ?)`)
+	stmt, err := tx.Prepare(`INSERT INTO scope_definition (project_id, definition, type) VALUES (?, ?, ?) RETURNING id`)
 	if err != nil {
-		return 0, fmt.Errorf("prepare stmt: %w", err)
+		return ScopeVersion{}, fmt.Errorf("prepare stmt: %w", err)
 	}
 	defer stmt.Close()
 
-	count := 0
-	for _, def := range definitions {
-		// Simple type inference for DB storage
-		// This mirrors logic in frontend/matcher but strictly for metadata
-		typ := "ip"
-		if len(def) > 0 && (def[len(def)-3] == '/' || def[len(def)-2] == '/') { // simplistic heuristic check for CIDR
-			typ = "cidr"
-		}
-		// Improve heuristic: use netip parsing or just rely on what frontend sends?
-		// Actually, let's just assume we want some value.
-		// Better: logic in handler calls this. But wait, this method takes []string definitions.
-		// It's better if the caller determines type. But for bulk add convenience, maybe we do it here?
-		// Or we change signature to take []ScopeDefinition?
-		// The plan says "BulkAddScopeDefinitions(projectID, definitions)".
-		// I will do simplistic check or just call it 'unknown' if not clear, but let's try to match api.
-
-		// Actually, importing net/netip here to parse is cleaner.
-		// But for now, let's just save it. The Matcher re-parses it anyway.
-		// The 'type' column is mostly for display or querying.
-
-		if _, err := stmt.Exec(projectID, def, typ); err != nil {
-			// Continue or fail?
-			// If duplicate, maybe ignore?
-			// But simpler to return error.
-			return count, fmt.Errorf("insert %q: %w", def, err)
+	changes := make([]ScopeRuleSnapshot, 0, len(rules))
+	for _, rule := range rules {
+		snap := ScopeRuleSnapshot{Definition: rule.Definition, Type: rule.Type}
+		if err := stmt.QueryRow(projectID, rule.Definition, rule.Type).Scan(&snap.ID); err != nil {
+			return ScopeVersion{}, fmt.Errorf("insert %q: %w", rule.Definition, err)
 		}
-		count++
+		changes = append(changes, snap)
 	}
 
+	version, _, err := tx.recordScopeChange(projectID, ScopeActionAdd, changes)
+	if err != nil {
+		return ScopeVersion{}, err
+	}
 	if err := tx.Commit(); err != nil {
-		return count, fmt.Errorf("commit: %w", err)
+		return ScopeVersion{}, fmt.Errorf("commit: %w", err)
 	}
-	return count, nil
+	return version, nil
+}
+
+// ParseScopeRules parses stored scope definitions with the same semantics the
+// importer applies.
+func ParseScopeRules(defs []ScopeDefinition) ([]scope.Rule, error) {
+	rules := make([]scope.Rule, 0, len(defs))
+	for _, def := range defs {
+		rule, err := scope.ParseRule(def.Definition, def.Type)
+		if err != nil {
+			return nil, fmt.Errorf("scope rule %d: %w", def.ID, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
 }
 
 // ListScopeDefinitions returns all scope definitions for a project ordered by id.
@@ -94,24 +126,45 @@ func (db *DB) ListScopeDefinitions(projectID int64) ([]ScopeDefinition, error) {
 
 // DeleteScopeDefinition removes a scope definition by ID.
 func (db *DB) DeleteScopeDefinition(id int64) error {
-	res, err := db.Exec(`DELETE FROM scope_definition WHERE id = ?`, id)
+	var projectID int64
+	if err := db.QueryRow(`SELECT project_id FROM scope_definition WHERE id = ?`, id).Scan(&projectID); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("get scope_definition: %w", err)
+	}
+	_, err := db.DeleteScopeDefinitionForProject(projectID, id)
+	return err
+}
+
+// DeleteScopeDefinitionForProject removes a scope definition scoped to a
+// project, records the removal as a scope version and re-evaluates the
+// project's hosts in the same transaction.
+func (db *DB) DeleteScopeDefinitionForProject(projectID, scopeID int64) (ScopeVersion, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete scope_definition: %w", err)
+		return ScopeVersion{}, err
+	}
+	defer tx.Rollback()
+
+	var removed ScopeRuleSnapshot
+	err = tx.QueryRow(
+		`DELETE FROM scope_definition WHERE id = ? AND project_id = ? RETURNING id, definition, type`,
+		scopeID, projectID,
+	).Scan(&removed.ID, &removed.Definition, &removed.Type)
+	if err == sql.ErrNoRows {
+		return ScopeVersion{}, sql.ErrNoRows
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return sql.ErrNoRows
+	if err != nil {
+		return ScopeVersion{}, fmt.Errorf("delete scope_definition scoped: %w", err)
 	}
-	return nil
-}
 
-// DeleteScopeDefinitionForProject removes a scope definition scoped to a project.
-func (db *DB) DeleteScopeDefinitionForProject(projectID, scopeID int64) error {
-	res, err := db.Exec(`DELETE FROM scope_definition WHERE id = ? AND project_id = ?`, scopeID, projectID)
+	version, _, err := tx.recordScopeChange(projectID, ScopeActionDelete, []ScopeRuleSnapshot{removed})
 	if err != nil {
-		return fmt.Errorf("delete scope_definition scoped: %w", err)
+		return ScopeVersion{}, err
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return sql.ErrNoRows
+	if err := tx.Commit(); err != nil {
+		return ScopeVersion{}, fmt.Errorf("commit: %w", err)
 	}
-	return nil
+	return version, nil
 }
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// Scope version actions.
+const (
+	ScopeActionBaseline = "baseline"
+	ScopeActionAdd      = "add"
+	ScopeActionDelete   = "delete"
+)
+
+// Reasons recorded on host scope transitions.
+const (
+	ScopeTransitionScopeChange = "scope_change"
+	ScopeTransitionEvaluate    = "evaluate"
+	ScopeTransitionImport      = "import"
+	ScopeTransitionMerge       = "merge"
+)
+
+// ScopeRuleSnapshot is a scope definition as recorded in scope history.
+type ScopeRuleSnapshot struct {
+	ID         int64
+	Definition string
+	Type       string
+}
+
+// ScopeVersion is one recorded scope mutation. Changes holds the rules added
+// or removed by it and Rules the complete rule set in effect afterwards.
+type ScopeVersion struct {
+	ID           int64
+	ProjectID    int64
+	Version      int
+	Action       string
+	Actor        string
+	Changes      []ScopeRuleSnapshot
+	Rules        []ScopeRuleSnapshot
+	HostsUpdated int
+	CreatedAt    time.Time
+}
+
+// Matcher builds a scope matcher from the version's rule set.
+func (v ScopeVersion) Matcher() (*scope.Matcher, error) {
+	rules := make([]scope.Rule, 0, len(v.Rules))
+	for _, snap := range v.Rules {
+		rule, err := scope.ParseRule(snap.Definition, snap.Type)
+		if err != nil {
+			return nil, fmt.Errorf("scope version %d rule %d: %w", v.Version, snap.ID, err)
+		}
+		rules = append(rules, rule)
+	}
+	return scope.NewMatcherFromRules(rules), nil
+}
+
+// HostScopeTransition records a change of host.in_scope. ScopeVersionID is
+// set when the change was caused by a scope mutation.
+type HostScopeTransition struct {
+	ID             int64
+	ProjectID      int64
+	HostID         int64
+	IPAddress      string
+	FromInScope    bool
+	ToInScope      bool
+	ScopeVersionID *int64
+	Reason         string
+	CreatedAt      time.Time
+}
+
+// ScopeEvaluation summarises a re-evaluation of a project's hosts.
+type ScopeEvaluation struct {
+	Updated    int
+	InScope    int
+	OutOfScope int
+}
+
+func snapshotScopeDefinitions(defs []ScopeDefinition) []ScopeRuleSnapshot {
+	out := make([]ScopeRuleSnapshot, 0, len(defs))
+	for _, def := range defs {
+		out = append(out, ScopeRuleSnapshot{ID: def.ID, Definition: def.Definition, Type: def.Type})
+	}
+	return out
+}
+
+func (tx *Tx) listScopeDefinitions(projectID int64) ([]ScopeDefinition, error) {
+	rows, err := tx.Query(
+		`SELECT id, project_id, definition, type, created_at FROM scope_definition WHERE project_id = ? ORDER BY id`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scope_definition: %w", err)
+	}
+	defer rows.Close()
+
+	var defs []ScopeDefinition
+	for rows.Next() {
+		var s ScopeDefinition
+		if err := rows.Scan(&s.ID, &s.ProjectID, &s.Definition, &s.Type, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan scope_definition: %w", err)
+		}
+		defs = append(defs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list scope_definition rows: %w", err)
+	}
+	return defs, nil
+}
+
+// recordScopeChange versions a scope mutation already applied in tx, audits
+// each changed rule and re-evaluates every host of the project against the
+// new rule set. The change is attributed to the transaction's actor.
+func (tx *Tx) recordScopeChange(projectID int64, action string, changes []ScopeRuleSnapshot) (ScopeVersion, ScopeEvaluation, error) {
+	defs, err := tx.listScopeDefinitions(projectID)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, err
+	}
+	if changes == nil {
+		changes = []ScopeRuleSnapshot{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, fmt.Errorf("encode scope changes: %w", err)
+	}
+	rules := snapshotScopeDefinitions(defs)
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, fmt.Errorf("encode scope rules: %w", err)
+	}
+
+	v := ScopeVersion{ProjectID: projectID, Action: action, Actor: tx.actor, Changes: changes, Rules: rules}
+	err = tx.QueryRow(
+		`INSERT INTO scope_version (project_id, version, action, actor, changes, rules)
+		 VALUES (?, (SELECT COALESCE(MAX(version), 0) + 1 FROM scope_version WHERE project_id = ?), ?, ?, ?, ?)
+		 RETURNING id, version, created_at`,
+		projectID, projectID, action, tx.actor, string(changesJSON), string(rulesJSON),
+	).Scan(&v.ID, &v.Version, &v.CreatedAt)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, fmt.Errorf("insert scope_version: %w", err)
+	}
+
+	auditAction := AuditScopeAdd
+	if action == ScopeActionDelete {
+		auditAction = AuditScopeDelete
+	}
+	for _, change := range changes {
+		e := AuditEvent{ProjectID: projectID, Action: auditAction, EntityType: AuditEntityScope, EntityID: change.ID}
+		var before, after any
+		if action == ScopeActionDelete {
+			before = change
+		} else {
+			after = change
+		}
+		if err := tx.audit(e, before, after); err != nil {
+			return ScopeVersion{}, ScopeEvaluation{}, err
+		}
+	}
+
+	parsed, err := ParseScopeRules(defs)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, err
+	}
+	eval, err := tx.reevaluateHostScope(projectID, scope.NewMatcherFromRules(parsed), &v.ID, ScopeTransitionScopeChange)
+	if err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, err
+	}
+	if _, err := tx.Exec(`UPDATE scope_version SET hosts_updated = ? WHERE id = ?`, eval.Updated, v.ID); err != nil {
+		return ScopeVersion{}, ScopeEvaluation{}, fmt.Errorf("update scope_version hosts: %w", err)
+	}
+	v.HostsUpdated = eval.Updated
+	return v, eval, nil
+}
+
+// reevaluateHostScope applies matcher to every host of the project, updating
+// in_scope and recording a transition for each host that changed.
+func (tx *Tx) reevaluateHostScope(projectID int64, matcher *scope.Matcher, versionID *int64, reason string) (ScopeEvaluation, error) {
+	type hostScope struct {
+		id       int64
+		ip       string
+		hostname string
+		inScope  bool
+	}
+	rows, err := tx.Query(`SELECT id, ip_address, hostname, in_scope FROM host WHERE project_id = ? ORDER BY id`, projectID)
+	if err != nil {
+		return ScopeEvaluation{}, fmt.Errorf("list hosts for scope: %w", err)
+	}
+	var hosts []hostScope
+	for rows.Next() {
+		var h hostScope
+		if err := rows.Scan(&h.id, &h.ip, &h.hostname, &h.inScope); err != nil {
+			rows.Close()
+			return ScopeEvaluation{}, fmt.Errorf("scan host for scope: %w", err)
+		}
+		hosts = append(hosts, h)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return ScopeEvaluation{}, fmt.Errorf("list hosts for scope rows: %w", err)
+	}
+	rows.Close()
+
+	var eval ScopeEvaluation
+	for _, h := range hosts {
+		inScope := matcher.Match(h.ip, h.hostname)
+		if inScope {
+			eval.InScope++
+		} else {
+			eval.OutOfScope++
+		}
+		if inScope == h.inScope {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE host SET in_scope = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, inScope, h.id); err != nil {
+			return ScopeEvaluation{}, fmt.Errorf("update host scope: %w", err)
+		}
+		if err := tx.InsertHostScopeTransition(HostScopeTransition{
+			ProjectID:      projectID,
+			HostID:         h.id,
+			IPAddress:      h.ip,
+			FromInScope:    h.inScope,
+			ToInScope:      inScope,
+			ScopeVersionID: versionID,
+			Reason:         reason,
+		}); err != nil {
+			return ScopeEvaluation{}, err
+		}
+		eval.Updated++
+	}
+	return eval, nil
+}
+
+// InsertHostScopeTransition records a host scope change within a transaction.
+func (tx *Tx) InsertHostScopeTransition(t HostScopeTransition) error {
+	var versionID sql.NullInt64
+	if t.ScopeVersionID != nil {
+		versionID = sql.NullInt64{Int64: *t.ScopeVersionID, Valid: true}
+	}
+	_, err := tx.Exec(
+		`INSERT INTO host_scope_transition (project_id, host_id, ip_address, from_in_scope, to_in_scope, scope_version_id, reason)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ProjectID, t.HostID, t.IPAddress, t.FromInScope, t.ToInScope, versionID, t.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("insert host_scope_transition: %w", err)
+	}
+	return nil
+}
+
+// EvaluateScope re-evaluates every host of a project against its current
+// scope definitions. Changed hosts get a transition with no scope version.
+func (db *DB) EvaluateScope(projectID int64) (ScopeEvaluation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return ScopeEvaluation{}, err
+	}
+	defer tx.Rollback()
+
+	defs, err := tx.listScopeDefinitions(projectID)
+	if err != nil {
+		return ScopeEvaluation{}, err
+	}
+	rules, err := ParseScopeRules(defs)
+	if err != nil {
+		return ScopeEvaluation{}, err
+	}
+	eval, err := tx.reevaluateHostScope(projectID, scope.NewMatcherFromRules(rules), nil, ScopeTransitionEvaluate)
+	if err != nil {
+		return ScopeEvaluation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ScopeEvaluation{}, fmt.Errorf("commit scope evaluation: %w", err)
+	}
+	return eval, nil
+}
+
+const scopeVersionColumns = `id, project_id, version, action, actor, changes, rules, hosts_updated, created_at`
+
+func scanScopeVersion(row interface{ Scan(...any) error }) (ScopeVersion, error) {
+	var v ScopeVersion
+	var changes, rules string
+	if err := row.Scan(&v.ID, &v.ProjectID, &v.Version, &v.Action, &v.Actor, &changes, &rules, &v.HostsUpdated, &v.CreatedAt); err != nil {
+		return ScopeVersion{}, err
+	}
+	if err := json.Unmarshal([]byte(changes), &v.Changes); err != nil {
+		return ScopeVersion{}, fmt.Errorf("decode scope version %d changes: %w", v.ID, err)
+	}
+	if err := json.Unmarshal([]byte(rules), &v.Rules); err != nil {
+		return ScopeVersion{}, fmt.Errorf("decode scope version %d rules: %w", v.ID, err)
+	}
+	return v, nil
+}
+
+// ListScopeVersions returns a project's scope history, newest first.
+func (db *DB) ListScopeVersions(projectID int64) ([]ScopeVersion, error) {
+	rows, err := db.Query(
+		`SELECT `+scopeVersionColumns+` FROM scope_version WHERE project_id = ? ORDER BY version DESC`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scope_version: %w", err)
+	}
+	defer rows.Close()
+
+	var items []ScopeVersion
+	for rows.Next() {
+		v, err := scanScopeVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan scope_version: %w", err)
+		}
+		items = append(items, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list scope_version rows: %w", err)
+	}
+	return items, nil
+}
+
+// GetScopeVersionAt returns the scope version in effect at the given time:
+// the latest version recorded at or before it. ok is false when the project
+// had no recorded scope yet, meaning every host was in scope.
+func (db *DB) GetScopeVersionAt(projectID int64, at time.Time) (ScopeVersion, bool, error) {
+	row := db.QueryRow(
+		`SELECT `+scopeVersionColumns+` FROM scope_version
+		  WHERE project_id = ? AND created_at <= ?
+		  ORDER BY created_at DESC, version DESC
+		  LIMIT 1`,
+		projectID, at.UTC().Format("2006-01-02 15:04:05"),
+	)
+	v, err := scanScopeVersion(row)
+	if err == sql.ErrNoRows {
+		return ScopeVersion{}, false, nil
+	}
+	if err != nil {
+		return ScopeVersion{}, false, fmt.Errorf("get scope_version at: %w", err)
+	}
+	return v, true, nil
+}
+
+// ListHostScopeTransitions returns the scope transitions of one host, oldest
+// first.
+func (db *DB) ListHostScopeTransitions(projectID, hostID int64) ([]HostScopeTransition, error) {
+	rows, err := db.Query(
+		`SELECT id, project_id, host_id, ip_address, from_in_scope, to_in_scope, scope_version_id, reason, created_at
+		   FROM host_scope_transition
+		  WHERE project_id = ? AND host_id = ?
+		  ORDER BY id`,
+		projectID, hostID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list host_scope_transition: %w", err)
+	}
+	defer rows.Close()
+
+	var items []HostScopeTransition
+	for rows.Next() {
+		var t HostScopeTransition
+		var versionID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.ProjectID, &t.HostID, &t.IPAddress, &t.FromInScope, &t.ToInScope, &versionID, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan host_scope_transition: %w", err)
+		}
+		if versionID.Valid {
+			id := versionID.Int64
+			t.ScopeVersionID = &id
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list host_scope_transition rows: %w", err)
+	}
+	return items, nil
+}
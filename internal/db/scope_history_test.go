@@ -0,0 +1,154 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScopeChangesAreVersionedAndReevaluateHosts(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	p, err := db.CreateProject("scope-history")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	hosts := map[string]Host{}
+	for _, ip := range []string{"10.0.0.5", "10.0.1.5"} {
+		h, err := db.UpsertHost(Host{ProjectID: p.ID, IPAddress: ip, InScope: true})
+		if err != nil {
+			t.Fatalf("upsert host: %v", err)
+		}
+		hosts[ip] = h
+	}
+	inScope := func(ip string) bool {
+		t.Helper()
+		h, _, err := db.GetHostByID(hosts[ip].ID)
+		if err != nil {
+			t.Fatalf("get host: %v", err)
+		}
+		return h.InScope
+	}
+
+	v1, err := db.WithActor("alice").BulkAddScopeDefinitions(p.ID, []string{"10.0.0.0/24"}, "include")
+	if err != nil {
+		t.Fatalf("add include: %v", err)
+	}
+	if v1.Version != 1 || v1.Action != ScopeActionAdd || v1.Actor != "alice" || v1.HostsUpdated != 1 {
+		t.Fatalf("unexpected first version: %+v", v1)
+	}
+	if !inScope("10.0.0.5") || inScope("10.0.1.5") {
+		t.Fatalf("expected include to take 10.0.1.5 out of scope")
+	}
+
+	v2, err := db.WithActor("bob").BulkAddScopeDefinitions(p.ID, []string{"10.0.0.5"}, "exclude")
+	if err != nil {
+		t.Fatalf("add exclude: %v", err)
+	}
+	if v2.Version != 2 || len(v2.Rules) != 2 || len(v2.Changes) != 1 || v2.Changes[0].Type != "exclude" {
+		t.Fatalf("unexpected second version: %+v", v2)
+	}
+	if inScope("10.0.0.5") {
+		t.Fatalf("expected exclude to take 10.0.0.5 out of scope")
+	}
+
+	v3, err := db.WithActor("bob").DeleteScopeDefinitionForProject(p.ID, v2.Changes[0].ID)
+	if err != nil {
+		t.Fatalf("delete exclude: %v", err)
+	}
+	if v3.Version != 3 || v3.Action != ScopeActionDelete || len(v3.Rules) != 1 || v3.HostsUpdated != 1 {
+		t.Fatalf("unexpected third version: %+v", v3)
+	}
+	if !inScope("10.0.0.5") {
+		t.Fatalf("expected deleting the exclude to restore 10.0.0.5")
+	}
+
+	transitions, err := db.ListHostScopeTransitions(p.ID, hosts["10.0.0.5"].ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(transitions) != 2 ||
+		transitions[0].ToInScope || transitions[0].ScopeVersionID == nil || *transitions[0].ScopeVersionID != v2.ID ||
+		!transitions[1].ToInScope || transitions[1].ScopeVersionID == nil || *transitions[1].ScopeVersionID != v3.ID ||
+		transitions[1].Reason != ScopeTransitionScopeChange {
+		t.Fatalf("unexpected transitions: %+v", transitions)
+	}
+
+	if err := db.UpdateHostScope(hosts["10.0.1.5"].ID, true); err != nil {
+		t.Fatalf("force host in scope: %v", err)
+	}
+	eval, err := db.EvaluateScope(p.ID)
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if eval.Updated != 1 || eval.InScope != 1 || eval.OutOfScope != 1 {
+		t.Fatalf("unexpected evaluation: %+v", eval)
+	}
+	transitions, err = db.ListHostScopeTransitions(p.ID, hosts["10.0.1.5"].ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if last := transitions[len(transitions)-1]; last.Reason != ScopeTransitionEvaluate || last.ScopeVersionID != nil {
+		t.Fatalf("unexpected evaluate transition: %+v", last)
+	}
+
+	versions, err := db.ListScopeVersions(p.ID)
+	if err != nil {
+		t.Fatalf("list versions: %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 3 {
+		t.Fatalf("unexpected history: %+v", versions)
+	}
+}
+
+func TestGetScopeVersionAt(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	p, err := db.CreateProject("scope-as-of")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, err := db.BulkAddScopeDefinitions(p.ID, []string{"10.0.0.0/24"}, "include"); err != nil {
+		t.Fatalf("add include: %v", err)
+	}
+	if _, err := db.BulkAddScopeDefinitions(p.ID, []string{"10.0.0.5"}, "exclude"); err != nil {
+		t.Fatalf("add exclude: %v", err)
+	}
+	for version, at := range map[int]string{1: "2024-03-01 09:00:00", 2: "2024-03-10 09:00:00"} {
+		if _, err := db.Exec(`UPDATE scope_version SET created_at = ? WHERE project_id = ? AND version = ?`, at, p.ID, version); err != nil {
+			t.Fatalf("backdate version: %v", err)
+		}
+	}
+
+	if _, found, err := db.GetScopeVersionAt(p.ID, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)); err != nil || found {
+		t.Fatalf("expected no scope before the first version: found=%v err=%v", found, err)
+	}
+
+	v, found, err := db.GetScopeVersionAt(p.ID, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil || !found {
+		t.Fatalf("get scope at: found=%v err=%v", found, err)
+	}
+	if v.Version != 1 || len(v.Rules) != 1 {
+		t.Fatalf("unexpected version: %+v", v)
+	}
+	matcher, err := v.Matcher()
+	if err != nil {
+		t.Fatalf("matcher: %v", err)
+	}
+	if !matcher.InScope("10.0.0.5") {
+		t.Fatalf("expected 10.0.0.5 in scope before the exclude was added")
+	}
+
+	v, _, err = db.GetScopeVersionAt(p.ID, time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("get scope at: %v", err)
+	}
+	matcher, err = v.Matcher()
+	if err != nil {
+		t.Fatalf("matcher: %v", err)
+	}
+	if v.Version != 2 || matcher.InScope("10.0.0.5") {
+		t.Fatalf("expected the exclude to apply from version 2: %+v", v)
+	}
+}
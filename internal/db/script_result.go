@@ -0,0 +1,178 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScriptResultQuery filters ListScriptResults. Empty fields match everything.
+type ScriptResultQuery struct {
+	ScriptID  string
+	IPAddress string
+	// ElementKey is a dotted path into the parsed element tree, for example
+	// "subject.commonName" for ssl-cert. Array elements are addressed by
+	// zero-based index. Results without the key are dropped.
+	ElementKey string
+	// Value is a case-insensitive substring matched against the element at
+	// ElementKey, or against the raw output when no key is given.
+	Value string
+}
+
+// ScriptResultMatch is a script result with the element resolved by the query.
+type ScriptResultMatch struct {
+	ScriptResult
+	Value json.RawMessage
+}
+
+// InsertScriptResult stores one script result within a transaction. A
+// repeated script on the same host/port within one import replaces the
+// earlier row.
+func (tx *Tx) InsertScriptResult(r ScriptResult) error {
+	elements := string(r.Elements)
+	if len(r.Elements) == 0 {
+		elements = "null"
+	}
+	_, err := tx.Exec(
+		`INSERT INTO script_result (scan_import_id, project_id, ip_address, port_number, protocol, script_id, output, elements)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(scan_import_id, ip_address, port_number, protocol, script_id) DO UPDATE SET
+		   output=excluded.output,
+		   elements=excluded.elements`,
+		r.ScanImportID, r.ProjectID, r.IPAddress, r.PortNumber, r.Protocol, r.ScriptID, r.Output, elements,
+	)
+	if err != nil {
+		return fmt.Errorf("insert script result: %w", err)
+	}
+	return nil
+}
+
+// ListScriptResults returns the most recent result (by scan time) of each
+// script per host/port across completed imports, ordered by host address and
+// port.
+func (db *DB) ListScriptResults(projectID int64, q ScriptResultQuery) ([]ScriptResultMatch, error) {
+	where := []string{"sr.project_id = ?", "si.status = ?"}
+	args := []any{projectID, ScanImportStatusComplete}
+	if scriptID := strings.TrimSpace(q.ScriptID); scriptID != "" {
+		where = append(where, "sr.script_id = ?")
+		args = append(args, scriptID)
+	}
+	if ip := strings.TrimSpace(q.IPAddress); ip != "" {
+		where = append(where, "sr.ip_address = ?")
+		args = append(args, ip)
+	}
+
+	rows, err := db.Query(
+		`SELECT r.id, r.scan_import_id, r.project_id, r.ip_address, r.port_number, r.protocol,
+		        r.script_id, r.output, r.elements, r.created_at
+		   FROM (
+		         SELECT sr.*,
+		                ROW_NUMBER() OVER (
+		                  PARTITION BY sr.ip_address, sr.port_number, sr.protocol, sr.script_id
+		                  ORDER BY `+scanImportTimeSQL+` DESC, sr.scan_import_id DESC
+		                ) AS rn
+		           FROM script_result sr
+		           JOIN scan_import si ON si.id = sr.scan_import_id
+		          WHERE `+strings.Join(where, " AND ")+`
+		        ) r
+		   LEFT JOIN host h ON h.project_id = r.project_id AND h.ip_address = r.ip_address
+		  WHERE r.rn = 1
+		  ORDER BY h.ip_key, r.ip_address, r.port_number, r.protocol, r.script_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list script results: %w", err)
+	}
+	defer rows.Close()
+
+	key := strings.TrimSpace(q.ElementKey)
+	needle := strings.ToLower(strings.TrimSpace(q.Value))
+	var items []ScriptResultMatch
+	for rows.Next() {
+		var r ScriptResult
+		var elements string
+		if err := rows.Scan(&r.ID, &r.ScanImportID, &r.ProjectID, &r.IPAddress, &r.PortNumber, &r.Protocol, &r.ScriptID, &r.Output, &elements, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan script result: %w", err)
+		}
+		r.Elements = json.RawMessage(elements)
+
+		match := ScriptResultMatch{ScriptResult: r}
+		haystack := r.Output
+		if key != "" {
+			value, ok := LookupScriptElement(r.Elements, key)
+			if !ok {
+				continue
+			}
+			match.Value = value
+			haystack = scriptElementText(value)
+		}
+		if needle != "" && !strings.Contains(strings.ToLower(haystack), needle) {
+			continue
+		}
+		items = append(items, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list script results rows: %w", err)
+	}
+	return items, nil
+}
+
+// LookupScriptElement resolves a dotted path within a script element tree.
+// Nmap keys may themselves contain dots (addresses, OIDs), so at each level
+// the longest run of segments naming an existing key wins.
+func LookupScriptElement(elements json.RawMessage, path string) (json.RawMessage, bool) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return elements, len(elements) > 0
+	}
+	return lookupScriptSegments(elements, strings.Split(path, "."))
+}
+
+func lookupScriptSegments(node json.RawMessage, segments []string) (json.RawMessage, bool) {
+	if len(segments) == 0 {
+		return node, true
+	}
+	trimmed := bytes.TrimSpace(node)
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+	switch trimmed[0] {
+	case '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return nil, false
+		}
+		for n := len(segments); n > 0; n-- {
+			child, ok := obj[strings.Join(segments[:n], ".")]
+			if !ok {
+				continue
+			}
+			if value, ok := lookupScriptSegments(child, segments[n:]); ok {
+				return value, true
+			}
+		}
+	case '[':
+		var arr []json.RawMessage
+		if err := json.Unmarshal(trimmed, &arr); err != nil {
+			return nil, false
+		}
+		idx, err := strconv.Atoi(segments[0])
+		if err != nil || idx < 0 || idx >= len(arr) {
+			return nil, false
+		}
+		return lookupScriptSegments(arr[idx], segments[1:])
+	}
+	return nil, false
+}
+
+// scriptElementText renders a resolved element for substring matching:
+// strings are unquoted, tables are matched on their JSON text.
+func scriptElementText(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text
+	}
+	return string(value)
+}
@@ -171,7 +171,7 @@ func (db *DB) ListServiceCampaignQueue(projectID int64, campaigns []string, limi
 		`SELECT h.id, h.ip_address, h.hostname
 		   %s
 		  GROUP BY h.id, h.ip_address, h.hostname, h.ip_int
-		  ORDER BY CASE WHEN h.ip_int IS NULL THEN 1 ELSE 0 END, h.ip_int, h.ip_address
+		  ORDER BY CASE WHEN h.ip_key IS NULL THEN 1 ELSE 0 END, h.ip_key, h.ip_address
 		  LIMIT ? OFFSET ?`,
 		baseWhere,
 	)
@@ -219,7 +219,7 @@ func (db *DB) ListServiceCampaignQueue(projectID int64, campaigns []string, limi
 		    AND h.in_scope = 1
 		    AND p.state IN ('open', 'open|filtered')
 		    AND %s
-		  ORDER BY CASE WHEN h.ip_int IS NULL THEN 1 ELSE 0 END, h.ip_int, h.ip_address, p.port_number, p.protocol`,
+		  ORDER BY CASE WHEN h.ip_key IS NULL THEN 1 ELSE 0 END, h.ip_key, h.ip_address, p.port_number, p.protocol`,
 		makePlaceholders(len(hostIDs)),
 		combinedPredicate,
 	)
@@ -303,19 +303,21 @@ func (db *DB) listServiceQueueSourceImportIDs(projectID int64, hostIPs []string)
 		return []int64{}, nil
 	}
 
-	args := make([]any, 0, len(hostIPs)+1)
-	args = append(args, projectID)
+	args := make([]any, 0, len(hostIPs)+2)
+	args = append(args, projectID, ScanImportStatusComplete)
 	for _, ip := range hostIPs {
 		args = append(args, ip)
 	}
 
 	rows, err := db.Query(
 		fmt.Sprintf(
-			`SELECT DISTINCT scan_import_id
-			   FROM host_observation
-			  WHERE project_id = ?
-			    AND ip_address IN (%s)
-			  ORDER BY scan_import_id`,
+			`SELECT DISTINCT ho.scan_import_id
+			   FROM host_observation ho
+			   JOIN scan_import si ON si.id = ho.scan_import_id
+			  WHERE ho.project_id = ?
+			    AND si.status = ?
+			    AND ho.ip_address IN (%s)
+			  ORDER BY ho.scan_import_id`,
 			makePlaceholders(len(hostIPs)),
 		),
 		args...,
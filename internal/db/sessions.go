@@ -0,0 +1,163 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks bearer tokens so they are recognisable in scripts and
+// secret scanners.
+const APITokenPrefix = "nmt_"
+
+// APIToken describes a bearer token. The secret itself is only returned once,
+// by CreateAPIToken.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateSession starts a browser session for a user and returns the cookie
+// value.
+func (db *DB) CreateSession(userID int64, ttl time.Duration) (string, time.Time, error) {
+	token, err := newSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	if _, err := db.Exec(
+		`INSERT INTO user_session (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		hashSecret(token), userID, expires.Format("2006-01-02 15:04:05"),
+	); err != nil {
+		return "", time.Time{}, fmt.Errorf("insert user_session: %w", err)
+	}
+	return token, expires, nil
+}
+
+// GetSessionUser resolves an unexpired session cookie to its user.
+func (db *DB) GetSessionUser(token string) (User, bool, error) {
+	var u User
+	err := db.QueryRow(
+		`SELECT u.id, u.username, u.is_admin, u.created_at, u.updated_at
+		   FROM user_session s
+		   JOIN app_user u ON u.id = s.user_id
+		  WHERE s.token_hash = ? AND s.expires_at > ?`,
+		hashSecret(token), time.Now().UTC().Format("2006-01-02 15:04:05"),
+	).Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, false, nil
+		}
+		return User{}, false, fmt.Errorf("get session user: %w", err)
+	}
+	return u, true, nil
+}
+
+// DeleteSession ends a browser session. Unknown tokens are ignored.
+func (db *DB) DeleteSession(token string) error {
+	if _, err := db.Exec(`DELETE FROM user_session WHERE token_hash = ?`, hashSecret(token)); err != nil {
+		return fmt.Errorf("delete user_session: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIToken issues a bearer token for a user and returns its secret.
+func (db *DB) CreateAPIToken(userID int64, name string) (APIToken, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret = APITokenPrefix + secret
+	var t APIToken
+	err = db.QueryRow(
+		`INSERT INTO api_token (user_id, name, token_hash) VALUES (?, ?, ?)
+		 RETURNING id, user_id, name, created_at`,
+		userID, strings.TrimSpace(name), hashSecret(secret),
+	).Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("insert api_token: %w", err)
+	}
+	return t, secret, nil
+}
+
+// ListAPITokens returns a user's tokens, newest first.
+func (db *DB) ListAPITokens(userID int64) ([]APIToken, error) {
+	rows, err := db.Query(
+		`SELECT id, user_id, name, created_at, last_used_at FROM api_token WHERE user_id = ? ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list api_token: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("scan api_token: %w", err)
+		}
+		t.LastUsedAt = ptrTimeFromNull(lastUsed)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api_token rows: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken revokes one of a user's tokens.
+func (db *DB) DeleteAPIToken(userID, tokenID int64) error {
+	res, err := db.Exec(`DELETE FROM api_token WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("delete api_token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAPITokenUser resolves a bearer token to its user and records its use.
+func (db *DB) GetAPITokenUser(secret string) (User, bool, error) {
+	var u User
+	var tokenID int64
+	err := db.QueryRow(
+		`SELECT t.id, u.id, u.username, u.is_admin, u.created_at, u.updated_at
+		   FROM api_token t
+		   JOIN app_user u ON u.id = t.user_id
+		  WHERE t.token_hash = ?`,
+		hashSecret(secret),
+	).Scan(&tokenID, &u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, false, nil
+		}
+		return User{}, false, fmt.Errorf("get api token user: %w", err)
+	}
+	if _, err := db.Exec(`UPDATE api_token SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`, tokenID); err != nil {
+		return User{}, false, fmt.Errorf("touch api_token: %w", err)
+	}
+	return u, true, nil
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,13 +1,16 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 // Tx wraps sql.Tx to reuse DB helpers within a transaction.
 type Tx struct {
 	*sql.Tx
+	actor string
 }
 
 // Begin starts a transaction on the DB.
@@ -16,7 +19,17 @@ func (db *DB) Begin() (*Tx, error) {
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
 	}
-	return &Tx{Tx: tx}, nil
+	return &Tx{Tx: tx, actor: db.actor}, nil
+}
+
+// BeginRead starts a read-only transaction. Unlike Begin it does not take the
+// write lock, so a long read does not hold up imports.
+func (db *DB) BeginRead() (*Tx, error) {
+	tx, err := db.DB.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin read tx: %w", err)
+	}
+	return &Tx{Tx: tx, actor: db.actor}, nil
 }
 
 // InsertScanImport records import metadata within a transaction.
@@ -25,21 +38,27 @@ func (tx *Tx) InsertScanImport(s ScanImport) (ScanImport, error) {
 	var sourceIP sql.NullString
 	var sourcePort sql.NullInt64
 	var sourcePortRaw sql.NullString
+	var scanStartedAt, scanFinishedAt sql.NullTime
 	err := tx.QueryRow(
 		`INSERT INTO scan_import (
-			project_id, filename, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw
+			project_id, filename, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status,
+			scan_started_at, scan_finished_at
 		 )
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		 RETURNING id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_label, source_ip, source_port, source_port_raw`,
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id, project_id, filename, import_time, hosts_found, ports_found, nmap_args, scanner_type, scanner_label, source_ip, source_port, source_port_raw, status, scan_started_at, scan_finished_at`,
 		s.ProjectID,
 		s.Filename,
 		s.HostsFound,
 		s.PortsFound,
 		s.NmapArgs,
+		normalizeScannerType(s.ScannerType),
 		s.ScannerLabel,
 		nullableStringValue(s.SourceIP),
 		nullableIntValue(s.SourcePort),
 		nullableStringValue(s.SourcePortRaw),
+		normalizeScanImportStatus(s.Status),
+		nullableTimeValue(s.ScanStartedAt),
+		nullableTimeValue(s.ScanFinishedAt),
 	).Scan(
 		&out.ID,
 		&out.ProjectID,
@@ -48,10 +67,14 @@ func (tx *Tx) InsertScanImport(s ScanImport) (ScanImport, error) {
 		&out.HostsFound,
 		&out.PortsFound,
 		&out.NmapArgs,
+		&out.ScannerType,
 		&out.ScannerLabel,
 		&sourceIP,
 		&sourcePort,
 		&sourcePortRaw,
+		&out.Status,
+		&scanStartedAt,
+		&scanFinishedAt,
 	)
 	if err != nil {
 		return ScanImport{}, fmt.Errorf("insert scan_import: %w", err)
@@ -59,9 +82,23 @@ func (tx *Tx) InsertScanImport(s ScanImport) (ScanImport, error) {
 	out.SourceIP = ptrStringFromNull(sourceIP)
 	out.SourcePort = ptrIntFromNull(sourcePort)
 	out.SourcePortRaw = ptrStringFromNull(sourcePortRaw)
+	out.ScanStartedAt = ptrTimeFromNull(scanStartedAt)
+	out.ScanFinishedAt = ptrTimeFromNull(scanFinishedAt)
 	return out, nil
 }
 
+// UpdateScanImportScanTimes records the scanner's run start/finish times for a scan import within a transaction.
+func (tx *Tx) UpdateScanImportScanTimes(id int64, startedAt, finishedAt *time.Time) error {
+	_, err := tx.Exec(
+		`UPDATE scan_import SET scan_started_at = ?, scan_finished_at = ? WHERE id = ?`,
+		nullableTimeValue(startedAt), nullableTimeValue(finishedAt), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update scan_import scan times: %w", err)
+	}
+	return nil
+}
+
 // UpdateScanImportSourceMetadata updates source metadata fields for a scan import within a transaction.
 func (tx *Tx) UpdateScanImportSourceMetadata(id int64, nmapArgs string, sourceIP *string, sourcePort *int, sourcePortRaw *string) error {
 	_, err := tx.Exec(
@@ -108,10 +145,10 @@ func (tx *Tx) UpdateScanImportCounts(id int64, hostsFound, portsFound int) error
 func (tx *Tx) GetHostByIP(projectID int64, ip string) (Host, bool, error) {
 	var h Host
 	err := tx.QueryRow(
-		`SELECT id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at
+		`SELECT id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at
 		 FROM host WHERE project_id = ? AND ip_address = ?`,
 		projectID, ip,
-	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
+	).Scan(&h.ID, &h.ProjectID, &h.IPAddress, &h.Hostname, &h.OSGuess, &h.MACAddress, &h.MACVendor, &h.LatestScan, &h.InScope, &h.Notes, &h.CreatedAt, &h.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Host{}, false, nil
@@ -128,19 +165,26 @@ func (tx *Tx) UpsertHost(h Host) (Host, error) {
 	if value, ok := ipv4ToInt(h.IPAddress); ok {
 		ipInt = value
 	}
+	var key any
+	if value, ok := ipKey(h.IPAddress); ok {
+		key = value
+	}
 	err := tx.QueryRow(
-		`INSERT INTO host (project_id, ip_address, hostname, os_guess, in_scope, notes, ip_int)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		`INSERT INTO host (project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, in_scope, notes, ip_int, ip_key)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(project_id, ip_address) DO UPDATE SET
 		   hostname=excluded.hostname,
 		   os_guess=excluded.os_guess,
+		   mac_address=excluded.mac_address,
+		   mac_vendor=excluded.mac_vendor,
 		   in_scope=excluded.in_scope,
 		   notes=excluded.notes,
 		   ip_int=excluded.ip_int,
+		   ip_key=excluded.ip_key,
 		   updated_at=CURRENT_TIMESTAMP
-		 RETURNING id, project_id, ip_address, hostname, os_guess, latest_scan, in_scope, notes, created_at, updated_at`,
-		h.ProjectID, h.IPAddress, h.Hostname, h.OSGuess, h.InScope, h.Notes, ipInt,
-	).Scan(&out.ID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.OSGuess, &out.LatestScan, &out.InScope, &out.Notes, &out.CreatedAt, &out.UpdatedAt)
+		 RETURNING id, project_id, ip_address, hostname, os_guess, mac_address, mac_vendor, latest_scan, in_scope, notes, created_at, updated_at`,
+		h.ProjectID, h.IPAddress, h.Hostname, h.OSGuess, h.MACAddress, h.MACVendor, h.InScope, h.Notes, ipInt, key,
+	).Scan(&out.ID, &out.ProjectID, &out.IPAddress, &out.Hostname, &out.OSGuess, &out.MACAddress, &out.MACVendor, &out.LatestScan, &out.InScope, &out.Notes, &out.CreatedAt, &out.UpdatedAt)
 	if err != nil {
 		return Host{}, fmt.Errorf("upsert host: %w", err)
 	}
@@ -151,10 +195,10 @@ func (tx *Tx) UpsertHost(h Host) (Host, error) {
 func (tx *Tx) GetPortByKey(hostID int64, portNumber int, protocol string) (Port, bool, error) {
 	var p Port
 	err := tx.QueryRow(
-		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at
+		`SELECT id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at
 		 FROM port WHERE host_id = ? AND port_number = ? AND protocol = ?`,
 		hostID, portNumber, protocol,
-	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.CreatedAt, &p.UpdatedAt)
+	).Scan(&p.ID, &p.HostID, &p.PortNumber, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product, &p.ExtraInfo, &p.WorkStatus, &p.ScriptOutput, &p.Notes, &p.LastSeen, &p.NotObservedAt, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Port{}, false, nil
@@ -173,8 +217,8 @@ func (tx *Tx) UpsertPort(p Port) (Port, error) {
 
 	var out Port
 	err := tx.QueryRow(
-		`INSERT INTO port (host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))
+		`INSERT INTO port (host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?)
 		 ON CONFLICT(host_id, port_number, protocol) DO UPDATE SET
 		   state=excluded.state,
 		   service=excluded.service,
@@ -185,10 +229,11 @@ func (tx *Tx) UpsertPort(p Port) (Port, error) {
 		   script_output=excluded.script_output,
 		   notes=excluded.notes,
 		   last_seen=COALESCE(excluded.last_seen, port.last_seen, CURRENT_TIMESTAMP),
+		   not_observed_at=excluded.not_observed_at,
 		   updated_at=CURRENT_TIMESTAMP
-		 RETURNING id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, created_at, updated_at`,
-		p.HostID, p.PortNumber, p.Protocol, p.State, p.Service, p.Version, p.Product, p.ExtraInfo, p.WorkStatus, p.ScriptOutput, p.Notes, lastSeen,
-	).Scan(&out.ID, &out.HostID, &out.PortNumber, &out.Protocol, &out.State, &out.Service, &out.Version, &out.Product, &out.ExtraInfo, &out.WorkStatus, &out.ScriptOutput, &out.Notes, &out.LastSeen, &out.CreatedAt, &out.UpdatedAt)
+		 RETURNING id, host_id, port_number, protocol, state, service, version, product, extra_info, work_status, script_output, notes, last_seen, not_observed_at, created_at, updated_at`,
+		p.HostID, p.PortNumber, p.Protocol, p.State, p.Service, p.Version, p.Product, p.ExtraInfo, p.WorkStatus, p.ScriptOutput, p.Notes, lastSeen, p.NotObservedAt,
+	).Scan(&out.ID, &out.HostID, &out.PortNumber, &out.Protocol, &out.State, &out.Service, &out.Version, &out.Product, &out.ExtraInfo, &out.WorkStatus, &out.ScriptOutput, &out.Notes, &out.LastSeen, &out.NotObservedAt, &out.CreatedAt, &out.UpdatedAt)
 	if err != nil {
 		return Port{}, fmt.Errorf("upsert port: %w", err)
 	}
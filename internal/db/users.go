@@ -0,0 +1,369 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Project roles, from least to most privileged.
+const (
+	RoleViewer  = "viewer"
+	RoleAnalyst = "analyst"
+	RoleAdmin   = "admin"
+)
+
+// MinPasswordLength is the shortest password CreateUser and SetUserPassword
+// accept.
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when a username/password pair does not match.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidUsername is returned for empty usernames or ones containing whitespace.
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrPasswordTooShort is returned for passwords shorter than MinPasswordLength.
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	// ErrInvalidRole is returned for roles other than viewer, analyst and admin.
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleAnalyst: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is a known project role.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAllows reports whether a member holding role may act as want.
+func RoleAllows(role, want string) bool {
+	have, ok := roleRank[role]
+	return ok && have >= roleRank[want]
+}
+
+// User is a local account. Site admins hold the admin role on every project
+// and manage accounts.
+type User struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IsAdmin   bool      `json:"is_admin"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProjectMember grants a user a role on one project.
+type ProjectMember struct {
+	ProjectID int64     `json:"project_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so both failure paths take about as long.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("nmap-tracker-dummy"), bcrypt.DefaultCost)
+
+// HasUsers reports whether any account exists, which is what turns on
+// authentication in the web server.
+func (db *DB) HasUsers() (bool, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM app_user)`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("count users: %w", err)
+	}
+	return exists, nil
+}
+
+// CreateUser adds an account with a bcrypt-hashed password.
+func (db *DB) CreateUser(username, password string, isAdmin bool) (User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || strings.ContainsAny(username, " \t\r\n") {
+		return User{}, ErrInvalidUsername
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	var u User
+	err = db.QueryRow(
+		`INSERT INTO app_user (username, password_hash, is_admin) VALUES (?, ?, ?)
+		 RETURNING id, username, is_admin, created_at, updated_at`,
+		username, hash, isAdmin,
+	).Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return User{}, fmt.Errorf("insert user: %w", err)
+	}
+	return u, nil
+}
+
+// ListUsers returns all accounts ordered by username.
+func (db *DB) ListUsers() ([]User, error) {
+	rows, err := db.Query(`SELECT id, username, is_admin, created_at, updated_at FROM app_user ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list users rows: %w", err)
+	}
+	return users, nil
+}
+
+// GetUserByUsername fetches an account by case-insensitive username.
+func (db *DB) GetUserByUsername(username string) (User, bool, error) {
+	var u User
+	err := db.QueryRow(
+		`SELECT id, username, is_admin, created_at, updated_at FROM app_user WHERE username = ?`,
+		strings.TrimSpace(username),
+	).Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, false, nil
+		}
+		return User{}, false, fmt.Errorf("get user: %w", err)
+	}
+	return u, true, nil
+}
+
+// AuthenticateUser checks a username and password, returning
+// ErrInvalidCredentials when either is wrong.
+func (db *DB) AuthenticateUser(username, password string) (User, error) {
+	var u User
+	var hash string
+	err := db.QueryRow(
+		`SELECT id, username, is_admin, created_at, updated_at, password_hash FROM app_user WHERE username = ?`,
+		strings.TrimSpace(username),
+	).Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt, &hash)
+	if err == sql.ErrNoRows {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("get user: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// SetUserPassword replaces an account's password and ends its sessions.
+func (db *DB) SetUserPassword(id int64, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE app_user SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, hash, id)
+	if err != nil {
+		return fmt.Errorf("update user password: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`DELETE FROM user_session WHERE user_id = ?`, id); err != nil {
+		return fmt.Errorf("delete user sessions: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteUser removes an account with its sessions, tokens and memberships.
+func (db *DB) DeleteUser(id int64) error {
+	res, err := db.Exec(`DELETE FROM app_user WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ProjectRole returns the role a user holds on a project. Site admins are
+// admins everywhere; found is false when the user is not a member.
+func (db *DB) ProjectRole(user User, projectID int64) (string, bool, error) {
+	if user.IsAdmin {
+		return RoleAdmin, true, nil
+	}
+	var role string
+	err := db.QueryRow(
+		`SELECT role FROM project_member WHERE project_id = ? AND user_id = ?`,
+		projectID, user.ID,
+	).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("get project role: %w", err)
+	}
+	return role, true, nil
+}
+
+// ListProjectsForUser returns the projects a user can see: all of them for
+// site admins, otherwise those the user is a member of.
+func (db *DB) ListProjectsForUser(user User) ([]Project, error) {
+	if user.IsAdmin {
+		return db.ListProjects()
+	}
+	rows, err := db.Query(
+		`SELECT p.id, p.name, p.created_at, p.updated_at, p.archived_at
+		   FROM project p
+		   JOIN project_member m ON m.project_id = p.id
+		  WHERE m.user_id = ?
+		  ORDER BY p.name`,
+		user.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list user projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan project: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list user projects rows: %w", err)
+	}
+	return projects, nil
+}
+
+// ListProjectMembers returns a project's members ordered by username.
+func (db *DB) ListProjectMembers(projectID int64) ([]ProjectMember, error) {
+	rows, err := db.Query(
+		`SELECT m.project_id, m.user_id, u.username, m.role, m.created_at
+		   FROM project_member m
+		   JOIN app_user u ON u.id = m.user_id
+		  WHERE m.project_id = ?
+		  ORDER BY u.username`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list project members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []ProjectMember
+	for rows.Next() {
+		var m ProjectMember
+		if err := rows.Scan(&m.ProjectID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan project member: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list project members rows: %w", err)
+	}
+	return members, nil
+}
+
+// SetProjectMember grants or changes a user's role on a project.
+func (db *DB) SetProjectMember(projectID, userID int64, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRow(`SELECT username FROM app_user WHERE id = ?`, userID).Scan(&username); err != nil {
+		if err == sql.ErrNoRows {
+			return sql.ErrNoRows
+		}
+		return fmt.Errorf("get user: %w", err)
+	}
+	var before any
+	var previous string
+	err = tx.QueryRow(`SELECT role FROM project_member WHERE project_id = ? AND user_id = ?`, projectID, userID).Scan(&previous)
+	switch {
+	case err == nil:
+		if previous == role {
+			return nil
+		}
+		before = map[string]string{"user": username, "role": previous}
+	case err != sql.ErrNoRows:
+		return fmt.Errorf("get project member: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO project_member (project_id, user_id, role) VALUES (?, ?, ?)
+		 ON CONFLICT(project_id, user_id) DO UPDATE SET role = excluded.role`,
+		projectID, userID, role,
+	); err != nil {
+		return fmt.Errorf("set project member: %w", err)
+	}
+	event := AuditEvent{ProjectID: projectID, Action: AuditMemberSet, EntityType: AuditEntityMember, EntityID: userID}
+	if err := tx.audit(event, before, map[string]string{"user": username, "role": role}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveProjectMember revokes a user's role on a project.
+func (db *DB) RemoveProjectMember(projectID, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username, role string
+	err = tx.QueryRow(
+		`SELECT u.username, m.role
+		   FROM project_member m
+		   JOIN app_user u ON u.id = m.user_id
+		  WHERE m.project_id = ? AND m.user_id = ?`,
+		projectID, userID,
+	).Scan(&username, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return sql.ErrNoRows
+		}
+		return fmt.Errorf("get project member: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM project_member WHERE project_id = ? AND user_id = ?`, projectID, userID); err != nil {
+		return fmt.Errorf("delete project member: %w", err)
+	}
+	event := AuditEvent{ProjectID: projectID, Action: AuditMemberRemove, EntityType: AuditEntityMember, EntityID: userID}
+	if err := tx.audit(event, map[string]string{"user": username, "role": role}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
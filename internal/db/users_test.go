@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserAccountsSessionsAndTokens(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	if enabled, err := db.HasUsers(); err != nil || enabled {
+		t.Fatalf("expected no users: enabled=%v err=%v", enabled, err)
+	}
+	if _, err := db.CreateUser("alice", "short", false); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("expected short password error, got %v", err)
+	}
+	alice, err := db.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := db.CreateUser("Alice", "another password", false); err == nil {
+		t.Fatalf("expected usernames to be unique regardless of case")
+	}
+
+	if _, err := db.AuthenticateUser("alice", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	if _, err := db.AuthenticateUser("nobody", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials for unknown user, got %v", err)
+	}
+	if u, err := db.AuthenticateUser("ALICE", "correct horse"); err != nil || u.ID != alice.ID {
+		t.Fatalf("authenticate: %+v %v", u, err)
+	}
+
+	session, _, err := db.CreateSession(alice.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if u, found, err := db.GetSessionUser(session); err != nil || !found || u.Username != "alice" {
+		t.Fatalf("get session user: %+v found=%v err=%v", u, found, err)
+	}
+	expired, _, err := db.CreateSession(alice.ID, -time.Hour)
+	if err != nil {
+		t.Fatalf("create expired session: %v", err)
+	}
+	if _, found, _ := db.GetSessionUser(expired); found {
+		t.Fatalf("expected expired session to be rejected")
+	}
+	if err := db.SetUserPassword(alice.ID, "battery staple"); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if _, found, _ := db.GetSessionUser(session); found {
+		t.Fatalf("expected password change to end sessions")
+	}
+
+	token, secret, err := db.CreateAPIToken(alice.ID, "ci")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if u, found, err := db.GetAPITokenUser(secret); err != nil || !found || u.ID != alice.ID {
+		t.Fatalf("get token user: %+v found=%v err=%v", u, found, err)
+	}
+	tokens, err := db.ListAPITokens(alice.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Fatalf("list tokens: %+v %v", tokens, err)
+	}
+	if err := db.DeleteAPIToken(alice.ID, token.ID); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if _, found, _ := db.GetAPITokenUser(secret); found {
+		t.Fatalf("expected revoked token to be rejected")
+	}
+}
+
+func TestProjectRoles(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	p, err := db.CreateProject("roles")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	admin, err := db.CreateUser("root", "password1", true)
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	bob, err := db.CreateUser("bob", "password2", false)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	if role, found, err := db.ProjectRole(admin, p.ID); err != nil || !found || role != RoleAdmin {
+		t.Fatalf("site admin role: %q found=%v err=%v", role, found, err)
+	}
+	if _, found, err := db.ProjectRole(bob, p.ID); err != nil || found {
+		t.Fatalf("expected bob to have no role: found=%v err=%v", found, err)
+	}
+	if err := db.SetProjectMember(p.ID, bob.ID, "owner"); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("expected invalid role, got %v", err)
+	}
+	if err := db.WithActor("root").SetProjectMember(p.ID, bob.ID, RoleViewer); err != nil {
+		t.Fatalf("set member: %v", err)
+	}
+	if err := db.WithActor("root").SetProjectMember(p.ID, bob.ID, RoleAnalyst); err != nil {
+		t.Fatalf("change member: %v", err)
+	}
+	role, _, err := db.ProjectRole(bob, p.ID)
+	if err != nil || role != RoleAnalyst {
+		t.Fatalf("bob role: %q %v", role, err)
+	}
+	if !RoleAllows(role, RoleViewer) || RoleAllows(role, RoleAdmin) {
+		t.Fatalf("unexpected role ordering for %q", role)
+	}
+	projects, err := db.ListProjectsForUser(bob)
+	if err != nil || len(projects) != 1 || projects[0].ID != p.ID {
+		t.Fatalf("list user projects: %+v %v", projects, err)
+	}
+
+	if err := db.WithActor("root").RemoveProjectMember(p.ID, bob.ID); err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	events, err := db.ListAuditEvents(p.ID, AuditQuery{})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if len(events) != 3 || events[0].Action != AuditMemberRemove || events[2].Action != AuditMemberSet || events[0].Actor != "root" {
+		t.Fatalf("unexpected membership audit: %+v", events)
+	}
+}
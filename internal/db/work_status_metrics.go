@@ -0,0 +1,269 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// UnattributedActor groups status changes recorded without an actor.
+const UnattributedActor = "unattributed"
+
+// PortStatusTransition is one recorded work_status change.
+type PortStatusTransition struct {
+	ID         int64     `json:"id"`
+	ProjectID  int64     `json:"project_id"`
+	HostID     int64     `json:"host_id"`
+	PortID     int64     `json:"port_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DurationStats summarises a set of durations in seconds. Percentiles use
+// the nearest-rank method.
+type DurationStats struct {
+	Count       int     `json:"count"`
+	MeanSeconds float64 `json:"mean_seconds"`
+	P50Seconds  float64 `json:"p50_seconds"`
+	P90Seconds  float64 `json:"p90_seconds"`
+	P95Seconds  float64 `json:"p95_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+}
+
+// WorkStatusMetrics reports testing throughput for a project.
+//
+// ScannedToDone measures the first transition to done after each entry into
+// scanned (the port's creation by an import, or a later reset) from that
+// entry; reopening a done port and finishing it again is not counted twice.
+// It is broken down by service campaign (a port can match several) and by the
+// analyst who marked the port done. TimeInStatus is the age of every port in
+// its current status.
+//
+// Only current ports count. Transitions are deleted with their port, and
+// replay and import deletion prune only ports back in scanned, so what is
+// lost is the history of ports reset to scanned that no scan reports any
+// more.
+type WorkStatusMetrics struct {
+	ScannedToDone DurationStats            `json:"scanned_to_done"`
+	ByCampaign    map[string]DurationStats `json:"by_campaign"`
+	ByAnalyst     map[string]DurationStats `json:"by_analyst"`
+	TimeInStatus  map[string]DurationStats `json:"time_in_status"`
+}
+
+// ListPortStatusTransitions returns a port's work status history, oldest first.
+func (db *DB) ListPortStatusTransitions(portID int64) ([]PortStatusTransition, error) {
+	rows, err := db.Query(
+		`SELECT id, project_id, host_id, port_id, from_status, to_status, actor, created_at
+		   FROM port_status_transition
+		  WHERE port_id = ?
+		  ORDER BY id`,
+		portID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list port_status_transition: %w", err)
+	}
+	defer rows.Close()
+
+	var items []PortStatusTransition
+	for rows.Next() {
+		var t PortStatusTransition
+		if err := rows.Scan(&t.ID, &t.ProjectID, &t.HostID, &t.PortID, &t.FromStatus, &t.ToStatus, &t.Actor, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan port_status_transition: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list port_status_transition rows: %w", err)
+	}
+	return items, nil
+}
+
+// WorkStatusMetrics computes throughput metrics for a project as of now.
+func (db *DB) WorkStatusMetrics(projectID int64, now time.Time) (WorkStatusMetrics, error) {
+	type portState struct {
+		status  string
+		created time.Time
+		since   time.Time
+	}
+	ports := make(map[int64]*portState)
+	rows, err := db.Query(
+		`SELECT p.id, p.work_status, p.created_at
+		   FROM port p
+		   JOIN host h ON h.id = p.host_id
+		  WHERE h.project_id = ?`,
+		projectID,
+	)
+	if err != nil {
+		return WorkStatusMetrics{}, fmt.Errorf("list ports for metrics: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		state := &portState{}
+		if err := rows.Scan(&id, &state.status, &state.created); err != nil {
+			rows.Close()
+			return WorkStatusMetrics{}, fmt.Errorf("scan port for metrics: %w", err)
+		}
+		state.since = state.created
+		ports[id] = state
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return WorkStatusMetrics{}, fmt.Errorf("list ports for metrics rows: %w", err)
+	}
+	rows.Close()
+
+	campaigns, err := db.portCampaigns(projectID)
+	if err != nil {
+		return WorkStatusMetrics{}, err
+	}
+
+	rows, err = db.Query(
+		`SELECT port_id, to_status, actor, created_at
+		   FROM port_status_transition
+		  WHERE project_id = ?
+		  ORDER BY port_id, id`,
+		projectID,
+	)
+	if err != nil {
+		return WorkStatusMetrics{}, fmt.Errorf("list transitions for metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var overall []float64
+	byCampaign := make(map[string][]float64)
+	byAnalyst := make(map[string][]float64)
+	started := make(map[int64]time.Time)
+	finished := make(map[int64]bool)
+	for rows.Next() {
+		var portID int64
+		var toStatus, actor string
+		var at time.Time
+		if err := rows.Scan(&portID, &toStatus, &actor, &at); err != nil {
+			return WorkStatusMetrics{}, fmt.Errorf("scan transition for metrics: %w", err)
+		}
+		state, ok := ports[portID]
+		if !ok {
+			continue
+		}
+		start, ok := started[portID]
+		if !ok {
+			start = state.created
+		}
+		switch toStatus {
+		case "scanned":
+			started[portID] = at
+			delete(finished, portID)
+		case "done":
+			if finished[portID] {
+				break
+			}
+			finished[portID] = true
+			seconds := at.Sub(start).Seconds()
+			if seconds < 0 {
+				seconds = 0
+			}
+			overall = append(overall, seconds)
+			for _, campaign := range campaigns[portID] {
+				byCampaign[campaign] = append(byCampaign[campaign], seconds)
+			}
+			if actor == "" {
+				actor = UnattributedActor
+			}
+			byAnalyst[actor] = append(byAnalyst[actor], seconds)
+		}
+		// The last transition marks when the port entered its current status.
+		state.since = at
+	}
+	if err := rows.Err(); err != nil {
+		return WorkStatusMetrics{}, fmt.Errorf("list transitions for metrics rows: %w", err)
+	}
+
+	inStatus := make(map[string][]float64)
+	for _, state := range ports {
+		inStatus[state.status] = append(inStatus[state.status], math.Max(0, now.Sub(state.since).Seconds()))
+	}
+
+	return WorkStatusMetrics{
+		ScannedToDone: summarizeDurations(overall),
+		ByCampaign:    summarizeDurationGroups(byCampaign),
+		ByAnalyst:     summarizeDurationGroups(byAnalyst),
+		TimeInStatus:  summarizeDurationGroups(inStatus),
+	}, nil
+}
+
+// portCampaigns maps each port of the project to the service campaigns it
+// belongs to.
+func (db *DB) portCampaigns(projectID int64) (map[int64][]string, error) {
+	names := make([]string, 0, len(serviceCampaignDefinitions))
+	for name := range serviceCampaignDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[int64][]string)
+	for _, name := range names {
+		rows, err := db.Query(
+			`SELECT p.id
+			   FROM port p
+			   JOIN host h ON h.id = p.host_id
+			  WHERE h.project_id = ? AND `+serviceCampaignDefinitions[name].predicate,
+			projectID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("list %s campaign ports: %w", name, err)
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan %s campaign port: %w", name, err)
+			}
+			out[id] = append(out[id], name)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("list %s campaign ports rows: %w", name, err)
+		}
+		rows.Close()
+	}
+	return out, nil
+}
+
+func summarizeDurationGroups(groups map[string][]float64) map[string]DurationStats {
+	out := make(map[string]DurationStats, len(groups))
+	for key, values := range groups {
+		out[key] = summarizeDurations(values)
+	}
+	return out
+}
+
+func summarizeDurations(values []float64) DurationStats {
+	if len(values) == 0 {
+		return DurationStats{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return DurationStats{
+		Count:       len(sorted),
+		MeanSeconds: sum / float64(len(sorted)),
+		P50Seconds:  nearestRank(sorted, 50),
+		P90Seconds:  nearestRank(sorted, 90),
+		P95Seconds:  nearestRank(sorted, 95),
+		MaxSeconds:  sorted[len(sorted)-1],
+	}
+}
+
+func nearestRank(sorted []float64, percentile float64) float64 {
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkStatusMetrics(t *testing.T) {
+	db := newWorkflowDB(t)
+	defer db.Close()
+	projectID, ports := seedPorts(t, db)
+	if _, err := db.Exec(`UPDATE port SET created_at = '2024-03-01 00:00:00'`); err != nil {
+		t.Fatalf("backdate ports: %v", err)
+	}
+
+	if err := db.WithActor("alice").UpdateWorkStatus(ports[0].ID, "done"); err != nil {
+		t.Fatalf("update 80: %v", err)
+	}
+	bob := db.WithActor("bob")
+	if err := bob.BulkUpdatePortStatusesForProject(projectID, []int64{ports[1].ID}, "flagged"); err != nil {
+		t.Fatalf("flag 443: %v", err)
+	}
+	if err := bob.BulkUpdateByFilter(projectID, nil, []int{443}, nil, "done"); err != nil {
+		t.Fatalf("finish 443: %v", err)
+	}
+
+	history, err := db.ListPortStatusTransitions(ports[1].ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(history) != 2 || history[0].FromStatus != "scanned" || history[0].ToStatus != "flagged" || history[1].ToStatus != "done" || history[1].Actor != "bob" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	transitions, err := db.ListPortStatusTransitions(ports[0].ID)
+	if err != nil || len(transitions) != 1 {
+		t.Fatalf("list transitions for 80: %v (%d)", err, len(transitions))
+	}
+	for id, at := range map[int64]string{
+		transitions[0].ID: "2024-03-01 02:00:00",
+		history[0].ID:     "2024-03-01 01:00:00",
+		history[1].ID:     "2024-03-01 05:00:00",
+	} {
+		if _, err := db.Exec(`UPDATE port_status_transition SET created_at = ? WHERE id = ?`, at, id); err != nil {
+			t.Fatalf("backdate transition: %v", err)
+		}
+	}
+
+	metrics, err := db.WorkStatusMetrics(projectID, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	overall := metrics.ScannedToDone
+	if overall.Count != 2 || overall.MeanSeconds != 12600 || overall.P50Seconds != 7200 || overall.P90Seconds != 18000 || overall.MaxSeconds != 18000 {
+		t.Fatalf("unexpected overall stats: %+v", overall)
+	}
+	if metrics.ByAnalyst["alice"].MeanSeconds != 7200 || metrics.ByAnalyst["bob"].MeanSeconds != 18000 {
+		t.Fatalf("unexpected analyst stats: %+v", metrics.ByAnalyst)
+	}
+	if metrics.ByCampaign[ServiceCampaignHTTP].Count != 2 || metrics.ByCampaign[ServiceCampaignSSH].Count != 0 {
+		t.Fatalf("unexpected campaign stats: %+v", metrics.ByCampaign)
+	}
+	if done := metrics.TimeInStatus["done"]; done.Count != 2 || done.MaxSeconds != 79200 {
+		t.Fatalf("unexpected time in status: %+v", metrics.TimeInStatus)
+	}
+
+	// Reopening a done port and finishing it again is one scanned-to-done.
+	if err := db.UpdateWorkStatus(ports[0].ID, "flagged"); err != nil {
+		t.Fatalf("reopen 80: %v", err)
+	}
+	if err := db.UpdateWorkStatus(ports[0].ID, "done"); err != nil {
+		t.Fatalf("finish 80 again: %v", err)
+	}
+	metrics, err = db.WorkStatusMetrics(projectID, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	if overall := metrics.ScannedToDone; overall.Count != 2 || overall.MeanSeconds != 12600 {
+		t.Fatalf("expected the second done not to count, got %+v", overall)
+	}
+
+	// A port reset to scanned can be pruned, and its history goes with it.
+	if err := db.UpdateWorkStatus(ports[1].ID, "scanned"); err != nil {
+		t.Fatalf("reset 443: %v", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if pruned, err := tx.PruneHostPorts(ports[1].HostID, []int64{ports[0].ID}); err != nil || pruned != 1 {
+		t.Fatalf("prune 443: %d %v", pruned, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if history, err := db.ListPortStatusTransitions(ports[1].ID); err != nil || len(history) != 0 {
+		t.Fatalf("expected pruned port history removed, got %+v (%v)", history, err)
+	}
+	metrics, err = db.WorkStatusMetrics(projectID, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	if overall := metrics.ScannedToDone; overall.Count != 1 || overall.MeanSeconds != 7200 {
+		t.Fatalf("expected only port 80 to count, got %+v", overall)
+	}
+}
@@ -118,6 +118,8 @@ func csvHeader() []string {
 		"ip_address",
 		"hostname",
 		"os_guess",
+		"mac_address",
+		"mac_vendor",
 		"in_scope",
 		"host_notes",
 		"port_id",
@@ -143,6 +145,8 @@ func csvRow(project db.Project, host db.Host, port db.Port) []string {
 		host.IPAddress,
 		host.Hostname,
 		host.OSGuess,
+		host.MACAddress,
+		host.MACVendor,
 		boolToString(host.InScope),
 		host.Notes,
 		strconv.FormatInt(port.ID, 10),
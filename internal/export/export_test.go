@@ -84,7 +84,7 @@ func TestExportProjectCSVHeader(t *testing.T) {
 	if len(lines) == 0 {
 		t.Fatalf("expected csv output")
 	}
-	expectedHeader := "project_id,project_name,host_id,ip_address,hostname,os_guess,in_scope,host_notes,port_id,port_number,protocol,state,service,version,product,extra_info,work_status,script_output,port_notes,last_seen"
+	expectedHeader := "project_id,project_name,host_id,ip_address,hostname,os_guess,mac_address,mac_vendor,in_scope,host_notes,port_id,port_number,protocol,state,service,version,product,extra_info,work_status,script_output,port_notes,last_seen"
 	if lines[0] != expectedHeader {
 		t.Fatalf("unexpected csv header: %s", lines[0])
 	}
@@ -120,12 +120,14 @@ func setupExportDB(t *testing.T) *db.DB {
 	}
 
 	hostA, err := database.UpsertHost(db.Host{
-		ProjectID: project.ID,
-		IPAddress: "10.0.0.10",
-		Hostname:  "web-01",
-		OSGuess:   "Linux",
-		InScope:   true,
-		Notes:     "first host",
+		ProjectID:  project.ID,
+		IPAddress:  "10.0.0.10",
+		Hostname:   "web-01",
+		OSGuess:    "Linux",
+		MACAddress: "00:0C:29:AB:CD:EF",
+		MACVendor:  "VMware",
+		InScope:    true,
+		Notes:      "first host",
 	})
 	if err != nil {
 		t.Fatalf("upsert host: %v", err)
@@ -195,6 +197,8 @@ func setFixedTimes(t *testing.T, database *db.DB, projectID, hostAID, hostBID, p
 	portTime := time.Date(2024, 1, 2, 5, 6, 7, 0, time.UTC)
 	scopeTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	importTime := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	scanStart := time.Date(2024, 1, 2, 22, 0, 0, 0, time.UTC)
+	scanFinish := time.Date(2024, 1, 2, 22, 30, 0, 0, time.UTC)
 
 	if _, err := database.Exec(`UPDATE project SET created_at = ?, updated_at = ? WHERE id = ?`, toDBTime(projectTime), toDBTime(projectTime), projectID); err != nil {
 		t.Fatalf("update project time: %v", err)
@@ -202,7 +206,7 @@ func setFixedTimes(t *testing.T, database *db.DB, projectID, hostAID, hostBID, p
 	if _, err := database.Exec(`UPDATE scope_definition SET created_at = ?`, toDBTime(scopeTime)); err != nil {
 		t.Fatalf("update scope time: %v", err)
 	}
-	if _, err := database.Exec(`UPDATE scan_import SET import_time = ?`, toDBTime(importTime)); err != nil {
+	if _, err := database.Exec(`UPDATE scan_import SET import_time = ?, scan_started_at = ?, scan_finished_at = ?`, toDBTime(importTime), toDBTime(scanStart), toDBTime(scanFinish)); err != nil {
 		t.Fatalf("update scan import time: %v", err)
 	}
 	if _, err := database.Exec(`UPDATE host SET created_at = ?, updated_at = ? WHERE id IN (?, ?)`, toDBTime(hostTime), toDBTime(hostTime), hostAID, hostBID); err != nil {
@@ -40,17 +40,20 @@ type ScopeDefinitionInfo struct {
 }
 
 type ScanImportInfo struct {
-	ID            int64     `json:"id"`
-	ProjectID     int64     `json:"project_id"`
-	Filename      string    `json:"filename"`
-	ImportTime    time.Time `json:"import_time"`
-	HostsFound    int       `json:"hosts_found"`
-	PortsFound    int       `json:"ports_found"`
-	NmapArgs      string    `json:"nmap_args"`
-	ScannerLabel  string    `json:"scanner_label"`
-	SourceIP      *string   `json:"source_ip"`
-	SourcePort    *int      `json:"source_port"`
-	SourcePortRaw *string   `json:"source_port_raw"`
+	ID             int64      `json:"id"`
+	ProjectID      int64      `json:"project_id"`
+	Filename       string     `json:"filename"`
+	ImportTime     time.Time  `json:"import_time"`
+	HostsFound     int        `json:"hosts_found"`
+	PortsFound     int        `json:"ports_found"`
+	NmapArgs       string     `json:"nmap_args"`
+	ScannerType    string     `json:"scanner_type"`
+	ScannerLabel   string     `json:"scanner_label"`
+	SourceIP       *string    `json:"source_ip"`
+	SourcePort     *int       `json:"source_port"`
+	SourcePortRaw  *string    `json:"source_port_raw"`
+	ScanStartedAt  *time.Time `json:"scan_started_at"`
+	ScanFinishedAt *time.Time `json:"scan_finished_at"`
 }
 
 // HostExport captures a host with ports for export.
@@ -60,33 +63,36 @@ type HostExport struct {
 }
 
 type HostInfo struct {
-	ID        int64     `json:"id"`
-	ProjectID int64     `json:"project_id"`
-	IPAddress string    `json:"ip_address"`
-	Hostname  string    `json:"hostname"`
-	OSGuess   string    `json:"os_guess"`
-	InScope   bool      `json:"in_scope"`
-	Notes     string    `json:"notes"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64     `json:"id"`
+	ProjectID  int64     `json:"project_id"`
+	IPAddress  string    `json:"ip_address"`
+	Hostname   string    `json:"hostname"`
+	OSGuess    string    `json:"os_guess"`
+	MACAddress string    `json:"mac_address"`
+	MACVendor  string    `json:"mac_vendor"`
+	InScope    bool      `json:"in_scope"`
+	Notes      string    `json:"notes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type PortInfo struct {
-	ID           int64     `json:"id"`
-	HostID       int64     `json:"host_id"`
-	PortNumber   int       `json:"port_number"`
-	Protocol     string    `json:"protocol"`
-	State        string    `json:"state"`
-	Service      string    `json:"service"`
-	Version      string    `json:"version"`
-	Product      string    `json:"product"`
-	ExtraInfo    string    `json:"extra_info"`
-	WorkStatus   string    `json:"work_status"`
-	ScriptOutput string    `json:"script_output"`
-	Notes        string    `json:"notes"`
-	LastSeen     time.Time `json:"last_seen"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            int64      `json:"id"`
+	HostID        int64      `json:"host_id"`
+	PortNumber    int        `json:"port_number"`
+	Protocol      string     `json:"protocol"`
+	State         string     `json:"state"`
+	Service       string     `json:"service"`
+	Version       string     `json:"version"`
+	Product       string     `json:"product"`
+	ExtraInfo     string     `json:"extra_info"`
+	WorkStatus    string     `json:"work_status"`
+	ScriptOutput  string     `json:"script_output"`
+	Notes         string     `json:"notes"`
+	LastSeen      time.Time  `json:"last_seen"`
+	NotObservedAt *time.Time `json:"not_observed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // ExportProjectJSON writes full project data as JSON to the writer.
@@ -209,17 +215,20 @@ func toScanImportInfos(imports []db.ScanImport) []ScanImportInfo {
 	out := make([]ScanImportInfo, 0, len(imports))
 	for _, imp := range imports {
 		out = append(out, ScanImportInfo{
-			ID:            imp.ID,
-			ProjectID:     imp.ProjectID,
-			Filename:      imp.Filename,
-			ImportTime:    imp.ImportTime,
-			HostsFound:    imp.HostsFound,
-			PortsFound:    imp.PortsFound,
-			NmapArgs:      imp.NmapArgs,
-			ScannerLabel:  imp.ScannerLabel,
-			SourceIP:      imp.SourceIP,
-			SourcePort:    imp.SourcePort,
-			SourcePortRaw: imp.SourcePortRaw,
+			ID:             imp.ID,
+			ProjectID:      imp.ProjectID,
+			Filename:       imp.Filename,
+			ImportTime:     imp.ImportTime,
+			HostsFound:     imp.HostsFound,
+			PortsFound:     imp.PortsFound,
+			NmapArgs:       imp.NmapArgs,
+			ScannerType:    imp.ScannerType,
+			ScannerLabel:   imp.ScannerLabel,
+			SourceIP:       imp.SourceIP,
+			SourcePort:     imp.SourcePort,
+			SourcePortRaw:  imp.SourcePortRaw,
+			ScanStartedAt:  imp.ScanStartedAt,
+			ScanFinishedAt: imp.ScanFinishedAt,
 		})
 	}
 	return out
@@ -227,34 +236,37 @@ func toScanImportInfos(imports []db.ScanImport) []ScanImportInfo {
 
 func toHostInfo(host db.Host) HostInfo {
 	return HostInfo{
-		ID:        host.ID,
-		ProjectID: host.ProjectID,
-		IPAddress: host.IPAddress,
-		Hostname:  host.Hostname,
-		OSGuess:   host.OSGuess,
-		InScope:   host.InScope,
-		Notes:     host.Notes,
-		CreatedAt: host.CreatedAt,
-		UpdatedAt: host.UpdatedAt,
+		ID:         host.ID,
+		ProjectID:  host.ProjectID,
+		IPAddress:  host.IPAddress,
+		Hostname:   host.Hostname,
+		OSGuess:    host.OSGuess,
+		MACAddress: host.MACAddress,
+		MACVendor:  host.MACVendor,
+		InScope:    host.InScope,
+		Notes:      host.Notes,
+		CreatedAt:  host.CreatedAt,
+		UpdatedAt:  host.UpdatedAt,
 	}
 }
 
 func toPortInfo(port db.Port) PortInfo {
 	return PortInfo{
-		ID:           port.ID,
-		HostID:       port.HostID,
-		PortNumber:   port.PortNumber,
-		Protocol:     port.Protocol,
-		State:        port.State,
-		Service:      port.Service,
-		Version:      port.Version,
-		Product:      port.Product,
-		ExtraInfo:    port.ExtraInfo,
-		WorkStatus:   port.WorkStatus,
-		ScriptOutput: port.ScriptOutput,
-		Notes:        port.Notes,
-		LastSeen:     port.LastSeen,
-		CreatedAt:    port.CreatedAt,
-		UpdatedAt:    port.UpdatedAt,
+		ID:            port.ID,
+		HostID:        port.HostID,
+		PortNumber:    port.PortNumber,
+		Protocol:      port.Protocol,
+		State:         port.State,
+		Service:       port.Service,
+		Version:       port.Version,
+		Product:       port.Product,
+		ExtraInfo:     port.ExtraInfo,
+		WorkStatus:    port.WorkStatus,
+		ScriptOutput:  port.ScriptOutput,
+		Notes:         port.Notes,
+		LastSeen:      port.LastSeen,
+		NotObservedAt: port.NotObservedAt,
+		CreatedAt:     port.CreatedAt,
+		UpdatedAt:     port.UpdatedAt,
 	}
 }
@@ -36,6 +36,9 @@ func ExportProjectText(database *db.DB, projectID int64, w io.Writer) error {
 		if host.OSGuess != "" {
 			fmt.Fprintf(w, "OS: %s\n", host.OSGuess)
 		}
+		if host.MACAddress != "" {
+			fmt.Fprintf(w, "MAC: %s\n", formatMAC(host))
+		}
 		if host.Notes != "" {
 			fmt.Fprintf(w, "Notes: %s\n", host.Notes)
 		}
@@ -83,6 +86,9 @@ func ExportHostText(database *db.DB, projectID, hostID int64, w io.Writer) error
 	if host.OSGuess != "" {
 		fmt.Fprintf(w, "OS: %s\n", host.OSGuess)
 	}
+	if host.MACAddress != "" {
+		fmt.Fprintf(w, "MAC: %s\n", formatMAC(host))
+	}
 	if host.Notes != "" {
 		fmt.Fprintf(w, "Notes: %s\n", host.Notes)
 	}
@@ -109,3 +115,10 @@ func ExportHostText(database *db.DB, projectID, hostID int64, w io.Writer) error
 
 	return nil
 }
+
+func formatMAC(host db.Host) string {
+	if host.MACVendor == "" {
+		return host.MACAddress
+	}
+	return fmt.Sprintf("%s (%s)", host.MACAddress, host.MACVendor)
+}
@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// portRange is an inclusive range of port numbers.
+type portRange struct {
+	first, last int
+}
+
+// portSet maps a protocol to the port ranges probed for it.
+type portSet map[string][]portRange
+
+func (s portSet) contains(number int, protocol string) bool {
+	for _, r := range s[protocol] {
+		if number >= r.first && number <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+var portSpecProtocols = map[string]string{"T": "tcp", "U": "udp", "S": "sctp"}
+
+// parsePortSpec parses an nmap port specification such as "22,80",
+// "1-1024", "T:80,U:53", "-" or "60000-". Entries before any protocol prefix
+// apply to each of protocols. Service names and "[...]" ranges depend on
+// nmap-services and are reported as not understood.
+func parsePortSpec(spec string, protocols []string) (portSet, bool) {
+	set := make(portSet)
+	current := protocols
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, rest, ok := strings.Cut(entry, ":"); ok {
+			protocol, known := portSpecProtocols[strings.ToUpper(strings.TrimSpace(prefix))]
+			if !known {
+				return nil, false
+			}
+			current = []string{protocol}
+			entry = strings.TrimSpace(rest)
+		}
+		if entry == "" {
+			continue
+		}
+		r, ok := parsePortRange(entry)
+		if !ok {
+			return nil, false
+		}
+		for _, protocol := range current {
+			set[protocol] = append(set[protocol], r)
+		}
+	}
+	return set, len(set) > 0
+}
+
+// parsePortRange parses "N", "N-M", "-M", "N-" or "-". Open ends run from
+// port 1 and to 65535, as in nmap.
+func parsePortRange(entry string) (portRange, bool) {
+	first, last, isRange := strings.Cut(entry, "-")
+	if !isRange {
+		n, ok := parsePortNumber(entry)
+		return portRange{n, n}, ok
+	}
+	r := portRange{1, 65535}
+	if first != "" {
+		n, ok := parsePortNumber(first)
+		if !ok {
+			return portRange{}, false
+		}
+		r.first = n
+	}
+	if last != "" {
+		n, ok := parsePortNumber(last)
+		if !ok {
+			return portRange{}, false
+		}
+		r.last = n
+	}
+	return r, r.first <= r.last
+}
+
+func parsePortNumber(raw string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	return n, err == nil && n >= 0 && n <= 65535
+}
+
+// scanProtocols returns the protocols an nmap command line port-scans, from
+// its -s scan types: TCP unless only UDP or SCTP types are given. Ping (-sn or
+// the older -sP), list and IP protocol scans probe no ports and report false.
+func scanProtocols(tokens []string) ([]string, bool) {
+	var tcp, udp, sctp bool
+	for _, token := range tokens {
+		if !strings.HasPrefix(token, "-s") || len(token) < 3 {
+			continue
+		}
+		for _, c := range token[2:] {
+			switch c {
+			case 'S', 'T', 'A', 'W', 'M', 'N', 'F', 'X', 'I':
+				tcp = true
+			case 'U':
+				udp = true
+			case 'Y', 'Z':
+				sctp = true
+			case 'n', 'P', 'L', 'O':
+				return nil, false
+			}
+		}
+	}
+	var protocols []string
+	if tcp || (!udp && !sctp) {
+		protocols = append(protocols, "tcp")
+	}
+	if udp {
+		protocols = append(protocols, "udp")
+	}
+	if sctp {
+		protocols = append(protocols, "sctp")
+	}
+	return protocols, true
+}
+
+// nmapValueFlags take the following token as their value; the ones listed
+// can be followed by an address that must not be read as a scan target.
+var nmapValueFlags = map[string]bool{
+	"-S": true, "-D": true, "-sI": true, "-b": true, "-e": true, "-g": true,
+	"-iL": true, "-iR": true, "-oN": true, "-oX": true, "-oG": true, "-oA": true, "-oS": true,
+	"--dns-servers": true, "--proxies": true, "--source-port": true, "--excludefile": true,
+}
+
+// scanCoverage is the set of hosts and ports a scan probed, so ports it did
+// not report can be told apart from ports it never looked at.
+type scanCoverage struct {
+	ports    portSet
+	excluded portSet
+	// targets matches the IP, CIDR and range targets on the command line;
+	// nil when the targets are unknown (hostnames, -iL).
+	targets *scope.Matcher
+}
+
+// coverageForScan derives a scan's coverage from its command line and the
+// port list the scanner recorded (scannedPorts, an nmap port spec). Without
+// a recorded list the ports must come from -p; --top-ports and default scans
+// probe nmap-services ports that cannot be listed here, so they report false,
+// as do command lines that scan no ports.
+func coverageForScan(nmapArgs, scannedPorts string) (scanCoverage, bool) {
+	tokens := strings.Fields(nmapArgs)
+	protocols, ok := scanProtocols(tokens)
+	if !ok || len(tokens) == 0 {
+		return scanCoverage{}, false
+	}
+
+	var portSpec, excludedSpec string
+	var rules []scope.Rule
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case strings.HasPrefix(token, "-p"):
+			value, consumed := parseFlagValue(tokens, i, "-p")
+			if consumed {
+				i++
+			}
+			portSpec = value
+		case strings.HasPrefix(token, "--exclude-ports"):
+			value, consumed := parseLongFlagValue(tokens, i, "--exclude-ports")
+			if consumed {
+				i++
+			}
+			excludedSpec = value
+		case token == "--exclude" || strings.HasPrefix(token, "--exclude="):
+			value, consumed := parseLongFlagValue(tokens, i, "--exclude")
+			if consumed {
+				i++
+			}
+			for _, def := range strings.Split(value, ",") {
+				if rule, err := scope.ParseRule(def, scope.RuleExclude); err == nil && rule.Kind != scope.KindHostname {
+					rules = append(rules, rule)
+				}
+			}
+		case nmapValueFlags[token]:
+			i++
+		case strings.HasPrefix(token, "-"):
+		default:
+			rule, err := scope.ParseRule(cleanTokenValue(token), scope.RuleInclude)
+			if err == nil && rule.Kind != scope.KindHostname {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	var cov scanCoverage
+	switch {
+	case scannedPorts != "":
+		cov.ports, ok = parsePortSpec(scannedPorts, protocols)
+	case portSpec != "":
+		cov.ports, ok = parsePortSpec(portSpec, protocols)
+	default:
+		ok = false
+	}
+	if !ok {
+		return scanCoverage{}, false
+	}
+	if excludedSpec != "" {
+		if cov.excluded, ok = parsePortSpec(excludedSpec, protocols); !ok {
+			return scanCoverage{}, false
+		}
+	}
+	for _, rule := range rules {
+		if rule.Type == scope.RuleInclude {
+			cov.targets = scope.NewMatcherFromRules(rules)
+			break
+		}
+	}
+	return cov, true
+}
+
+func (c scanCoverage) coversPort(number int, protocol string) bool {
+	return c.ports.contains(number, protocol) && !c.excluded.contains(number, protocol)
+}
+
+func (c scanCoverage) targetsHost(ip string) bool {
+	return c.targets != nil && c.targets.InScope(ip)
+}
+
+// scannedPortsSpec renders per-protocol nmap service lists (as in
+// <scaninfo protocol="tcp" services="1-1024"/>) as one prefixed port spec.
+func scannedPortsSpec(services map[string]string) string {
+	var parts []string
+	for _, prefix := range []string{"T", "U", "S"} {
+		if list := strings.TrimSpace(services[portSpecProtocols[prefix]]); list != "" {
+			parts = append(parts, prefix+":"+list)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// reconcileMissingPorts marks the project's open or filtered ports that the
+// import covered but did not report as not observed. A port is covered when
+// its number falls in the scan's port coverage and its host either appears in
+// the import or is one of the scan's targets (a host that vanished). Ports
+// seen after the scan ran are left alone so importing an old scan late does
+// not hide newer results.
+func reconcileMissingPorts(tx *db.Tx, projectID int64, record db.ScanImport, scannedPorts string, stats *ImportStats) error {
+	coverage, ok := coverageForScan(record.NmapArgs, scannedPorts)
+	if !ok {
+		return nil
+	}
+	if err := tx.SetScanImportScannedPorts(record.ID, scannedPorts); err != nil {
+		return err
+	}
+	candidates, err := tx.ListUnobservedPorts(projectID, record.ID)
+	if err != nil {
+		return err
+	}
+	for _, port := range candidates {
+		if !coverage.coversPort(port.PortNumber, port.Protocol) {
+			continue
+		}
+		at := record.ScanTime()
+		switch {
+		case port.HostObserved && port.HostSeenAt != nil:
+			at = *port.HostSeenAt
+		case port.HostObserved:
+		case !coverage.targetsHost(port.IPAddress):
+			continue
+		}
+		if !port.LastSeen.Before(at) {
+			continue
+		}
+		if err := tx.MarkPortNotObserved(port.PortID, at); err != nil {
+			return err
+		}
+		stats.PortsNotObserved++
+	}
+	return nil
+}
+
+// coveredScan is a completed import whose coverage is known, for replay.
+type coveredScan struct {
+	importID int64
+	at       time.Time
+	coverage scanCoverage
+}
+
+// coveredScans loads the project's imports whose coverage can be derived,
+// oldest scan first.
+func coveredScans(tx *db.Tx, projectID int64) ([]coveredScan, error) {
+	imports, err := tx.ListImportCoverage(projectID)
+	if err != nil {
+		return nil, err
+	}
+	var out []coveredScan
+	for _, imp := range imports {
+		if coverage, ok := coverageForScan(imp.NmapArgs, imp.ScannedPorts); ok {
+			out = append(out, coveredScan{importID: imp.ImportID, at: imp.ScanTime, coverage: coverage})
+		}
+	}
+	return out, nil
+}
+
+// applyCoverage replays reconciliation over merged ports: a port that is not
+// closed becomes not observed as of the first covering scan after it was last
+// seen that did not report it.
+func applyCoverage(ports []db.Port, ip string, history []db.HostHistoryEntry, scans []coveredScan) {
+	hostSeen := make(map[int64]time.Time, len(history))
+	reported := make(map[int64]map[portKey]bool, len(history))
+	for _, entry := range history {
+		hostSeen[entry.Import.ID] = entry.ObservedAt()
+		keys := make(map[portKey]bool, len(entry.Ports))
+		for _, p := range entry.Ports {
+			keys[portKey{p.PortNumber, p.Protocol}] = true
+		}
+		reported[entry.Import.ID] = keys
+	}
+
+	for i := range ports {
+		port := &ports[i]
+		if port.State == "closed" || port.State == db.PortStateNotObserved {
+			continue
+		}
+		key := portKey{port.PortNumber, port.Protocol}
+		var missedAt *time.Time
+		for _, scan := range scans {
+			if !scan.coverage.coversPort(port.PortNumber, port.Protocol) || reported[scan.importID][key] {
+				continue
+			}
+			at, observed := hostSeen[scan.importID]
+			if !observed {
+				if !scan.coverage.targetsHost(ip) {
+					continue
+				}
+				at = scan.at
+			}
+			if port.LastSeen.Before(at) && (missedAt == nil || at.Before(*missedAt)) {
+				missedAt = &at
+			}
+		}
+		if missedAt != nil {
+			port.State = db.PortStateNotObserved
+			port.NotObservedAt = missedAt
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package importer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+func TestCoverageForScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		scanned  string
+		ok       bool
+		covered  []string
+		outside  []string
+		targeted []string
+		missed   []string
+	}{
+		{
+			name:    "port list and range",
+			args:    "nmap -sS -p 22,80,8000-8100 10.0.0.0/24",
+			ok:      true,
+			covered: []string{"22/tcp", "80/tcp", "8080/tcp"},
+			outside: []string{"443/tcp", "80/udp"},
+			// The CIDR target makes hosts missing from the scan count as covered.
+			targeted: []string{"10.0.0.9"},
+			missed:   []string{"10.0.1.1"},
+		},
+		{
+			name:    "protocol prefixes and attached value",
+			args:    "nmap -sSU -pT:443,U:53 10.0.0.1",
+			ok:      true,
+			covered: []string{"443/tcp", "53/udp"},
+			outside: []string{"53/tcp", "443/udp"},
+		},
+		{
+			name:    "all ports minus excluded",
+			args:    "nmap -p- --exclude-ports 25 --exclude 10.0.0.5 10.0.0.0/29",
+			ok:      true,
+			covered: []string{"1/tcp", "65535/tcp"},
+			outside: []string{"25/tcp"},
+			// Output and source flags take a value that is not a target.
+			targeted: []string{"10.0.0.4"},
+			missed:   []string{"10.0.0.5"},
+		},
+		{
+			name:     "recorded list wins over top ports",
+			args:     "nmap --top-ports 100 -oX out.xml 192.168.1.10",
+			scanned:  "T:22,80",
+			ok:       true,
+			covered:  []string{"22/tcp", "80/tcp"},
+			outside:  []string{"443/tcp"},
+			targeted: []string{"192.168.1.10"},
+			missed:   []string{"192.168.1.11"},
+		},
+		{name: "top ports without recorded list", args: "nmap --top-ports 100 10.0.0.1"},
+		{name: "default ports", args: "nmap -sV 10.0.0.1"},
+		{name: "ping scan", args: "nmap -sn -p 80 10.0.0.0/24"},
+		{name: "legacy ping scan", args: "nmap -sP 10.0.0.0/24"},
+		{name: "service names", args: "nmap -p http,ssh 10.0.0.1"},
+		{name: "no arguments", args: "", scanned: "T:22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cov, ok := coverageForScan(tt.args, tt.scanned)
+			if ok != tt.ok {
+				t.Fatalf("expected ok=%v, got %v", tt.ok, ok)
+			}
+			for _, port := range tt.covered {
+				if number, protocol := splitPort(t, port); !cov.coversPort(number, protocol) {
+					t.Errorf("expected %s to be covered", port)
+				}
+			}
+			for _, port := range tt.outside {
+				if number, protocol := splitPort(t, port); cov.coversPort(number, protocol) {
+					t.Errorf("expected %s not to be covered", port)
+				}
+			}
+			for _, ip := range tt.targeted {
+				if !cov.targetsHost(ip) {
+					t.Errorf("expected %s to be a target", ip)
+				}
+			}
+			for _, ip := range tt.missed {
+				if cov.targetsHost(ip) {
+					t.Errorf("expected %s not to be a target", ip)
+				}
+			}
+		})
+	}
+}
+
+func splitPort(t *testing.T, port string) (int, string) {
+	t.Helper()
+	var number int
+	var protocol string
+	if _, err := fmt.Sscanf(strings.Replace(port, "/", " ", 1), "%d %s", &number, &protocol); err != nil {
+		t.Fatalf("bad port %q: %v", port, err)
+	}
+	return number, protocol
+}
+
+func portStates(t *testing.T, database *db.DB, projectID int64, ip string) map[string]string {
+	t.Helper()
+	host, found, err := database.GetHostByIP(projectID, ip)
+	if err != nil || !found {
+		t.Fatalf("get host %s: found=%v err=%v", ip, found, err)
+	}
+	ports, err := database.ListPorts(host.ID)
+	if err != nil {
+		t.Fatalf("list ports: %v", err)
+	}
+	out := make(map[string]string, len(ports))
+	for _, p := range ports {
+		if (p.State == db.PortStateNotObserved) != (p.NotObservedAt != nil) {
+			t.Fatalf("port %d state %q with not_observed_at %v", p.PortNumber, p.State, p.NotObservedAt)
+		}
+		out[fmt.Sprintf("%d/%s", p.PortNumber, p.Protocol)] = p.State
+	}
+	return out
+}
+
+func TestImportMarksMissingCoveredPortsNotObserved(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("reconcile")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	matcher := mustMatcher(t, []string{"10.0.0.0/24"})
+	importAt := func(filename, args string, scanned time.Time, hosts ...HostObservation) ImportStats {
+		t.Helper()
+		stats, err := ImportObservationsWithOptions(database, matcher, project.ID, filename, Observations{Hosts: hosts},
+			ParseMetadata{NmapArgs: args, ScanStartedAt: scanned}, ImportOptions{}, scanned)
+		if err != nil {
+			t.Fatalf("import %s: %v", filename, err)
+		}
+		return stats
+	}
+	open := func(numbers ...int) []PortObservation {
+		var ports []PortObservation
+		for _, n := range numbers {
+			ports = append(ports, PortObservation{PortNumber: n, Protocol: "tcp", State: "open"})
+		}
+		return ports
+	}
+
+	t1 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	importAt("full.xml", "nmap -p- 10.0.0.0/24", t1,
+		HostObservation{IPAddress: "10.0.0.1", Ports: open(22, 80, 443, 8080)},
+		HostObservation{IPAddress: "10.0.0.2", Ports: open(21)},
+		HostObservation{IPAddress: "10.0.0.3", Ports: open(25)},
+	)
+
+	// The rescan covers 1-1024 on 10.0.0.1-2 only; 10.0.0.2 no longer answers.
+	stats := importAt("rescan.xml", "nmap -sS -p 1-1024 10.0.0.1-2", t1.Add(24*time.Hour),
+		HostObservation{IPAddress: "10.0.0.1", Ports: open(22)},
+	)
+	if stats.PortsNotObserved != 3 {
+		t.Fatalf("expected 3 ports not observed, got %d", stats.PortsNotObserved)
+	}
+	want := map[string]string{"22/tcp": "open", "80/tcp": "not_observed", "443/tcp": "not_observed", "8080/tcp": "open"}
+	if got := portStates(t, database, project.ID, "10.0.0.1"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected 10.0.0.1 states: %v", got)
+	}
+	if got := portStates(t, database, project.ID, "10.0.0.2"); got["21/tcp"] != "not_observed" {
+		t.Fatalf("expected vanished target's port not observed, got %v", got)
+	}
+	if got := portStates(t, database, project.ID, "10.0.0.3"); got["25/tcp"] != "open" {
+		t.Fatalf("expected untargeted host untouched, got %v", got)
+	}
+	summary, err := database.GetDashboardStats(project.ID)
+	if err != nil {
+		t.Fatalf("dashboard stats: %v", err)
+	}
+	if summary.WorkStatus.Scanned != 3 {
+		t.Fatalf("expected 3 open ports on the dashboard, got %d", summary.WorkStatus.Scanned)
+	}
+
+	// An older scan imported late must not hide the newer results, and a
+	// scan reporting a port again clears the mark.
+	late := importAt("old.xml", "nmap -p 1-100 10.0.0.1", t1.Add(-24*time.Hour),
+		HostObservation{IPAddress: "10.0.0.1", Ports: open(22)},
+	)
+	if late.PortsNotObserved != 0 {
+		t.Fatalf("expected late old scan to mark nothing, got %d", late.PortsNotObserved)
+	}
+	importAt("back.xml", "nmap -p 80 10.0.0.1", t1.Add(48*time.Hour),
+		HostObservation{IPAddress: "10.0.0.1", Ports: open(80)},
+	)
+	if got := portStates(t, database, project.ID, "10.0.0.1"); got["80/tcp"] != "open" || got["443/tcp"] != "not_observed" {
+		t.Fatalf("expected 80 open again and 443 still not observed, got %v", got)
+	}
+
+	before := projectSnapshot(t, database, project.ID)
+	if _, err := RebuildProject(database, project.ID, PolicyLatestWins); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if after := projectSnapshot(t, database, project.ID); !reflect.DeepEqual(before, after) {
+		t.Fatalf("rebuild changed reconciled state:\nbefore %v\nafter  %v", before, after)
+	}
+}
+
+func TestImportXMLUsesScanInfoForCoverage(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	matcher := mustMatcher(t, nil)
+
+	// With host starttime/endtime the host's own scan time decides whether
+	// the rescan is newer than the port.
+	for name, hostTimes := range map[string]bool{"scaninfo": false, "host times": true} {
+		project, err := database.CreateProject(name)
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		scan := func(start time.Time, ports string) string {
+			host := "<host>"
+			if hostTimes {
+				host = fmt.Sprintf(`<host starttime="%d" endtime="%d">`, start.Unix(), start.Add(time.Minute).Unix())
+			}
+			return fmt.Sprintf(`<?xml version="1.0"?>
+<nmaprun args="nmap --top-ports 3 10.0.0.1" start="%d">
+  <scaninfo type="syn" protocol="tcp" numservices="3" services="22,80,443"/>
+  %s
+    <status state="up"/>
+    <address addr="10.0.0.1" addrtype="ipv4"/>
+    <ports>%s</ports>
+  </host>
+</nmaprun>`, start.Unix(), host, ports)
+		}
+		port := func(n int) string {
+			return fmt.Sprintf(`<port protocol="tcp" portid="%d"><state state="open"/></port>`, n)
+		}
+
+		t1 := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		if _, err := ImportXML(database, matcher, project.ID, "first.xml", strings.NewReader(scan(t1, port(22)+port(80))), t1); err != nil {
+			t.Fatalf("%s: import first: %v", name, err)
+		}
+		stats, err := ImportXML(database, matcher, project.ID, "second.xml", strings.NewReader(scan(t1.Add(time.Hour), port(22))), t1)
+		if err != nil {
+			t.Fatalf("%s: import second: %v", name, err)
+		}
+		if stats.ScannedPorts != "T:22,80,443" || stats.PortsNotObserved != 1 {
+			t.Fatalf("%s: unexpected stats: scanned %q, not observed %d", name, stats.ScannedPorts, stats.PortsNotObserved)
+		}
+		if got := portStates(t, database, project.ID, "10.0.0.1"); got["80/tcp"] != "not_observed" {
+			t.Fatalf("%s: expected 80/tcp not observed, got %v", name, got)
+		}
+	}
+}
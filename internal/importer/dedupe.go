@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// ErrDuplicateImport is returned when a scan was already imported into the
+// project. Set ImportOptions.Force to import it anyway.
+var ErrDuplicateImport = errors.New("duplicate import")
+
+// DuplicateImportError identifies the earlier import a rejected file
+// duplicates.
+type DuplicateImportError struct {
+	Existing db.DuplicateImport
+	// Reason is db.DuplicateContent or db.DuplicateNear.
+	Reason string
+}
+
+func (e *DuplicateImportError) Error() string {
+	if e.Reason == db.DuplicateNear {
+		return fmt.Sprintf("%v: same scan arguments and start time as import %d (%s); use force to import anyway", ErrDuplicateImport, e.Existing.ID, e.Existing.Filename)
+	}
+	return fmt.Sprintf("%v: same content as import %d (%s); use force to import anyway", ErrDuplicateImport, e.Existing.ID, e.Existing.Filename)
+}
+
+func (e *DuplicateImportError) Is(target error) bool {
+	return target == ErrDuplicateImport
+}
+
+// checkDuplicate rejects an import that repeats an earlier one of the
+// project, unless forced. tx must already hold the write lock, as db.Begin
+// does, so two imports of one file cannot both pass the lookup before either
+// commits.
+func checkDuplicate(tx *db.Tx, projectID int64, record db.ScanImport, contentSHA256 string, force bool) error {
+	if force {
+		return nil
+	}
+	existing, reason, found, err := tx.FindDuplicateScanImport(projectID, record.ID, contentSHA256, record.NmapArgs, record.ScanStartedAt)
+	if err != nil {
+		return err
+	}
+	if found {
+		return &DuplicateImportError{Existing: existing, Reason: reason}
+	}
+	return nil
+}
+
+// ContentHash returns the SHA-256 of r's normalised content, as recorded on
+// imports for duplicate detection.
+func ContentHash(r io.Reader) (string, error) {
+	h := NewContentHasher()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return h.Sum(), nil
+}
+
+// ContentHasher computes the SHA-256 of scan file content normalised so
+// re-saved copies of one file hash alike: a leading UTF-8 BOM is dropped, CRLF
+// line endings become LF and whitespace at the end of the file is ignored.
+type ContentHasher struct {
+	h         hash.Hash
+	started   bool
+	head      []byte
+	pendingCR bool
+	trailing  []byte
+	buf       []byte
+}
+
+// NewContentHasher returns an empty hasher.
+func NewContentHasher() *ContentHasher {
+	return &ContentHasher{h: sha256.New()}
+}
+
+// Write adds p to the hash. It never fails.
+func (c *ContentHasher) Write(p []byte) (int, error) {
+	out := c.buf[:0]
+	for _, b := range p {
+		if !c.started {
+			c.head = append(c.head, b)
+			if len(c.head) < len(utf8BOM) && bytes.HasPrefix(utf8BOM, c.head) {
+				continue
+			}
+			out = c.flushHead(out)
+			continue
+		}
+		out = c.normalize(out, b)
+	}
+	c.h.Write(out)
+	c.buf = out[:0]
+	return len(p), nil
+}
+
+// Sum returns the hex digest of everything written so far.
+func (c *ContentHasher) Sum() string {
+	if !c.started {
+		c.h.Write(c.flushHead(nil))
+	}
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+func (c *ContentHasher) flushHead(out []byte) []byte {
+	c.started = true
+	head := c.head
+	c.head = nil
+	if bytes.Equal(head, utf8BOM) {
+		return out
+	}
+	for _, b := range head {
+		out = c.normalize(out, b)
+	}
+	return out
+}
+
+// normalize appends b to out, holding back whitespace until something else
+// follows it so trailing whitespace never reaches the hash.
+func (c *ContentHasher) normalize(out []byte, b byte) []byte {
+	if c.pendingCR {
+		c.pendingCR = false
+		if b != '\n' {
+			c.trailing = append(c.trailing, '\r')
+		}
+	}
+	switch b {
+	case '\r':
+		c.pendingCR = true
+		return out
+	case ' ', '\t', '\n':
+		c.trailing = append(c.trailing, b)
+		return out
+	}
+	out = append(out, c.trailing...)
+	c.trailing = c.trailing[:0]
+	return append(out, b)
+}
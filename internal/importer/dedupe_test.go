@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+func TestContentHasherNormalizesLineEndingsBOMAndTrailingSpace(t *testing.T) {
+	base := "<nmaprun>\n  <host/>\n</nmaprun>"
+	want, err := ContentHash(strings.NewReader(base))
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	for name, variant := range map[string]string{
+		"crlf":     strings.ReplaceAll(base, "\n", "\r\n"),
+		"bom":      "\xEF\xBB\xBF" + base,
+		"trailing": base + "\n\n  \r\n",
+	} {
+		got, err := ContentHash(strings.NewReader(variant))
+		if err != nil {
+			t.Fatalf("hash %s: %v", name, err)
+		}
+		if got != want {
+			t.Fatalf("%s variant hashed differently", name)
+		}
+	}
+
+	// Byte-at-a-time writes must agree with a single write.
+	h := NewContentHasher()
+	for _, b := range []byte("\xEF\xBB\xBF" + strings.ReplaceAll(base, "\n", "\r\n") + "\r\n") {
+		h.Write([]byte{b})
+	}
+	if h.Sum() != want {
+		t.Fatalf("split writes hashed differently")
+	}
+
+	for name, variant := range map[string]string{
+		"inner space": strings.Replace(base, "  <host/>", "<host/>", 1),
+		"lone cr":     strings.Replace(base, "\n", "\r", 1),
+		"content":     strings.Replace(base, "host", "port", 1),
+	} {
+		got, err := ContentHash(strings.NewReader(variant))
+		if err != nil {
+			t.Fatalf("hash %s: %v", name, err)
+		}
+		if got == want {
+			t.Fatalf("%s change did not alter the hash", name)
+		}
+	}
+}
+
+func TestImportXMLRejectsDuplicateContent(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("dupes")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	body := syntheticHosts(t, 3) + "</nmaprun>\n"
+	now := time.Now().UTC()
+
+	first, err := ImportXMLWithOptions(database, nil, project.ID, "a.xml", strings.NewReader(body), ImportOptions{}, now)
+	if err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	if first.ContentSHA256 == "" {
+		t.Fatalf("expected content hash on import")
+	}
+
+	// Re-saved with Windows line endings it is still the same file.
+	_, err = ImportXMLWithOptions(database, nil, project.ID, "a-copy.xml", strings.NewReader(strings.ReplaceAll(body, "\n", "\r\n")), ImportOptions{}, now)
+	if !errors.Is(err, ErrDuplicateImport) {
+		t.Fatalf("expected duplicate import error, got %v", err)
+	}
+	var duplicate *DuplicateImportError
+	if !errors.As(err, &duplicate) || duplicate.Existing.ID != first.ID || duplicate.Reason != db.DuplicateContent {
+		t.Fatalf("unexpected duplicate error: %#v", duplicate)
+	}
+	var rows int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM scan_import WHERE project_id = ?`, project.ID).Scan(&rows); err != nil {
+		t.Fatalf("count imports: %v", err)
+	}
+	if rows != 1 {
+		t.Fatalf("expected rejected import to be discarded, got %d scan_import rows", rows)
+	}
+
+	forced, err := ImportXMLWithOptions(database, nil, project.ID, "a-again.xml", strings.NewReader(body), ImportOptions{Force: true}, now)
+	if err != nil {
+		t.Fatalf("forced import: %v", err)
+	}
+	if forced.ContentSHA256 != first.ContentSHA256 {
+		t.Fatalf("expected forced import to record the same hash")
+	}
+
+	groups, err := database.ListDuplicateImportGroups(project.ID)
+	if err != nil {
+		t.Fatalf("list duplicates: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Reason != db.DuplicateContent || len(groups[0].Imports) != 2 {
+		t.Fatalf("unexpected duplicate groups: %+v", groups)
+	}
+}
+
+func TestImportXMLRejectsNearDuplicate(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("near")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	now := time.Now().UTC()
+
+	first, err := ImportXMLWithOptions(database, nil, project.ID, "run.xml", strings.NewReader(syntheticHosts(t, 2)+"</nmaprun>\n"), ImportOptions{}, now)
+	if err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	// Same command line and start time, different content: the run was
+	// saved twice, or trimmed before upload.
+	_, err = ImportXMLWithOptions(database, nil, project.ID, "run-partial.xml", strings.NewReader(syntheticHosts(t, 1)+"</nmaprun>\n"), ImportOptions{}, now)
+	var duplicate *DuplicateImportError
+	if !errors.As(err, &duplicate) || duplicate.Existing.ID != first.ID || duplicate.Reason != db.DuplicateNear {
+		t.Fatalf("expected near-duplicate of %d, got %v", first.ID, err)
+	}
+}
+
+func TestImportFileRejectsDuplicateGNMAP(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("gnmap-dupes")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	now := time.Now().UTC()
+
+	first, err := ImportFileWithOptions(database, nil, project.ID, gnmapFixturePath(t), ImportOptions{}, now)
+	if err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	data, err := os.ReadFile(gnmapFixturePath(t))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	_, err = ImportWithOptions(database, nil, project.ID, "copy.gnmap", strings.NewReader(string(data)+"\n\n"), ImportOptions{}, now)
+	var duplicate *DuplicateImportError
+	if !errors.As(err, &duplicate) || duplicate.Existing.ID != first.ID || duplicate.Reason != db.DuplicateContent {
+		t.Fatalf("expected content duplicate of %d, got %v", first.ID, err)
+	}
+	if _, err := ImportWithOptions(database, nil, project.ID, "copy.gnmap", strings.NewReader(string(data)), ImportOptions{Force: true}, now); err != nil {
+		t.Fatalf("forced import: %v", err)
+	}
+}
+
+func TestConcurrentDuplicateImportsKeepOne(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("racing-dupes")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	gnmap, err := os.ReadFile(gnmapFixturePath(t))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	now := time.Now().UTC()
+
+	for name, body := range map[string]string{
+		"scan.xml":   syntheticHosts(t, 50) + "</nmaprun>\n",
+		"scan.gnmap": string(gnmap),
+	} {
+		const workers = 4
+		errs := make([]error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = ImportWithOptions(database, nil, project.ID, name, strings.NewReader(body), ImportOptions{}, now)
+			}(i)
+		}
+		wg.Wait()
+
+		imported := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				imported++
+			case !errors.Is(err, ErrDuplicateImport):
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+		}
+		if imported != 1 {
+			t.Fatalf("%s: expected exactly one import to win, got %d", name, imported)
+		}
+	}
+}
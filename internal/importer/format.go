@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// Format identifies a supported scan output format.
+type Format string
+
+const (
+	FormatUnknown     Format = ""
+	FormatNmapXML     Format = "nmap_xml"
+	FormatGNMAP       Format = "gnmap"
+	FormatMasscanXML  Format = "masscan_xml"
+	FormatMasscanJSON Format = "masscan_json"
+	FormatNaabuJSON   Format = "naabu_json"
+	FormatRustscan    Format = "rustscan"
+)
+
+type parseFunc func(io.Reader) (Observations, ParseMetadata, error)
+
+const formatSniffSize = 4096
+
+// ErrUnrecognizedFormat is returned when a scan file matches no supported format.
+var ErrUnrecognizedFormat = errors.New("unrecognized scan format")
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// DetectFormat sniffs the beginning of r to determine its scan format. The
+// returned reader replays the sniffed bytes and must be used in place of r.
+func DetectFormat(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReaderSize(r, formatSniffSize)
+	head, err := br.Peek(formatSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return FormatUnknown, br, fmt.Errorf("sniff format: %w", err)
+	}
+	return detectFormatFromHead(head), br, nil
+}
+
+func detectFormatFromHead(head []byte) Format {
+	head = bytes.TrimPrefix(head, utf8BOM)
+	head = bytes.TrimLeft(head, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(head, []byte("<")):
+		if bytes.Contains(head, []byte(`scanner="masscan"`)) || bytes.Contains(head, []byte("<!-- masscan")) {
+			return FormatMasscanXML
+		}
+		// Other XML documents are not scans; nmap writes <nmaprun> after at
+		// most a prolog, doctype and stylesheet.
+		if !bytes.Contains(head, []byte("<nmaprun")) {
+			return FormatUnknown
+		}
+		return FormatNmapXML
+	case bytes.HasPrefix(head, []byte("# Nmap")), bytes.HasPrefix(head, []byte("Host:")):
+		return FormatGNMAP
+	case bytes.HasPrefix(head, []byte("[")):
+		return FormatMasscanJSON
+	case bytes.HasPrefix(head, []byte("{")):
+		// masscan records carry a "ports" array; naabu emits one flat port per line.
+		firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+		switch {
+		case bytes.Contains(firstLine, []byte(`"ports"`)):
+			return FormatMasscanJSON
+		case bytes.Contains(firstLine, []byte(`"port"`)):
+			return FormatNaabuJSON
+		}
+		return FormatUnknown
+	default:
+		firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+		if looksLikeRustscanLine(string(firstLine)) {
+			return FormatRustscan
+		}
+		return FormatUnknown
+	}
+}
+
+func parserForFormat(format Format) parseFunc {
+	switch format {
+	case FormatGNMAP:
+		return parseGNMAPWithMetadata
+	case FormatMasscanXML:
+		return ParseMasscanXMLWithMetadata
+	case FormatMasscanJSON:
+		return ParseMasscanJSONWithMetadata
+	case FormatNaabuJSON:
+		return ParseNaabuJSONWithMetadata
+	case FormatRustscan:
+		return ParseRustscanWithMetadata
+	default:
+		return nil
+	}
+}
+
+// ImportFileWithOptions opens a scan file, detects its format, and imports it.
+// A nil matcher applies the project's stored scope definitions.
+func ImportFileWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, path string, options ImportOptions, now time.Time) (ImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportStats{}, fmt.Errorf("open scan file: %w", err)
+	}
+	defer f.Close()
+
+	return ImportWithOptions(database, matcher, projectID, filepath.Base(path), f, options, now)
+}
+
+// ImportWithOptions detects the format of r and dispatches to the matching importer.
+func ImportWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, r io.Reader, options ImportOptions, now time.Time) (ImportStats, error) {
+	format, r, err := DetectFormat(r)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	if format == FormatNmapXML {
+		return ImportXMLWithOptions(database, matcher, projectID, filename, r, options, now)
+	}
+	parse := parserForFormat(format)
+	if parse == nil {
+		return ImportStats{}, fmt.Errorf("%w: %q", ErrUnrecognizedFormat, filename)
+	}
+	return importParsedWithOptions(database, matcher, projectID, filename, r, parse, options, now)
+}
@@ -1,3 +1,246 @@
 package importer
 
-// Greppable nmap parsing logic will live here.
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const gnmapArgsMarker = " as: "
+
+// ParseGNMAP parses greppable nmap output (-oG) from a reader into Observations.
+func ParseGNMAP(r io.Reader) (Observations, error) {
+	obs, _, err := parseGNMAPWithMetadata(r)
+	if err != nil {
+		return Observations{}, err
+	}
+	return obs, nil
+}
+
+// ParseGNMAPWithMetadata parses greppable nmap output and returns extracted metadata.
+func ParseGNMAPWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	return parseGNMAPWithMetadata(r)
+}
+
+func parseGNMAPWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	var obs Observations
+	var metadata ParseMetadata
+	byIP := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if metadata.NmapArgs == "" {
+				metadata.NmapArgs = gnmapArgsFromComment(line)
+			}
+			if spec, ok := gnmapScannedPorts(line); ok {
+				metadata.ScannedPorts = spec
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "Host:") {
+			continue
+		}
+
+		host, err := parseGNMAPHostLine(line)
+		if err != nil {
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode gnmap line %d: %w", lineNo, err)
+		}
+
+		idx, ok := byIP[host.IPAddress]
+		if !ok {
+			byIP[host.IPAddress] = len(obs.Hosts)
+			obs.Hosts = append(obs.Hosts, host)
+			continue
+		}
+		mergeGNMAPHost(&obs.Hosts[idx], host)
+	}
+	if err := scanner.Err(); err != nil {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("read gnmap: %w", err)
+	}
+	metadata.ScannerType = db.ScannerTypeNmap
+	return obs, metadata, nil
+}
+
+// gnmapArgsFromComment extracts the command line from the
+// "# Nmap 7.94 scan initiated <date> as: <args>" header.
+func gnmapArgsFromComment(line string) string {
+	if !strings.Contains(line, "scan initiated") {
+		return ""
+	}
+	idx := strings.Index(line, gnmapArgsMarker)
+	if idx < 0 {
+		return ""
+	}
+	return strings.TrimSpace(line[idx+len(gnmapArgsMarker):])
+}
+
+// gnmapScannedPorts converts the verbose "# Ports scanned: TCP(3;22,80,443)
+// UDP(0;) SCTP(0;) PROTOCOLS(0;)" header into a prefixed port spec.
+func gnmapScannedPorts(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "# Ports scanned:")
+	if !ok {
+		return "", false
+	}
+	services := make(map[string]string)
+	for _, field := range strings.Fields(rest) {
+		name, list, ok := strings.Cut(strings.TrimSuffix(field, ")"), "(")
+		if !ok {
+			continue
+		}
+		if _, ports, ok := strings.Cut(list, ";"); ok {
+			services[strings.ToLower(name)] = ports
+		}
+	}
+	spec := scannedPortsSpec(services)
+	return spec, spec != ""
+}
+
+// parseGNMAPHostLine parses one tab-separated "Host:" record. A host usually
+// appears twice: once with Status and once with Ports/OS.
+func parseGNMAPHostLine(line string) (HostObservation, error) {
+	var host HostObservation
+	for _, field := range strings.Split(line, "\t") {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Host":
+			ip, hostname := parseGNMAPHostField(value)
+			host.IPAddress = ip
+			host.Hostname = hostname
+		case "Status":
+			host.HostState = strings.ToLower(strings.TrimSpace(value))
+		case "Ports":
+			ports, err := parseGNMAPPorts(value)
+			if err != nil {
+				return HostObservation{}, err
+			}
+			host.Ports = ports
+			if host.HostState == "" {
+				host.HostState = "up"
+			}
+		case "OS":
+			host.OSGuess = value
+		}
+	}
+	if host.IPAddress == "" {
+		return HostObservation{}, fmt.Errorf("missing host address")
+	}
+	return host, nil
+}
+
+func parseGNMAPHostField(value string) (string, string) {
+	ip, rest, _ := strings.Cut(value, " ")
+	rest = strings.TrimSpace(rest)
+	hostname := strings.TrimSuffix(strings.TrimPrefix(rest, "("), ")")
+	return strings.TrimSpace(ip), strings.TrimSpace(hostname)
+}
+
+// parseGNMAPPorts parses the comma-separated port tuples of a Ports field.
+// Each tuple is port/state/protocol/owner/service/rpc_info/version/.
+func parseGNMAPPorts(value string) ([]PortObservation, error) {
+	var ports []PortObservation
+	for _, raw := range splitGNMAPPortEntries(value) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parts := strings.Split(raw, "/")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid port entry %q", raw)
+		}
+		portNumber, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || portNumber < 0 || portNumber > 65535 {
+			return nil, fmt.Errorf("invalid port number in %q", raw)
+		}
+		port := PortObservation{
+			PortNumber: portNumber,
+			State:      strings.ToLower(strings.TrimSpace(parts[1])),
+			Protocol:   strings.ToLower(strings.TrimSpace(parts[2])),
+		}
+		if len(parts) > 4 {
+			port.Service = gnmapUnescape(parts[4])
+		}
+		if len(parts) > 6 {
+			version := strings.TrimSuffix(strings.Join(parts[6:], "/"), "/")
+			port.Product, port.Version, port.ExtraInfo = splitGNMAPVersion(gnmapUnescape(version))
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// splitGNMAPPortEntries splits a Ports field on the commas that separate
+// tuples. Version strings may contain commas themselves, so a comma only ends
+// an entry when the next chunk starts with a "<port>/" prefix.
+func splitGNMAPPortEntries(value string) []string {
+	var entries []string
+	for _, chunk := range strings.Split(value, ",") {
+		if len(entries) > 0 && !startsWithPortNumber(strings.TrimSpace(chunk)) {
+			entries[len(entries)-1] += "," + chunk
+			continue
+		}
+		entries = append(entries, chunk)
+	}
+	return entries
+}
+
+func startsWithPortNumber(chunk string) bool {
+	digits := 0
+	for digits < len(chunk) && chunk[digits] >= '0' && chunk[digits] <= '9' {
+		digits++
+	}
+	return digits > 0 && digits < len(chunk) && chunk[digits] == '/'
+}
+
+// splitGNMAPVersion recovers product/version/extrainfo from nmap's combined
+// "product version (extrainfo)" string. The split is a best-effort heuristic:
+// the version starts at the first token beginning with a digit.
+func splitGNMAPVersion(value string) (string, string, string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", ""
+	}
+
+	var extraInfo string
+	if strings.HasSuffix(value, ")") {
+		if open := strings.LastIndex(value, " ("); open >= 0 {
+			extraInfo = strings.TrimSpace(value[open+2 : len(value)-1])
+			value = strings.TrimSpace(value[:open])
+		}
+	}
+
+	tokens := strings.Fields(value)
+	for i, token := range tokens {
+		if i > 0 && token[0] >= '0' && token[0] <= '9' {
+			return strings.Join(tokens[:i], " "), strings.Join(tokens[i:], " "), extraInfo
+		}
+	}
+	return value, "", extraInfo
+}
+
+// gnmapUnescape reverses nmap's escaping of '/' as '|' inside tuple fields.
+func gnmapUnescape(value string) string {
+	return strings.TrimSpace(strings.ReplaceAll(value, "|", "/"))
+}
+
+func mergeGNMAPHost(dst *HostObservation, src HostObservation) {
+	dst.Hostname = pickNonEmpty(dst.Hostname, src.Hostname)
+	dst.OSGuess = pickNonEmpty(src.OSGuess, dst.OSGuess)
+	dst.HostState = pickNonEmpty(dst.HostState, src.HostState)
+	dst.Ports = append(dst.Ports, src.Ports...)
+}
@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gnmapFixturePath(t *testing.T) string {
+	t.Helper()
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(filename), "testdata", "sampleNmap.gnmap")
+}
+
+func TestParseGNMAPSampleFile(t *testing.T) {
+	f, err := os.Open(gnmapFixturePath(t))
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+
+	obs, metadata, err := ParseGNMAPWithMetadata(f)
+	if err != nil {
+		t.Fatalf("parse gnmap: %v", err)
+	}
+	if metadata.NmapArgs != "nmap -sV -O -oG sample.gnmap 192.0.2.0/29" {
+		t.Fatalf("unexpected nmap args: %q", metadata.NmapArgs)
+	}
+	if len(obs.Hosts) != 3 {
+		t.Fatalf("expected 3 hosts, got %d", len(obs.Hosts))
+	}
+
+	gw := obs.Hosts[0]
+	if gw.IPAddress != "192.0.2.1" || gw.Hostname != "gw.example.test" || gw.HostState != "up" {
+		t.Fatalf("unexpected gateway host: %#v", gw)
+	}
+	if gw.OSGuess != "Linux 5.0 - 5.14" {
+		t.Fatalf("unexpected os guess: %q", gw.OSGuess)
+	}
+	if len(gw.Ports) != 3 {
+		t.Fatalf("expected 3 ports on gateway, got %d", len(gw.Ports))
+	}
+	ssh := gw.Ports[0]
+	if ssh.PortNumber != 22 || ssh.Protocol != "tcp" || ssh.State != "open" || ssh.Service != "ssh" {
+		t.Fatalf("unexpected ssh port: %#v", ssh)
+	}
+	if ssh.Product != "OpenSSH" || ssh.Version != "8.9p1 Ubuntu 3ubuntu0.6" || ssh.ExtraInfo != "Ubuntu Linux; protocol 2.0" {
+		t.Fatalf("unexpected ssh fingerprint: %#v", ssh)
+	}
+	if gw.Ports[2].State != "filtered" || gw.Ports[2].Product != "" {
+		t.Fatalf("unexpected filtered port: %#v", gw.Ports[2])
+	}
+
+	second := obs.Hosts[1]
+	if second.Hostname != "" || len(second.Ports) != 2 {
+		t.Fatalf("unexpected second host: %#v", second)
+	}
+	if second.Ports[0].Protocol != "udp" || second.Ports[0].Product != "dnsmasq" || second.Ports[0].Version != "2.86" {
+		t.Fatalf("unexpected udp port: %#v", second.Ports[0])
+	}
+	if second.Ports[1].Product != "Microsoft Terminal Services" || second.Ports[1].Version != "" {
+		t.Fatalf("unexpected rdp fingerprint: %#v", second.Ports[1])
+	}
+
+	if obs.Hosts[2].HostState != "down" || len(obs.Hosts[2].Ports) != 0 {
+		t.Fatalf("unexpected down host: %#v", obs.Hosts[2])
+	}
+}
+
+func TestParseGNMAPHandlesEscapesAndCommas(t *testing.T) {
+	input := "Host: 10.0.0.5 ()\tPorts: 8080/open/tcp//http-proxy//Foo|Bar proxy 2.1 (a, b)/, 9000/closed/tcp/////\n"
+	obs, err := ParseGNMAP(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse gnmap: %v", err)
+	}
+	if len(obs.Hosts) != 1 || len(obs.Hosts[0].Ports) != 2 {
+		t.Fatalf("unexpected observations: %#v", obs)
+	}
+	p := obs.Hosts[0].Ports[0]
+	if p.Product != "Foo/Bar proxy" || p.Version != "2.1" || p.ExtraInfo != "a, b" {
+		t.Fatalf("unexpected fingerprint: %#v", p)
+	}
+	if obs.Hosts[0].HostState != "up" {
+		t.Fatalf("expected ports line to imply up, got %q", obs.Hosts[0].HostState)
+	}
+}
+
+func TestParseGNMAPRejectsMalformedPort(t *testing.T) {
+	input := "Host: 10.0.0.5 ()\tPorts: notaport/open/tcp////\n"
+	if _, err := ParseGNMAP(strings.NewReader(input)); err == nil {
+		t.Fatalf("expected error for malformed port entry")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Format
+	}{
+		{"<?xml version=\"1.0\"?><nmaprun/>", FormatNmapXML},
+		{"\xEF\xBB\xBF\n  <nmaprun/>", FormatNmapXML},
+		{"# Nmap 7.94 scan initiated as: nmap -oG - 10.0.0.1\n", FormatGNMAP},
+		{"Host: 10.0.0.1 ()\tStatus: Up\n", FormatGNMAP},
+		{"hello world", FormatUnknown},
+		{"", FormatUnknown},
+		{"<?xml version=\"1.0\"?><project><modelVersion/></project>", FormatUnknown},
+		{`{"name":"tool","version":"1.0"}`, FormatUnknown},
+	}
+	for _, tc := range tests {
+		got, r, err := DetectFormat(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("detect %q: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Fatalf("detect %q: got %q want %q", tc.input, got, tc.want)
+		}
+		replayed, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("replay %q: %v", tc.input, err)
+		}
+		if string(replayed) != tc.input {
+			t.Fatalf("replay mismatch: got %q want %q", replayed, tc.input)
+		}
+	}
+}
+
+func TestImportFileWithOptionsDetectsGNMAP(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("gnmap")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	now := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	stats, err := ImportFileWithOptions(database, mustMatcher(t, nil), project.ID, gnmapFixturePath(t), ImportOptions{}, now)
+	if err != nil {
+		t.Fatalf("import gnmap: %v", err)
+	}
+	if stats.HostsFound != 3 || stats.PortsFound != 5 {
+		t.Fatalf("unexpected stats: hosts=%d ports=%d", stats.HostsFound, stats.PortsFound)
+	}
+	if stats.NmapArgs != "nmap -sV -O -oG sample.gnmap 192.0.2.0/29" {
+		t.Fatalf("unexpected recorded args: %q", stats.NmapArgs)
+	}
+
+	host, found, err := database.GetHostByIP(project.ID, "192.0.2.1")
+	if err != nil || !found {
+		t.Fatalf("get host: found=%v err=%v", found, err)
+	}
+	if host.Hostname != "gw.example.test" || host.OSGuess != "Linux 5.0 - 5.14" {
+		t.Fatalf("unexpected host row: %#v", host)
+	}
+	ports, err := database.ListPorts(host.ID)
+	if err != nil {
+		t.Fatalf("list ports: %v", err)
+	}
+	if len(ports) != 3 {
+		t.Fatalf("expected 3 ports, got %d", len(ports))
+	}
+
+	observations, err := database.ListHostObservationsByImport(project.ID, stats.ID)
+	if err != nil {
+		t.Fatalf("list host observations: %v", err)
+	}
+	if len(observations) != 3 {
+		t.Fatalf("expected 3 host observations, got %d", len(observations))
+	}
+}
+
+func TestImportWithOptionsRejectsUnknownFormat(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("unknown")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	_, err = ImportWithOptions(database, mustMatcher(t, nil), project.ID, "notes.txt", strings.NewReader("just some notes"), ImportOptions{}, time.Now())
+	if err == nil || !strings.Contains(err.Error(), ErrUnrecognizedFormat.Error()) {
+		t.Fatalf("expected unrecognized format error, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package importer
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -19,7 +20,7 @@ import (
 var (
 	reTopPorts1000 = regexp.MustCompile(`(?i)--top-ports(?:=|\s+)1000(?:\D|$)`)
 	reScriptVuln   = regexp.MustCompile(`(?i)--script(?:=|\s+)vuln(?:\D|$)`)
-	reFullTCP      = regexp.MustCompile(`(?i)(?:^|\s)-p(?:=|\s+)?(?:t:)?1-65535(?:\s|$)`)
+	reFullTCP      = regexp.MustCompile(`(?i)(?:^|\s)(?:-p|--ports?)(?:=|\s+)?(?:t:)?[01]-65535(?:\s|$)`)
 	rePortSelect   = regexp.MustCompile(`(?i)(?:^|\s)-p(?:=|\s+|$|[0-9t])`)
 )
 
@@ -30,11 +31,19 @@ type Observations struct {
 
 // HostObservation represents a host and its ports.
 type HostObservation struct {
-	IPAddress string
-	Hostname  string
-	OSGuess   string
-	HostState string
+	IPAddress  string
+	Hostname   string
+	OSGuess    string
+	MACAddress string
+	MACVendor  string
+	HostState  string
+	// StartedAt and EndedAt are the scanner-reported times the host was
+	// scanned; zero when the format does not record them.
+	StartedAt time.Time
+	EndedAt   time.Time
 	Ports     []PortObservation
+	// Scripts holds host-level (<hostscript>) NSE results.
+	Scripts []ScriptResult
 }
 
 // PortObservation captures per-port data.
@@ -47,19 +56,80 @@ type PortObservation struct {
 	Product      string
 	ExtraInfo    string
 	ScriptOutput string
+	Scripts      []ScriptResult
 }
 
-// ParseMetadata captures import metadata from a parsed XML file.
+// ScriptResult captures one NSE script's raw output and its parsed element
+// tree as JSON.
+type ScriptResult struct {
+	ScriptID string
+	Output   string
+	Elements json.RawMessage
+}
+
+// ParseMetadata captures import metadata from a parsed scan file.
 type ParseMetadata struct {
-	NmapArgs string
+	NmapArgs    string
+	ScannerType string
+	// ScanStartedAt and ScanFinishedAt are the scanner-reported run times;
+	// zero when the format does not record them.
+	ScanStartedAt  time.Time
+	ScanFinishedAt time.Time
+	// ContentSHA256 is the normalised hash of the parsed file; see
+	// ContentHasher.
+	ContentSHA256 string
+	// ScannedPorts is the port list the scanner recorded probing, as an nmap
+	// port spec ("T:1-1024,U:53"); empty when the file does not say.
+	ScannedPorts string
+	// artifact holds the original file for the import to store.
+	artifact *db.ScanArtifactWriter
 }
 
+// DefaultImportBatchSize is the number of hosts staged per transaction by the
+// streaming XML import when ImportOptions.BatchSize is unset.
+const DefaultImportBatchSize = 500
+
+// staleStagingImportAge bounds how long an unpublished staging import may
+// linger before a later import purges it.
+const staleStagingImportAge = 24 * time.Hour
+
 // ImportOptions controls optional behavior during import.
 type ImportOptions struct {
-	ManualIntents    []string
+	ManualIntents []string
+	// BatchSize is the number of hosts committed per staging transaction in
+	// the streaming XML import. Zero uses DefaultImportBatchSize.
+	BatchSize int
+	// ScanArgs is a fallback command line for formats that do not record one
+	// (masscan, naabu, rustscan); it feeds intent inference and nmap_args.
+	ScanArgs         string
 	ScannerLabel     string
 	ManualSourceIP   string
 	ManualSourcePort string
+	// Force imports a file even when the project already has an import with
+	// the same content hash, or the same scan arguments and start time.
+	Force bool
+	// Progress, when set, is called as the import moves through its phases
+	// and after each staged batch of hosts.
+	Progress func(ImportProgress) `json:"-"`
+}
+
+// Import phases reported through ImportOptions.Progress.
+const (
+	PhaseParsing = "parsing"
+	PhaseWriting = "writing"
+)
+
+// ImportProgress is a snapshot of a running import.
+type ImportProgress struct {
+	Phase string
+	Hosts int
+	Ports int
+}
+
+func (o ImportOptions) report(phase string, stats *ImportStats) {
+	if o.Progress != nil {
+		o.Progress(ImportProgress{Phase: phase, Hosts: stats.HostsFound, Ports: stats.PortsFound})
+	}
 }
 
 // SuggestedIntent represents an auto-inferred intent.
@@ -71,9 +141,32 @@ type SuggestedIntent struct {
 // ImportStats holds results of an import operation.
 type ImportStats struct {
 	db.ScanImport
-	InScope  int
-	OutScope int
-	Skipped  int
+	InScope    int
+	OutScope   int
+	Skipped    int
+	MACChanges []MACChange
+	// ContentSHA256 is the normalised hash recorded for the import, empty
+	// when the observations did not come from a file.
+	ContentSHA256 string
+	// RawSHA256 is the SHA-256 of the original file stored with the import,
+	// empty when the observations did not come from a file.
+	RawSHA256 string
+	// ScannedPorts is ParseMetadata.ScannedPorts for the import.
+	ScannedPorts string
+	// PortsNotObserved counts current ports the scan covered but no longer
+	// reported; see reconcileMissingPorts.
+	PortsNotObserved int
+}
+
+// MACChange records a known host whose MAC address differs from the one
+// stored by an earlier import, which usually means the IP was reassigned to
+// another device or is being spoofed.
+type MACChange struct {
+	IPAddress      string
+	PreviousMAC    string
+	PreviousVendor string
+	MACAddress     string
+	MACVendor      string
 }
 
 type sourceMetadata struct {
@@ -145,12 +238,18 @@ func ImportObservations(database *db.DB, matcher *scope.Matcher, projectID int64
 	return ImportObservationsWithOptions(database, matcher, projectID, filename, obs, ParseMetadata{}, ImportOptions{}, now)
 }
 
-// ImportObservationsWithOptions merges parsed observations into the DB for a project.
+// ImportObservationsWithOptions merges parsed observations into the DB for a
+// project. A nil matcher applies the project's stored scope definitions.
 func ImportObservationsWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, obs Observations, metadata ParseMetadata, options ImportOptions, now time.Time) (ImportStats, error) {
 	if err := ValidateImportOptions(options); err != nil {
 		return ImportStats{}, err
 	}
-	resolvedSource, err := resolveSourceMetadata(metadata.NmapArgs, options)
+	matcher, err := resolveMatcher(database, projectID, matcher)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	scanArgs := pickNonEmpty(metadata.NmapArgs, strings.TrimSpace(options.ScanArgs))
+	resolvedSource, err := resolveSourceMetadata(scanArgs, options)
 	if err != nil {
 		return ImportStats{}, err
 	}
@@ -163,40 +262,63 @@ func ImportObservationsWithOptions(database *db.DB, matcher *scope.Matcher, proj
 
 	stats := ImportStats{
 		ScanImport: db.ScanImport{
-			ProjectID:     projectID,
-			Filename:      filename,
-			HostsFound:    len(obs.Hosts),
-			NmapArgs:      resolvedSource.NmapArgs,
-			ScannerLabel:  resolvedSource.ScannerLabel,
-			SourceIP:      resolvedSource.SourceIP,
-			SourcePort:    resolvedSource.SourcePort,
-			SourcePortRaw: resolvedSource.SourcePortRaw,
+			ProjectID:      projectID,
+			Filename:       filename,
+			HostsFound:     len(obs.Hosts),
+			NmapArgs:       resolvedSource.NmapArgs,
+			ScannerType:    pickNonEmpty(metadata.ScannerType, db.ScannerTypeNmap),
+			ScannerLabel:   resolvedSource.ScannerLabel,
+			SourceIP:       resolvedSource.SourceIP,
+			SourcePort:     resolvedSource.SourcePort,
+			SourcePortRaw:  resolvedSource.SourcePortRaw,
+			ScanStartedAt:  timePtr(metadata.ScanStartedAt),
+			ScanFinishedAt: timePtr(metadata.ScanFinishedAt),
 		},
 	}
 	for _, h := range obs.Hosts {
 		stats.PortsFound += len(h.Ports)
 	}
 
+	if err := checkDuplicate(tx, projectID, stats.ScanImport, metadata.ContentSHA256, options.Force); err != nil {
+		return ImportStats{}, err
+	}
 	record, err := tx.InsertScanImport(stats.ScanImport)
 	if err != nil {
 		return ImportStats{}, err
 	}
 	stats.ScanImport = record
+	stats.ContentSHA256 = metadata.ContentSHA256
+	if err := tx.SetScanImportContentHash(record.ID, metadata.ContentSHA256); err != nil {
+		return ImportStats{}, err
+	}
+	if metadata.artifact != nil {
+		artifact, err := tx.AttachScanArtifact(record.ID, metadata.artifact)
+		if err != nil {
+			return ImportStats{}, err
+		}
+		stats.RawSHA256 = artifact.SHA256
+	}
 
-	resolvedIntents := ResolveImportIntents(options.ManualIntents, SuggestIntents(filename, metadata.NmapArgs, obs))
+	resolvedIntents := ResolveImportIntents(options.ManualIntents, SuggestIntents(filename, scanArgs, obs))
 	if err := insertResolvedIntents(tx, stats.ScanImport.ID, resolvedIntents); err != nil {
 		return ImportStats{}, err
 	}
 
 	for _, hObs := range obs.Hosts {
-		if _, err := netip.ParseAddr(hObs.IPAddress); err != nil {
-			return ImportStats{}, fmt.Errorf("invalid ip %q: %w", hObs.IPAddress, err)
+		ip, ok := normalizeHostAddress(hObs.IPAddress)
+		if !ok {
+			return ImportStats{}, fmt.Errorf("invalid ip %q", hObs.IPAddress)
 		}
+		hObs.IPAddress = ip
 
-		if err := upsertHostAndObservations(tx, matcher, projectID, stats.ScanImport.ID, hObs, now, &stats); err != nil {
+		if err := upsertHostAndObservations(tx, matcher, projectID, stats.ScanImport.ID, hObs, observedAt(hObs, stats.ScanImport, now), &stats); err != nil {
 			return ImportStats{}, err
 		}
 	}
+	stats.ScannedPorts = metadata.ScannedPorts
+	if err := reconcileMissingPorts(tx, projectID, stats.ScanImport, stats.ScannedPorts, &stats); err != nil {
+		return ImportStats{}, err
+	}
 
 	if err := tx.UpdateScanImportCounts(stats.ScanImport.ID, stats.HostsFound, stats.PortsFound); err != nil {
 		return ImportStats{}, err
@@ -207,152 +329,362 @@ func ImportObservationsWithOptions(database *db.DB, matcher *scope.Matcher, proj
 	return stats, nil
 }
 
-// ImportXML streams an Nmap XML document within a single transaction.
+// ImportXML streams an Nmap XML document into the database.
 func ImportXML(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, r io.Reader, now time.Time) (ImportStats, error) {
 	return ImportXMLWithOptions(database, matcher, projectID, filename, r, ImportOptions{}, now)
 }
 
-// ImportXMLWithOptions streams an Nmap XML document within a single transaction.
+// ImportXMLWithOptions streams an Nmap XML document into the database.
+//
+// Hosts are decoded one at a time and staged as observations under a
+// scan_import in the staging state, committing every BatchSize hosts so that
+// neither memory nor the write lock grows with the file. A final transaction
+// merges the staged observations into current host/port state and marks the
+// import complete; until then the import is invisible to readers, and on
+// failure the staged rows are discarded.
+//
+// The file is hashed as it is read. Unless options.Force is set, the publish
+// transaction rejects it with a *DuplicateImportError when the project
+// already has an import with the same hash, or the same nmap arguments and
+// scan start time.
+//
+// A nil matcher applies the project's stored scope definitions.
 func ImportXMLWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, r io.Reader, options ImportOptions, now time.Time) (ImportStats, error) {
 	if err := ValidateImportOptions(options); err != nil {
 		return ImportStats{}, err
 	}
-	initialSource, err := resolveSourceMetadata("", options)
+	matcher, err := resolveMatcher(database, projectID, matcher)
 	if err != nil {
 		return ImportStats{}, err
 	}
-
-	tx, err := database.Begin()
+	initialSource, err := resolveSourceMetadata(strings.TrimSpace(options.ScanArgs), options)
 	if err != nil {
 		return ImportStats{}, err
 	}
-	defer tx.Rollback()
-
-	stats := ImportStats{
-		ScanImport: db.ScanImport{
-			ProjectID:     projectID,
-			Filename:      filename,
-			NmapArgs:      initialSource.NmapArgs,
-			ScannerLabel:  initialSource.ScannerLabel,
-			SourceIP:      initialSource.SourceIP,
-			SourcePort:    initialSource.SourcePort,
-			SourcePortRaw: initialSource.SourcePortRaw,
-		},
+	if _, err := database.PurgeStaleStagingScanImports(staleStagingImportAge); err != nil {
+		return ImportStats{}, err
 	}
-
-	record, err := tx.InsertScanImport(stats.ScanImport)
+	artifact, err := database.NewScanArtifactWriter()
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer artifact.Close()
+
+	record, err := database.InsertScanImport(db.ScanImport{
+		ProjectID:     projectID,
+		Filename:      filename,
+		NmapArgs:      initialSource.NmapArgs,
+		ScannerLabel:  initialSource.ScannerLabel,
+		SourceIP:      initialSource.SourceIP,
+		SourcePort:    initialSource.SourcePort,
+		SourcePortRaw: initialSource.SourcePortRaw,
+		Status:        db.ScanImportStatusStaging,
+	})
 	if err != nil {
 		return ImportStats{}, err
 	}
-	stats.ScanImport = record
 
-	var nmapArgs string
-	sourceMetadataUpdated := false
-	updateSourceMetadata := func() error {
-		if sourceMetadataUpdated {
-			return nil
+	stats := ImportStats{ScanImport: record}
+	options.report(PhaseParsing, &stats)
+	hasher := NewContentHasher()
+	r = io.TeeReader(r, io.MultiWriter(hasher, artifact))
+	nmapArgs, err := stageXML(database, matcher, projectID, r, options, &stats)
+	if err == nil {
+		// Hash whatever follows the closing </nmaprun> too.
+		if _, err = io.Copy(io.Discard, r); err != nil {
+			err = fmt.Errorf("read xml: %w", err)
 		}
-		resolvedSource, err := resolveSourceMetadata(nmapArgs, options)
-		if err != nil {
-			return err
-		}
-		if err := tx.UpdateScanImportSourceMetadata(
-			stats.ScanImport.ID,
-			resolvedSource.NmapArgs,
-			resolvedSource.SourceIP,
-			resolvedSource.SourcePort,
-			resolvedSource.SourcePortRaw,
-		); err != nil {
-			return err
-		}
-		stats.ScanImport.NmapArgs = resolvedSource.NmapArgs
-		stats.ScanImport.ScannerLabel = resolvedSource.ScannerLabel
-		stats.ScanImport.SourceIP = resolvedSource.SourceIP
-		stats.ScanImport.SourcePort = resolvedSource.SourcePort
-		stats.ScanImport.SourcePortRaw = resolvedSource.SourcePortRaw
-		sourceMetadataUpdated = true
-		return nil
 	}
-	intentsInserted := false
-	insertIntents := func() error {
-		if intentsInserted {
-			return nil
-		}
+	if err == nil {
+		stats.ContentSHA256 = hasher.Sum()
+		options.report(PhaseWriting, &stats)
 		resolved := ResolveImportIntents(options.ManualIntents, SuggestIntents(filename, nmapArgs, Observations{}))
-		if err := insertResolvedIntents(tx, stats.ScanImport.ID, resolved); err != nil {
-			return err
+		err = publishStagedImport(database, projectID, resolved, artifact, options, now, &stats)
+	}
+	if err != nil {
+		if discardErr := database.DiscardStagingScanImport(record.ID); discardErr != nil {
+			return ImportStats{}, fmt.Errorf("%w (discard staged import: %v)", err, discardErr)
 		}
-		intentsInserted = true
-		return nil
+		return ImportStats{}, err
 	}
+	stats.ScanImport.Status = db.ScanImportStatusComplete
+	return stats, nil
+}
 
-	dec := xml.NewDecoder(r)
-	for {
-		tok, err := dec.Token()
-		if err == io.EOF {
-			break
+// stageXML decodes hosts from r and writes their observations in batched
+// transactions. It returns the effective scan arguments for intent inference.
+func stageXML(database *db.DB, matcher *scope.Matcher, projectID int64, r io.Reader, options ImportOptions, stats *ImportStats) (string, error) {
+	batchSize := batchSizeOrDefault(options.BatchSize)
+	nmapArgs := strings.TrimSpace(options.ScanArgs)
+	scanned := make(map[string]string)
+
+	var tx *db.Tx
+	pending := 0
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	begin := func() error {
+		if tx != nil {
+			return nil
+		}
+		var err error
+		tx, err = database.Begin()
+		return err
+	}
+	flush := func() error {
+		if tx == nil {
+			return nil
 		}
+		err := tx.Commit()
+		tx = nil
+		pending = 0
 		if err != nil {
-			return ImportStats{}, fmt.Errorf("decode xml: %w", err)
+			return fmt.Errorf("commit staged batch: %w", err)
 		}
+		options.report(PhaseParsing, stats)
+		return nil
+	}
 
-		start, ok := tok.(xml.StartElement)
-		if !ok {
-			continue
-		}
+	err := walkXML(r,
+		func(start xml.StartElement) error {
+			nmapArgs = pickNonEmpty(nmapArgsFromStart(start), strings.TrimSpace(options.ScanArgs))
+			resolvedSource, err := resolveSourceMetadata(nmapArgs, options)
+			if err != nil {
+				return err
+			}
+			if err := begin(); err != nil {
+				return err
+			}
+			if err := tx.UpdateScanImportSourceMetadata(
+				stats.ScanImport.ID,
+				resolvedSource.NmapArgs,
+				resolvedSource.SourceIP,
+				resolvedSource.SourcePort,
+				resolvedSource.SourcePortRaw,
+			); err != nil {
+				return err
+			}
+			stats.ScanImport.NmapArgs = resolvedSource.NmapArgs
+			stats.ScanImport.ScannerLabel = resolvedSource.ScannerLabel
+			stats.ScanImport.SourceIP = resolvedSource.SourceIP
+			stats.ScanImport.SourcePort = resolvedSource.SourcePort
+			stats.ScanImport.SourcePortRaw = resolvedSource.SourcePortRaw
+			stats.ScanImport.ScanStartedAt = timePtr(unixTimeAttr(start, "start"))
+			return nil
+		},
+		func(info xml.StartElement) error {
+			scanned[attrValue(info, "protocol")] = attrValue(info, "services")
+			stats.ScannedPorts = scannedPortsSpec(scanned)
+			return nil
+		},
+		func(host nmapHost) error {
+			hObs := observationFromHost(host)
+			ip, ok := normalizeHostAddress(hObs.IPAddress)
+			if !ok {
+				stats.Skipped++
+				return nil
+			}
+			hObs.IPAddress = ip
 
-		if start.Name.Local == "nmaprun" {
-			nmapArgs = nmapArgsFromStart(start)
-			if err := updateSourceMetadata(); err != nil {
-				return ImportStats{}, err
+			if err := begin(); err != nil {
+				return err
 			}
-			if err := insertIntents(); err != nil {
-				return ImportStats{}, err
+			inScope, err := countScope(tx, matcher, projectID, hObs, stats)
+			if err != nil {
+				return err
 			}
-			continue
-		}
-		if start.Name.Local != "host" {
-			continue
-		}
-		if err := insertIntents(); err != nil {
-			return ImportStats{}, err
-		}
+			if err := insertObservations(tx, projectID, stats.ScanImport.ID, hObs, inScope); err != nil {
+				return err
+			}
+			stats.HostsFound++
+			stats.PortsFound += len(hObs.Ports)
+			pending++
+			if pending >= batchSize {
+				return flush()
+			}
+			return nil
+		},
+		func(finished xml.StartElement) error {
+			stats.ScanImport.ScanFinishedAt = timePtr(unixTimeAttr(finished, "time"))
+			return nil
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := flush(); err != nil {
+		return "", err
+	}
+	return nmapArgs, nil
+}
 
-		var host nmapHost
-		if err := dec.DecodeElement(&host, &start); err != nil {
-			return ImportStats{}, fmt.Errorf("decode host: %w", err)
-		}
+// publishStagedImport merges the staged observations of an import into
+// current host/port state, stores the original file and marks the import
+// complete in a single transaction. Observations are read back in pages of the
+// options' batch size.
+func publishStagedImport(database *db.DB, projectID int64, intents []db.ScanImportIntent, artifact *db.ScanArtifactWriter, options ImportOptions, now time.Time, stats *ImportStats) error {
+	batchSize := batchSizeOrDefault(options.BatchSize)
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-		hObs := observationFromHost(host)
-		if strings.TrimSpace(hObs.IPAddress) == "" {
-			stats.Skipped++
-			continue
+	if err := checkDuplicate(tx, projectID, stats.ScanImport, stats.ContentSHA256, options.Force); err != nil {
+		return err
+	}
+	if err := tx.SetScanImportContentHash(stats.ScanImport.ID, stats.ContentSHA256); err != nil {
+		return err
+	}
+	stored, err := tx.AttachScanArtifact(stats.ScanImport.ID, artifact)
+	if err != nil {
+		return err
+	}
+	stats.RawSHA256 = stored.SHA256
+
+	if err := insertResolvedIntents(tx, stats.ScanImport.ID, intents); err != nil {
+		return err
+	}
+	if err := tx.UpdateScanImportScanTimes(stats.ScanImport.ID, stats.ScanImport.ScanStartedAt, stats.ScanImport.ScanFinishedAt); err != nil {
+		return err
+	}
+
+	var afterID int64
+	for {
+		hosts, err := tx.ListHostObservationsAfter(stats.ScanImport.ID, afterID, batchSize)
+		if err != nil {
+			return err
 		}
-		addr, err := netip.ParseAddr(hObs.IPAddress)
-		if err != nil || !addr.Is4() {
-			stats.Skipped++
-			continue
+		if len(hosts) == 0 {
+			break
 		}
-
-		stats.HostsFound++
-		stats.PortsFound += len(hObs.Ports)
-		if err := upsertHostAndObservations(tx, matcher, projectID, stats.ScanImport.ID, hObs, now, &stats); err != nil {
-			return ImportStats{}, err
+		for _, staged := range hosts {
+			ports, err := tx.ListPortObservationsForHost(stats.ScanImport.ID, staged.IPAddress)
+			if err != nil {
+				return err
+			}
+			hObs := hostObservationFromStaged(staged, ports)
+			if err := upsertCurrentState(tx, projectID, hObs, staged.InScope, observedAt(hObs, stats.ScanImport, now), stats); err != nil {
+				return err
+			}
+			afterID = staged.ID
 		}
 	}
 
-	if err := insertIntents(); err != nil {
-		return ImportStats{}, err
+	if err := reconcileMissingPorts(tx, projectID, stats.ScanImport, stats.ScannedPorts, stats); err != nil {
+		return err
 	}
 
 	stats.ScanImport.HostsFound = stats.HostsFound
 	stats.ScanImport.PortsFound = stats.PortsFound
 	if err := tx.UpdateScanImportCounts(stats.ScanImport.ID, stats.HostsFound, stats.PortsFound); err != nil {
-		return ImportStats{}, err
+		return err
+	}
+	if err := tx.MarkScanImportComplete(stats.ScanImport.ID); err != nil {
+		return err
 	}
 	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit staged import: %w", err)
+	}
+	return nil
+}
+
+func hostObservationFromStaged(staged db.HostObservation, ports []db.PortObservation) HostObservation {
+	host := HostObservation{
+		IPAddress:  staged.IPAddress,
+		Hostname:   staged.Hostname,
+		OSGuess:    staged.OSGuess,
+		MACAddress: staged.MACAddress,
+		MACVendor:  staged.MACVendor,
+		HostState:  staged.HostState,
+	}
+	if staged.ScanStartedAt != nil {
+		host.StartedAt = *staged.ScanStartedAt
+	}
+	if staged.ScanEndedAt != nil {
+		host.EndedAt = *staged.ScanEndedAt
+	}
+	for _, p := range ports {
+		host.Ports = append(host.Ports, PortObservation{
+			PortNumber:   p.PortNumber,
+			Protocol:     p.Protocol,
+			State:        p.State,
+			Service:      p.Service,
+			Version:      p.Version,
+			Product:      p.Product,
+			ExtraInfo:    p.ExtraInfo,
+			ScriptOutput: p.ScriptOutput,
+		})
+	}
+	return host
+}
+
+func batchSizeOrDefault(size int) int {
+	if size <= 0 {
+		return DefaultImportBatchSize
+	}
+	return size
+}
+
+// ImportGNMAPWithOptions parses greppable nmap output and imports it within a single transaction.
+func ImportGNMAPWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, r io.Reader, options ImportOptions, now time.Time) (ImportStats, error) {
+	return importParsedWithOptions(database, matcher, projectID, filename, r, parseGNMAPWithMetadata, options, now)
+}
+
+// importParsedWithOptions runs a whole-document parser and imports the result
+// within a single transaction.
+func importParsedWithOptions(database *db.DB, matcher *scope.Matcher, projectID int64, filename string, r io.Reader, parse parseFunc, options ImportOptions, now time.Time) (ImportStats, error) {
+	if err := ValidateImportOptions(options); err != nil {
+		return ImportStats{}, err
+	}
+	options.report(PhaseParsing, &ImportStats{})
+	artifact, err := database.NewScanArtifactWriter()
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer artifact.Close()
+	hasher := NewContentHasher()
+	r = io.TeeReader(r, io.MultiWriter(hasher, artifact))
+	obs, metadata, err := parse(r)
+	if err != nil {
 		return ImportStats{}, err
 	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return ImportStats{}, fmt.Errorf("read scan file: %w", err)
+	}
+	metadata.ContentSHA256 = hasher.Sum()
+	metadata.artifact = artifact
+
+	// Mirror the XML streaming path: hosts without a usable IP address are skipped.
+	kept := obs.Hosts[:0]
+	skipped := 0
+	for _, host := range obs.Hosts {
+		ip, ok := normalizeHostAddress(host.IPAddress)
+		if !ok {
+			skipped++
+			continue
+		}
+		host.IPAddress = ip
+		kept = append(kept, host)
+	}
+	obs.Hosts = kept
+	if len(kept) == 0 && skipped > 0 {
+		return ImportStats{}, fmt.Errorf("no host in %s has a usable IP address", filename)
+	}
+
+	parsed := ImportStats{ScanImport: db.ScanImport{HostsFound: len(obs.Hosts)}}
+	for _, host := range obs.Hosts {
+		parsed.PortsFound += len(host.Ports)
+	}
+	options.report(PhaseWriting, &parsed)
+
+	stats, err := ImportObservationsWithOptions(database, matcher, projectID, filename, obs, metadata, options, now)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	stats.Skipped = skipped
 	return stats, nil
 }
 
@@ -445,52 +777,143 @@ func ResolveImportIntents(manual []string, suggested []SuggestedIntent) []db.Sca
 	return out
 }
 
-func upsertHostAndObservations(tx *db.Tx, matcher *scope.Matcher, projectID, scanImportID int64, hObs HostObservation, now time.Time, stats *ImportStats) error {
-	inScope := matcher.InScope(hObs.IPAddress)
+func upsertHostAndObservations(tx *db.Tx, matcher *scope.Matcher, projectID, scanImportID int64, hObs HostObservation, seenAt time.Time, stats *ImportStats) error {
+	inScope, err := countScope(tx, matcher, projectID, hObs, stats)
+	if err != nil {
+		return err
+	}
+	if err := upsertCurrentState(tx, projectID, hObs, inScope, seenAt, stats); err != nil {
+		return err
+	}
+	return insertObservations(tx, projectID, scanImportID, hObs, inScope)
+}
+
+// countScope classifies a host against the matcher and tallies the result.
+// Hostname rules fall back to the stored hostname when the scan reports none
+// (for example nmap -n), so a rescan does not drop a host out of scope.
+func countScope(tx *db.Tx, matcher *scope.Matcher, projectID int64, hObs HostObservation, stats *ImportStats) (bool, error) {
+	hostname := hObs.Hostname
+	if hostname == "" && matcher.HasHostnameRules() {
+		existing, _, err := tx.GetHostByIP(projectID, hObs.IPAddress)
+		if err != nil {
+			return false, err
+		}
+		hostname = existing.Hostname
+	}
+	inScope := matcher.Match(hObs.IPAddress, hostname)
 	if inScope {
 		stats.InScope++
 	} else {
 		stats.OutScope++
 	}
+	return inScope, nil
+}
 
-	existingHost, _, err := tx.GetHostByIP(projectID, hObs.IPAddress)
+// observedAt returns when the scanner saw a host: its own end or start time,
+// else the run's start or finish time, else now for formats without times.
+func observedAt(hObs HostObservation, record db.ScanImport, now time.Time) time.Time {
+	switch {
+	case !hObs.EndedAt.IsZero():
+		return hObs.EndedAt
+	case !hObs.StartedAt.IsZero():
+		return hObs.StartedAt
+	case record.ScanStartedAt != nil:
+		return *record.ScanStartedAt
+	case record.ScanFinishedAt != nil:
+		return *record.ScanFinishedAt
+	}
+	return now
+}
+
+// upsertCurrentState merges one observed host into the current host/port rows,
+// preserving analyst-owned fields (notes, work status). Port last_seen moves
+// to seenAt but never backwards, so importing an older scan late does not
+// make its ports look fresh. A MAC address that differs from the stored one
+// is recorded in stats.MACChanges, and a change of in_scope as a host scope
+// transition.
+func upsertCurrentState(tx *db.Tx, projectID int64, hObs HostObservation, inScope bool, seenAt time.Time, stats *ImportStats) error {
+	existingHost, found, err := tx.GetHostByIP(projectID, hObs.IPAddress)
 	if err != nil {
 		return err
 	}
+	existingPorts := make(map[portKey]db.Port)
+	var hostSeen time.Time
+	if found {
+		ports, err := tx.ListPorts(existingHost.ID)
+		if err != nil {
+			return err
+		}
+		for _, p := range ports {
+			existingPorts[portKey{p.PortNumber, p.Protocol}] = p
+			if seen := portSeen(p); seen.After(hostSeen) {
+				hostSeen = seen
+			}
+		}
+	}
+	// A scan older than what the host already reflects, imported late, only
+	// fills values the newer scans left empty, as replaying in scan order
+	// would.
+	stale := seenAt.Before(hostSeen)
 
 	host := db.Host{
-		ProjectID: projectID,
-		IPAddress: hObs.IPAddress,
-		Hostname:  pickNonEmpty(hObs.Hostname, existingHost.Hostname),
-		OSGuess:   pickNonEmpty(hObs.OSGuess, existingHost.OSGuess),
-		InScope:   inScope,
-		Notes:     existingHost.Notes,
+		ProjectID:  projectID,
+		IPAddress:  hObs.IPAddress,
+		Hostname:   pickNonEmpty(hObs.Hostname, existingHost.Hostname),
+		OSGuess:    pickNonEmpty(hObs.OSGuess, existingHost.OSGuess),
+		MACAddress: existingHost.MACAddress,
+		MACVendor:  existingHost.MACVendor,
+		InScope:    inScope,
+		Notes:      existingHost.Notes,
+	}
+	if stale {
+		host.Hostname = pickNonEmpty(existingHost.Hostname, hObs.Hostname)
+		host.OSGuess = pickNonEmpty(existingHost.OSGuess, hObs.OSGuess)
+	}
+	switch {
+	case hObs.MACAddress == "":
+	case stale && existingHost.MACAddress != "":
+	case strings.EqualFold(hObs.MACAddress, existingHost.MACAddress):
+		host.MACVendor = pickNonEmpty(hObs.MACVendor, existingHost.MACVendor)
+	default:
+		if found && existingHost.MACAddress != "" {
+			stats.MACChanges = append(stats.MACChanges, MACChange{
+				IPAddress:      hObs.IPAddress,
+				PreviousMAC:    existingHost.MACAddress,
+				PreviousVendor: existingHost.MACVendor,
+				MACAddress:     hObs.MACAddress,
+				MACVendor:      hObs.MACVendor,
+			})
+		}
+		host.MACAddress = hObs.MACAddress
+		host.MACVendor = hObs.MACVendor
 	}
 	upsertedHost, err := tx.UpsertHost(host)
 	if err != nil {
 		return err
 	}
-
-	if _, err := tx.InsertHostObservation(db.HostObservation{
-		ScanImportID: scanImportID,
-		ProjectID:    projectID,
-		IPAddress:    hObs.IPAddress,
-		Hostname:     hObs.Hostname,
-		InScope:      inScope,
-		HostState:    strings.ToLower(strings.TrimSpace(hObs.HostState)),
-	}); err != nil {
-		return err
+	if found && existingHost.InScope != inScope {
+		if err := tx.InsertHostScopeTransition(db.HostScopeTransition{
+			ProjectID:   projectID,
+			HostID:      upsertedHost.ID,
+			IPAddress:   upsertedHost.IPAddress,
+			FromInScope: existingHost.InScope,
+			ToInScope:   inScope,
+			Reason:      db.ScopeTransitionImport,
+		}); err != nil {
+			return err
+		}
 	}
 
 	for _, pObs := range hObs.Ports {
-		existingPort, _, err := tx.GetPortByKey(upsertedHost.ID, pObs.PortNumber, pObs.Protocol)
-		if err != nil {
-			return err
-		}
+		existingPort, portFound := existingPorts[portKey{pObs.PortNumber, pObs.Protocol}]
 		workStatus := existingPort.WorkStatus
 		if workStatus == "" {
 			workStatus = "scanned"
 		}
+		lastSeen := seenAt
+		if existingPort.LastSeen.After(lastSeen) {
+			lastSeen = existingPort.LastSeen
+		}
 		port := db.Port{
 			HostID:       upsertedHost.ID,
 			PortNumber:   pObs.PortNumber,
@@ -503,12 +926,58 @@ func upsertHostAndObservations(tx *db.Tx, matcher *scope.Matcher, projectID, sca
 			WorkStatus:   workStatus,
 			ScriptOutput: pickNonEmpty(pObs.ScriptOutput, existingPort.ScriptOutput),
 			Notes:        existingPort.Notes,
-			LastSeen:     now,
+			LastSeen:     lastSeen,
+		}
+		if portFound && seenAt.Before(portSeen(existingPort)) {
+			port.State = existingPort.State
+			port.Service = pickNonEmpty(existingPort.Service, pObs.Service)
+			port.Version = pickNonEmpty(existingPort.Version, pObs.Version)
+			port.Product = pickNonEmpty(existingPort.Product, pObs.Product)
+			port.ExtraInfo = pickNonEmpty(existingPort.ExtraInfo, pObs.ExtraInfo)
+			port.ScriptOutput = pickNonEmpty(existingPort.ScriptOutput, pObs.ScriptOutput)
+			port.NotObservedAt = existingPort.NotObservedAt
 		}
 		if _, err := tx.UpsertPort(port); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// portSeen returns when a scan last reported on the port: its last sighting,
+// or a later covering scan that no longer saw it.
+func portSeen(p db.Port) time.Time {
+	if p.NotObservedAt != nil && p.NotObservedAt.After(p.LastSeen) {
+		return *p.NotObservedAt
+	}
+	return p.LastSeen
+}
 
+// insertObservations records the per-import host and port snapshot rows.
+func insertObservations(tx *db.Tx, projectID, scanImportID int64, hObs HostObservation, inScope bool) error {
+	if _, err := tx.InsertHostObservation(db.HostObservation{
+		ScanImportID:  scanImportID,
+		ProjectID:     projectID,
+		IPAddress:     hObs.IPAddress,
+		Hostname:      hObs.Hostname,
+		OSGuess:       hObs.OSGuess,
+		MACAddress:    hObs.MACAddress,
+		MACVendor:     hObs.MACVendor,
+		InScope:       inScope,
+		HostState:     strings.ToLower(strings.TrimSpace(hObs.HostState)),
+		ScanStartedAt: timePtr(hObs.StartedAt),
+		ScanEndedAt:   timePtr(hObs.EndedAt),
+	}); err != nil {
+		return err
+	}
+
+	if err := insertScriptResults(tx, projectID, scanImportID, hObs.IPAddress, 0, "", hObs.Scripts); err != nil {
+		return err
+	}
+	for _, pObs := range hObs.Ports {
+		if err := insertScriptResults(tx, projectID, scanImportID, hObs.IPAddress, pObs.PortNumber, pObs.Protocol, pObs.Scripts); err != nil {
+			return err
+		}
 		if _, err := tx.InsertPortObservation(db.PortObservation{
 			ScanImportID: scanImportID,
 			ProjectID:    projectID,
@@ -528,6 +997,24 @@ func upsertHostAndObservations(tx *db.Tx, matcher *scope.Matcher, projectID, sca
 	return nil
 }
 
+func insertScriptResults(tx *db.Tx, projectID, scanImportID int64, ip string, portNumber int, protocol string, scripts []ScriptResult) error {
+	for _, script := range scripts {
+		if err := tx.InsertScriptResult(db.ScriptResult{
+			ScanImportID: scanImportID,
+			ProjectID:    projectID,
+			IPAddress:    ip,
+			PortNumber:   portNumber,
+			Protocol:     protocol,
+			ScriptID:     script.ScriptID,
+			Output:       script.Output,
+			Elements:     script.Elements,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func insertResolvedIntents(tx *db.Tx, importID int64, intents []db.ScanImportIntent) error {
 	for _, intent := range intents {
 		intent.ScanImportID = importID
@@ -539,12 +1026,7 @@ func insertResolvedIntents(tx *db.Tx, importID int64, intents []db.ScanImportInt
 }
 
 func nmapArgsFromStart(start xml.StartElement) string {
-	for _, attr := range start.Attr {
-		if attr.Name.Local == "args" {
-			return strings.TrimSpace(attr.Value)
-		}
-	}
-	return ""
+	return strings.TrimSpace(attrValue(start, "args"))
 }
 
 func hasFlag(args, flag string) bool {
@@ -743,10 +1225,28 @@ func cleanTokenValue(value string) string {
 	return strings.TrimSpace(value)
 }
 
+// normalizeHostAddress canonicalizes a host IP so IPv4 and IPv6 hosts each
+// map to one row: IPv4-mapped IPv6 collapses to IPv4 and zones are dropped.
+func normalizeHostAddress(raw string) (string, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	return addr.WithZone("").Unmap().String(), true
+}
+
 func intPtr(value int) *int {
 	return &value
 }
 
+// timePtr returns nil for the zero time so unknown scan times stay NULL.
+func timePtr(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+	return &value
+}
+
 func stringPtr(value string) *string {
 	return &value
 }
@@ -1,8 +1,15 @@
 package importer
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -621,3 +628,445 @@ func sameIntPtr(a, b *int) bool {
 func strPtr(value string) *string {
 	return &value
 }
+
+func TestImportXMLStoresIPv6HostsAsOwnRows(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("dual-stack")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	matcher := mustMatcher(t, []string{"198.51.100.0/24", "2001:db8::/64"})
+	xmlPayload := `<?xml version="1.0"?>
+<nmaprun args="nmap -6 -sV 2001:db8::/120">
+  <host>
+    <status state="up"/>
+    <address addr="2001:DB8::5" addrtype="ipv6"/>
+    <address addr="00:11:22:33:44:55" addrtype="mac"/>
+    <ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+  </host>
+  <host>
+    <status state="up"/>
+    <address addr="198.51.100.5" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+  </host>
+  <host>
+    <status state="up"/>
+    <address addr="2001:db8:1::9" addrtype="ipv6"/>
+  </host>
+</nmaprun>`
+
+	stats, err := ImportXML(database, matcher, project.ID, "dual.xml", strings.NewReader(xmlPayload), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("import xml: %v", err)
+	}
+	if stats.HostsFound != 3 || stats.Skipped != 0 || stats.InScope != 2 || stats.OutScope != 1 {
+		t.Fatalf("unexpected stats: hosts=%d skipped=%d in=%d out=%d", stats.HostsFound, stats.Skipped, stats.InScope, stats.OutScope)
+	}
+
+	v6, found, err := database.GetHostByIP(project.ID, "2001:db8::5")
+	if err != nil || !found {
+		t.Fatalf("expected canonical ipv6 host row, found=%v err=%v", found, err)
+	}
+	if !v6.InScope {
+		t.Fatalf("expected ipv6 host in scope")
+	}
+	if _, found, _ := database.GetHostByIP(project.ID, "198.51.100.5"); !found {
+		t.Fatalf("expected separate ipv4 host row")
+	}
+	outside, found, _ := database.GetHostByIP(project.ID, "2001:db8:1::9")
+	if !found || outside.InScope {
+		t.Fatalf("expected out-of-scope ipv6 host row, got %+v found=%v", outside, found)
+	}
+}
+
+func TestImportXMLCapturesMACAndFlagsChanges(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("mac")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	matcher := mustMatcher(t, nil)
+
+	scan := func(mac, vendor string) string {
+		return `<?xml version="1.0"?>
+<nmaprun args="nmap -sn 192.168.1.0/24">
+  <host>
+    <status state="up"/>
+    <address addr="192.168.1.10" addrtype="ipv4"/>
+    <address addr="` + mac + `" addrtype="mac" vendor="` + vendor + `"/>
+  </host>
+  <host>
+    <status state="up"/>
+    <address addr="192.168.1.11" addrtype="ipv4"/>
+  </host>
+</nmaprun>`
+	}
+
+	first, err := ImportXML(database, matcher, project.ID, "first.xml", strings.NewReader(scan("00:0c:29:ab:cd:ef", "VMware")), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	if len(first.MACChanges) != 0 {
+		t.Fatalf("expected no MAC changes on first import, got %+v", first.MACChanges)
+	}
+
+	host, _, err := database.GetHostByIP(project.ID, "192.168.1.10")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if host.MACAddress != "00:0C:29:AB:CD:EF" || host.MACVendor != "VMware" {
+		t.Fatalf("unexpected host MAC: %q %q", host.MACAddress, host.MACVendor)
+	}
+	observations, err := database.ListHostObservationsByImport(project.ID, first.ID)
+	if err != nil {
+		t.Fatalf("list observations: %v", err)
+	}
+	if len(observations) != 2 || observations[0].MACAddress != "00:0C:29:AB:CD:EF" || observations[0].MACVendor != "VMware" {
+		t.Fatalf("unexpected host observations: %+v", observations)
+	}
+
+	// Same MAC in different case is not a change.
+	same, err := ImportXML(database, matcher, project.ID, "same.xml", strings.NewReader(scan("00:0C:29:AB:CD:EF", "VMware")), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("same import: %v", err)
+	}
+	if len(same.MACChanges) != 0 {
+		t.Fatalf("expected no MAC changes for identical MAC, got %+v", same.MACChanges)
+	}
+
+	changed, err := ImportXML(database, matcher, project.ID, "changed.xml", strings.NewReader(scan("B8:27:EB:01:02:03", "Raspberry Pi Foundation")), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("changed import: %v", err)
+	}
+	want := MACChange{
+		IPAddress:      "192.168.1.10",
+		PreviousMAC:    "00:0C:29:AB:CD:EF",
+		PreviousVendor: "VMware",
+		MACAddress:     "B8:27:EB:01:02:03",
+		MACVendor:      "Raspberry Pi Foundation",
+	}
+	if len(changed.MACChanges) != 1 || changed.MACChanges[0] != want {
+		t.Fatalf("unexpected MAC changes: %+v", changed.MACChanges)
+	}
+	host, _, err = database.GetHostByIP(project.ID, "192.168.1.10")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if host.MACAddress != want.MACAddress || host.MACVendor != want.MACVendor {
+		t.Fatalf("expected host MAC to follow latest import, got %q %q", host.MACAddress, host.MACVendor)
+	}
+
+	// A scan from off-segment that reports no MAC keeps the stored one.
+	if _, err := ImportXML(database, matcher, project.ID, "remote.xml", strings.NewReader(`<nmaprun><host><status state="up"/><address addr="192.168.1.10" addrtype="ipv4"/></host></nmaprun>`), time.Now().UTC()); err != nil {
+		t.Fatalf("remote import: %v", err)
+	}
+	host, _, err = database.GetHostByIP(project.ID, "192.168.1.10")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if host.MACAddress != want.MACAddress {
+		t.Fatalf("expected MAC preserved when absent from scan, got %q", host.MACAddress)
+	}
+}
+
+func TestImportXMLStoresQueryableScriptResults(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("scripts")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	matcher := mustMatcher(t, nil)
+
+	scan := func(signing string) string {
+		return `<nmaprun>
+  <host>
+    <status state="up"/>
+    <address addr="10.0.0.5" addrtype="ipv4"/>
+    <ports>
+      <port protocol="tcp" portid="443">
+        <state state="open"/>
+        <script id="ssl-cert" output="Subject: commonName=intranet.example">
+          <table key="subject"><elem key="commonName">intranet.example</elem></table>
+        </script>
+      </port>
+    </ports>
+    <hostscript>
+      <script id="smb2-security-mode" output="3:1:1: ` + signing + `">
+        <table key="3:1:1"><elem>` + signing + `</elem></table>
+      </script>
+    </hostscript>
+  </host>
+  <host>
+    <status state="up"/>
+    <address addr="10.0.0.6" addrtype="ipv4"/>
+    <hostscript>
+      <script id="smb2-security-mode" output="3:1:1: Message signing enabled and required">
+        <table key="3:1:1"><elem>Message signing enabled and required</elem></table>
+      </script>
+    </hostscript>
+  </host>
+</nmaprun>`
+	}
+
+	if _, err := ImportXML(database, matcher, project.ID, "first.xml", strings.NewReader(scan("Message signing enabled and required")), time.Now().UTC()); err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	second, err := ImportXML(database, matcher, project.ID, "second.xml", strings.NewReader(scan("Message signing enabled but not required")), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("second import: %v", err)
+	}
+
+	results, err := database.ListScriptResults(project.ID, db.ScriptResultQuery{ScriptID: "smb2-security-mode", ElementKey: "3:1:1.0", Value: "not required"})
+	if err != nil {
+		t.Fatalf("list script results: %v", err)
+	}
+	if len(results) != 1 || results[0].IPAddress != "10.0.0.5" || results[0].ScanImportID != second.ID || results[0].PortNumber != 0 {
+		t.Fatalf("expected only the latest weak-signing host result, got %+v", results)
+	}
+	if string(results[0].Value) != `"Message signing enabled but not required"` {
+		t.Fatalf("unexpected resolved value: %s", results[0].Value)
+	}
+
+	results, err = database.ListScriptResults(project.ID, db.ScriptResultQuery{ScriptID: "ssl-cert", ElementKey: "subject.commonName"})
+	if err != nil {
+		t.Fatalf("list ssl-cert results: %v", err)
+	}
+	if len(results) != 1 || results[0].PortNumber != 443 || results[0].Protocol != "tcp" || string(results[0].Value) != `"intranet.example"` {
+		t.Fatalf("unexpected ssl-cert results: %+v", results)
+	}
+
+	results, err = database.ListScriptResults(project.ID, db.ScriptResultQuery{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("list host results: %v", err)
+	}
+	if len(results) != 2 || results[0].ScriptID != "smb2-security-mode" || results[1].ScriptID != "ssl-cert" {
+		t.Fatalf("unexpected host results: %+v", results)
+	}
+}
+
+func TestImportXMLUsesScanTimesForLastSeenAndLatestImport(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("scan-times")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	matcher := mustMatcher(t, nil)
+
+	recent := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	old := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	scan := func(args string, start time.Time) string {
+		s := start.Unix()
+		return fmt.Sprintf(`<?xml version="1.0"?>
+<nmaprun args="%s" start="%d">
+  <host starttime="%d" endtime="%d">
+    <status state="up"/>
+    <address addr="10.0.0.1" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="22"><state state="open"/></port></ports>
+  </host>
+  <runstats><finished time="%d"/></runstats>
+</nmaprun>`, args, s, s+5, s+60, s+120)
+	}
+
+	importNow := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	newer, err := ImportXML(database, matcher, project.ID, "recent.xml", strings.NewReader(scan("nmap -p- 10.0.0.1", recent)), importNow)
+	if err != nil {
+		t.Fatalf("import recent scan: %v", err)
+	}
+	older, err := ImportXML(database, matcher, project.ID, "old.xml", strings.NewReader(scan("nmap -p 22 10.0.0.1", old)), importNow)
+	if err != nil {
+		t.Fatalf("import old scan: %v", err)
+	}
+
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != 2 || imports[1].ScanStartedAt == nil || imports[1].ScanFinishedAt == nil {
+		t.Fatalf("expected scan times on imports, got %+v", imports)
+	}
+	if !imports[1].ScanStartedAt.Equal(old) || !imports[1].ScanFinishedAt.Equal(old.Add(120*time.Second)) {
+		t.Fatalf("unexpected old scan times: %v %v", imports[1].ScanStartedAt, imports[1].ScanFinishedAt)
+	}
+	if !imports[1].ScanTime().Before(imports[0].ScanTime()) {
+		t.Fatalf("expected old import to sort before recent by scan time")
+	}
+
+	observations, err := database.ListHostObservationsByImport(project.ID, older.ID)
+	if err != nil {
+		t.Fatalf("list observations: %v", err)
+	}
+	if len(observations) != 1 || observations[0].ScanStartedAt == nil || observations[0].ScanEndedAt == nil ||
+		!observations[0].ScanEndedAt.Equal(old.Add(60*time.Second)) {
+		t.Fatalf("unexpected host observation times: %+v", observations)
+	}
+
+	host, _, err := database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	port, _, err := database.GetPortByKey(host.ID, 22, "tcp")
+	if err != nil {
+		t.Fatalf("get port: %v", err)
+	}
+	if !port.LastSeen.Equal(recent.Add(60 * time.Second)) {
+		t.Fatalf("expected last_seen from the recent scan's host end time, got %v", port.LastSeen)
+	}
+
+	// Re-deriving latest_scan must pick the recent scan even though the old
+	// one was imported later.
+	if err := database.SetScanImportIntents(project.ID, older.ID, []db.ScanImportIntentInput{
+		{Intent: db.IntentTop1KTCP, Source: db.IntentSourceManual, Confidence: 1},
+	}); err != nil {
+		t.Fatalf("set intents: %v", err)
+	}
+	host, _, err = database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if host.LatestScan != db.HostLatestScanFullPort {
+		t.Fatalf("expected latest_scan from recent import %d, got %q", newer.ID, host.LatestScan)
+	}
+}
+
+func TestImportStoresOriginalFile(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "sampleNmap.xml"))
+	if err != nil {
+		t.Fatalf("read sample: %v", err)
+	}
+	sum := sha256.Sum256(raw)
+	wantSHA := hex.EncodeToString(sum[:])
+
+	for _, inDir := range []bool{false, true} {
+		t.Run(fmt.Sprintf("in dir %v", inDir), func(t *testing.T) {
+			path := filepath.Join(testutil.TempDir(t), "test.db")
+			if inDir {
+				if err := os.Mkdir(db.ArtifactDirFor(path), 0o755); err != nil {
+					t.Fatalf("create artifact dir: %v", err)
+				}
+			}
+			database, err := db.Open(path)
+			if err != nil {
+				t.Fatalf("open db: %v", err)
+			}
+			defer database.Close()
+
+			var imports []ImportStats
+			var projects []db.Project
+			for _, name := range []string{"first", "second"} {
+				project, err := database.CreateProject(name)
+				if err != nil {
+					t.Fatalf("create project: %v", err)
+				}
+				stats, err := ImportFileWithOptions(database, nil, project.ID, filepath.Join("testdata", "sampleNmap.xml"), ImportOptions{}, time.Now())
+				if err != nil {
+					t.Fatalf("import: %v", err)
+				}
+				if stats.RawSHA256 != wantSHA {
+					t.Fatalf("raw sha = %s, want %s", stats.RawSHA256, wantSHA)
+				}
+				projects = append(projects, project)
+				imports = append(imports, stats)
+			}
+
+			_, artifact, err := database.GetScanImportArtifact(projects[0].ID, imports[0].ID)
+			if err != nil {
+				t.Fatalf("get artifact: %v", err)
+			}
+			if artifact.InDir != inDir || artifact.Size != int64(len(raw)) {
+				t.Fatalf("unexpected artifact %+v", artifact)
+			}
+			r, err := database.ReadScanArtifact(artifact)
+			if err != nil {
+				t.Fatalf("read artifact: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			r.Close()
+			if err != nil || !bytes.Equal(got, raw) {
+				t.Fatalf("stored file differs from the original (%v)", err)
+			}
+			stored := artifactFile(database, wantSHA)
+			if _, err := os.Stat(stored); inDir && err != nil {
+				t.Fatalf("expected %s: %v", stored, err)
+			}
+
+			countArtifacts := func() int {
+				var n int
+				if err := database.QueryRow(`SELECT COUNT(*) FROM scan_artifact`).Scan(&n); err != nil {
+					t.Fatalf("count artifacts: %v", err)
+				}
+				return n
+			}
+			if n := countArtifacts(); n != 1 {
+				t.Fatalf("expected the shared file to be stored once, got %d", n)
+			}
+			if _, err := DeleteScanImport(database, projects[0].ID, imports[0].ID); err != nil {
+				t.Fatalf("delete import: %v", err)
+			}
+			if n := countArtifacts(); n != 1 {
+				t.Fatalf("expected the file to stay while another import uses it, got %d", n)
+			}
+			if err := database.DeleteProject(projects[1].ID); err != nil {
+				t.Fatalf("delete project: %v", err)
+			}
+			if n := countArtifacts(); n != 0 {
+				t.Fatalf("expected the unused file to be pruned, got %d", n)
+			}
+			if _, err := os.Stat(stored); inDir && !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be removed: %v", stored, err)
+			}
+		})
+	}
+}
+
+func artifactFile(database *db.DB, sha string) string {
+	return filepath.Join(database.ArtifactDir(), sha[:2], sha+".gz")
+}
+
+func TestConcurrentImportsIntoOneProject(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Concurrent")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	const workers = 4
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var gnmap strings.Builder
+			gnmap.WriteString("# Nmap 7.94 scan initiated Mon Mar  4 10:00:00 2024 as: nmap -oG - 192.0.2.0/24\n")
+			for h := 0; h < 20; h++ {
+				fmt.Fprintf(&gnmap, "Host: 192.0.2.%d ()\tPorts: %d/open/tcp//http///\n", i*20+h+1, 8000+i)
+			}
+			_, errs[i] = ImportWithOptions(database, nil, project.ID, fmt.Sprintf("scan-%d.gnmap", i), strings.NewReader(gnmap.String()), ImportOptions{}, time.Now())
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("import %d: %v", i, err)
+		}
+	}
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != workers {
+		t.Fatalf("expected %d imports, got %d", workers, len(imports))
+	}
+}
@@ -68,6 +68,32 @@ func TestSuggestIntentsInfersTop1KFromDefaultTCPScans(t *testing.T) {
 	}
 }
 
+func TestSuggestIntentsInfersAllTCPFromMasscanArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       string
+		wantAllTCP bool
+	}{
+		{name: "masscan compact range", args: "masscan -p0-65535 10.0.0.0/16 --rate 10000", wantAllTCP: true},
+		{name: "masscan spaced range", args: "masscan -p 0-65535 10.0.0.0/16", wantAllTCP: true},
+		{name: "masscan long flag", args: "masscan --ports 1-65535 10.0.0.0/16", wantAllTCP: true},
+		{name: "masscan long flag equals", args: "masscan --ports=0-65535 10.0.0.0/16", wantAllTCP: true},
+		{name: "masscan partial range", args: "masscan -p0-1024 10.0.0.0/16", wantAllTCP: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			suggested := SuggestIntents("masscan.json", tc.args, Observations{})
+			if got := hasSuggestedIntent(suggested, db.IntentAllTCP); got != tc.wantAllTCP {
+				t.Fatalf("all_tcp intent mismatch for args %q: got %v want %v (suggested=%+v)", tc.args, got, tc.wantAllTCP, suggested)
+			}
+			if hasSuggestedIntent(suggested, db.IntentTop1KTCP) {
+				t.Fatalf("explicit masscan port range should not infer top_1k_tcp: %+v", suggested)
+			}
+		})
+	}
+}
+
 func hasSuggestedIntent(items []SuggestedIntent, intent string) bool {
 	for _, item := range items {
 		if item.Intent == intent {
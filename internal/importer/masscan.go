@@ -0,0 +1,236 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// Internal parsing structs matching masscan -oX output. Masscan reuses the
+// nmaprun layout but emits one <host> element per discovered port or banner.
+type masscanRun struct {
+	Args     string `xml:"args,attr"`
+	Start    string `xml:"start,attr"`
+	Finished struct {
+		Time string `xml:"time,attr"`
+	} `xml:"runstats>finished"`
+	Hosts []masscanHost `xml:"host"`
+}
+
+type masscanHost struct {
+	Addresses []nmapAddress `xml:"address"`
+	Ports     []masscanPort `xml:"ports>port"`
+}
+
+type masscanPort struct {
+	Protocol string         `xml:"protocol,attr"`
+	PortID   int            `xml:"portid,attr"`
+	State    nmapState      `xml:"state"`
+	Service  masscanService `xml:"service"`
+}
+
+type masscanService struct {
+	Name   string `xml:"name,attr"`
+	Banner string `xml:"banner,attr"`
+}
+
+// masscanRecord matches one element of masscan -oJ output.
+type masscanRecord struct {
+	IP    string              `json:"ip"`
+	Ports []masscanRecordPort `json:"ports"`
+}
+
+type masscanRecordPort struct {
+	Port    int    `json:"port"`
+	Proto   string `json:"proto"`
+	Status  string `json:"status"`
+	Service *struct {
+		Name   string `json:"name"`
+		Banner string `json:"banner"`
+	} `json:"service"`
+}
+
+// ParseMasscanXMLWithMetadata parses masscan -oX output, merging the per-port
+// host elements into one observation per address.
+func ParseMasscanXMLWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	var run masscanRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("decode masscan xml: %w", err)
+	}
+
+	merger := newObservationMerger()
+	for _, h := range run.Hosts {
+		host := HostObservation{IPAddress: hostAddress(h.Addresses), HostState: "up"}
+		for _, p := range h.Ports {
+			host.Ports = append(host.Ports, masscanPortObservation(p.PortID, p.Protocol, p.State.State, p.Service.Name, p.Service.Banner))
+		}
+		merger.add(host)
+	}
+	return merger.observations(), ParseMetadata{
+		NmapArgs:       strings.TrimSpace(run.Args),
+		ScannerType:    db.ScannerTypeMasscan,
+		ScanStartedAt:  unixTime(run.Start),
+		ScanFinishedAt: unixTime(run.Finished.Time),
+	}, nil
+}
+
+// ParseMasscanJSONWithMetadata parses masscan -oJ output. Both the bracketed
+// array form and the older line-per-record form (including the trailing
+// "{finished: 1}" marker) are accepted.
+func ParseMasscanJSONWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("read masscan json: %w", err)
+	}
+
+	var records []masscanRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		records, err = parseMasscanJSONLines(data)
+		if err != nil {
+			return Observations{}, ParseMetadata{}, err
+		}
+	}
+
+	// JSON that does not start with an addressed record is not a masscan scan.
+	if len(records) == 0 {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("%w: no masscan json records", ErrUnrecognizedFormat)
+	}
+
+	merger := newObservationMerger()
+	for i, rec := range records {
+		host := HostObservation{IPAddress: strings.TrimSpace(rec.IP), HostState: "up"}
+		if host.IPAddress == "" && i == 0 {
+			return Observations{}, ParseMetadata{}, fmt.Errorf("%w: first masscan json record has no ip", ErrUnrecognizedFormat)
+		}
+		if host.IPAddress == "" {
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode masscan json record %d: no ip", i+1)
+		}
+		for _, p := range rec.Ports {
+			var name, banner string
+			if p.Service != nil {
+				name, banner = p.Service.Name, p.Service.Banner
+			}
+			host.Ports = append(host.Ports, masscanPortObservation(p.Port, p.Proto, p.Status, name, banner))
+		}
+		merger.add(host)
+	}
+	return merger.observations(), ParseMetadata{ScannerType: db.ScannerTypeMasscan}, nil
+}
+
+func parseMasscanJSONLines(data []byte) ([]masscanRecord, error) {
+	var records []masscanRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.Trim(line, "[],")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.Contains(line, "finished:") {
+			continue
+		}
+		if !strings.HasPrefix(line, "{") && len(records) == 0 {
+			return nil, fmt.Errorf("%w: masscan json line %d is not a record", ErrUnrecognizedFormat, lineNo)
+		}
+		if !strings.HasPrefix(line, "{") {
+			return nil, fmt.Errorf("decode masscan json line %d: not a record", lineNo)
+		}
+		var rec masscanRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("decode masscan json line %d: %w", lineNo, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read masscan json: %w", err)
+	}
+	return records, nil
+}
+
+func masscanPortObservation(port int, protocol, state, serviceName, banner string) PortObservation {
+	obs := PortObservation{
+		PortNumber: port,
+		Protocol:   strings.ToLower(strings.TrimSpace(protocol)),
+		State:      strings.ToLower(strings.TrimSpace(state)),
+	}
+	obs.Service = strings.TrimSpace(serviceName)
+	if banner = strings.TrimSpace(banner); banner != "" {
+		obs.ScriptOutput = joinScripts([]nmapScript{{ID: obs.Service, Output: banner}})
+	}
+	return obs
+}
+
+// observationMerger folds repeated host/port records (as emitted by masscan
+// and naabu) into one HostObservation per address, preserving first-seen order.
+type observationMerger struct {
+	hosts  []HostObservation
+	byIP   map[string]int
+	byPort map[string]int
+}
+
+func newObservationMerger() *observationMerger {
+	return &observationMerger{
+		byIP:   make(map[string]int),
+		byPort: make(map[string]int),
+	}
+}
+
+func (m *observationMerger) add(host HostObservation) {
+	idx, ok := m.byIP[host.IPAddress]
+	if !ok {
+		idx = len(m.hosts)
+		m.byIP[host.IPAddress] = idx
+		m.hosts = append(m.hosts, HostObservation{
+			IPAddress:  host.IPAddress,
+			Hostname:   host.Hostname,
+			OSGuess:    host.OSGuess,
+			MACAddress: host.MACAddress,
+			MACVendor:  host.MACVendor,
+			HostState:  host.HostState,
+		})
+	}
+	dst := &m.hosts[idx]
+	dst.Hostname = pickNonEmpty(dst.Hostname, host.Hostname)
+	dst.OSGuess = pickNonEmpty(dst.OSGuess, host.OSGuess)
+	if dst.MACAddress == "" && host.MACAddress != "" {
+		dst.MACAddress, dst.MACVendor = host.MACAddress, host.MACVendor
+	}
+	dst.HostState = pickNonEmpty(dst.HostState, host.HostState)
+
+	for _, p := range host.Ports {
+		key := fmt.Sprintf("%s|%d|%s", host.IPAddress, p.PortNumber, p.Protocol)
+		portIdx, ok := m.byPort[key]
+		if !ok {
+			m.byPort[key] = len(dst.Ports)
+			if p.State == "" {
+				p.State = "open"
+			}
+			dst.Ports = append(dst.Ports, p)
+			continue
+		}
+		existing := &dst.Ports[portIdx]
+		existing.State = pickNonEmpty(p.State, existing.State)
+		existing.Service = pickNonEmpty(existing.Service, p.Service)
+		existing.Product = pickNonEmpty(existing.Product, p.Product)
+		existing.Version = pickNonEmpty(existing.Version, p.Version)
+		existing.ExtraInfo = pickNonEmpty(existing.ExtraInfo, p.ExtraInfo)
+		if p.ScriptOutput != "" {
+			if existing.ScriptOutput == "" {
+				existing.ScriptOutput = p.ScriptOutput
+			} else {
+				existing.ScriptOutput += "\n" + p.ScriptOutput
+			}
+		}
+	}
+}
+
+func (m *observationMerger) observations() Observations {
+	return Observations{Hosts: m.hosts}
+}
@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+const masscanXMLSample = `<?xml version="1.0"?>
+<!-- masscan v1.3 scan -->
+<nmaprun scanner="masscan" start="1709546400" version="1.3"  xmloutputversion="1.03">
+<scaninfo type="syn" protocol="tcp" />
+<host endtime="1709546401"><address addr="10.1.0.5" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1709546401"><address addr="10.1.0.5" addrtype="ipv4"/><ports><port protocol="tcp" portid="445"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1709546402"><address addr="10.1.0.5" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open" reason="response" reason_ttl="64"/><service name="title" banner="Welcome"></service></port></ports></host>
+<host endtime="1709546402"><address addr="10.1.0.6" addrtype="ipv4"/><ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<runstats><finished time="1709546410" timestr="2024-03-04 10:00:10" elapsed="10" /><hosts up="2" down="0" total="2" /></runstats>
+</nmaprun>`
+
+const masscanJSONSample = `[
+{   "ip": "10.1.0.5",   "timestamp": "1709546401", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.1.0.5",   "timestamp": "1709546402", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "http", "banner": "HTTP/1.1 200 OK"} } ] }
+,
+{   "ip": "10.1.0.7",   "timestamp": "1709546403", "ports": [ {"port": 53, "proto": "udp", "status": "open", "reason": "none", "ttl": 64} ] }
+]
+`
+
+const masscanLegacyJSONSample = `[
+{   "ip": "10.1.0.8",   "timestamp": "1501516466", "ports": [ {"port": 3389, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 128} ] },
+{finished: 1}
+]
+`
+
+func TestParseMasscanXMLMergesPerPortHosts(t *testing.T) {
+	obs, metadata, err := ParseMasscanXMLWithMetadata(strings.NewReader(masscanXMLSample))
+	if err != nil {
+		t.Fatalf("parse masscan xml: %v", err)
+	}
+	if metadata.ScannerType != db.ScannerTypeMasscan {
+		t.Fatalf("unexpected scanner type %q", metadata.ScannerType)
+	}
+	if len(obs.Hosts) != 2 {
+		t.Fatalf("expected 2 merged hosts, got %d", len(obs.Hosts))
+	}
+	first := obs.Hosts[0]
+	if first.IPAddress != "10.1.0.5" || first.HostState != "up" || len(first.Ports) != 2 {
+		t.Fatalf("unexpected merged host: %#v", first)
+	}
+	http := first.Ports[0]
+	if http.PortNumber != 80 || http.State != "open" || http.Service != "title" || http.ScriptOutput != "title: Welcome" {
+		t.Fatalf("unexpected banner merge: %#v", http)
+	}
+}
+
+func TestParseMasscanJSONFormats(t *testing.T) {
+	obs, metadata, err := ParseMasscanJSONWithMetadata(strings.NewReader(masscanJSONSample))
+	if err != nil {
+		t.Fatalf("parse masscan json: %v", err)
+	}
+	if metadata.ScannerType != db.ScannerTypeMasscan {
+		t.Fatalf("unexpected scanner type %q", metadata.ScannerType)
+	}
+	if len(obs.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(obs.Hosts))
+	}
+	http := obs.Hosts[0].Ports[0]
+	if len(obs.Hosts[0].Ports) != 1 || http.Service != "http" || !strings.Contains(http.ScriptOutput, "HTTP/1.1 200 OK") {
+		t.Fatalf("unexpected merged http port: %#v", obs.Hosts[0].Ports)
+	}
+	if udp := obs.Hosts[1].Ports[0]; udp.Protocol != "udp" || udp.PortNumber != 53 {
+		t.Fatalf("unexpected udp port: %#v", udp)
+	}
+
+	legacy, _, err := ParseMasscanJSONWithMetadata(strings.NewReader(masscanLegacyJSONSample))
+	if err != nil {
+		t.Fatalf("parse legacy masscan json: %v", err)
+	}
+	if len(legacy.Hosts) != 1 || legacy.Hosts[0].Ports[0].PortNumber != 3389 {
+		t.Fatalf("unexpected legacy observations: %#v", legacy)
+	}
+
+	for name, input := range map[string]string{
+		"no ip":        `[{"ports":[{"port":80,"proto":"tcp"}]}]`,
+		"not a record": "[\n" + `{"ip":"10.1.0.8","ports":[{"port":22,"proto":"tcp"}]},` + "\ngarbage\n]",
+		"empty":        "[\n]\n",
+	} {
+		if _, _, err := ParseMasscanJSONWithMetadata(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error for %s", name)
+		}
+	}
+	for _, input := range []string{`[1,2,3]`, `[{"name":"x"}]`, "[]"} {
+		if _, _, err := ParseMasscanJSONWithMetadata(strings.NewReader(input)); !errors.Is(err, ErrUnrecognizedFormat) {
+			t.Fatalf("expected ErrUnrecognizedFormat for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestParseNaabuJSONLines(t *testing.T) {
+	input := `{"host":"app.example.test","ip":"10.2.0.10","port":443,"protocol":"tcp","timestamp":"2024-03-04T10:00:00Z"}
+{"host":"app.example.test","ip":"10.2.0.10","port":{"Port":8443,"Protocol":0,"TLS":true}}
+{"ip":"10.2.0.11","port":161,"protocol":"udp"}
+`
+	obs, metadata, err := ParseNaabuJSONWithMetadata(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse naabu: %v", err)
+	}
+	if metadata.ScannerType != db.ScannerTypeNaabu {
+		t.Fatalf("unexpected scanner type %q", metadata.ScannerType)
+	}
+	if len(obs.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(obs.Hosts))
+	}
+	app := obs.Hosts[0]
+	if app.Hostname != "app.example.test" || len(app.Ports) != 2 || app.Ports[1].PortNumber != 8443 || app.Ports[1].Protocol != "tcp" {
+		t.Fatalf("unexpected naabu host: %#v", app)
+	}
+	if obs.Hosts[1].Ports[0].Protocol != "udp" {
+		t.Fatalf("expected udp protocol, got %#v", obs.Hosts[1].Ports[0])
+	}
+
+	for name, input := range map[string]string{
+		"invalid port": `{"ip":"10.2.0.12","port":0}`,
+		"no address":   `{"ip":"10.2.0.12","port":22}` + "\n" + `{"port":80}`,
+		"not a record": `{"ip":"10.2.0.12","port":22}` + "\nnot json",
+		"empty":        "\n\n",
+	} {
+		if _, _, err := ParseNaabuJSONWithMetadata(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error for %s", name)
+		}
+	}
+	// JSON that is not naabu output at all is reported as such.
+	for _, input := range []string{`{"name":"x","port":1}`, `{"port": 8080,` + "\n" + `"debug": true}`} {
+		if _, _, err := ParseNaabuJSONWithMetadata(strings.NewReader(input)); !errors.Is(err, ErrUnrecognizedFormat) {
+			t.Fatalf("expected ErrUnrecognizedFormat for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestParseRustscanGreppable(t *testing.T) {
+	obs, metadata, err := ParseRustscanWithMetadata(strings.NewReader("10.3.0.1 -> [22,80,443]\n10.3.0.2 -> [3389]\n"))
+	if err != nil {
+		t.Fatalf("parse rustscan: %v", err)
+	}
+	if metadata.ScannerType != db.ScannerTypeRustscan {
+		t.Fatalf("unexpected scanner type %q", metadata.ScannerType)
+	}
+	if len(obs.Hosts) != 2 || len(obs.Hosts[0].Ports) != 3 || obs.Hosts[1].Ports[0].PortNumber != 3389 {
+		t.Fatalf("unexpected rustscan observations: %#v", obs)
+	}
+}
+
+func TestDetectFormatDiscoveryScanners(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Format
+	}{
+		{masscanXMLSample, FormatMasscanXML},
+		{masscanJSONSample, FormatMasscanJSON},
+		{`{"ip":"10.1.0.5","timestamp":"1","ports":[{"port":80}]}`, FormatMasscanJSON},
+		{`{"host":"a","ip":"10.2.0.10","port":443}`, FormatNaabuJSON},
+		{"10.3.0.1 -> [22,80]\n", FormatRustscan},
+	}
+	for _, tc := range tests {
+		got, _, err := DetectFormat(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("detect: %v", err)
+		}
+		if got != tc.want {
+			t.Fatalf("detect %.40q: got %q want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestImportMasscanRecordsScannerTypeAndArgsIntents(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("masscan")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	options := ImportOptions{ScanArgs: "masscan -p0-65535 10.1.0.0/24 --rate 5000"}
+	stats, err := ImportWithOptions(database, mustMatcher(t, nil), project.ID, "sweep.xml", strings.NewReader(masscanXMLSample), options, now)
+	if err != nil {
+		t.Fatalf("import masscan: %v", err)
+	}
+	if stats.HostsFound != 2 || stats.PortsFound != 3 {
+		t.Fatalf("unexpected stats: hosts=%d ports=%d", stats.HostsFound, stats.PortsFound)
+	}
+
+	imports, err := database.ListScanImportsWithIntents(project.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != 1 {
+		t.Fatalf("expected 1 import, got %d", len(imports))
+	}
+	item := imports[0]
+	if item.ScannerType != db.ScannerTypeMasscan {
+		t.Fatalf("expected masscan scanner type, got %q", item.ScannerType)
+	}
+	if item.NmapArgs != options.ScanArgs {
+		t.Fatalf("expected fallback args recorded, got %q", item.NmapArgs)
+	}
+	if len(item.Intents) != 1 || item.Intents[0].Intent != db.IntentAllTCP {
+		t.Fatalf("expected all_tcp intent only, got %#v", item.Intents)
+	}
+
+	naabuStats, err := ImportWithOptions(database, mustMatcher(t, nil), project.ID, "naabu.json", strings.NewReader(`{"ip":"10.1.0.9","port":8080}`), ImportOptions{}, now)
+	if err != nil {
+		t.Fatalf("import naabu: %v", err)
+	}
+	if naabuStats.ScannerType != db.ScannerTypeNaabu {
+		t.Fatalf("expected naabu scanner type, got %q", naabuStats.ScannerType)
+	}
+
+	// Records whose only address is a hostname leave nothing to import.
+	if _, err := ImportWithOptions(database, mustMatcher(t, nil), project.ID, "names.json", strings.NewReader(`{"host":"app.example.test","port":443}`), ImportOptions{}, now); err == nil {
+		t.Fatalf("expected import without usable addresses to fail")
+	}
+	if imports, err = database.ListScanImportsWithIntents(project.ID); err != nil || len(imports) != 2 {
+		t.Fatalf("expected no import for the failed file, got %d (%v)", len(imports), err)
+	}
+}
@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// naabuRecord matches one line of naabu -json output. Older releases emit the
+// port as a bare number; newer ones nest it as {"Port":80,"Protocol":...}.
+type naabuRecord struct {
+	Host     string          `json:"host"`
+	IP       string          `json:"ip"`
+	Port     json.RawMessage `json:"port"`
+	Protocol json.RawMessage `json:"protocol"`
+}
+
+type naabuNestedPort struct {
+	Port     int             `json:"Port"`
+	Protocol json.RawMessage `json:"Protocol"`
+}
+
+// ParseNaabuJSONWithMetadata parses naabu JSON lines output into Observations.
+func ParseNaabuJSONWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	merger := newObservationMerger()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// JSON whose first line is not a record naming an address, such as a
+		// pretty-printed document, is not a naabu scan.
+		first := len(merger.hosts) == 0
+		var rec naabuRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			if first {
+				return Observations{}, ParseMetadata{}, fmt.Errorf("%w: naabu line %d is not a record", ErrUnrecognizedFormat, lineNo)
+			}
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode naabu line %d: %w", lineNo, err)
+		}
+		host := HostObservation{HostState: "up"}
+		host.IPAddress = strings.TrimSpace(rec.IP)
+		hostname := strings.TrimSpace(rec.Host)
+		if host.IPAddress == "" && hostname == "" {
+			if first {
+				return Observations{}, ParseMetadata{}, fmt.Errorf("%w: first naabu record has no ip or host", ErrUnrecognizedFormat)
+			}
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode naabu line %d: no ip or host", lineNo)
+		}
+		port, protocol, err := rec.portAndProtocol()
+		if err != nil {
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode naabu line %d: %w", lineNo, err)
+		}
+		if host.IPAddress == "" {
+			host.IPAddress = hostname
+		} else if hostname != host.IPAddress {
+			host.Hostname = hostname
+		}
+		host.Ports = []PortObservation{{PortNumber: port, Protocol: protocol, State: "open"}}
+		merger.add(host)
+	}
+	if err := scanner.Err(); err != nil {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("read naabu json: %w", err)
+	}
+	if len(merger.hosts) == 0 {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("%w: no naabu records", ErrUnrecognizedFormat)
+	}
+	return merger.observations(), ParseMetadata{ScannerType: db.ScannerTypeNaabu}, nil
+}
+
+func (rec naabuRecord) portAndProtocol() (int, string, error) {
+	protocolRaw := rec.Protocol
+	var port int
+	if err := json.Unmarshal(rec.Port, &port); err != nil {
+		var nested naabuNestedPort
+		if err := json.Unmarshal(rec.Port, &nested); err != nil {
+			return 0, "", fmt.Errorf("invalid port %s", string(rec.Port))
+		}
+		port = nested.Port
+		if len(protocolRaw) == 0 {
+			protocolRaw = nested.Protocol
+		}
+	}
+	if port < 1 || port > 65535 {
+		return 0, "", fmt.Errorf("invalid port %d", port)
+	}
+	return port, naabuProtocol(protocolRaw), nil
+}
+
+// naabuProtocol accepts the protocol as a string or as naabu's numeric enum
+// (0 = tcp, 1 = udp). Missing values default to tcp.
+func naabuProtocol(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "tcp"
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			return name
+		}
+		return "tcp"
+	}
+	var enum int
+	if err := json.Unmarshal(raw, &enum); err == nil && enum == 1 {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// ParseRustscanWithMetadata parses rustscan greppable output ("10.0.0.1 -> [22,80]").
+func ParseRustscanWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
+	merger := newObservationMerger()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		addr, list, ok := strings.Cut(line, "->")
+		if !ok {
+			return Observations{}, ParseMetadata{}, fmt.Errorf("decode rustscan line %d: missing '->'", lineNo)
+		}
+		host := HostObservation{IPAddress: strings.TrimSpace(addr), HostState: "up"}
+		list = strings.Trim(strings.TrimSpace(list), "[]")
+		for _, raw := range strings.Split(list, ",") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			port, err := strconv.Atoi(raw)
+			if err != nil || port < 1 || port > 65535 {
+				return Observations{}, ParseMetadata{}, fmt.Errorf("decode rustscan line %d: invalid port %q", lineNo, raw)
+			}
+			host.Ports = append(host.Ports, PortObservation{PortNumber: port, Protocol: "tcp", State: "open"})
+		}
+		merger.add(host)
+	}
+	if err := scanner.Err(); err != nil {
+		return Observations{}, ParseMetadata{}, fmt.Errorf("read rustscan output: %w", err)
+	}
+	return merger.observations(), ParseMetadata{ScannerType: db.ScannerTypeRustscan}, nil
+}
+
+// looksLikeRustscanLine reports whether line matches the "<ip> -> [ports]" shape.
+func looksLikeRustscanLine(line string) bool {
+	addr, list, ok := strings.Cut(line, "->")
+	if !ok {
+		return false
+	}
+	if _, err := netip.ParseAddr(strings.TrimSpace(addr)); err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(list), "[")
+}
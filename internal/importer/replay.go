@@ -0,0 +1,591 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// MergePolicy selects how replaying observation history resolves values that
+// differ between scans of the same host or port.
+type MergePolicy string
+
+const (
+	// PolicyLatestWins applies the rule imports use: the newest non-empty
+	// value of each field and the newest state win. Replaying with it
+	// reproduces the state of importing every scan in scan order.
+	PolicyLatestWins MergePolicy = "latest-wins"
+	// PolicyMostSpecificWins takes a port's service fingerprint whole from
+	// the scan that reported the most of it, and the longest host name and
+	// OS guess, so a later scan without -sV or -O cannot blank or mix them.
+	PolicyMostSpecificWins MergePolicy = "most-specific-wins"
+	// PolicyKeepManualEdits replays like PolicyLatestWins but leaves ports an
+	// analyst has worked on as they are and does not recreate ports deleted
+	// by hand.
+	PolicyKeepManualEdits MergePolicy = "never-overwrite-manual-edits"
+)
+
+// MergePolicies lists the supported policies, default first.
+var MergePolicies = []MergePolicy{PolicyLatestWins, PolicyMostSpecificWins, PolicyKeepManualEdits}
+
+// ErrUnknownMergePolicy is returned for a policy name that is not supported.
+var ErrUnknownMergePolicy = errors.New("unknown merge policy")
+
+// ParseMergePolicy resolves a policy name; empty selects PolicyLatestWins.
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return PolicyLatestWins, nil
+	}
+	for _, policy := range MergePolicies {
+		if MergePolicy(name) == policy {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownMergePolicy, name)
+}
+
+// mergeFunc folds a host's observation history, oldest first, into host and
+// port rows. current holds the host's existing ports; only observed fields of
+// the result are used, analyst fields are carried over by replayHost.
+type mergeFunc func(host db.Host, current map[portKey]db.Port, history []db.HostHistoryEntry) (db.Host, []db.Port)
+
+func mergerForPolicy(policy MergePolicy) mergeFunc {
+	switch policy {
+	case PolicyLatestWins:
+		return mergeLatest
+	case PolicyMostSpecificWins:
+		return mergeMostSpecific
+	case PolicyKeepManualEdits:
+		return mergeKeepManual
+	default:
+		return nil
+	}
+}
+
+// ReplayStats counts the current-state rows rewritten by replaying
+// observation history.
+type ReplayStats struct {
+	HostsRebuilt int
+	HostsRemoved int
+	PortsRemoved int
+}
+
+// DeleteImportStats describes a deleted import and the state rebuilt after it.
+type DeleteImportStats struct {
+	Import db.ScanImport
+	ReplayStats
+}
+
+// DeleteScanImport removes a completed import and rebuilds every host it
+// observed from the observations of the remaining imports, in scan order.
+// Analyst notes and work status are kept. Ports no remaining import reports
+// are deleted unless an analyst has worked on them, and hosts left with no
+// ports and no notes are deleted. A missing import returns sql.ErrNoRows.
+func DeleteScanImport(database *db.DB, projectID, importID int64) (DeleteImportStats, error) {
+	tx, err := database.Begin()
+	if err != nil {
+		return DeleteImportStats{}, err
+	}
+	defer tx.Rollback()
+
+	record, ips, err := tx.DeleteScanImport(projectID, importID)
+	if err != nil {
+		return DeleteImportStats{}, err
+	}
+	stats := DeleteImportStats{Import: record}
+	scans, err := coveredScans(tx, projectID)
+	if err != nil {
+		return DeleteImportStats{}, err
+	}
+	for _, ip := range ips {
+		if err := replayHost(tx, projectID, ip, mergeLatest, scans, &stats.ReplayStats); err != nil {
+			return DeleteImportStats{}, err
+		}
+	}
+	if err := tx.SyncHostLatestScan(projectID, ips); err != nil {
+		return DeleteImportStats{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return DeleteImportStats{}, err
+	}
+	// The stored file goes too unless another import shares it; a failed
+	// prune leaves it for the next one.
+	database.PruneScanArtifacts()
+	return stats, nil
+}
+
+// ReparseStats describes an import parsed again from its stored file.
+type ReparseStats struct {
+	// Before is the import as it was recorded before the reparse.
+	Before db.ScanImport
+	Import db.ScanImport
+	// Format is the detected format of the stored file.
+	Format   Format
+	InScope  int
+	OutScope int
+	Skipped  int
+	ReplayStats
+}
+
+// ReparseScanImport parses an import's stored original file again with the
+// current parsers and scope rules, replaces the import's observations, and
+// rebuilds every host it observed before or now from the project's history,
+// as DeleteScanImport does. The import keeps its id, filename, intents and
+// import time. Hosts the file reports that the import had not observed are
+// created; hosts deleted by hand are not. A missing import returns
+// sql.ErrNoRows and one without a stored file db.ErrNoScanArtifact.
+func ReparseScanImport(database *db.DB, projectID, importID int64) (ReparseStats, error) {
+	_, artifact, err := database.GetScanImportArtifact(projectID, importID)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	raw, err := database.ReadScanArtifact(artifact)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	defer raw.Close()
+	format, r, err := DetectFormat(raw)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	if format != FormatNmapXML && parserForFormat(format) == nil {
+		return ReparseStats{}, fmt.Errorf("%w: stored file of import %d", ErrUnrecognizedFormat, importID)
+	}
+	matcher, err := resolveMatcher(database, projectID, nil)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	defer tx.Rollback()
+
+	before, oldIPs, err := tx.ClearScanImportObservations(projectID, importID)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	stats := ReparseStats{Before: before, Import: before, Format: format}
+	stats.Import.HostsFound, stats.Import.PortsFound = 0, 0
+
+	observed := make(map[string]bool, len(oldIPs))
+	for _, ip := range oldIPs {
+		observed[ip] = true
+	}
+	ips := append([]string(nil), oldIPs...)
+	counts := ImportStats{}
+	// Observations are written as hosts are parsed; hosts the file did not
+	// report before are created from them afterwards, as publishing does.
+	metadata, err := walkObservations(format, r, func(hObs HostObservation) error {
+		ip, ok := normalizeHostAddress(hObs.IPAddress)
+		if !ok {
+			stats.Skipped++
+			return nil
+		}
+		hObs.IPAddress = ip
+		stats.Import.HostsFound++
+		stats.Import.PortsFound += len(hObs.Ports)
+		inScope, err := countScope(tx, matcher, projectID, hObs, &counts)
+		if err != nil {
+			return err
+		}
+		if err := insertObservations(tx, projectID, importID, hObs, inScope); err != nil {
+			return err
+		}
+		if !observed[ip] {
+			observed[ip] = true
+			ips = append(ips, ip)
+		}
+		return nil
+	})
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	stats.Import.NmapArgs = pickNonEmpty(metadata.NmapArgs, before.NmapArgs)
+	stats.Import.ScannerType = pickNonEmpty(metadata.ScannerType, db.ScannerTypeNmap)
+	stats.Import.ScanStartedAt = timePtr(metadata.ScanStartedAt)
+	stats.Import.ScanFinishedAt = timePtr(metadata.ScanFinishedAt)
+	stats.InScope, stats.OutScope = counts.InScope, counts.OutScope
+	if err := tx.FinishScanImportReparse(before, stats.Import, metadata.ScannedPorts); err != nil {
+		return ReparseStats{}, err
+	}
+	if err := createReparsedHosts(tx, projectID, stats.Import, ips[len(oldIPs):], &counts); err != nil {
+		return ReparseStats{}, err
+	}
+
+	scans, err := coveredScans(tx, projectID)
+	if err != nil {
+		return ReparseStats{}, err
+	}
+	for _, ip := range ips {
+		if err := replayHost(tx, projectID, ip, mergeLatest, scans, &stats.ReplayStats); err != nil {
+			return ReparseStats{}, err
+		}
+	}
+	if err := tx.SyncHostLatestScan(projectID, ips); err != nil {
+		return ReparseStats{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ReparseStats{}, err
+	}
+	return stats, nil
+}
+
+// walkObservations feeds each host of a scan file to onHost. Nmap XML is
+// streamed a host at a time; the other formats are parsed whole, as they are
+// on import.
+func walkObservations(format Format, r io.Reader, onHost func(HostObservation) error) (ParseMetadata, error) {
+	if format == FormatNmapXML {
+		return walkXMLObservations(r, onHost)
+	}
+	obs, metadata, err := parserForFormat(format)(r)
+	if err != nil {
+		return ParseMetadata{}, err
+	}
+	for _, host := range obs.Hosts {
+		if err := onHost(host); err != nil {
+			return ParseMetadata{}, err
+		}
+	}
+	return metadata, nil
+}
+
+// createReparsedHosts creates the current rows of hosts a reparse reported
+// for the first time from the import's observations. Hosts that exist, or
+// were deleted by hand before, are left to replay.
+func createReparsedHosts(tx *db.Tx, projectID int64, record db.ScanImport, newIPs []string, stats *ImportStats) error {
+	if len(newIPs) == 0 {
+		return nil
+	}
+	pending := make(map[string]bool, len(newIPs))
+	for _, ip := range newIPs {
+		pending[ip] = true
+	}
+	var afterID int64
+	for {
+		hosts, err := tx.ListHostObservationsAfter(record.ID, afterID, DefaultImportBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(hosts) == 0 {
+			return nil
+		}
+		for _, staged := range hosts {
+			afterID = staged.ID
+			if !pending[staged.IPAddress] {
+				continue
+			}
+			delete(pending, staged.IPAddress)
+			if _, found, err := tx.GetHostByIP(projectID, staged.IPAddress); err != nil {
+				return err
+			} else if found {
+				continue
+			}
+			ports, err := tx.ListPortObservationsForHost(record.ID, staged.IPAddress)
+			if err != nil {
+				return err
+			}
+			hObs := hostObservationFromStaged(staged, ports)
+			if err := upsertCurrentState(tx, projectID, hObs, staged.InScope, observedAt(hObs, record, record.ImportTime), stats); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RebuildProject recomputes every current host of a project and its ports by
+// replaying the project's observation history under policy. Hosts deleted by
+// hand are not recreated, hosts without history are kept as they are, as
+// MergeProjects does, and latest_scan, which follows import intents, is left
+// alone; otherwise the pruning rules of DeleteScanImport apply.
+func RebuildProject(database *db.DB, projectID int64, policy MergePolicy) (ReplayStats, error) {
+	merge := mergerForPolicy(policy)
+	if merge == nil {
+		return ReplayStats{}, fmt.Errorf("%w %q", ErrUnknownMergePolicy, policy)
+	}
+	tx, err := database.Begin()
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	defer tx.Rollback()
+
+	ips, err := tx.ListHostIPs(projectID)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	scans, err := coveredScans(tx, projectID)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	var stats ReplayStats
+	for _, ip := range ips {
+		history, err := tx.ListHostHistory(projectID, ip)
+		if err != nil {
+			return ReplayStats{}, err
+		}
+		if len(history) == 0 {
+			continue
+		}
+		if err := replayHost(tx, projectID, ip, merge, scans, &stats); err != nil {
+			return ReplayStats{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return ReplayStats{}, err
+	}
+	return stats, nil
+}
+
+// MergeProjectsStats describes a project merge and the state rebuilt after it.
+type MergeProjectsStats struct {
+	db.ProjectMergeStats
+	ReplayStats
+}
+
+// MergeProjects merges the source project into the target (see
+// db.Tx.MergeProjectInto for the conflict policy) and then replays every
+// observed host of the target from the combined history, in scan order,
+// so hosts both projects saw end up as if all their scans had been imported
+// into one project. Missing-port reconciliation is re-derived the same way;
+// latest_scan is left alone, as RebuildProject does.
+func MergeProjects(database *db.DB, targetID, sourceID int64) (MergeProjectsStats, error) {
+	tx, err := database.Begin()
+	if err != nil {
+		return MergeProjectsStats{}, err
+	}
+	defer tx.Rollback()
+
+	merged, err := tx.MergeProjectInto(targetID, sourceID)
+	if err != nil {
+		return MergeProjectsStats{}, err
+	}
+	stats := MergeProjectsStats{ProjectMergeStats: merged}
+	ips, err := tx.ListHostIPs(targetID)
+	if err != nil {
+		return MergeProjectsStats{}, err
+	}
+	scans, err := coveredScans(tx, targetID)
+	if err != nil {
+		return MergeProjectsStats{}, err
+	}
+	for _, ip := range ips {
+		// Hosts without history, such as those imported before observations
+		// were recorded, are kept as they are rather than pruned.
+		history, err := tx.ListHostHistory(targetID, ip)
+		if err != nil {
+			return MergeProjectsStats{}, err
+		}
+		if len(history) == 0 {
+			continue
+		}
+		if err := replayHost(tx, targetID, ip, mergeLatest, scans, &stats.ReplayStats); err != nil {
+			return MergeProjectsStats{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return MergeProjectsStats{}, err
+	}
+	return stats, nil
+}
+
+// replayHost recomputes one host and its ports from its observation history,
+// then reconciles the ports against the covered scans as imports do. The
+// host's scope, notes and the ports' work status and notes are analyst or
+// scope-evaluation state and carry over unchanged.
+func replayHost(tx *db.Tx, projectID int64, ip string, merge mergeFunc, scans []coveredScan, stats *ReplayStats) error {
+	existing, found, err := tx.GetHostByIP(projectID, ip)
+	if err != nil || !found {
+		return err
+	}
+	history, err := tx.ListHostHistory(projectID, ip)
+	if err != nil {
+		return err
+	}
+	existingPorts, err := tx.ListPorts(existing.ID)
+	if err != nil {
+		return err
+	}
+	current := make(map[portKey]db.Port, len(existingPorts))
+	for _, port := range existingPorts {
+		current[portKey{port.PortNumber, port.Protocol}] = port
+	}
+
+	host, ports := merge(existing, current, history)
+	applyCoverage(ports, ip, history, scans)
+	host.ProjectID, host.IPAddress = existing.ProjectID, existing.IPAddress
+	host.InScope, host.Notes = existing.InScope, existing.Notes
+	if _, err := tx.UpsertHost(host); err != nil {
+		return err
+	}
+	keep := make([]int64, 0, len(ports))
+	for _, port := range ports {
+		prior := current[portKey{port.PortNumber, port.Protocol}]
+		port.HostID = existing.ID
+		port.WorkStatus = pickNonEmpty(prior.WorkStatus, "scanned")
+		port.Notes = prior.Notes
+		saved, err := tx.UpsertPort(port)
+		if err != nil {
+			return err
+		}
+		keep = append(keep, saved.ID)
+	}
+
+	removed, err := tx.PruneHostPorts(existing.ID, keep)
+	if err != nil {
+		return err
+	}
+	stats.PortsRemoved += int(removed)
+	if len(history) == 0 {
+		pruned, err := tx.PruneHost(existing.ID)
+		if err != nil {
+			return err
+		}
+		if pruned {
+			stats.HostsRemoved++
+			return nil
+		}
+	}
+	stats.HostsRebuilt++
+	return nil
+}
+
+type portKey struct {
+	number   int
+	protocol string
+}
+
+// mergeMAC applies the import rule for MAC addresses: a missing MAC keeps the
+// stored one, the same MAC may fill in the vendor, and a new MAC replaces both.
+func mergeMAC(host *db.Host, obs db.HostObservation) {
+	switch {
+	case obs.MACAddress == "":
+	case strings.EqualFold(obs.MACAddress, host.MACAddress):
+		host.MACVendor = pickNonEmpty(obs.MACVendor, host.MACVendor)
+	default:
+		host.MACAddress = obs.MACAddress
+		host.MACVendor = obs.MACVendor
+	}
+}
+
+// foldPorts walks the port observations of history in order, calling apply
+// for each with the port accumulated so far, and returns the ports in the
+// order they were first seen. last_seen is the newest observation time.
+func foldPorts(history []db.HostHistoryEntry, apply func(port *db.Port, obs db.PortObservation)) []db.Port {
+	var order []portKey
+	ports := make(map[portKey]*db.Port)
+	for _, entry := range history {
+		seenAt := entry.ObservedAt()
+		for _, p := range entry.Ports {
+			key := portKey{p.PortNumber, p.Protocol}
+			port, ok := ports[key]
+			if !ok {
+				port = &db.Port{PortNumber: p.PortNumber, Protocol: p.Protocol}
+				ports[key] = port
+				order = append(order, key)
+			}
+			port.State = p.State
+			port.ScriptOutput = pickNonEmpty(p.ScriptOutput, port.ScriptOutput)
+			apply(port, p)
+			if seenAt.After(port.LastSeen) {
+				port.LastSeen = seenAt
+			}
+		}
+	}
+
+	out := make([]db.Port, 0, len(order))
+	for _, key := range order {
+		out = append(out, *ports[key])
+	}
+	return out
+}
+
+// mergeLatest folds history the way imports merge it: the latest non-empty
+// value of each field wins and the latest reported state wins.
+func mergeLatest(_ db.Host, _ map[portKey]db.Port, history []db.HostHistoryEntry) (db.Host, []db.Port) {
+	var host db.Host
+	for _, entry := range history {
+		obs := entry.Observation
+		host.Hostname = pickNonEmpty(obs.Hostname, host.Hostname)
+		host.OSGuess = pickNonEmpty(obs.OSGuess, host.OSGuess)
+		mergeMAC(&host, obs)
+	}
+	ports := foldPorts(history, func(port *db.Port, p db.PortObservation) {
+		port.Service = pickNonEmpty(p.Service, port.Service)
+		port.Version = pickNonEmpty(p.Version, port.Version)
+		port.Product = pickNonEmpty(p.Product, port.Product)
+		port.ExtraInfo = pickNonEmpty(p.ExtraInfo, port.ExtraInfo)
+	})
+	return host, ports
+}
+
+// mergeMostSpecific keeps the most detailed value seen, newest on ties. A
+// port's service, product, version and extra info are taken together from
+// one observation so fingerprints of different scans are never mixed.
+func mergeMostSpecific(_ db.Host, _ map[portKey]db.Port, history []db.HostHistoryEntry) (db.Host, []db.Port) {
+	var host db.Host
+	for _, entry := range history {
+		obs := entry.Observation
+		host.Hostname = pickLonger(obs.Hostname, host.Hostname)
+		host.OSGuess = pickLonger(obs.OSGuess, host.OSGuess)
+		mergeMAC(&host, obs)
+	}
+	detail := make(map[portKey]int)
+	ports := foldPorts(history, func(port *db.Port, p db.PortObservation) {
+		key := portKey{p.PortNumber, p.Protocol}
+		score := fingerprintDetail(p)
+		if score == 0 || score < detail[key] {
+			return
+		}
+		detail[key] = score
+		port.Service, port.Product, port.Version, port.ExtraInfo = p.Service, p.Product, p.Version, p.ExtraInfo
+	})
+	return host, ports
+}
+
+// mergeKeepManual replays like mergeLatest but returns ports an analyst has
+// worked on unchanged and drops observed ports that no longer exist, since
+// every observed port has a row unless someone deleted it.
+func mergeKeepManual(existing db.Host, current map[portKey]db.Port, history []db.HostHistoryEntry) (db.Host, []db.Port) {
+	host, merged := mergeLatest(existing, current, history)
+	ports := merged[:0]
+	for _, port := range merged {
+		prior, ok := current[portKey{port.PortNumber, port.Protocol}]
+		switch {
+		case !ok:
+		case manuallyEdited(prior):
+			ports = append(ports, prior)
+		default:
+			ports = append(ports, port)
+		}
+	}
+	return host, ports
+}
+
+// manuallyEdited matches db.PruneHostPorts: a port with notes or a work
+// status past "scanned" has analyst work attached.
+func manuallyEdited(port db.Port) bool {
+	return strings.TrimSpace(port.Notes) != "" || (port.WorkStatus != "" && port.WorkStatus != "scanned")
+}
+
+func fingerprintDetail(p db.PortObservation) int {
+	score := 0
+	for _, value := range []string{p.Service, p.Product, p.Version, p.ExtraInfo} {
+		if strings.TrimSpace(value) != "" {
+			score++
+		}
+	}
+	return score
+}
+
+// pickLonger returns the longer non-empty value, preferring candidate on ties.
+func pickLonger(candidate, current string) string {
+	if strings.TrimSpace(candidate) == "" || len(candidate) < len(current) {
+		return current
+	}
+	return candidate
+}
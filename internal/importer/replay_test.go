@@ -0,0 +1,639 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+func TestDeleteScanImportRebuildsFromRemainingHistory(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("rollback")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	matcher := mustMatcher(t, []string{"10.0.0.0/24"})
+	importAt := func(filename string, scanned time.Time, obs Observations) ImportStats {
+		t.Helper()
+		stats, err := ImportObservationsWithOptions(database, matcher, project.ID, filename, obs,
+			ParseMetadata{NmapArgs: "nmap -sV " + filename, ScanStartedAt: scanned}, ImportOptions{}, scanned)
+		if err != nil {
+			t.Fatalf("import %s: %v", filename, err)
+		}
+		return stats
+	}
+
+	t1 := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	importAt("good.xml", t1, Observations{Hosts: []HostObservation{{
+		IPAddress: "10.0.0.1", Hostname: "alpha",
+		Ports: []PortObservation{
+			{PortNumber: 22, Protocol: "tcp", State: "open", Service: "ssh", Product: "OpenSSH", Version: "8.9"},
+			{PortNumber: 80, Protocol: "tcp", State: "open", Service: "http"},
+		},
+	}}})
+	bad := importAt("bad.xml", t2, Observations{Hosts: []HostObservation{
+		{
+			IPAddress: "10.0.0.1", Hostname: "wrong", MACAddress: "00:11:22:33:44:55",
+			Ports: []PortObservation{
+				{PortNumber: 22, Protocol: "tcp", State: "filtered", Service: "ssh", Product: "Dropbear"},
+				{PortNumber: 443, Protocol: "tcp", State: "open", Service: "https"},
+				{PortNumber: 8080, Protocol: "tcp", State: "open", Service: "http-proxy"},
+			},
+		},
+		{IPAddress: "10.0.0.2", Ports: []PortObservation{{PortNumber: 21, Protocol: "tcp", State: "open", Service: "ftp"}}},
+		{IPAddress: "10.0.0.3", Ports: []PortObservation{{PortNumber: 25, Protocol: "tcp", State: "open", Service: "smtp"}}},
+	}})
+
+	// Analyst work done after the bad import must survive its removal.
+	host, _, err := database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if err := database.UpdateHostNotes(host.ID, "jump box"); err != nil {
+		t.Fatalf("host notes: %v", err)
+	}
+	ssh, _, _ := database.GetPortByKey(host.ID, 22, "tcp")
+	if err := database.UpdatePortNotes(ssh.ID, "weak kex"); err != nil {
+		t.Fatalf("port notes: %v", err)
+	}
+	https, _, _ := database.GetPortByKey(host.ID, 443, "tcp")
+	if err := database.UpdateWorkStatus(https.ID, "flagged"); err != nil {
+		t.Fatalf("flag port: %v", err)
+	}
+	smtpHost, _, _ := database.GetHostByIP(project.ID, "10.0.0.3")
+	if err := database.UpdateHostNotes(smtpHost.ID, "check relay"); err != nil {
+		t.Fatalf("host notes: %v", err)
+	}
+
+	stats, err := DeleteScanImport(database, project.ID, bad.ID)
+	if err != nil {
+		t.Fatalf("delete import: %v", err)
+	}
+	if stats.Import.Filename != "bad.xml" || stats.HostsRebuilt != 2 || stats.HostsRemoved != 1 || stats.PortsRemoved != 3 {
+		t.Fatalf("unexpected delete stats: %+v", stats)
+	}
+
+	host, _, err = database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if host.Hostname != "alpha" || host.MACAddress != "" || host.Notes != "jump box" || !host.InScope {
+		t.Fatalf("host not rebuilt from history: %+v", host)
+	}
+	ssh, _, _ = database.GetPortByKey(host.ID, 22, "tcp")
+	if ssh.State != "open" || ssh.Product != "OpenSSH" || ssh.Version != "8.9" || ssh.Notes != "weak kex" || !ssh.LastSeen.Equal(t1) {
+		t.Fatalf("ssh port not rebuilt: %+v", ssh)
+	}
+	if _, found, _ := database.GetPortByKey(host.ID, 80, "tcp"); !found {
+		t.Fatalf("expected port 80 from the remaining import")
+	}
+	if _, found, _ := database.GetPortByKey(host.ID, 8080, "tcp"); found {
+		t.Fatalf("expected port 8080 seen only by the deleted import to be removed")
+	}
+	if port, found, _ := database.GetPortByKey(host.ID, 443, "tcp"); !found || port.WorkStatus != "flagged" {
+		t.Fatalf("expected flagged port 443 to be kept, found=%v %+v", found, port)
+	}
+	if _, found, _ := database.GetHostByIP(project.ID, "10.0.0.2"); found {
+		t.Fatalf("expected host seen only by the deleted import to be removed")
+	}
+	if kept, found, _ := database.GetHostByIP(project.ID, "10.0.0.3"); !found || kept.Notes != "check relay" {
+		t.Fatalf("expected annotated host to be kept, found=%v %+v", found, kept)
+	}
+
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil || len(imports) != 1 {
+		t.Fatalf("expected one remaining import: %+v %v", imports, err)
+	}
+	events, err := database.ListAuditEvents(project.ID, db.AuditQuery{})
+	if err != nil || len(events) == 0 || events[0].Action != db.AuditImportDelete || events[0].EntityID != bad.ID {
+		t.Fatalf("expected import.delete audit event, got %+v %v", events, err)
+	}
+
+	if _, err := DeleteScanImport(database, project.ID, bad.ID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a deleted import, got %v", err)
+	}
+}
+
+// projectSnapshot renders a project's current hosts and ports without ids or
+// row timestamps so states reached by different routes can be compared.
+func projectSnapshot(t *testing.T, database *db.DB, projectID int64) []string {
+	t.Helper()
+	hosts, err := database.ListHosts(projectID)
+	if err != nil {
+		t.Fatalf("list hosts: %v", err)
+	}
+	var out []string
+	for _, h := range hosts {
+		out = append(out, fmt.Sprintf("%s|%s|%s|%s|%s|%s|%v|%s", h.IPAddress, h.Hostname, h.OSGuess, h.MACAddress, h.MACVendor, h.LatestScan, h.InScope, h.Notes))
+		ports, err := database.ListPorts(h.ID)
+		if err != nil {
+			t.Fatalf("list ports: %v", err)
+		}
+		for _, p := range ports {
+			notObserved := ""
+			if p.NotObservedAt != nil {
+				notObserved = p.NotObservedAt.UTC().Format(time.RFC3339)
+			}
+			out = append(out, fmt.Sprintf("  %d/%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s", p.PortNumber, p.Protocol, p.State, p.Service, p.Product, p.Version,
+				p.ExtraInfo, p.ScriptOutput, p.WorkStatus, p.Notes, p.LastSeen.UTC().Format(time.RFC3339), notObserved))
+		}
+	}
+	return out
+}
+
+func replayScans() []struct {
+	name    string
+	scanned time.Time
+	obs     Observations
+} {
+	t1 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	return []struct {
+		name    string
+		scanned time.Time
+		obs     Observations
+	}{
+		{"discovery.xml", t1, Observations{Hosts: []HostObservation{
+			{IPAddress: "10.0.0.1", Ports: []PortObservation{{PortNumber: 22, Protocol: "tcp", State: "open"}, {PortNumber: 80, Protocol: "tcp", State: "open"}}},
+			{IPAddress: "10.0.0.2", MACAddress: "AA:BB:CC:00:00:01", Ports: []PortObservation{{PortNumber: 445, Protocol: "tcp", State: "open"}}},
+			{IPAddress: "192.168.1.5", Ports: []PortObservation{{PortNumber: 53, Protocol: "udp", State: "open|filtered"}}},
+		}}},
+		{"versions.xml", t1.Add(time.Hour), Observations{Hosts: []HostObservation{
+			{IPAddress: "10.0.0.1", Hostname: "web01.corp.local", OSGuess: "Linux 5.x", Ports: []PortObservation{
+				{PortNumber: 22, Protocol: "tcp", State: "open", Service: "ssh", Product: "OpenSSH", Version: "8.9p1", ExtraInfo: "Ubuntu"},
+				{PortNumber: 80, Protocol: "tcp", State: "open", Service: "http", Product: "nginx", ScriptOutput: "http-title: Intranet"},
+			}},
+			{IPAddress: "10.0.0.2", MACAddress: "aa:bb:cc:00:00:01", MACVendor: "Acme", Ports: []PortObservation{
+				{PortNumber: 445, Protocol: "tcp", State: "open", Service: "microsoft-ds"},
+			}},
+		}}},
+		{"recheck.xml", t1.Add(48 * time.Hour), Observations{Hosts: []HostObservation{
+			{IPAddress: "10.0.0.1", Hostname: "web01", Ports: []PortObservation{
+				{PortNumber: 22, Protocol: "tcp", State: "open", Service: "ssh", Product: "Dropbear"},
+				{PortNumber: 80, Protocol: "tcp", State: "closed"},
+				{PortNumber: 8443, Protocol: "tcp", State: "open", Service: "https-alt"},
+			}},
+			{IPAddress: "10.0.0.2", MACAddress: "AA:BB:CC:00:00:02", Ports: []PortObservation{
+				{PortNumber: 445, Protocol: "tcp", State: "filtered"},
+			}},
+		}}},
+	}
+}
+
+func TestRebuildLatestWinsEqualsImportedState(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	matcher := mustMatcher(t, []string{"10.0.0.0/24"})
+	importInto := func(name string, order []int) int64 {
+		t.Helper()
+		project, err := database.CreateProject(name)
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		scans := replayScans()
+		for _, i := range order {
+			scan := scans[i]
+			if _, err := ImportObservationsWithOptions(database, matcher, project.ID, scan.name, scan.obs,
+				ParseMetadata{NmapArgs: "nmap -sV " + scan.name, ScanStartedAt: scan.scanned}, ImportOptions{}, scan.scanned); err != nil {
+				t.Fatalf("import %s: %v", scan.name, err)
+			}
+		}
+		return project.ID
+	}
+
+	inOrder := importInto("in-order", []int{0, 1, 2})
+	merged := projectSnapshot(t, database, inOrder)
+	stats, err := RebuildProject(database, inOrder, PolicyLatestWins)
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if stats.HostsRebuilt != 3 || stats.HostsRemoved != 0 || stats.PortsRemoved != 0 {
+		t.Fatalf("unexpected rebuild stats: %+v", stats)
+	}
+	if replayed := projectSnapshot(t, database, inOrder); !reflect.DeepEqual(merged, replayed) {
+		t.Fatalf("replayed state differs from merged state:\nmerged:   %q\nreplayed: %q", merged, replayed)
+	}
+
+	// Scans imported out of order merge as if imported in scan order, and
+	// replaying them keeps that state.
+	shuffled := importInto("out-of-order", []int{2, 0, 1})
+	if got := projectSnapshot(t, database, shuffled); !reflect.DeepEqual(merged, got) {
+		t.Fatalf("out-of-order imports merged differently:\nwant: %q\ngot:  %q", merged, got)
+	}
+	if _, err := RebuildProject(database, shuffled, PolicyLatestWins); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if replayed := projectSnapshot(t, database, shuffled); !reflect.DeepEqual(merged, replayed) {
+		t.Fatalf("rebuilt out-of-order state differs:\nwant: %q\ngot:  %q", merged, replayed)
+	}
+}
+
+func TestMergeProjectsEqualsSingleProject(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	matcher := mustMatcher(t, []string{"10.0.0.0/24"})
+	scans := replayScans()
+	newProject := func(name string, withScope bool) db.Project {
+		t.Helper()
+		project, err := database.CreateProject(name)
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		if withScope {
+			if _, err := database.BulkAddScopeDefinitions(project.ID, []string{"10.0.0.0/24"}, "include"); err != nil {
+				t.Fatalf("add scope: %v", err)
+			}
+		}
+		return project
+	}
+	importInto := func(project db.Project, order ...int) {
+		t.Helper()
+		for _, i := range order {
+			scan := scans[i]
+			if _, err := ImportObservationsWithOptions(database, matcher, project.ID, scan.name, scan.obs,
+				ParseMetadata{NmapArgs: "nmap -sV " + scan.name, ScanStartedAt: scan.scanned}, ImportOptions{}, scan.scanned); err != nil {
+				t.Fatalf("import %s: %v", scan.name, err)
+			}
+		}
+	}
+	port := func(projectID int64, ip string, number int) db.Port {
+		t.Helper()
+		host, found, err := database.GetHostByIP(projectID, ip)
+		if err != nil || !found {
+			t.Fatalf("get host %s: found=%v err=%v", ip, found, err)
+		}
+		p, found, err := database.GetPortByKey(host.ID, number, "tcp")
+		if err != nil || !found {
+			t.Fatalf("get port %s:%d: found=%v err=%v", ip, number, found, err)
+		}
+		return p
+	}
+
+	// The same engagement split across two projects by mistake, with
+	// analyst work in both.
+	target := newProject("split-a", true)
+	source := newProject("split-b", false)
+	importInto(target, 0, 2)
+	importInto(source, 1)
+	if err := database.UpdateWorkStatus(port(target.ID, "10.0.0.1", 22).ID, "flagged"); err != nil {
+		t.Fatalf("target status: %v", err)
+	}
+	if err := database.UpdatePortNotes(port(target.ID, "10.0.0.1", 22).ID, "weak kex"); err != nil {
+		t.Fatalf("target notes: %v", err)
+	}
+	if err := database.UpdateWorkStatus(port(source.ID, "10.0.0.1", 22).ID, "done"); err != nil {
+		t.Fatalf("source status: %v", err)
+	}
+	if err := database.UpdatePortNotes(port(source.ID, "10.0.0.1", 22).ID, "creds reused"); err != nil {
+		t.Fatalf("source notes: %v", err)
+	}
+	if err := database.UpdateWorkStatus(port(source.ID, "10.0.0.1", 80).ID, "in_progress"); err != nil {
+		t.Fatalf("source status: %v", err)
+	}
+	sourceHost, _, err := database.GetHostByIP(source.ID, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("get source host: %v", err)
+	}
+	if err := database.UpdateHostNotes(sourceHost.ID, "file server"); err != nil {
+		t.Fatalf("source host notes: %v", err)
+	}
+
+	stats, err := MergeProjects(database, target.ID, source.ID)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if stats.Imports != 1 || stats.HostsMerged != 2 || stats.HostsMoved != 0 || stats.PortsMerged != 3 {
+		t.Fatalf("unexpected merge stats: %+v", stats)
+	}
+	if _, found, err := database.GetProjectByID(source.ID); err != nil || found {
+		t.Fatalf("expected the source project to be deleted, found=%v err=%v", found, err)
+	}
+	imports, err := database.ListScanImports(target.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != 3 {
+		t.Fatalf("expected 3 imports after merge, got %d", len(imports))
+	}
+
+	// Conflicts follow the documented policy: the furthest status wins and
+	// differing notes are both kept.
+	merged := port(target.ID, "10.0.0.1", 22)
+	if merged.WorkStatus != "done" || merged.Notes != "weak kex\n\n[merged from split-b]\ncreds reused" {
+		t.Fatalf("unexpected merged port: status=%q notes=%q", merged.WorkStatus, merged.Notes)
+	}
+	transitions, err := database.ListPortStatusTransitions(merged.ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(transitions) != 3 || transitions[len(transitions)-1].ToStatus != "done" {
+		t.Fatalf("expected both projects' transitions and the merge's, got %+v", transitions)
+	}
+
+	// Apart from analyst state, the result is what importing every scan into
+	// one project produces.
+	single := newProject("single", true)
+	importInto(single, 0, 1, 2)
+	for _, edit := range []struct {
+		number int
+		status string
+		notes  string
+	}{{22, merged.WorkStatus, merged.Notes}, {80, "in_progress", ""}} {
+		p := port(single.ID, "10.0.0.1", edit.number)
+		if err := database.UpdateWorkStatus(p.ID, edit.status); err != nil {
+			t.Fatalf("single status: %v", err)
+		}
+		if err := database.UpdatePortNotes(p.ID, edit.notes); err != nil {
+			t.Fatalf("single notes: %v", err)
+		}
+	}
+	singleHost, _, err := database.GetHostByIP(single.ID, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("get single host: %v", err)
+	}
+	if err := database.UpdateHostNotes(singleHost.ID, "file server"); err != nil {
+		t.Fatalf("single host notes: %v", err)
+	}
+	if want, got := projectSnapshot(t, database, single.ID), projectSnapshot(t, database, target.ID); !reflect.DeepEqual(want, got) {
+		t.Fatalf("merged state differs from a single project:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	if _, err := database.SetProjectArchived(single.ID, true); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if _, err := MergeProjects(database, target.ID, single.ID); !errors.Is(err, db.ErrProjectArchived) {
+		t.Fatalf("expected ErrProjectArchived merging an archived project, got %v", err)
+	}
+	if _, err := MergeProjects(database, target.ID, target.ID); !errors.Is(err, db.ErrMergeSameProject) {
+		t.Fatalf("expected ErrMergeSameProject, got %v", err)
+	}
+}
+
+func TestRebuildKeepsHostsWithoutHistory(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("legacy")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	scan := replayScans()[0]
+	if _, err := ImportObservationsWithOptions(database, nil, project.ID, scan.name, scan.obs,
+		ParseMetadata{NmapArgs: "nmap -sV " + scan.name, ScanStartedAt: scan.scanned}, ImportOptions{}, scan.scanned); err != nil {
+		t.Fatalf("import %s: %v", scan.name, err)
+	}
+
+	// A host from before observations were recorded has current state only.
+	legacy, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.0.200", Hostname: "old-box", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert legacy host: %v", err)
+	}
+	if _, err := database.UpsertPort(db.Port{HostID: legacy.ID, PortNumber: 23, Protocol: "tcp", State: "open", Service: "telnet", WorkStatus: "scanned"}); err != nil {
+		t.Fatalf("upsert legacy port: %v", err)
+	}
+
+	stats, err := RebuildProject(database, project.ID, PolicyLatestWins)
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if stats.HostsRemoved != 0 || stats.PortsRemoved != 0 {
+		t.Fatalf("expected nothing pruned, got %+v", stats)
+	}
+	host, found, err := database.GetHostByIP(project.ID, "10.0.0.200")
+	if err != nil || !found || host.Hostname != "old-box" {
+		t.Fatalf("expected legacy host kept: found=%v %+v %v", found, host, err)
+	}
+	if port, found, err := database.GetPortByKey(host.ID, 23, "tcp"); err != nil || !found || port.Service != "telnet" {
+		t.Fatalf("expected legacy port kept: found=%v %+v %v", found, port, err)
+	}
+}
+
+func TestRebuildMergePolicies(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("policies")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	for _, scan := range replayScans() {
+		if _, err := ImportObservationsWithOptions(database, nil, project.ID, scan.name, scan.obs,
+			ParseMetadata{NmapArgs: "nmap -sV " + scan.name, ScanStartedAt: scan.scanned}, ImportOptions{}, scan.scanned); err != nil {
+			t.Fatalf("import %s: %v", scan.name, err)
+		}
+	}
+	host, _, err := database.GetHostByIP(project.ID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	port := func(number int) db.Port {
+		t.Helper()
+		p, found, err := database.GetPortByKey(host.ID, number, "tcp")
+		if err != nil || !found {
+			t.Fatalf("get port %d: found=%v %v", number, found, err)
+		}
+		return p
+	}
+
+	// The import merge mixes the old version string into the new product.
+	if ssh := port(22); ssh.Product != "Dropbear" || ssh.Version != "8.9p1" {
+		t.Fatalf("unexpected merged ssh fingerprint: %+v", ssh)
+	}
+
+	if _, err := RebuildProject(database, project.ID, PolicyMostSpecificWins); err != nil {
+		t.Fatalf("rebuild most-specific: %v", err)
+	}
+	host, _, _ = database.GetHostByIP(project.ID, "10.0.0.1")
+	if host.Hostname != "web01.corp.local" || host.OSGuess != "Linux 5.x" {
+		t.Fatalf("expected most specific host fields, got %+v", host)
+	}
+	ssh := port(22)
+	if ssh.State != "open" || ssh.Product != "OpenSSH" || ssh.Version != "8.9p1" || ssh.ExtraInfo != "Ubuntu" {
+		t.Fatalf("expected the most detailed ssh fingerprint, got %+v", ssh)
+	}
+	if http := port(80); http.State != "closed" || http.Product != "nginx" || http.ScriptOutput != "http-title: Intranet" {
+		t.Fatalf("expected latest state with detailed http fingerprint, got %+v", http)
+	}
+
+	// Analyst work pins a port under never-overwrite-manual-edits.
+	if err := database.UpdatePortNotes(ssh.ID, "OpenSSH confirmed by banner"); err != nil {
+		t.Fatalf("port notes: %v", err)
+	}
+	alt := port(8443)
+	if err := database.DeletePort(alt.ID); err != nil {
+		t.Fatalf("delete port: %v", err)
+	}
+	if _, err := RebuildProject(database, project.ID, PolicyKeepManualEdits); err != nil {
+		t.Fatalf("rebuild keep-manual: %v", err)
+	}
+	if kept := port(22); kept.Product != "OpenSSH" || kept.ExtraInfo != "Ubuntu" || kept.Notes != "OpenSSH confirmed by banner" {
+		t.Fatalf("expected annotated port untouched, got %+v", kept)
+	}
+	if _, found, _ := database.GetPortByKey(host.ID, 8443, "tcp"); found {
+		t.Fatalf("expected deleted port to stay deleted")
+	}
+	if http := port(80); http.Product != "nginx" || http.State != "closed" {
+		t.Fatalf("expected untouched port replayed latest-wins, got %+v", http)
+	}
+
+	if _, err := RebuildProject(database, project.ID, PolicyLatestWins); err != nil {
+		t.Fatalf("rebuild latest-wins: %v", err)
+	}
+	if _, found, _ := database.GetPortByKey(host.ID, 8443, "tcp"); !found {
+		t.Fatalf("expected latest-wins replay to restore the observed port")
+	}
+	if ssh := port(22); ssh.Product != "Dropbear" || ssh.Notes != "OpenSSH confirmed by banner" {
+		t.Fatalf("expected latest-wins fingerprint with notes kept, got %+v", ssh)
+	}
+
+	if _, err := ParseMergePolicy("oldest-wins"); !errors.Is(err, ErrUnknownMergePolicy) {
+		t.Fatalf("expected unknown policy error, got %v", err)
+	}
+	if policy, err := ParseMergePolicy(""); err != nil || policy != PolicyLatestWins {
+		t.Fatalf("expected default policy, got %q %v", policy, err)
+	}
+}
+
+func TestReparseScanImportRestoresObservations(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("reparse")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	stats, err := ImportFileWithOptions(database, nil, project.ID, "testdata/sampleNmap.gnmap", ImportOptions{}, time.Now())
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	host, _, err := database.GetHostByIP(project.ID, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if err := database.UpdateHostNotes(host.ID, "gateway"); err != nil {
+		t.Fatalf("host notes: %v", err)
+	}
+
+	// Lose what an older parser might have dropped: one port of a kept host
+	// and a whole host.
+	for _, stmt := range []string{
+		`DELETE FROM port_observation WHERE ip_address = '192.0.2.1' AND port_number = 80`,
+		`DELETE FROM port WHERE host_id = (SELECT id FROM host WHERE ip_address = '192.0.2.1') AND port_number = 80`,
+		`DELETE FROM port_observation WHERE ip_address = '192.0.2.2'`,
+		`DELETE FROM host_observation WHERE ip_address = '192.0.2.2'`,
+		`DELETE FROM host WHERE ip_address = '192.0.2.2'`,
+		`UPDATE scan_import SET hosts_found = 1, ports_found = 2`,
+	} {
+		if _, err := database.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	reparsed, err := ReparseScanImport(database, project.ID, stats.ID)
+	if err != nil {
+		t.Fatalf("reparse: %v", err)
+	}
+	if reparsed.Format != FormatGNMAP || reparsed.Before.HostsFound != 1 ||
+		reparsed.Import.HostsFound != stats.HostsFound || reparsed.Import.PortsFound != stats.PortsFound {
+		t.Fatalf("unexpected reparse stats: %+v (import was %+v)", reparsed, stats.ScanImport)
+	}
+	host, _, err = database.GetHostByIP(project.ID, "192.0.2.1")
+	if err != nil || host.Notes != "gateway" {
+		t.Fatalf("expected host notes to survive: %+v %v", host, err)
+	}
+	if http, found, err := database.GetPortByKey(host.ID, 80, "tcp"); err != nil || !found || http.Product != "nginx" {
+		t.Fatalf("expected port 80 restored: %+v %v", http, err)
+	}
+	if _, found, _ := database.GetHostByIP(project.ID, "192.0.2.2"); !found {
+		t.Fatalf("expected host missing from the old observations to be created")
+	}
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil || len(imports) != 1 || imports[0].HostsFound != stats.HostsFound {
+		t.Fatalf("expected import counts restored: %+v %v", imports, err)
+	}
+	events, err := database.ListAuditEvents(project.ID, db.AuditQuery{})
+	if err != nil || len(events) == 0 || events[0].Action != db.AuditImportReparse {
+		t.Fatalf("expected a reparse audit event: %+v %v", events, err)
+	}
+
+	// Nmap XML is streamed back host by host.
+	xmlStats, err := ImportFileWithOptions(database, nil, project.ID, "testdata/sampleNmap.xml", ImportOptions{}, time.Now())
+	if err != nil {
+		t.Fatalf("import xml: %v", err)
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf(`DELETE FROM port_observation WHERE scan_import_id = %d`, xmlStats.ID),
+		fmt.Sprintf(`DELETE FROM host_observation WHERE scan_import_id = %d`, xmlStats.ID),
+		`DELETE FROM host WHERE ip_address = '127.0.0.1'`,
+	} {
+		if _, err := database.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	reparsed, err = ReparseScanImport(database, project.ID, xmlStats.ID)
+	if err != nil {
+		t.Fatalf("reparse xml: %v", err)
+	}
+	if reparsed.Format != FormatNmapXML || reparsed.Import.PortsFound != xmlStats.PortsFound || reparsed.Import.ScanStartedAt == nil {
+		t.Fatalf("unexpected xml reparse stats: %+v (import was %+v)", reparsed, xmlStats.ScanImport)
+	}
+	if _, found, err := database.GetHostByIP(project.ID, "127.0.0.1"); err != nil || !found {
+		t.Fatalf("expected xml host recreated: %v", err)
+	}
+
+	direct, err := ImportObservations(database, nil, project.ID, "direct", Observations{
+		Hosts: []HostObservation{{IPAddress: "192.0.2.9"}},
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("import observations: %v", err)
+	}
+	if _, err := ReparseScanImport(database, project.ID, direct.ID); !errors.Is(err, db.ErrNoScanArtifact) {
+		t.Fatalf("expected ErrNoScanArtifact, got %v", err)
+	}
+	if _, err := ReparseScanImport(database, project.ID, 99999); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestLateImportOfOlderScanKeepsNewerState(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("late")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	base := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	importScan := func(day int, ports ...PortObservation) {
+		t.Helper()
+		scanned := base.AddDate(0, 0, day)
+		obs := Observations{Hosts: []HostObservation{{IPAddress: "10.0.0.5", HostState: "up", Ports: ports}}}
+		if _, err := ImportObservationsWithOptions(database, mustMatcher(t, nil), project.ID, fmt.Sprintf("day%d.xml", day), obs,
+			ParseMetadata{NmapArgs: "nmap -sV -p 22,80 10.0.0.5", ScanStartedAt: scanned}, ImportOptions{}, scanned); err != nil {
+			t.Fatalf("import day %d: %v", day, err)
+		}
+	}
+	ssh := func(version string) PortObservation {
+		return PortObservation{PortNumber: 22, Protocol: "tcp", State: "open", Service: "ssh", Version: version}
+	}
+	http := PortObservation{PortNumber: 80, Protocol: "tcp", State: "open", Service: "http", Product: "nginx"}
+
+	importScan(2, ssh("2.0"), http)
+	importScan(3, ssh("3.0"))
+	importScan(1, ssh("1.0"), http)
+
+	host, _, err := database.GetHostByIP(project.ID, "10.0.0.5")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	sshPort, _, err := database.GetPortByKey(host.ID, 22, "tcp")
+	if err != nil || sshPort.Version != "3.0" || sshPort.State != "open" {
+		t.Fatalf("expected the newest ssh version to stay, got %+v (%v)", sshPort, err)
+	}
+	httpPort, _, err := database.GetPortByKey(host.ID, 80, "tcp")
+	if err != nil || httpPort.State != db.PortStateNotObserved || httpPort.NotObservedAt == nil {
+		t.Fatalf("expected port 80 to stay not observed, got %+v (%v)", httpPort, err)
+	}
+}
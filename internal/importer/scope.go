@@ -0,0 +1,32 @@
+package importer
+
+import (
+	"fmt"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/scope"
+)
+
+// ProjectScopeMatcher builds a matcher from the project's stored scope
+// definitions. It is shared by the CLI and web imports so both classify
+// hosts the same way.
+func ProjectScopeMatcher(database *db.DB, projectID int64) (*scope.Matcher, error) {
+	defs, err := database.ListScopeDefinitions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := db.ParseScopeRules(defs)
+	if err != nil {
+		return nil, fmt.Errorf("build scope matcher: %w", err)
+	}
+	return scope.NewMatcherFromRules(rules), nil
+}
+
+// resolveMatcher returns matcher, or the project's stored scope when matcher
+// is nil. Callers that want every host in scope pass scope.NewMatcher(nil).
+func resolveMatcher(database *db.DB, projectID int64, matcher *scope.Matcher) (*scope.Matcher, error) {
+	if matcher != nil {
+		return matcher, nil
+	}
+	return ProjectScopeMatcher(database, projectID)
+}
@@ -0,0 +1,263 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxArchiveDepth bounds how deeply archives inside archives are opened.
+const maxArchiveDepth = 4
+
+// archiveSniffSize covers the tar magic, which sits at offset 257.
+const archiveSniffSize = 512
+
+// ScanSource is one candidate scan file found by WalkScanSources.
+type ScanSource struct {
+	// Path names the file for people: its path, or for an archive entry the
+	// archive's path and the entry joined by ":".
+	Path string
+	// Filename is the name recorded for the import: the base name of the
+	// file or entry, without a .gz suffix.
+	Filename string
+}
+
+// ScanSourceFunc receives each file WalkScanSources finds with a reader over
+// its content, or with the error that kept it from being read. Returning an
+// error stops the walk.
+type ScanSourceFunc func(src ScanSource, r io.Reader, err error) error
+
+// WalkScanSources expands paths into the files they name and calls fn for
+// each, in order. A path may be a file, a directory, searched recursively in
+// lexical order, or a glob pattern. Gzip, zip and tar files (including
+// .tar.gz) are recognised by their content and their entries walked in
+// place of the archive. A file named twice is visited once. fn decides what
+// is a scan; DetectFormat reports ErrUnrecognizedFormat for anything else.
+func WalkScanSources(paths []string, fn ScanSourceFunc) error {
+	w := &sourceWalker{fn: fn, seen: make(map[string]bool)}
+	for _, p := range paths {
+		if err := w.walkArg(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsArchiveFile reports whether the file at path is a gzip, zip or tar
+// archive that WalkScanSources would open rather than hand on.
+func IsArchiveFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, archiveSniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return archiveKind(head[:n]) != "", nil
+}
+
+type sourceWalker struct {
+	fn   ScanSourceFunc
+	seen map[string]bool
+}
+
+func (w *sourceWalker) walkArg(arg string) error {
+	if _, err := os.Lstat(arg); err != nil && strings.ContainsAny(arg, "*?[") {
+		matches, globErr := filepath.Glob(arg)
+		if globErr != nil {
+			return w.fn(ScanSource{Path: arg}, nil, fmt.Errorf("bad pattern: %w", globErr))
+		}
+		if len(matches) == 0 {
+			return w.fn(ScanSource{Path: arg}, nil, errors.New("no files match"))
+		}
+		for _, match := range matches {
+			if err := w.walkPath(match); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.walkPath(arg)
+}
+
+func (w *sourceWalker) walkPath(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return w.fn(ScanSource{Path: root}, nil, err)
+	}
+	if !info.IsDir() {
+		return w.walkFile(root)
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return w.fn(ScanSource{Path: p}, nil, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// Symlinks are followed to files, not to directories.
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range files {
+		if err := w.walkFile(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *sourceWalker) walkFile(p string) error {
+	key := p
+	if abs, err := filepath.Abs(p); err == nil {
+		key = abs
+	}
+	if w.seen[key] {
+		return nil
+	}
+	w.seen[key] = true
+
+	f, err := os.Open(p)
+	if err != nil {
+		return w.fn(ScanSource{Path: p}, nil, err)
+	}
+	defer f.Close()
+	return w.walkStream(ScanSource{Path: p, Filename: filepath.Base(p)}, f, 0)
+}
+
+// walkStream hands r to fn, or walks it as an archive when its content is
+// one.
+func (w *sourceWalker) walkStream(src ScanSource, r io.Reader, depth int) error {
+	br := bufio.NewReaderSize(r, archiveSniffSize)
+	head, err := br.Peek(archiveSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return w.fn(src, nil, err)
+	}
+	kind := archiveKind(head)
+	if kind == "" {
+		return w.fn(src, br, nil)
+	}
+	if depth >= maxArchiveDepth {
+		return w.fn(src, nil, fmt.Errorf("archives nested more than %d deep", maxArchiveDepth))
+	}
+	switch kind {
+	case "gzip":
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return w.fn(src, nil, err)
+		}
+		defer gz.Close()
+		inner := src
+		inner.Filename = trimGzipSuffix(src.Filename)
+		return w.walkStream(inner, gz, depth+1)
+	case "tar":
+		return w.walkTar(src, br, depth)
+	default:
+		return w.walkZip(src, br, depth)
+	}
+}
+
+func archiveKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return "zip"
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return "tar"
+	}
+	return ""
+}
+
+func trimGzipSuffix(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tgz"):
+		return name[:len(name)-len(".tgz")] + ".tar"
+	case strings.HasSuffix(lower, ".gz"):
+		return name[:len(name)-len(".gz")]
+	}
+	return name
+}
+
+func (w *sourceWalker) walkTar(src ScanSource, r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return w.fn(src, nil, fmt.Errorf("read tar: %w", err))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		entry := ScanSource{Path: src.Path + ":" + hdr.Name, Filename: path.Base(hdr.Name)}
+		if err := w.walkStream(entry, tr, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip walks a zip's entries in name order. Zip needs random access, so
+// the archive is spooled to a temporary file first.
+func (w *sourceWalker) walkZip(src ScanSource, r io.Reader, depth int) error {
+	tmp, err := os.CreateTemp("", "nmap-tracker-zip-*")
+	if err != nil {
+		return w.fn(src, nil, fmt.Errorf("spool zip: %w", err))
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return w.fn(src, nil, fmt.Errorf("spool zip: %w", err))
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return w.fn(src, nil, fmt.Errorf("read zip: %w", err))
+	}
+	entries := make([]*zip.File, 0, len(zr.File))
+	for _, f := range zr.File {
+		if f.Mode().IsRegular() {
+			entries = append(entries, f)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, f := range entries {
+		entry := ScanSource{Path: src.Path + ":" + f.Name, Filename: path.Base(f.Name)}
+		rc, err := f.Open()
+		if err != nil {
+			if err := w.fn(entry, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		err = w.walkStream(entry, rc, depth+1)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sloppy/nmaptracker/internal/testutil"
+)
+
+func TestWalkScanSourcesExpandsDirectoriesGlobsAndArchives(t *testing.T) {
+	dir := testutil.TempDir(t)
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("gzipped"))
+	gw.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, name := range []string{"b.gnmap", "a/scan.xml"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("zip " + name))
+	}
+	zw.Close()
+
+	var tarGz bytes.Buffer
+	tgw := gzip.NewWriter(&tarGz)
+	tw := tar.NewWriter(tgw)
+	tw.WriteHeader(&tar.Header{Name: "out/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "out/c.json", Typeflag: tar.TypeReg, Mode: 0o644, Size: 6})
+	tw.Write([]byte("tar c!"))
+	tw.Close()
+	tgw.Close()
+
+	plain := write("scans/one.xml", []byte("plain"))
+	write("scans/deep/two.xml.gz", gz.Bytes())
+	write("scans/deep/bundle.zip", zipped.Bytes())
+	write("other/run.tgz", tarGz.Bytes())
+	write("other/notes.txt", []byte("notes"))
+
+	type seen struct{ Path, Filename, Content string }
+	var got []seen
+	var failures []string
+	err := WalkScanSources([]string{
+		filepath.Join(dir, "scans"),
+		plain, // already visited through the directory
+		filepath.Join(dir, "other", "*.tgz"),
+		filepath.Join(dir, "missing", "*.xml"),
+	}, func(src ScanSource, r io.Reader, err error) error {
+		if err != nil {
+			failures = append(failures, src.Path+": "+err.Error())
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read %s: %v", src.Path, err)
+		}
+		rel, _ := filepath.Rel(dir, src.Path)
+		got = append(got, seen{filepath.ToSlash(rel), src.Filename, string(data)})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+
+	want := []seen{
+		{"scans/deep/bundle.zip:a/scan.xml", "scan.xml", "zip a/scan.xml"},
+		{"scans/deep/bundle.zip:b.gnmap", "b.gnmap", "zip b.gnmap"},
+		{"scans/deep/two.xml.gz", "two.xml", "gzipped"},
+		{"scans/one.xml", "one.xml", "plain"},
+		{"other/run.tgz:out/c.json", "c.json", "tar c!"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sources:\n got %+v\nwant %+v", got, want)
+	}
+	if len(failures) != 1 || filepath.Base(filepath.Dir(failures[0])) != "missing" {
+		t.Fatalf("expected one unmatched glob failure, got %v", failures)
+	}
+
+	if archive, err := IsArchiveFile(filepath.Join(dir, "other", "run.tgz")); err != nil || !archive {
+		t.Fatalf("IsArchiveFile(run.tgz) = %v, %v", archive, err)
+	}
+	if archive, err := IsArchiveFile(plain); err != nil || archive {
+		t.Fatalf("IsArchiveFile(one.xml) = %v, %v", archive, err)
+	}
+}
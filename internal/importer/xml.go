@@ -1,24 +1,26 @@
 package importer
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Internal parsing structs matching nmap XML.
-type nmapRun struct {
-	Args  string     `xml:"args,attr"`
-	Hosts []nmapHost `xml:"host"`
-}
-
 type nmapHost struct {
-	Addresses []nmapAddress `xml:"address"`
-	Status    nmapHostState `xml:"status"`
-	Hostnames nmapHostnames `xml:"hostnames"`
-	Ports     []nmapPort    `xml:"ports>port"`
-	OS        nmapOS        `xml:"os"`
+	Addresses   []nmapAddress `xml:"address"`
+	Status      nmapHostState `xml:"status"`
+	Hostnames   nmapHostnames `xml:"hostnames"`
+	Ports       []nmapPort    `xml:"ports>port"`
+	OS          nmapOS        `xml:"os"`
+	HostScripts []nmapScript  `xml:"hostscript>script"`
+	StartTime   string        `xml:"starttime,attr"`
+	EndTime     string        `xml:"endtime,attr"`
 }
 
 type nmapHostState struct {
@@ -28,6 +30,7 @@ type nmapHostState struct {
 type nmapAddress struct {
 	Addr     string `xml:"addr,attr"`
 	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr"`
 }
 
 type nmapHostnames struct {
@@ -58,8 +61,17 @@ type nmapService struct {
 }
 
 type nmapScript struct {
-	ID     string `xml:"id,attr"`
-	Output string `xml:"output,attr"`
+	ID       string           `xml:"id,attr"`
+	Output   string           `xml:"output,attr"`
+	Elements []nmapScriptNode `xml:",any"`
+}
+
+// nmapScriptNode is one <elem> or <table> of structured script output.
+type nmapScriptNode struct {
+	XMLName  xml.Name
+	Key      string           `xml:"key,attr"`
+	Value    string           `xml:",chardata"`
+	Children []nmapScriptNode `xml:",any"`
 }
 
 type nmapOS struct {
@@ -79,32 +91,166 @@ func parseXML(r io.Reader) (Observations, error) {
 }
 
 func parseXMLWithMetadata(r io.Reader) (Observations, ParseMetadata, error) {
-	var run nmapRun
+	var obs Observations
+	metadata, err := walkXMLObservations(r, func(host HostObservation) error {
+		obs.Hosts = append(obs.Hosts, host)
+		return nil
+	})
+	if err != nil {
+		return Observations{}, ParseMetadata{}, err
+	}
+	return obs, metadata, nil
+}
+
+// walkXMLObservations streams the hosts of an nmap XML document to onHost and
+// returns the document's metadata. The scan finish time is only known once
+// every host has been seen.
+func walkXMLObservations(r io.Reader, onHost func(HostObservation) error) (ParseMetadata, error) {
+	var metadata ParseMetadata
+	scanned := make(map[string]string)
+	err := walkXML(r,
+		func(start xml.StartElement) error {
+			metadata.NmapArgs = nmapArgsFromStart(start)
+			metadata.ScanStartedAt = unixTimeAttr(start, "start")
+			return nil
+		},
+		func(info xml.StartElement) error {
+			scanned[attrValue(info, "protocol")] = attrValue(info, "services")
+			metadata.ScannedPorts = scannedPortsSpec(scanned)
+			return nil
+		},
+		func(h nmapHost) error {
+			return onHost(observationFromHost(h))
+		},
+		func(finished xml.StartElement) error {
+			metadata.ScanFinishedAt = unixTimeAttr(finished, "time")
+			return nil
+		},
+	)
+	if err != nil {
+		return ParseMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// walkXML streams an nmap XML document token by token, calling onRun for the
+// nmaprun start element, onScanInfo for each <scaninfo>, onHost for each
+// <host> and onFinished for the runstats <finished> element. Only the host
+// currently being decoded is held in memory.
+func walkXML(r io.Reader, onRun, onScanInfo func(xml.StartElement) error, onHost func(nmapHost) error, onFinished func(xml.StartElement) error) error {
 	dec := xml.NewDecoder(r)
-	if err := dec.Decode(&run); err != nil {
-		return Observations{}, ParseMetadata{}, fmt.Errorf("decode xml: %w", err)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode xml: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "nmaprun":
+			if err := onRun(start); err != nil {
+				return err
+			}
+		case "scaninfo":
+			if err := onScanInfo(start); err != nil {
+				return err
+			}
+		case "host":
+			var host nmapHost
+			if err := dec.DecodeElement(&host, &start); err != nil {
+				return fmt.Errorf("decode host: %w", err)
+			}
+			if err := onHost(host); err != nil {
+				return err
+			}
+		case "finished":
+			if err := onFinished(start); err != nil {
+				return err
+			}
+		}
 	}
+}
 
-	var obs Observations
-	for _, h := range run.Hosts {
-		host := observationFromHost(h)
-		obs.Hosts = append(obs.Hosts, host)
+// unixTime parses the epoch-seconds timestamps nmap writes in start, time,
+// starttime and endtime attributes. Missing or malformed values yield the
+// zero time.
+func unixTime(raw string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
+func unixTimeAttr(start xml.StartElement, name string) time.Time {
+	return unixTime(attrValue(start, name))
+}
+
+func attrValue(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
 	}
-	return obs, ParseMetadata{NmapArgs: strings.TrimSpace(run.Args)}, nil
+	return ""
 }
 
-func firstIPv4(addrs []nmapAddress) string {
+// hostAddress returns the host's IP address. Nmap emits one IP <address> per
+// host (IPv4 or IPv6) alongside an optional MAC; IPv4 wins if both appear.
+func hostAddress(addrs []nmapAddress) string {
+	var ipv6 string
 	for _, a := range addrs {
-		if strings.ToLower(a.AddrType) == "ipv4" {
+		switch strings.ToLower(a.AddrType) {
+		case "ipv4":
 			return a.Addr
+		case "ipv6":
+			if ipv6 == "" {
+				ipv6 = a.Addr
+			}
 		}
 	}
-	if len(addrs) > 0 {
-		return addrs[0].Addr
+	if ipv6 != "" {
+		return ipv6
+	}
+	for _, a := range addrs {
+		if !strings.EqualFold(a.AddrType, "mac") {
+			return a.Addr
+		}
 	}
 	return ""
 }
 
+// hostMAC returns the host's MAC address and its OUI vendor, as nmap reports
+// them for targets on the local segment. The address is canonicalized to
+// upper-case colon form; unparseable values are dropped.
+func hostMAC(addrs []nmapAddress) (string, string) {
+	for _, a := range addrs {
+		if !strings.EqualFold(a.AddrType, "mac") {
+			continue
+		}
+		mac, ok := normalizeMACAddress(a.Addr)
+		if !ok {
+			continue
+		}
+		return mac, strings.TrimSpace(a.Vendor)
+	}
+	return "", ""
+}
+
+func normalizeMACAddress(raw string) (string, bool) {
+	hw, err := net.ParseMAC(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	return strings.ToUpper(hw.String()), true
+}
+
 func firstHostname(h nmapHostnames) string {
 	if len(h.Hostnames) == 0 {
 		return ""
@@ -134,13 +280,81 @@ func joinScripts(scripts []nmapScript) string {
 	return strings.Join(parts, "\n")
 }
 
+func scriptResults(scripts []nmapScript) []ScriptResult {
+	var out []ScriptResult
+	for _, s := range scripts {
+		id := strings.TrimSpace(s.ID)
+		if id == "" {
+			continue
+		}
+		out = append(out, ScriptResult{
+			ScriptID: id,
+			Output:   s.Output,
+			Elements: scriptElementsJSON(s.Elements),
+		})
+	}
+	return out
+}
+
+// scriptElementsJSON converts a script's element tree to JSON. A table whose
+// children carry keys becomes an object (keyless children are keyed by their
+// position); a table of keyless children becomes an array. Scripts without
+// structured output yield nil.
+func scriptElementsJSON(nodes []nmapScriptNode) json.RawMessage {
+	if len(nodes) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(scriptTree(nodes))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func scriptTree(nodes []nmapScriptNode) any {
+	keyed := false
+	for _, n := range nodes {
+		if n.Key != "" {
+			keyed = true
+			break
+		}
+	}
+	if !keyed {
+		items := make([]any, 0, len(nodes))
+		for _, n := range nodes {
+			items = append(items, scriptNodeValue(n))
+		}
+		return items
+	}
+	obj := make(map[string]any, len(nodes))
+	for i, n := range nodes {
+		key := n.Key
+		if key == "" {
+			key = strconv.Itoa(i)
+		}
+		obj[key] = scriptNodeValue(n)
+	}
+	return obj
+}
+
+func scriptNodeValue(n nmapScriptNode) any {
+	if n.XMLName.Local == "table" {
+		return scriptTree(n.Children)
+	}
+	return strings.TrimSpace(n.Value)
+}
+
 func observationFromHost(h nmapHost) HostObservation {
 	host := HostObservation{
-		IPAddress: firstIPv4(h.Addresses),
+		IPAddress: hostAddress(h.Addresses),
 		Hostname:  firstHostname(h.Hostnames),
 		OSGuess:   firstOS(h.OS),
 		HostState: strings.ToLower(strings.TrimSpace(h.Status.State)),
+		StartedAt: unixTime(h.StartTime),
+		EndedAt:   unixTime(h.EndTime),
 	}
+	host.MACAddress, host.MACVendor = hostMAC(h.Addresses)
+	host.Scripts = scriptResults(h.HostScripts)
 	for _, p := range h.Ports {
 		host.Ports = append(host.Ports, PortObservation{
 			PortNumber:   p.PortID,
@@ -151,6 +365,7 @@ func observationFromHost(h nmapHost) HostObservation {
 			Product:      p.Service.Product,
 			ExtraInfo:    p.Service.ExtraInfo,
 			ScriptOutput: joinScripts(p.Scripts),
+			Scripts:      scriptResults(p.Scripts),
 		})
 	}
 	return host
@@ -0,0 +1,308 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// syntheticNmapXML generates an nmap XML document of roughly targetBytes on
+// the fly so large-file imports can be exercised without a fixture on disk.
+type syntheticNmapXML struct {
+	targetBytes int64
+	written     int64
+	hosts       int
+	maxHosts    int
+	buf         bytes.Buffer
+	padding     string
+	closed      bool
+	footer      bool
+}
+
+func newSyntheticNmapXML(targetBytes int64, maxHosts int) *syntheticNmapXML {
+	g := &syntheticNmapXML{
+		targetBytes: targetBytes,
+		maxHosts:    maxHosts,
+		padding:     strings.Repeat("A", 6*1024),
+	}
+	g.buf.WriteString(`<?xml version="1.0"?>` + "\n")
+	g.buf.WriteString(`<nmaprun scanner="nmap" args="nmap -p- -sV 10.0.0.0/8" start="1709546400">` + "\n")
+	return g
+}
+
+func (g *syntheticNmapXML) Read(p []byte) (int, error) {
+	for g.buf.Len() < len(p) && !g.closed {
+		if g.written >= g.targetBytes || (g.maxHosts > 0 && g.hosts >= g.maxHosts) {
+			if !g.footer {
+				g.buf.WriteString("</nmaprun>\n")
+				g.footer = true
+			}
+			g.closed = true
+			break
+		}
+		g.writeHost()
+	}
+	if g.buf.Len() == 0 && g.closed {
+		return 0, io.EOF
+	}
+	n, _ := g.buf.Read(p)
+	g.written += int64(n)
+	return n, nil
+}
+
+func (g *syntheticNmapXML) writeHost() {
+	n := g.hosts + 1
+	ip := fmt.Sprintf("10.%d.%d.%d", (n>>16)&0xff, (n>>8)&0xff, n&0xff)
+	fmt.Fprintf(&g.buf, `<host><status state="up"/><address addr="%s" addrtype="ipv4"/><hostnames><hostname name="h%d.example.test"/></hostnames><ports>`, ip, n)
+	for _, port := range []int{22, 80, 443} {
+		fmt.Fprintf(&g.buf, `<port protocol="tcp" portid="%d"><state state="open"/><service name="svc%d" product="prod" version="1.%d"/><script id="banner" output="%s"/></port>`, port, port, n%10, g.padding)
+	}
+	g.buf.WriteString("</ports></host>\n")
+	g.hosts++
+}
+
+// failingReader returns err once the wrapped reader is exhausted.
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+// callbackReader runs fn once, when the decoder first reaches it, then reports EOF.
+type callbackReader struct {
+	once sync.Once
+	fn   func()
+}
+
+func (c *callbackReader) Read(p []byte) (int, error) {
+	c.once.Do(c.fn)
+	return 0, io.EOF
+}
+
+func syntheticHosts(t *testing.T, count int) string {
+	t.Helper()
+	data, err := io.ReadAll(newSyntheticNmapXML(1<<40, count))
+	if err != nil {
+		t.Fatalf("generate xml: %v", err)
+	}
+	body := string(data)
+	return strings.TrimSuffix(body, "</nmaprun>\n")
+}
+
+// TestImportXMLStreamsWithBoundedMemory imports a generated document and checks
+// that peak heap use stays flat relative to input size. The default input is
+// 32 MiB; set NMAP_TRACKER_STREAM_TEST_BYTES=2147483648 to run the 2 GB fixture.
+func TestImportXMLStreamsWithBoundedMemory(t *testing.T) {
+	targetBytes := int64(32 << 20)
+	if raw := os.Getenv("NMAP_TRACKER_STREAM_TEST_BYTES"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			t.Fatalf("invalid NMAP_TRACKER_STREAM_TEST_BYTES %q", raw)
+		}
+		targetBytes = parsed
+	} else if testing.Short() {
+		t.Skip("skipping large streaming import in short mode")
+	}
+
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("stream")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	runtime.GC()
+	var baseline runtime.MemStats
+	runtime.ReadMemStats(&baseline)
+
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	var sampler sync.WaitGroup
+	sampler.Add(1)
+	go func() {
+		defer sampler.Done()
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > peak.Load() {
+				peak.Store(m.HeapInuse)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	input := newSyntheticNmapXML(targetBytes, 0)
+	started := time.Now()
+	stats, err := ImportXMLWithOptions(database, mustMatcher(t, nil), project.ID, "huge.xml", input, ImportOptions{BatchSize: 200}, time.Now().UTC())
+	close(done)
+	sampler.Wait()
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	growth := int64(peak.Load()) - int64(baseline.HeapInuse)
+	t.Logf("imported %d MiB (%d hosts, %d ports) in %s; peak heap growth %.1f MiB",
+		input.written>>20, stats.HostsFound, stats.PortsFound, time.Since(started).Round(time.Millisecond), float64(growth)/(1<<20))
+
+	if stats.HostsFound != input.hosts || stats.PortsFound != input.hosts*3 {
+		t.Fatalf("unexpected stats: hosts=%d ports=%d generated=%d", stats.HostsFound, stats.PortsFound, input.hosts)
+	}
+	const budget = 16 << 20
+	if growth > budget {
+		t.Fatalf("peak heap growth %d bytes exceeds %d byte budget for %d byte input", growth, budget, input.written)
+	}
+}
+
+func TestImportXMLStagesUntilPublished(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("staging")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	var status string
+	var stagedHosts, visibleImports, visibleHosts int
+	probe := &callbackReader{fn: func() {
+		if err := database.QueryRow(`SELECT status FROM scan_import WHERE project_id = ?`, project.ID).Scan(&status); err != nil {
+			t.Errorf("query status: %v", err)
+		}
+		if err := database.QueryRow(`SELECT COUNT(*) FROM host_observation WHERE project_id = ?`, project.ID).Scan(&stagedHosts); err != nil {
+			t.Errorf("count staged hosts: %v", err)
+		}
+		imports, err := database.ListScanImports(project.ID)
+		if err != nil {
+			t.Errorf("list imports: %v", err)
+		}
+		visibleImports = len(imports)
+		hosts, err := database.ListHosts(project.ID)
+		if err != nil {
+			t.Errorf("list hosts: %v", err)
+		}
+		visibleHosts = len(hosts)
+	}}
+
+	// The probe sits after 40 hosts so several batches have been committed by
+	// the time the decoder reaches it.
+	body := io.MultiReader(strings.NewReader(syntheticHosts(t, 40)), probe, strings.NewReader(" </nmaprun>"))
+	stats, err := ImportXMLWithOptions(database, mustMatcher(t, nil), project.ID, "staged.xml", body, ImportOptions{BatchSize: 5}, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	if status != db.ScanImportStatusStaging {
+		t.Fatalf("expected staging status mid-import, got %q", status)
+	}
+	if stagedHosts == 0 {
+		t.Fatalf("expected committed staged observations mid-import")
+	}
+	if visibleImports != 0 || visibleHosts != 0 {
+		t.Fatalf("staging import leaked to readers: imports=%d hosts=%d", visibleImports, visibleHosts)
+	}
+
+	if stats.Status != db.ScanImportStatusComplete || stats.HostsFound != 40 {
+		t.Fatalf("unexpected stats: %+v", stats.ScanImport)
+	}
+	imports, err := database.ListScanImportsWithIntents(project.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != 1 || imports[0].HostsFound != 40 || imports[0].PortsFound != 120 {
+		t.Fatalf("unexpected published import: %+v", imports)
+	}
+	if len(imports[0].Intents) == 0 || imports[0].Intents[0].Intent != db.IntentAllTCP {
+		t.Fatalf("expected all_tcp intent on published import, got %+v", imports[0].Intents)
+	}
+	hosts, err := database.ListHosts(project.ID)
+	if err != nil {
+		t.Fatalf("list hosts: %v", err)
+	}
+	if len(hosts) != 40 {
+		t.Fatalf("expected 40 hosts after publish, got %d", len(hosts))
+	}
+}
+
+func TestImportXMLDiscardsStagedRowsOnFailure(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("failure")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	readErr := errors.New("connection reset")
+	body := failingReader{r: strings.NewReader(syntheticHosts(t, 12)), err: readErr}
+	if _, err := ImportXMLWithOptions(database, mustMatcher(t, nil), project.ID, "broken.xml", body, ImportOptions{BatchSize: 3}, time.Now().UTC()); !errors.Is(err, readErr) {
+		t.Fatalf("expected read error, got %v", err)
+	}
+
+	var importRows, hostObs, portObs, hosts int
+	for query, dst := range map[string]*int{
+		`SELECT COUNT(*) FROM scan_import WHERE project_id = ?`:      &importRows,
+		`SELECT COUNT(*) FROM host_observation WHERE project_id = ?`: &hostObs,
+		`SELECT COUNT(*) FROM port_observation WHERE project_id = ?`: &portObs,
+		`SELECT COUNT(*) FROM host WHERE project_id = ?`:             &hosts,
+	} {
+		if err := database.QueryRow(query, project.ID).Scan(dst); err != nil {
+			t.Fatalf("count rows: %v", err)
+		}
+	}
+	if importRows != 0 || hostObs != 0 || portObs != 0 || hosts != 0 {
+		t.Fatalf("expected failed import to leave no rows: imports=%d host_obs=%d port_obs=%d hosts=%d", importRows, hostObs, portObs, hosts)
+	}
+}
+
+func TestImportXMLReportsProgress(t *testing.T) {
+	database := newTestDB(t)
+	defer database.Close()
+	project, err := database.CreateProject("progress")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	var updates []ImportProgress
+	options := ImportOptions{BatchSize: 10, Progress: func(p ImportProgress) { updates = append(updates, p) }}
+	body := strings.NewReader(syntheticHosts(t, 25) + " </nmaprun>")
+	if _, err := ImportXMLWithOptions(database, mustMatcher(t, nil), project.ID, "progress.xml", body, options, time.Now().UTC()); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	// Start, three staged batches, then the write phase.
+	if len(updates) != 5 {
+		t.Fatalf("expected 5 progress updates, got %+v", updates)
+	}
+	if updates[0].Phase != PhaseParsing || updates[0].Hosts != 0 {
+		t.Fatalf("unexpected first update: %+v", updates[0])
+	}
+	if updates[1].Hosts != 10 || updates[3].Hosts != 25 {
+		t.Fatalf("unexpected batch updates: %+v", updates)
+	}
+	last := updates[len(updates)-1]
+	if last.Phase != PhaseWriting || last.Hosts != 25 || last.Ports != 75 {
+		t.Fatalf("unexpected final update: %+v", last)
+	}
+}
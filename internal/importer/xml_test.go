@@ -116,3 +116,61 @@ func TestParseXMLWithScriptsAndVersion(t *testing.T) {
 		t.Fatalf("udp port parse failed: %#v", dns)
 	}
 }
+
+func TestParseXMLStructuredScriptResults(t *testing.T) {
+	xml := `
+<nmaprun>
+  <host>
+    <address addr="192.0.2.20" addrtype="ipv4"/>
+    <ports>
+      <port protocol="tcp" portid="443">
+        <state state="open"/>
+        <script id="ssl-cert" output="Subject: commonName=example.com">
+          <table key="subject">
+            <elem key="commonName">example.com</elem>
+            <elem key="organizationName">Example</elem>
+          </table>
+          <table key="extensions">
+            <table><elem key="name">X509v3 Subject Alternative Name</elem></table>
+          </table>
+          <elem key="sig_algo">sha256WithRSAEncryption</elem>
+        </script>
+      </port>
+    </ports>
+    <hostscript>
+      <script id="smb2-security-mode" output="3:1:1: Message signing enabled but not required">
+        <table key="3:1:1">
+          <elem>Message signing enabled but not required</elem>
+        </table>
+      </script>
+      <script id="clock-skew" output="0s"/>
+    </hostscript>
+  </host>
+</nmaprun>`
+	obs, err := ParseXML(strings.NewReader(xml))
+	if err != nil {
+		t.Fatalf("parse xml: %v", err)
+	}
+	h := obs.Hosts[0]
+	if len(h.Scripts) != 2 {
+		t.Fatalf("expected 2 host scripts, got %#v", h.Scripts)
+	}
+	if h.Scripts[0].ScriptID != "smb2-security-mode" || string(h.Scripts[0].Elements) != `{"3:1:1":["Message signing enabled but not required"]}` {
+		t.Fatalf("unexpected smb2-security-mode result: %s %s", h.Scripts[0].ScriptID, h.Scripts[0].Elements)
+	}
+	if h.Scripts[1].ScriptID != "clock-skew" || h.Scripts[1].Elements != nil || h.Scripts[1].Output != "0s" {
+		t.Fatalf("expected text-only clock-skew result, got %#v", h.Scripts[1])
+	}
+
+	port := h.Ports[0]
+	if len(port.Scripts) != 1 || port.Scripts[0].ScriptID != "ssl-cert" {
+		t.Fatalf("unexpected port scripts: %#v", port.Scripts)
+	}
+	want := `{"extensions":[{"name":"X509v3 Subject Alternative Name"}],"sig_algo":"sha256WithRSAEncryption","subject":{"commonName":"example.com","organizationName":"Example"}}`
+	if string(port.Scripts[0].Elements) != want {
+		t.Fatalf("unexpected ssl-cert elements:\n got %s\nwant %s", port.Scripts[0].Elements, want)
+	}
+	if !strings.Contains(port.ScriptOutput, "ssl-cert: Subject") {
+		t.Fatalf("expected flattened script output to be kept, got %q", port.ScriptOutput)
+	}
+}
@@ -1,70 +1,260 @@
 package scope
 
 import (
+	"errors"
+	"fmt"
 	"net/netip"
+	"strconv"
+	"strings"
 )
 
+// Rule types stored in scope_definition.type.
+const (
+	RuleInclude = "include"
+	RuleExclude = "exclude"
+)
+
+// Rule kinds derived from the definition text.
+const (
+	KindIP       = "ip"
+	KindCIDR     = "cidr"
+	KindRange    = "range"
+	KindHostname = "hostname"
+)
+
+// ErrInvalidRule is returned for scope definitions that cannot be parsed.
+var ErrInvalidRule = errors.New("invalid scope rule")
+
+// Rule is one parsed scope definition.
 type Rule struct {
 	Definition string
-	Type       string // "ip" or "cidr"
+	Type       string // RuleInclude or RuleExclude
+	Kind       string // KindIP, KindCIDR, KindRange or KindHostname
 	prefix     netip.Prefix
 	addr       netip.Addr
+	last       netip.Addr
+	hostname   string
+	wildcard   bool
 }
 
 type Matcher struct {
-	rules []Rule
+	rules        []Rule
+	hasIncludes  bool
+	hasHostnames bool
 }
 
-func NewMatcher(definitions []string) (*Matcher, error) {
-	var rules []Rule
-	for _, def := range definitions {
-		rule := Rule{Definition: def}
+// ParseRule parses a single definition: an IP, a CIDR, a dash range
+// ("10.0.0.10-10.0.0.40", or "10.0.0.10-40" for the last IPv4 octet), or a
+// hostname, optionally with a leading "*." wildcard that matches any
+// subdomain. An empty typ means include.
+func ParseRule(definition, typ string) (Rule, error) {
+	def := strings.TrimSpace(definition)
+	ruleType, ok := NormalizeRuleType(typ)
+	if !ok {
+		return Rule{}, fmt.Errorf("%w: unknown type %q for %q", ErrInvalidRule, typ, def)
+	}
+	rule := Rule{Definition: def, Type: ruleType}
+	if def == "" {
+		return Rule{}, fmt.Errorf("%w: empty definition", ErrInvalidRule)
+	}
 
-		// Try parsing as CIDR first
-		if prefix, err := netip.ParsePrefix(def); err == nil {
-			rule.Type = "cidr"
-			rule.prefix = prefix
-			rules = append(rules, rule)
-			continue
+	if addr, err := netip.ParseAddr(def); err == nil {
+		if addr.Zone() != "" {
+			return Rule{}, fmt.Errorf("%w: %q has a zone", ErrInvalidRule, def)
 		}
+		rule.Kind = KindIP
+		rule.addr = addr.Unmap()
+		return rule, nil
+	}
+	if strings.Contains(def, "/") {
+		prefix, err := netip.ParsePrefix(def)
+		if err != nil {
+			return Rule{}, fmt.Errorf("%w: %q is not a valid CIDR", ErrInvalidRule, def)
+		}
+		rule.Kind = KindCIDR
+		rule.prefix = prefix.Masked()
+		return rule, nil
+	}
+	if first, last, ok := strings.Cut(def, "-"); ok {
+		if start, err := netip.ParseAddr(strings.TrimSpace(first)); err == nil {
+			end, err := parseRangeEnd(start, strings.TrimSpace(last))
+			if err != nil {
+				return Rule{}, fmt.Errorf("%w: %q: %v", ErrInvalidRule, def, err)
+			}
+			rule.Kind = KindRange
+			rule.addr = start.Unmap()
+			rule.last = end
+			return rule, nil
+		}
+	}
 
-		// Try parsing as IP
-		if addr, err := netip.ParseAddr(def); err == nil {
-			rule.Type = "ip"
-			rule.addr = addr
-			rules = append(rules, rule)
-			continue
+	name := strings.TrimSuffix(strings.ToLower(def), ".")
+	if rest, ok := strings.CutPrefix(name, "*."); ok {
+		rule.wildcard = true
+		name = rest
+	}
+	if !validHostname(name) {
+		return Rule{}, fmt.Errorf("%w: %q is not an IP, CIDR, range or hostname", ErrInvalidRule, def)
+	}
+	rule.Kind = KindHostname
+	rule.hostname = name
+	return rule, nil
+}
+
+// NormalizeRuleType maps a stored or requested rule type to RuleInclude or
+// RuleExclude. Empty means include, as do the rule kinds ("ip", "cidr") that
+// older rows recorded in the type column.
+func NormalizeRuleType(typ string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "", RuleInclude, KindIP, KindCIDR:
+		return RuleInclude, true
+	case RuleExclude:
+		return RuleExclude, true
+	}
+	return "", false
+}
+
+func parseRangeEnd(start netip.Addr, raw string) (netip.Addr, error) {
+	start = start.Unmap()
+	end, err := netip.ParseAddr(raw)
+	if err != nil {
+		if !start.Is4() {
+			return netip.Addr{}, fmt.Errorf("invalid range end %q", raw)
+		}
+		octet, parseErr := strconv.ParseUint(raw, 10, 8)
+		if parseErr != nil {
+			return netip.Addr{}, fmt.Errorf("invalid range end %q", raw)
 		}
+		b := start.As4()
+		b[3] = uint8(octet)
+		end = netip.AddrFrom4(b)
+	}
+	end = end.Unmap()
+	if start.Is4() != end.Is4() {
+		return netip.Addr{}, fmt.Errorf("range mixes address families")
+	}
+	if end.Less(start) {
+		return netip.Addr{}, fmt.Errorf("range end before start")
+	}
+	return end, nil
+}
 
-		// Invalid - skip invalid entries as per plan robustness
+func validHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
 	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
 
-	return &Matcher{rules: rules}, nil
+// MatchesAddr reports whether an address rule covers addr. Hostname rules
+// never match an address.
+func (r Rule) MatchesAddr(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.WithZone("").Unmap()
+	switch r.Kind {
+	case KindIP:
+		return r.addr == addr
+	case KindCIDR:
+		return r.prefix.Contains(addr)
+	case KindRange:
+		return !addr.Less(r.addr) && !r.last.Less(addr)
+	}
+	return false
+}
+
+// MatchesHostname reports whether a hostname rule covers name. Matching is
+// case-insensitive; "*.example.com" matches any subdomain of example.com but
+// not example.com itself.
+func (r Rule) MatchesHostname(name string) bool {
+	if r.Kind != KindHostname {
+		return false
+	}
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if name == "" {
+		return false
+	}
+	if r.wildcard {
+		return strings.HasSuffix(name, "."+r.hostname)
+	}
+	return name == r.hostname
+}
+
+// Matches reports whether the rule covers a host by address or hostname.
+func (r Rule) Matches(addr netip.Addr, hostname string) bool {
+	if r.Kind == KindHostname {
+		return r.MatchesHostname(hostname)
+	}
+	return r.MatchesAddr(addr)
+}
+
+// NewMatcher builds a matcher from include definitions. Any definition that
+// does not parse is returned as an error.
+func NewMatcher(definitions []string) (*Matcher, error) {
+	rules := make([]Rule, 0, len(definitions))
+	for _, def := range definitions {
+		rule, err := ParseRule(def, RuleInclude)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return NewMatcherFromRules(rules), nil
+}
+
+// NewMatcherFromRules builds a matcher from parsed include and exclude rules.
+func NewMatcherFromRules(rules []Rule) *Matcher {
+	m := &Matcher{rules: rules}
+	for _, rule := range rules {
+		if rule.Type == RuleInclude {
+			m.hasIncludes = true
+		}
+		if rule.Kind == KindHostname {
+			m.hasHostnames = true
+		}
+	}
+	return m
+}
+
+// HasHostnameRules reports whether any rule matches on hostname, so callers
+// know whether a host's stored hostname is worth looking up.
+func (m *Matcher) HasHostnameRules() bool {
+	return m.hasHostnames
 }
 
 func (m *Matcher) InScope(ip string) bool {
+	return m.Match(ip, "")
+}
+
+// Match reports whether a host is in scope. Without include rules every host
+// is included; a matching exclude rule always wins.
+func (m *Matcher) Match(ip, hostname string) bool {
 	if len(m.rules) == 0 {
 		// No rules defined = everything in scope
 		return true
 	}
 
-	addr, err := netip.ParseAddr(ip)
-	if err != nil {
-		return false
-	}
-
+	addr, _ := netip.ParseAddr(strings.TrimSpace(ip))
+	included := !m.hasIncludes
 	for _, rule := range m.rules {
-		switch rule.Type {
-		case "cidr":
-			if rule.prefix.Contains(addr) {
-				return true
-			}
-		case "ip":
-			if rule.addr == addr {
-				return true
-			}
+		if !rule.Matches(addr, hostname) {
+			continue
+		}
+		if rule.Type == RuleExclude {
+			return false
 		}
+		included = true
 	}
-
-	return false
+	return included
 }
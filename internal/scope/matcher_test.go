@@ -1,6 +1,7 @@
 package scope
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -37,3 +38,87 @@ func TestMatcherEmpty(t *testing.T) {
 		t.Error("Empty matcher should include everything by default")
 	}
 }
+
+func mustRule(t *testing.T, def, typ string) Rule {
+	t.Helper()
+	rule, err := ParseRule(def, typ)
+	if err != nil {
+		t.Fatalf("ParseRule(%q, %q): %v", def, typ, err)
+	}
+	return rule
+}
+
+func TestMatcherIncludeExcludeRangesAndHostnames(t *testing.T) {
+	m := NewMatcherFromRules([]Rule{
+		mustRule(t, "10.0.0.0/16", RuleInclude),
+		mustRule(t, "10.0.5.0/24", RuleExclude),
+		mustRule(t, "192.168.1.10-192.168.1.40", RuleInclude),
+		mustRule(t, "172.16.0.5-9", ""),
+		mustRule(t, "*.corp.example.com", RuleInclude),
+		mustRule(t, "legacy.corp.example.com", RuleExclude),
+	})
+	if !m.HasHostnameRules() {
+		t.Fatalf("expected hostname rules to be reported")
+	}
+
+	tests := []struct {
+		ip, hostname string
+		want         bool
+	}{
+		{"10.0.4.1", "", true},
+		{"10.0.5.1", "", false},
+		{"10.0.5.1", "app.corp.example.com", false},
+		{"192.168.1.10", "", true},
+		{"192.168.1.40", "", true},
+		{"192.168.1.41", "", false},
+		{"172.16.0.9", "", true},
+		{"172.16.0.10", "", false},
+		{"8.8.8.8", "app.corp.example.com", true},
+		{"8.8.8.8", "APP.Corp.Example.com.", true},
+		{"8.8.8.8", "corp.example.com", false},
+		{"8.8.8.8", "legacy.corp.example.com", false},
+		{"8.8.8.8", "", false},
+	}
+	for _, tc := range tests {
+		if got := m.Match(tc.ip, tc.hostname); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v; want %v", tc.ip, tc.hostname, got, tc.want)
+		}
+	}
+}
+
+func TestMatcherExcludeOnly(t *testing.T) {
+	m := NewMatcherFromRules([]Rule{mustRule(t, "10.0.0.5", RuleExclude)})
+	if m.InScope("10.0.0.5") {
+		t.Error("excluded address should be out of scope")
+	}
+	if !m.InScope("10.0.0.6") {
+		t.Error("without include rules other addresses should stay in scope")
+	}
+}
+
+func TestParseRuleRejectsInvalidDefinitions(t *testing.T) {
+	for _, tc := range []struct{ def, typ string }{
+		{"10.0.0.0/33", RuleInclude},
+		{"10.0.0.40-10.0.0.10", RuleInclude},
+		{"10.0.0.1-300", RuleInclude},
+		{"10.0.0.1-2001:db8::1", RuleInclude},
+		{"not a host", RuleInclude},
+		{"", RuleInclude},
+		{"10.0.0.1", "maybe"},
+	} {
+		if _, err := ParseRule(tc.def, tc.typ); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("ParseRule(%q, %q) error = %v; want ErrInvalidRule", tc.def, tc.typ, err)
+		}
+	}
+	if _, err := NewMatcher([]string{"10.0.0.0/24", "bogus/rule"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("NewMatcher should return invalid definitions, got %v", err)
+	}
+}
+
+func TestParseRuleTreatsLegacyKindTypesAsInclude(t *testing.T) {
+	for _, typ := range []string{"", "ip", "cidr", "INCLUDE"} {
+		if rule := mustRule(t, "10.0.0.1", typ); rule.Type != RuleInclude {
+			t.Errorf("type %q normalized to %q", typ, rule.Type)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// apiListAuditEvents returns the project's audit log, newest first. Older
+// pages are fetched by passing the smallest id seen as before:
+//
+//	GET /projects/{id}/audit?host_id=12&before=340&limit=50
+func (s *Server) apiListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+
+	var q db.AuditQuery
+	for name, dst := range map[string]*int64{"host_id": &q.HostID, "before": &q.BeforeID} {
+		raw := strings.TrimSpace(r.URL.Query().Get(name))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 0 {
+			s.badRequest(w, fmt.Errorf("invalid %s", name))
+			return
+		}
+		*dst = value
+	}
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 1000 {
+			s.badRequest(w, fmt.Errorf("invalid limit"))
+			return
+		}
+		q.Limit = limit
+	}
+
+	events, err := s.DB.ListAuditEvents(projectID, q)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if events == nil {
+		events = []db.AuditEvent{}
+	}
+	s.jsonResponse(w, events, http.StatusOK)
+}
+
+// apiGetHostTimeline returns a host's audit events, scan observations and
+// scope transitions merged newest first.
+func (s *Server) apiGetHostTimeline(w http.ResponseWriter, r *http.Request) {
+	projectID, hostID, err := projectHostIDs(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	entries, err := s.DB.HostTimeline(projectID, hostID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("host not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, entries, http.StatusOK)
+}
@@ -0,0 +1,177 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// SessionCookieName is the cookie carrying a browser session.
+const SessionCookieName = "nmaptracker_session"
+
+// SessionTTL is how long a browser session stays valid after login.
+const SessionTTL = 7 * 24 * time.Hour
+
+type userContextKey struct{}
+
+// requestUser returns the authenticated user of a request. It reports false
+// when the server has no accounts and runs in single-user mode.
+func requestUser(r *http.Request) (db.User, bool) {
+	user, ok := r.Context().Value(userContextKey{}).(db.User)
+	return user, ok
+}
+
+// authenticate resolves the caller from a bearer token or session cookie.
+// Until the first account is created every request passes through
+// unauthenticated, as before accounts existed; afterwards everything except
+// login requires a user.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			scheme, token, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				s.errorResponse(w, fmt.Errorf("invalid authorization header"), http.StatusUnauthorized)
+				return
+			}
+			user, found, err := s.DB.GetAPITokenUser(strings.TrimSpace(token))
+			if err != nil {
+				s.serverError(w, err)
+				return
+			}
+			if !found {
+				s.errorResponse(w, fmt.Errorf("invalid api token"), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+			return
+		}
+
+		if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+			user, found, err := s.DB.GetSessionUser(cookie.Value)
+			if err != nil {
+				s.serverError(w, err)
+				return
+			}
+			if found {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+				return
+			}
+		}
+
+		enabled, err := s.DB.HasUsers()
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		if enabled && !isPublicAuthPath(r) {
+			s.errorResponse(w, fmt.Errorf("authentication required"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isPublicAuthPath lists the endpoints reachable without a session once
+// accounts exist.
+func isPublicAuthPath(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/auth/login", "/api/auth/me":
+		return true
+	default:
+		return false
+	}
+}
+
+// requireProjectRole rejects callers holding less than role on the project in
+// the {id} URL parameter. Non-members get 404 so project ids are not
+// disclosed.
+func (s *Server) requireProjectRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := requestUser(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			projectID, err := parseProjectID(r)
+			if err != nil {
+				s.badRequest(w, err)
+				return
+			}
+			have, member, err := s.DB.ProjectRole(user, projectID)
+			if err != nil {
+				s.serverError(w, err)
+				return
+			}
+			if !member {
+				s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
+				return
+			}
+			if !db.RoleAllows(have, role) {
+				s.errorResponse(w, fmt.Errorf("%s role required", role), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireWritableProject rejects changes to an archived project with 409.
+// It runs after requireProjectRole, so only members learn the project is
+// archived.
+func (s *Server) requireWritableProject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := parseProjectID(r)
+		if err != nil {
+			s.badRequest(w, err)
+			return
+		}
+		project, found, err := s.DB.GetProjectByID(projectID)
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		if !found {
+			s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
+			return
+		}
+		if project.Archived() {
+			s.errorResponse(w, db.ErrProjectArchived, http.StatusConflict)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireSiteAdmin limits account management to site admins.
+func (s *Server) requireSiteAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := requestUser(r); ok && !user.IsAdmin {
+			s.errorResponse(w, fmt.Errorf("site admin required"), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireUser rejects requests made in single-user mode, for endpoints that
+// only make sense for an account.
+func (s *Server) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestUser(r); !ok {
+			s.badRequest(w, fmt.Errorf("authentication is not enabled: create a user first"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseUserID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+}
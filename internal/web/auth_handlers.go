@@ -0,0 +1,310 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// apiLogin checks a username and password and starts a session cookie.
+func (s *Server) apiLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	user, err := s.DB.AuthenticateUser(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			s.errorResponse(w, err, http.StatusUnauthorized)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	token, expires, err := s.DB.CreateSession(user.ID, SessionTTL)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	s.jsonResponse(w, user, http.StatusOK)
+}
+
+// apiLogout ends the caller's browser session.
+func (s *Server) apiLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+		if err := s.DB.DeleteSession(cookie.Value); err != nil {
+			s.serverError(w, err)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiCurrentUser reports whether accounts are enabled and who is signed in.
+func (s *Server) apiCurrentUser(w http.ResponseWriter, r *http.Request) {
+	enabled, err := s.DB.HasUsers()
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	resp := map[string]interface{}{"auth_enabled": enabled, "user": nil}
+	if user, ok := requestUser(r); ok {
+		resp["user"] = user
+	}
+	s.jsonResponse(w, resp, http.StatusOK)
+}
+
+// apiListTokens returns the caller's API tokens without their secrets.
+func (s *Server) apiListTokens(w http.ResponseWriter, r *http.Request) {
+	user, _ := requestUser(r)
+	tokens, err := s.DB.ListAPITokens(user.ID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if tokens == nil {
+		tokens = []db.APIToken{}
+	}
+	s.jsonResponse(w, tokens, http.StatusOK)
+}
+
+// apiCreateToken issues a bearer token for the caller. The secret is only
+// shown in this response.
+func (s *Server) apiCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := requestUser(r)
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		s.badRequest(w, fmt.Errorf("token name is required"))
+		return
+	}
+	token, secret, err := s.DB.CreateAPIToken(user.ID, req.Name)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, map[string]interface{}{"token": token, "secret": secret}, http.StatusCreated)
+}
+
+// apiDeleteToken revokes one of the caller's tokens.
+func (s *Server) apiDeleteToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := requestUser(r)
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err := s.DB.DeleteAPIToken(user.ID, tokenID); err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("token not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.DB.ListUsers()
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if users == nil {
+		users = []db.User{}
+	}
+	s.jsonResponse(w, users, http.StatusOK)
+}
+
+// apiCreateUser adds an account. While no accounts exist every request is
+// unauthenticated, so the first account, which is always a site admin, can
+// only be created with `nmap-tracker users add`.
+func (s *Server) apiCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		IsAdmin  bool   `json:"is_admin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	enabled, err := s.DB.HasUsers()
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !enabled {
+		s.errorResponse(w, fmt.Errorf("create the first account with `nmap-tracker users add`"), http.StatusForbidden)
+		return
+	}
+	user, err := s.DB.CreateUser(req.Username, req.Password, req.IsAdmin)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidUsername) || errors.Is(err, db.ErrPasswordTooShort) {
+			s.badRequest(w, err)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, user, http.StatusCreated)
+}
+
+func (s *Server) apiSetUserPassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseUserID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err := s.DB.SetUserPassword(userID, req.Password); err != nil {
+		if errors.Is(err, db.ErrPasswordTooShort) {
+			s.badRequest(w, err)
+			return
+		}
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("user not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseUserID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if user, ok := requestUser(r); ok && user.ID == userID {
+		s.badRequest(w, fmt.Errorf("cannot delete your own account"))
+		return
+	}
+	if err := s.DB.DeleteUser(userID); err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("user not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiListMembers(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	members, err := s.DB.ListProjectMembers(projectID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if members == nil {
+		members = []db.ProjectMember{}
+	}
+	s.jsonResponse(w, members, http.StatusOK)
+}
+
+// apiSetMember grants a user a role on the project:
+//
+//	PUT /projects/{id}/members/{userID} {"role":"analyst"}
+func (s *Server) apiSetMember(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	userID, err := parseUserID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err := s.actorDB(r).SetProjectMember(projectID, userID, req.Role); err != nil {
+		if errors.Is(err, db.ErrInvalidRole) {
+			s.badRequest(w, err)
+			return
+		}
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("user not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, map[string]string{"role": req.Role}, http.StatusOK)
+}
+
+func (s *Server) apiDeleteMember(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	userID, err := parseUserID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err := s.actorDB(r).RemoveProjectMember(projectID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("member not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -73,7 +73,7 @@ func (s *Server) apiAddBaseline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	added, items, err := s.DB.BulkAddExpectedAssetBaselines(projectID, req.Definitions)
+	added, items, err := s.actorDB(r).BulkAddExpectedAssetBaselines(projectID, req.Definitions)
 	if err != nil {
 		if isBaselineValidationError(err) {
 			s.badRequest(w, err)
@@ -119,7 +119,7 @@ func (s *Server) apiDeleteBaseline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.DeleteExpectedAssetBaseline(projectID, baselineID); err != nil {
+	if err := s.actorDB(r).DeleteExpectedAssetBaseline(projectID, baselineID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			s.errorResponse(w, fmt.Errorf("baseline not found"), http.StatusNotFound)
 			return
@@ -165,6 +165,5 @@ func (s *Server) apiEvaluateBaseline(w http.ResponseWriter, r *http.Request) {
 
 func isBaselineValidationError(err error) bool {
 	return errors.Is(err, db.ErrInvalidBaselineDefinition) ||
-		errors.Is(err, db.ErrBaselineIPv6Unsupported) ||
 		errors.Is(err, db.ErrBaselineCIDRTooBroad)
 }
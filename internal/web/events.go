@@ -0,0 +1,174 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types published to live dashboard subscribers.
+const (
+	EventImportCompleted = "import.completed"
+	EventPortStatus      = "port.status"
+	EventPortNotes       = "port.notes"
+	EventScopeEvaluated  = "scope.evaluated"
+	EventImportIntents   = "import.intents"
+	EventImportJob       = "import.job"
+	EventImportDeleted   = "import.deleted"
+	EventImportReparsed  = "import.reparsed"
+)
+
+// eventBuffer is how many undelivered events a subscriber may hold before
+// newer ones are dropped for it.
+const eventBuffer = 32
+
+// eventKeepAlive is how often an idle stream sends a comment so proxies do
+// not close it.
+const eventKeepAlive = 25 * time.Second
+
+// Event is a change to a project that open pages may want to reflect.
+type Event struct {
+	Type      string      `json:"type"`
+	ProjectID int64       `json:"project_id"`
+	Actor     string      `json:"actor,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Time      time.Time   `json:"time"`
+}
+
+// Hub fans events out to subscribers of a project. Publishing never blocks:
+// a subscriber that falls behind misses events rather than stalling the
+// request that produced them.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan Event]struct{}
+	closed bool
+}
+
+// NewHub returns an empty hub.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int64]map[chan Event]struct{})}
+}
+
+// Subscribe registers for events of a project. The returned function must be
+// called to release the subscription.
+func (h *Hub) Subscribe(projectID int64) (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[projectID] == nil {
+		h.subs[projectID] = make(map[chan Event]struct{})
+	}
+	h.subs[projectID][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if _, ok := h.subs[projectID][ch]; !ok {
+				return
+			}
+			delete(h.subs[projectID], ch)
+			if len(h.subs[projectID]) == 0 {
+				delete(h.subs, projectID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers event to the project's current subscribers.
+func (h *Hub) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[event.ProjectID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription, letting open streams finish so the HTTP
+// server can shut down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for projectID, subs := range h.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(h.subs, projectID)
+	}
+}
+
+// publish records a change made by the request's caller.
+func (s *Server) publish(r *http.Request, projectID int64, eventType string, data interface{}) {
+	s.Events.Publish(Event{
+		Type:      eventType,
+		ProjectID: projectID,
+		Actor:     requestActor(r),
+		Data:      data,
+	})
+}
+
+// apiProjectEvents streams project changes as Server-Sent Events until the
+// client goes away or the server shuts down.
+func (s *Server) apiProjectEvents(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.serverError(w, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	events, unsubscribe := s.Events.Subscribe(projectID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n: connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
@@ -7,6 +7,9 @@ async function api(path, options = {}) {
         headers: { 'Content-Type': 'application/json', ...options.headers },
         ...options
     });
+    if (res.status === 401 && path !== '/auth/login') {
+        redirectToLogin();
+    }
     if (!res.ok) {
         const text = await res.text();
         throw new Error(text || res.statusText);
@@ -19,6 +22,40 @@ async function api(path, options = {}) {
     }
 }
 
+// Send the browser to the login page, returning here afterwards.
+function redirectToLogin() {
+    const next = window.location.pathname + window.location.search;
+    window.location.href = '/login.html?next=' + encodeURIComponent(next);
+}
+
+// Show the signed-in user and a sign-out link in the breadcrumb bar when
+// accounts are enabled.
+async function renderSessionBadge() {
+    const bar = document.querySelector('.breadcrumb');
+    if (!bar) return;
+    let me;
+    try {
+        me = await api('/auth/me');
+    } catch (e) {
+        return;
+    }
+    if (!me || !me.auth_enabled || !me.user) return;
+
+    const badge = el('span', 'session-badge');
+    badge.appendChild(el('span', 'current', me.user.username));
+    const logout = el('a', null, 'Sign out');
+    logout.href = '#';
+    logout.addEventListener('click', async (e) => {
+        e.preventDefault();
+        await api('/auth/logout', { method: 'POST' });
+        window.location.href = '/login.html';
+    });
+    badge.appendChild(logout);
+    bar.appendChild(badge);
+}
+
+document.addEventListener('DOMContentLoaded', renderSessionBadge);
+
 // Get URL params
 function getParam(name) {
     return new URLSearchParams(window.location.search).get(name);
@@ -93,24 +130,11 @@ function makeSortable(table) {
                 const aVal = aCell.textContent.trim();
                 const bVal = bCell.textContent.trim();
 
-                // IP Address Sort
-                const isIp = (str) => /^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$/.test(str);
-
-                // Helper to extract IP if it's inside a link or mixed content
-                // But textContent usually returns just the text, e.g. "192.168.1.1".
-                // Sometimes it might have newlines if complex. 
-                // Let's assume the cell starts with an IP or is an IP.
-
-                // Better approach: Check if it LOOKS like an IP (IPv4)
-                const ipRegex = /(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})/;
-                const aIpMatch = aVal.match(ipRegex);
-                const bIpMatch = bVal.match(ipRegex);
-
-                if (aIpMatch && bIpMatch) {
-                    const ipToNum = (ip) => {
-                        return ip.split('.').reduce((acc, octet) => (acc << 8) + parseInt(octet, 10), 0) >>> 0;
-                    };
-                    return (ipToNum(aIpMatch[0]) - ipToNum(bIpMatch[0])) * direction;
+                // IP Address Sort (IPv4 and IPv6; IPv4 sorts first, matching the server)
+                const aKey = ipSortKey(aVal);
+                const bKey = ipSortKey(bVal);
+                if (aKey && bKey) {
+                    return aKey.localeCompare(bKey) * direction;
                 }
 
                 // Try numeric sort first
@@ -130,6 +154,37 @@ function makeSortable(table) {
     });
 }
 
+// ipSortKey returns a fixed-width hex key for the address at the start of a
+// cell, mirroring the server-side ip_key (IPv4 stored in IPv4-mapped form).
+function ipSortKey(text) {
+    const v4 = text.match(/^(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})\b/);
+    if (v4) {
+        return '00000000000000000000ffff' + v4.slice(1)
+            .map(octet => parseInt(octet, 10).toString(16).padStart(2, '0'))
+            .join('');
+    }
+
+    const candidate = text.split(/\s/)[0].split('%')[0];
+    if (!candidate.includes(':') || !/^[0-9a-fA-F:]+$/.test(candidate)) {
+        return null;
+    }
+    const halves = candidate.split('::');
+    if (halves.length > 2) {
+        return null;
+    }
+    const head = halves[0] ? halves[0].split(':') : [];
+    const tail = halves.length === 2 && halves[1] ? halves[1].split(':') : [];
+    const missing = 8 - head.length - tail.length;
+    if (missing < 0 || (halves.length === 1 && missing !== 0)) {
+        return null;
+    }
+    const groups = [...head, ...Array(missing).fill('0'), ...tail];
+    if (groups.some(group => group.length === 0 || group.length > 4)) {
+        return null;
+    }
+    return groups.map(group => group.toLowerCase().padStart(4, '0')).join('');
+}
+
 function escapeHtml(unsafe) {
     if (!unsafe) return '';
     return unsafe
@@ -157,6 +212,37 @@ function debounce(func, wait) {
     return executedFunction;
 }
 
+// Live project updates. Calls onEvent(type, event) for each change published
+// on the project's Server-Sent Events stream; the browser reconnects on its
+// own if the stream drops.
+const PROJECT_EVENT_TYPES = ['import.completed', 'import.job', 'import.deleted', 'import.reparsed', 'port.status', 'port.notes', 'scope.evaluated', 'import.intents'];
+
+function subscribeProjectEvents(projectId, onEvent) {
+    if (!projectId || typeof EventSource === 'undefined') return null;
+    const source = new EventSource(`/api/projects/${projectId}/events`);
+    PROJECT_EVENT_TYPES.forEach(type => {
+        source.addEventListener(type, (e) => {
+            let event = {};
+            try {
+                event = JSON.parse(e.data);
+            } catch (err) {
+                console.error('Bad project event', err);
+                return;
+            }
+            onEvent(type, event);
+        });
+    });
+    window.addEventListener('beforeunload', () => source.close());
+    return source;
+}
+
+// isEditing reports whether the user is typing in a field, so live updates
+// do not re-render it away.
+function isEditing() {
+    const active = document.activeElement;
+    return !!active && (active.tagName === 'TEXTAREA' || (active.tagName === 'INPUT' && active.type === 'text'));
+}
+
 function openModal(title, content) {
     const modal = document.getElementById('content-modal');
     if (!modal) return;
@@ -265,6 +265,12 @@ function segmentSubnet(segmentKey, segmentLabel) {
     if (/^\d+\.\d+\.\d+\.\d+$/.test(segmentLabel)) {
         return `${segmentLabel}/32`;
     }
+    if (/^[0-9a-fA-F:]+\/\d+$/.test(segmentLabel)) {
+        return segmentLabel;
+    }
+    if (/^[0-9a-fA-F:]+$/.test(segmentLabel) && segmentLabel.includes(':')) {
+        return `${segmentLabel}/128`;
+    }
     return '';
 }
 
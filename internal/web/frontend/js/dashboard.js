@@ -346,6 +346,10 @@ document.addEventListener('DOMContentLoaded', async () => {
         document.getElementById('nav-project-name').textContent = project.Name;
         document.getElementById('nav-project-name').href = `project.html?id=${projectId}`;
         document.getElementById('project-title').textContent = project.Name;
+        if (project.ArchivedAt) {
+            document.getElementById('project-archived').style.display = 'inline-block';
+            document.getElementById('edit-project-name').style.display = 'none';
+        }
 
         document.getElementById('view-hosts-btn').href = `hosts.html?id=${projectId}`;
         document.getElementById('view-all-scans-btn').href = `scan_results.html?id=${projectId}`;
@@ -394,6 +398,20 @@ document.addEventListener('DOMContentLoaded', async () => {
         }
         loadImportIntents();
 
+        const refreshStats = debounce(loadDashboardStats, 500);
+        const refreshIntents = debounce(loadImportIntents, 500);
+        const refreshScope = debounce(loadScopeRules, 500);
+        subscribeProjectEvents(projectId, (type) => {
+            if (type === 'import.job') return;
+            refreshStats();
+            if (type === 'import.completed' || type === 'import.intents' || type === 'import.deleted' || type === 'import.reparsed') {
+                if (!isEditing()) refreshIntents();
+            }
+            if (type === 'scope.evaluated') {
+                refreshScope();
+            }
+        });
+
     } catch (err) {
         console.error(err);
         document.getElementById('error-msg').textContent = err.message;
@@ -499,6 +517,13 @@ function renderImportIntents(items) {
 
         const timeTd = document.createElement('td');
         timeTd.textContent = importTime;
+        if (item.scan_started_at || item.scan_finished_at) {
+            const scanMeta = document.createElement('div');
+            scanMeta.style.fontSize = '12px';
+            scanMeta.style.color = 'var(--text-dim)';
+            scanMeta.textContent = `Scanned: ${new Date(item.scan_started_at || item.scan_finished_at).toLocaleString()}`;
+            timeTd.appendChild(scanMeta);
+        }
 
         const fileTd = document.createElement('td');
         const fileName = document.createElement('div');
@@ -509,7 +534,7 @@ function renderImportIntents(items) {
         const scannerMeta = document.createElement('div');
         scannerMeta.style.fontSize = '12px';
         scannerMeta.style.color = 'var(--text-dim)';
-        scannerMeta.textContent = `Scanner: ${item.scanner_label || '-'}`;
+        scannerMeta.textContent = `Scanner: ${item.scanner_type || 'nmap'}${item.scanner_label ? ` (${item.scanner_label})` : ''}`;
         fileTd.appendChild(scannerMeta);
 
         const sourceIPMeta = document.createElement('div');
@@ -524,6 +549,39 @@ function renderImportIntents(items) {
         sourcePortMeta.textContent = `Source Port: ${formatSourcePortDisplay(item.source_port, item.source_port_raw)}`;
         fileTd.appendChild(sourcePortMeta);
 
+        const deleteBtn = document.createElement('button');
+        deleteBtn.type = 'button';
+        deleteBtn.className = 'btn btn-danger';
+        deleteBtn.style.marginTop = '6px';
+        deleteBtn.style.padding = '2px 8px';
+        deleteBtn.style.fontSize = '12px';
+        deleteBtn.textContent = 'Delete import';
+        deleteBtn.addEventListener('click', () => deleteImport(item.id, item.filename));
+        fileTd.appendChild(deleteBtn);
+
+        if (item.raw_available) {
+            const rawLink = document.createElement('a');
+            rawLink.className = 'btn btn-secondary';
+            rawLink.style.marginTop = '6px';
+            rawLink.style.marginLeft = '6px';
+            rawLink.style.padding = '2px 8px';
+            rawLink.style.fontSize = '12px';
+            rawLink.href = `/api/projects/${getProjectId()}/imports/${item.id}/raw`;
+            rawLink.textContent = 'Raw file';
+            fileTd.appendChild(rawLink);
+
+            const reparseBtn = document.createElement('button');
+            reparseBtn.type = 'button';
+            reparseBtn.className = 'btn btn-secondary';
+            reparseBtn.style.marginTop = '6px';
+            reparseBtn.style.marginLeft = '6px';
+            reparseBtn.style.padding = '2px 8px';
+            reparseBtn.style.fontSize = '12px';
+            reparseBtn.textContent = 'Reparse';
+            reparseBtn.addEventListener('click', () => reparseImport(item.id, item.filename));
+            fileTd.appendChild(reparseBtn);
+        }
+
         const argsTd = document.createElement('td');
         argsTd.appendChild(buildNmapArgsElement(item.nmap_args || ''));
 
@@ -561,6 +619,40 @@ function renderImportIntents(items) {
     });
 }
 
+// deleteImport removes an import; the server rebuilds the hosts and ports it
+// touched from the remaining imports.
+async function deleteImport(importId, filename) {
+    if (!confirm(`Delete import ${importId} (${filename})? Hosts and ports are rebuilt from the remaining imports; notes and work status are kept.`)) return;
+
+    try {
+        const result = await api(`/projects/${getProjectId()}/imports/${importId}`, {
+            method: 'DELETE'
+        });
+        showToast(`Import ${importId} deleted: ${result.hosts_rebuilt} hosts rebuilt, ${result.hosts_removed} removed`, 'success');
+        loadDashboardStats();
+        loadImportIntents();
+    } catch (err) {
+        showToast(err.message, 'error');
+    }
+}
+
+// reparseImport parses an import's stored file again with the current
+// importer; the server rebuilds the hosts and ports it touches.
+async function reparseImport(importId, filename) {
+    if (!confirm(`Reparse import ${importId} (${filename}) from its stored file? Its observations are replaced; notes and work status are kept.`)) return;
+
+    try {
+        const result = await api(`/projects/${getProjectId()}/imports/${importId}/reparse`, {
+            method: 'POST'
+        });
+        showToast(`Import ${importId} reparsed: ${result.hosts_found} hosts, ${result.ports_found} ports (was ${result.hosts_before}/${result.ports_before})`, 'success');
+        loadDashboardStats();
+        loadImportIntents();
+    } catch (err) {
+        showToast(err.message, 'error');
+    }
+}
+
 function buildNmapArgsElement(args) {
     const wrapper = document.createElement('div');
     wrapper.style.maxWidth = '100%';
@@ -747,7 +839,7 @@ async function addBaseline() {
         .map(line => line.trim())
         .filter(line => line.length > 0);
     if (definitions.length === 0) {
-        showToast('Enter at least one IPv4 address or CIDR', 'error');
+        showToast('Enter at least one IP address or CIDR', 'error');
         return;
     }
 
@@ -869,16 +961,17 @@ async function addScopeRules() {
         .filter(l => l.length > 0);
 
     if (lines.length === 0) {
-        showToast('Enter at least one IP or CIDR', 'error');
+        showToast('Enter at least one IP, CIDR, range or hostname', 'error');
         return;
     }
 
     const projectId = getProjectId();
+    const type = document.getElementById('scope-type').value;
 
     try {
         const result = await api(`/projects/${projectId}/scope`, {
             method: 'POST',
-            body: JSON.stringify({ definitions: lines })
+            body: JSON.stringify({ definitions: lines, type })
         });
 
         showToast(`Added ${result.added} scope rule(s)`, 'success');
@@ -949,16 +1042,23 @@ function setupImport() {
     });
 }
 
+const IMPORT_EXTENSIONS = ['.xml', '.gnmap', '.json', '.jsonl', '.txt'];
+
+function isImportableFile(name) {
+    const lower = name.toLowerCase();
+    return IMPORT_EXTENSIONS.some(ext => lower.endsWith(ext));
+}
+
 function handleFiles(files) {
     const validFiles = [];
     for (let i = 0; i < files.length; i++) {
-        if (files[i].name.endsWith('.xml')) {
+        if (isImportableFile(files[i].name)) {
             validFiles.push(files[i]);
         }
     }
 
     if (validFiles.length === 0) {
-        showToast('Please select at least one XML file', 'error');
+        showToast('Please select at least one Nmap, masscan, naabu or rustscan output file', 'error');
         return;
     }
 
@@ -979,6 +1079,32 @@ function clearImport() {
     document.getElementById('import-status').style.display = 'none';
 }
 
+// waitForImportJobs polls queued import jobs until each is done or failed,
+// passing the unfinished ones to onProgress after every round.
+async function waitForImportJobs(projectId, jobs, onProgress) {
+    const finished = [];
+    let pending = jobs.slice();
+    while (pending.length > 0) {
+        onProgress(pending);
+        await new Promise(resolve => setTimeout(resolve, 1000));
+        const next = [];
+        for (const job of pending) {
+            try {
+                const current = await api(`/projects/${projectId}/imports/jobs/${job.id}`);
+                if (current.status === 'done' || current.status === 'failed') {
+                    finished.push(current);
+                } else {
+                    next.push(current);
+                }
+            } catch (err) {
+                finished.push({ ...job, status: 'failed', error: err.message });
+            }
+        }
+        pending = next;
+    }
+    return finished;
+}
+
 async function uploadFile() {
     if (selectedFiles.length === 0) return;
 
@@ -986,50 +1112,111 @@ async function uploadFile() {
     const scannerLabel = (document.getElementById('import-scanner-label')?.value || '').trim();
     const sourceIP = (document.getElementById('import-source-ip')?.value || '').trim();
     const sourcePort = (document.getElementById('import-source-port')?.value || '').trim();
+    const scanArgs = (document.getElementById('import-scan-args')?.value || '').trim();
     document.getElementById('import-status').style.display = 'none';
     document.getElementById('import-progress').style.display = 'block';
 
     let totalHosts = 0;
     let totalPorts = 0;
     const errors = [];
+    const macChanges = [];
 
-    for (let i = 0; i < selectedFiles.length; i++) {
-        const file = selectedFiles[i];
-
-        const statusText = document.getElementById('import-progress').querySelector('p');
-        if (statusText) {
-            statusText.textContent = `Importing ${i + 1} of ${selectedFiles.length}...`;
-        }
+    const statusText = document.getElementById('import-progress').querySelector('p');
 
+    // submit queues one file and returns its job, or {duplicate} when the
+    // project already holds the same scan.
+    const submit = async (file, force) => {
         const formData = new FormData();
-        formData.append('file', file);
         if (scannerLabel) formData.append('scanner_label', scannerLabel);
         if (sourceIP) formData.append('source_ip', sourceIP);
         if (sourcePort) formData.append('source_port', sourcePort);
+        if (scanArgs) formData.append('scan_args', scanArgs);
+        if (force) formData.append('force', 'true');
+        formData.append('file', file);
 
-        try {
-            const response = await fetch(`/api/projects/${projectId}/import`, {
-                method: 'POST',
-                body: formData
-            });
+        const response = await fetch(`/api/projects/${projectId}/imports/jobs`, {
+            method: 'POST',
+            body: formData
+        });
+        if (response.status === 401) {
+            redirectToLogin();
+        }
+        if (response.status === 409) {
+            const body = await response.json();
+            return { duplicate: body.error };
+        }
+        if (!response.ok) {
+            const text = await response.text();
+            throw new Error(text || 'Upload failed');
+        }
+        return response.json();
+    };
 
-            if (!response.ok) {
-                const text = await response.text();
-                throw new Error(text || 'Import failed');
+    // Uploads are spooled by the server and imported in the background;
+    // queue every file first, then follow the jobs. Files the project
+    // already holds are collected and, if confirmed, sent again with force.
+    const importFiles = async (files, force) => {
+        const jobs = [];
+        const duplicates = [];
+        for (let i = 0; i < files.length; i++) {
+            const file = files[i];
+            if (statusText) {
+                statusText.textContent = `Uploading ${i + 1} of ${files.length}...`;
+            }
+            try {
+                const job = await submit(file, force);
+                if (job.duplicate) {
+                    duplicates.push({ file, message: job.duplicate });
+                } else {
+                    jobs.push({ ...job, file });
+                }
+            } catch (err) {
+                console.error(`Failed to upload ${file.name}:`, err);
+                errors.push(`${file.name}: ${err.message}`);
             }
+        }
 
-            const result = await response.json();
-            totalHosts += result.hosts_imported;
-            totalPorts += result.ports_imported;
+        const finished = await waitForImportJobs(projectId, jobs, (pending) => {
+            if (!statusText) return;
+            statusText.textContent = pending
+                .map(job => `${job.filename}: ${job.status} (${job.hosts_processed} hosts)`)
+                .join(' · ');
+        });
+        finished.forEach(job => {
+            const file = jobs.find(queued => queued.id === job.id)?.file;
+            if (job.status === 'failed' && job.duplicate_of && file) {
+                duplicates.push({ file, message: job.error });
+                return;
+            }
+            if (job.status === 'failed') {
+                errors.push(`${job.filename}: ${job.error || 'import failed'}`);
+                return;
+            }
+            totalHosts += job.hosts_processed;
+            totalPorts += job.ports_processed;
+            (job.mac_changes || []).forEach(change => {
+                macChanges.push(`${change.ip_address}: ${change.previous_mac} → ${change.mac_address}`);
+            });
+        });
+        return duplicates;
+    };
 
-        } catch (err) {
-            console.error(`Failed to import ${file.name}:`, err);
-            errors.push(`${file.name}: ${err.message}`);
+    const duplicates = await importFiles(selectedFiles, false);
+    if (duplicates.length > 0) {
+        const list = duplicates.map(d => `${d.file.name}: ${d.message}`).join('\n');
+        if (confirm(`Already imported into this project:\n\n${list}\n\nImport again anyway?`)) {
+            await importFiles(duplicates.map(d => d.file), true);
+        } else {
+            duplicates.forEach(d => errors.push(`${d.file.name}: already imported`));
         }
     }
 
     document.getElementById('import-progress').style.display = 'none';
 
+    if (macChanges.length > 0) {
+        showToast(`MAC address changed for ${macChanges.length} known host(s): ${macChanges.join(', ')}`, 'warning');
+    }
+
     if (errors.length > 0) {
         if (totalHosts > 0) {
             showToast(`Imported ${totalHosts} hosts, ${totalPorts} ports. Failures: ${errors.join(', ')}`, 'warning');
@@ -43,6 +43,13 @@ document.addEventListener('DOMContentLoaded', async () => {
         osGuess.textContent = host.OSGuess || 'OS Unknown';
         meta.appendChild(scopeBadge);
         meta.appendChild(osGuess);
+        if (host.MACAddress) {
+            const mac = document.createElement('span');
+            mac.style.color = 'var(--text-muted)';
+            mac.style.marginLeft = '10px';
+            mac.textContent = host.MACVendor ? `MAC ${host.MACAddress} (${host.MACVendor})` : `MAC ${host.MACAddress}`;
+            meta.appendChild(mac);
+        }
 
         document.getElementById('host-notes').value = host.Notes || '';
         let lastHostNotes = host.Notes || '';
@@ -114,6 +121,21 @@ document.addEventListener('DOMContentLoaded', async () => {
 
         // Load Ports
         loadPorts(projectId, hostId);
+        loadHostScripts(projectId, hostId);
+        loadHostTimeline(projectId, hostId);
+
+        const refreshHost = debounce(() => {
+            if (isEditing()) return;
+            loadPorts(projectId, hostId);
+            loadHostTimeline(projectId, hostId);
+        }, 500);
+        subscribeProjectEvents(projectId, (type, event) => {
+            const data = event.data || {};
+            const hostMatches = data.host_id === undefined || String(data.host_id) === String(hostId);
+            if (type === 'import.completed' || type === 'scope.evaluated' || (type.startsWith('port.') && hostMatches)) {
+                refreshHost();
+            }
+        });
 
     } catch (err) {
         document.getElementById('error-msg').textContent = err.message;
@@ -133,6 +155,137 @@ async function loadPorts(projectId, hostId) {
     }
 }
 
+async function loadHostScripts(projectId, hostId) {
+    try {
+        const results = await api(`/projects/${projectId}/hosts/${hostId}/scripts`);
+        renderHostScripts((results || []).filter(r => r.PortNumber === 0));
+    } catch (err) {
+        document.getElementById('error-msg').textContent = err.message;
+        document.getElementById('error-msg').style.display = 'block';
+    }
+}
+
+async function loadHostTimeline(projectId, hostId) {
+    try {
+        const entries = await api(`/projects/${projectId}/hosts/${hostId}/timeline`);
+        renderHostTimeline(entries || []);
+    } catch (err) {
+        document.getElementById('error-msg').textContent = err.message;
+        document.getElementById('error-msg').style.display = 'block';
+    }
+}
+
+// renderHostTimeline interleaves analyst changes with the scans that saw the
+// host and its scope transitions, newest first.
+function renderHostTimeline(entries) {
+    const card = document.getElementById('host-timeline-card');
+    const tbody = document.getElementById('host-timeline-list');
+    tbody.textContent = '';
+    if (entries.length === 0) {
+        card.style.display = 'none';
+        return;
+    }
+    card.style.display = 'block';
+
+    entries.forEach(entry => {
+        const row = document.createElement('tr');
+        let label = entry.Kind;
+        let details = '';
+        let actor = '';
+        if (entry.Kind === 'audit' && entry.Audit) {
+            label = entry.Audit.Action;
+            details = describeAuditChange(entry.Audit.Before, entry.Audit.After);
+            actor = entry.Audit.Actor;
+        } else if (entry.Kind === 'observation' && entry.Observation) {
+            label = 'Observed';
+            details = `${entry.Observation.Filename}: host ${entry.Observation.HostState || 'seen'}, ${entry.Observation.OpenPorts} open port(s)`;
+        } else if (entry.Kind === 'scope' && entry.ScopeTransition) {
+            label = 'Scope';
+            const t = entry.ScopeTransition;
+            details = `${t.FromInScope ? 'in' : 'out of'} scope → ${t.ToInScope ? 'in' : 'out of'} scope (${t.Reason})`;
+        }
+        row.appendChild(el('td', '', new Date(entry.Time).toLocaleString()));
+        row.appendChild(el('td', '', label));
+        row.appendChild(el('td', '', details));
+        row.appendChild(el('td', '', actor || '—'));
+        tbody.appendChild(row);
+    });
+}
+
+function describeAuditChange(before, after) {
+    const fields = new Set([...Object.keys(before || {}), ...Object.keys(after || {})]);
+    fields.delete('port');
+    const port = (after && after.port) || (before && before.port);
+    const parts = [];
+    fields.forEach(field => {
+        const from = before ? before[field] : undefined;
+        const to = after ? after[field] : undefined;
+        if (from === undefined) {
+            parts.push(`${field}: ${JSON.stringify(to)}`);
+        } else if (to === undefined) {
+            parts.push(`${field} was ${JSON.stringify(from)}`);
+        } else {
+            parts.push(`${field}: ${JSON.stringify(from)} → ${JSON.stringify(to)}`);
+        }
+    });
+    const text = parts.join(', ') || (after ? 'created' : 'deleted');
+    return port ? `${port} ${text}` : text;
+}
+
+// renderHostScripts lists <hostscript> results (smb-os-discovery and the like),
+// which have no port row to hang off.
+function renderHostScripts(scripts) {
+    const card = document.getElementById('host-scripts-card');
+    const list = document.getElementById('host-scripts-list');
+    list.textContent = '';
+    if (scripts.length === 0) {
+        card.style.display = 'none';
+        return;
+    }
+    card.style.display = 'block';
+
+    scripts.forEach(script => {
+        const container = document.createElement('div');
+        container.className = 'script-output-container';
+
+        const header = document.createElement('div');
+        header.className = 'script-output-header';
+        header.style.cursor = 'pointer';
+        header.addEventListener('click', () => {
+            container.classList.toggle('open');
+        });
+
+        const label = document.createElement('span');
+        label.className = 'script-output-label';
+        label.textContent = script.ScriptID;
+
+        const viewBtn = document.createElement('button');
+        viewBtn.className = 'btn-icon';
+        viewBtn.title = 'View Parsed';
+        viewBtn.textContent = '⤢';
+        viewBtn.addEventListener('click', (e) => {
+            e.stopPropagation();
+            const parsed = script.Elements ? `\n\n${JSON.stringify(script.Elements, null, 2)}` : '';
+            openModal(script.ScriptID, `${script.Output}${parsed}`);
+        });
+
+        header.appendChild(label);
+        header.appendChild(viewBtn);
+
+        const body = document.createElement('div');
+        body.className = 'script-output-body';
+        body.style.display = 'none';
+        const pre = document.createElement('pre');
+        pre.className = 'script-output-content';
+        pre.textContent = script.Output;
+        body.appendChild(pre);
+
+        container.appendChild(header);
+        container.appendChild(body);
+        list.appendChild(container);
+    });
+}
+
 function renderPorts(allPorts, projectId, hostId) {
     const tbody = document.getElementById('ports-list');
     tbody.innerHTML = '';
@@ -164,6 +317,9 @@ function renderPorts(allPorts, projectId, hostId) {
         const badge = document.createElement('span');
         badge.className = `badge ${stateBadgeClass(p.State)}`;
         badge.textContent = p.State;
+        if (p.NotObservedAt) {
+            badge.title = `Not reported by a covering scan since ${new Date(p.NotObservedAt).toLocaleString()}`;
+        }
         tdState.appendChild(badge);
 
         const tdService = document.createElement('td');
@@ -346,6 +502,8 @@ function stateBadgeClass(state) {
         case 'closed|filtered':
         case 'unfiltered':
             return 'badge-filtered';
+        case 'not_observed':
+            return 'badge-not-observed';
         default:
             return 'badge-filtered';
     }
@@ -22,6 +22,13 @@ document.addEventListener('DOMContentLoaded', async () => {
 
         await loadHosts();
 
+        const refreshHosts = debounce(() => {
+            if (!isEditing()) loadHosts();
+        }, 500);
+        subscribeProjectEvents(projectId, (type) => {
+            if (type !== 'port.notes' && type !== 'import.job') refreshHosts();
+        });
+
         document.getElementById('filter-form').addEventListener('submit', (e) => {
             e.preventDefault();
             currentPage = 1;
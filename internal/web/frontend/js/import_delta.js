@@ -36,6 +36,9 @@ document.addEventListener('DOMContentLoaded', async () => {
 async function loadImports(projectId) {
     const payload = await api(`/projects/${projectId}/imports`);
     importsCache = (payload && payload.items) ? payload.items : [];
+    // Order by when the scan ran, not when it was uploaded, so an old scan
+    // imported late does not become the default target.
+    importsCache.sort((a, b) => scanTimeOf(a).localeCompare(scanTimeOf(b)) || a.id - b.id);
 
     const baseSelect = document.getElementById('base-import-select');
     const targetSelect = document.getElementById('target-import-select');
@@ -61,7 +64,7 @@ async function loadImports(projectId) {
         targetSelect.appendChild(targetOption);
     });
 
-    // Default: target latest, base previous.
+    // Default: target latest scan, base the scan before it.
     targetSelect.value = String(importsCache[importsCache.length - 1].id);
     baseSelect.value = String(importsCache[importsCache.length - 2].id);
 
@@ -69,8 +72,13 @@ async function loadImports(projectId) {
     await compareSelectedImports(projectId);
 }
 
+function scanTimeOf(item) {
+    return item.scan_time || item.import_time || '';
+}
+
 function formatImportLabel(item) {
-    const dt = item.import_time ? new Date(item.import_time).toLocaleString() : 'unknown time';
+    const raw = scanTimeOf(item);
+    const dt = raw ? new Date(raw).toLocaleString() : 'unknown time';
     return `#${item.id} - ${item.filename || 'import'} (${dt})`;
 }
 
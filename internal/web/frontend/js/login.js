@@ -0,0 +1,24 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const form = document.getElementById('login-form');
+    const errorMsg = document.getElementById('error-msg');
+
+    form.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        errorMsg.textContent = '';
+        try {
+            await api('/auth/login', {
+                method: 'POST',
+                body: JSON.stringify({
+                    username: document.getElementById('username').value,
+                    password: document.getElementById('password').value
+                })
+            });
+        } catch (err) {
+            errorMsg.textContent = err.message;
+            return;
+        }
+        // Only follow same-site relative paths.
+        const next = getParam('next') || '/';
+        window.location.href = next.startsWith('/') && !next.startsWith('//') ? next : '/';
+    });
+});
@@ -43,9 +43,12 @@ document.addEventListener('DOMContentLoaded', () => {
     makeSortable(document.querySelector('table'));
 });
 
+let loadedProjects = [];
+
 async function loadProjects() {
     try {
         const projects = await api('/projects');
+        loadedProjects = projects || [];
         const tbody = document.getElementById('projects-list');
         tbody.innerHTML = '';
 
@@ -61,22 +64,26 @@ async function loadProjects() {
                 link.href = `project.html?id=${p.ID}`;
                 link.textContent = p.Name;
                 tdName.appendChild(link);
+                if (p.ArchivedAt) {
+                    const badge = document.createElement('span');
+                    badge.className = 'badge badge-archived';
+                    badge.textContent = 'archived';
+                    badge.title = `Archived ${new Date(p.ArchivedAt).toLocaleString()}; read-only`;
+                    badge.style.marginLeft = '8px';
+                    tdName.appendChild(badge);
+                }
 
                 const tdDate = document.createElement('td');
                 tdDate.textContent = new Date(p.CreatedAt).toLocaleString();
 
                 const tdActions = document.createElement('td');
-                const delBtn = document.createElement('a'); // Changed to link style or button with class
-                delBtn.href = "#";
-                delBtn.textContent = 'Delete';
-                delBtn.className = 'btn btn-danger';
-                delBtn.style.padding = '4px 8px';
-                delBtn.style.fontSize = '12px';
-                delBtn.onclick = (e) => {
-                    e.preventDefault();
-                    deleteProject(p.ID, p.Name);
-                };
-                tdActions.appendChild(delBtn);
+                if (!p.ArchivedAt) {
+                    tdActions.appendChild(actionButton('Rename', 'btn-secondary', () => renameProject(p)));
+                    tdActions.appendChild(actionButton('Merge into…', 'btn-secondary', () => mergeProject(p)));
+                }
+                tdActions.appendChild(actionButton('Clone', 'btn-secondary', () => cloneProject(p)));
+                tdActions.appendChild(actionButton(p.ArchivedAt ? 'Unarchive' : 'Archive', 'btn-secondary', () => setArchived(p, !p.ArchivedAt)));
+                tdActions.appendChild(actionButton('Delete', 'btn-danger', () => deleteProject(p.ID, p.Name)));
 
                 tr.appendChild(tdId);
                 tr.appendChild(tdName);
@@ -90,6 +97,79 @@ async function loadProjects() {
     }
 }
 
+function actionButton(label, className, onClick) {
+    const btn = document.createElement('a');
+    btn.href = '#';
+    btn.textContent = label;
+    btn.className = `btn ${className}`;
+    btn.style.padding = '4px 8px';
+    btn.style.fontSize = '12px';
+    btn.style.marginRight = '4px';
+    btn.onclick = (e) => {
+        e.preventDefault();
+        onClick();
+    };
+    return btn;
+}
+
+async function renameProject(project) {
+    const name = (prompt(`Rename project "${project.Name}" to:`, project.Name) || '').trim();
+    if (!name || name === project.Name) return;
+    try {
+        await api(`/projects/${project.ID}`, { method: 'PUT', body: JSON.stringify({ name }) });
+        loadProjects();
+    } catch (err) {
+        showError(err.message);
+    }
+}
+
+async function cloneProject(project) {
+    const name = (prompt(`Clone the scope and baseline of "${project.Name}" (no scan data) into a new project named:`, `${project.Name} (retest)`) || '').trim();
+    if (!name) return;
+    try {
+        await api(`/projects/${project.ID}/clone`, { method: 'POST', body: JSON.stringify({ name }) });
+        loadProjects();
+    } catch (err) {
+        showError(err.message);
+    }
+}
+
+async function setArchived(project, archived) {
+    if (archived && !confirm(`Archive project "${project.Name}"? It becomes read-only until unarchived.`)) return;
+    try {
+        await api(`/projects/${project.ID}/archive`, { method: archived ? 'POST' : 'DELETE' });
+        loadProjects();
+    } catch (err) {
+        showError(err.message);
+    }
+}
+
+async function mergeProject(source) {
+    const others = loadedProjects.filter(p => p.ID !== source.ID && !p.ArchivedAt);
+    if (others.length === 0) {
+        showError('No other active project to merge into.');
+        return;
+    }
+    const targetName = (prompt(`Merge "${source.Name}" into which project?\n${others.map(p => p.Name).join('\n')}`) || '').trim();
+    if (!targetName) return;
+    const target = others.find(p => p.Name === targetName);
+    if (!target) {
+        showError(`Project "${targetName}" not found.`);
+        return;
+    }
+    if (!confirm(`Merge "${source.Name}" into "${target.Name}"? Hosts are combined by IP and "${source.Name}" is deleted.`)) return;
+    try {
+        const result = await api(`/projects/${target.ID}/merge`, {
+            method: 'POST',
+            body: JSON.stringify({ source_project_id: source.ID })
+        });
+        loadProjects();
+        alert(`Merged ${result.imports} imports: ${result.hosts_moved} hosts moved, ${result.hosts_merged} hosts merged.`);
+    } catch (err) {
+        showError(err.message);
+    }
+}
+
 async function deleteProject(id, name) {
     if (!confirm(`Are you sure you want to delete project "${name}"?`)) return;
 
@@ -3,7 +3,7 @@ let currentPage = 1;
 const PAGE_SIZE = 100;
 let currentTotal = 0;
 
-const ALLOWED_STATES = ['open', 'open|filtered', 'closed', 'filtered', 'closed|filtered', 'unfiltered'];
+const ALLOWED_STATES = ['open', 'open|filtered', 'closed', 'filtered', 'closed|filtered', 'unfiltered', 'not_observed'];
 
 document.addEventListener('DOMContentLoaded', async () => {
     const projectId = getProjectId();
@@ -94,6 +94,13 @@ document.addEventListener('DOMContentLoaded', async () => {
         makeSortable(document.querySelector('table'));
         loadPortsPage(projectId);
 
+        const refreshPorts = debounce(() => {
+            if (!isEditing()) loadPortsPage(projectId);
+        }, 500);
+        subscribeProjectEvents(projectId, (type) => {
+            if (type !== 'import.intents' && type !== 'import.job') refreshPorts();
+        });
+
     } catch (err) {
         document.getElementById('error-msg').textContent = err.message;
         document.getElementById('error-msg').style.display = 'block';
@@ -173,6 +180,9 @@ function renderPorts(ports, projectId) {
         const badge = document.createElement('span');
         badge.className = `badge ${stateBadgeClass(p.State)}`;
         badge.textContent = p.State;
+        if (p.NotObservedAt) {
+            badge.title = `Not reported by a covering scan since ${new Date(p.NotObservedAt).toLocaleString()}`;
+        }
         tdState.appendChild(badge);
         tr.appendChild(tdState);
 
@@ -271,6 +281,8 @@ function stateBadgeClass(state) {
         case 'closed|filtered':
         case 'unfiltered':
             return 'badge-filtered';
+        case 'not_observed':
+            return 'badge-not-observed';
         default:
             return 'badge-filtered';
     }
@@ -43,6 +43,11 @@ document.addEventListener('DOMContentLoaded', async () => {
 
         bindServiceQueueEvents();
         await loadServiceQueue();
+
+        const refreshQueue = debounce(loadServiceQueue, 500);
+        subscribeProjectEvents(projectId, (type) => {
+            if (type !== 'import.intents' && type !== 'import.job') refreshQueue();
+        });
     } catch (err) {
         showError(err.message);
     }
@@ -3,7 +3,9 @@ package web
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/netip"
 	"strconv"
@@ -12,12 +14,19 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/sloppy/nmaptracker/internal/db"
 	"github.com/sloppy/nmaptracker/internal/export"
+	"github.com/sloppy/nmaptracker/internal/importer"
 )
 
 // API Handlers
 
 func (s *Server) apiListProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := s.DB.ListProjects()
+	var projects []db.Project
+	var err error
+	if user, ok := requestUser(r); ok {
+		projects, err = s.DB.ListProjectsForUser(user)
+	} else {
+		projects, err = s.DB.ListProjects()
+	}
 	if err != nil {
 		s.serverError(w, err)
 		return
@@ -43,6 +52,13 @@ func (s *Server) apiCreateProject(w http.ResponseWriter, r *http.Request) {
 		s.serverError(w, err)
 		return
 	}
+	// Whoever creates a project administers it.
+	if user, ok := requestUser(r); ok && !user.IsAdmin {
+		if err := s.actorDB(r).SetProjectMember(project.ID, user.ID, db.RoleAdmin); err != nil {
+			s.serverError(w, err)
+			return
+		}
+	}
 	s.jsonResponse(w, project, http.StatusCreated)
 }
 
@@ -64,17 +80,149 @@ func (s *Server) apiUpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.UpdateProject(id, req.Name); err != nil {
+	if err := s.actorDB(r).UpdateProject(id, req.Name); err != nil {
 		if err == sql.ErrNoRows {
 			s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, db.ErrProjectArchived) {
+			s.errorResponse(w, err, http.StatusConflict)
+			return
+		}
 		s.serverError(w, err)
 		return
 	}
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
+// apiArchiveProject archives (POST) or unarchives (DELETE) a project.
+func (s *Server) apiArchiveProject(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	project, err := s.actorDB(r).SetProjectArchived(id, r.Method == http.MethodPost)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, project, http.StatusOK)
+}
+
+// apiCloneProject creates a project with the scope, baseline and members of
+// the one in the URL, and none of its data.
+func (s *Server) apiCloneProject(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		s.badRequest(w, fmt.Errorf("project name is required"))
+		return
+	}
+
+	database := s.actorDB(r)
+	project, err := database.CloneProject(id, req.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	// As with a new project, whoever clones it administers the clone.
+	if user, ok := requestUser(r); ok && !user.IsAdmin {
+		if err := database.SetProjectMember(project.ID, user.ID, db.RoleAdmin); err != nil {
+			s.serverError(w, err)
+			return
+		}
+	}
+	s.jsonResponse(w, project, http.StatusCreated)
+}
+
+// apiMergeProject merges the project named by source_project_id into the
+// one in the URL and deletes it. The caller must administer both.
+func (s *Server) apiMergeProject(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	var req struct {
+		SourceProjectID int64 `json:"source_project_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if req.SourceProjectID <= 0 {
+		s.badRequest(w, fmt.Errorf("source_project_id is required"))
+		return
+	}
+	if user, ok := requestUser(r); ok {
+		role, member, err := s.DB.ProjectRole(user, req.SourceProjectID)
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		if !member {
+			s.errorResponse(w, fmt.Errorf("source project not found"), http.StatusNotFound)
+			return
+		}
+		if !db.RoleAllows(role, db.RoleAdmin) {
+			s.errorResponse(w, fmt.Errorf("admin role on the source project required"), http.StatusForbidden)
+			return
+		}
+	}
+
+	stats, err := importer.MergeProjects(s.actorDB(r), id, req.SourceProjectID)
+	switch {
+	case err == sql.ErrNoRows:
+		s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
+		return
+	case errors.Is(err, db.ErrMergeSameProject):
+		s.badRequest(w, err)
+		return
+	case errors.Is(err, db.ErrProjectArchived):
+		s.errorResponse(w, err, http.StatusConflict)
+		return
+	case err != nil:
+		s.serverError(w, err)
+		return
+	}
+	mergedIPs := stats.MergedIPs
+	if mergedIPs == nil {
+		mergedIPs = []string{}
+	}
+	s.jsonResponse(w, map[string]interface{}{
+		"project_id":        id,
+		"source_project_id": req.SourceProjectID,
+		"imports":           stats.Imports,
+		"hosts_moved":       stats.HostsMoved,
+		"hosts_merged":      stats.HostsMerged,
+		"ports_moved":       stats.PortsMoved,
+		"ports_merged":      stats.PortsMerged,
+		"merged_ips":        mergedIPs,
+		"hosts_rebuilt":     stats.HostsRebuilt,
+		"hosts_removed":     stats.HostsRemoved,
+		"ports_removed":     stats.PortsRemoved,
+	}, http.StatusOK)
+}
+
 func (s *Server) apiGetProject(w http.ResponseWriter, r *http.Request) {
 	id, err := parseProjectID(r)
 	if err != nil {
@@ -99,7 +247,7 @@ func (s *Server) apiDeleteProject(w http.ResponseWriter, r *http.Request) {
 		s.badRequest(w, err)
 		return
 	}
-	if err := s.DB.DeleteProject(id); err != nil {
+	if err := s.actorDB(r).DeleteProject(id); err != nil {
 		if err == sql.ErrNoRows {
 			s.errorResponse(w, fmt.Errorf("project not found"), http.StatusNotFound)
 			return
@@ -153,25 +301,14 @@ func (s *Server) apiListHosts(w http.ResponseWriter, r *http.Request) {
 	page, pageSize := parsePagination(filters.Page, filters.Size)
 	offset := (page - 1) * pageSize
 
-	var subnetStart *int64
-	var subnetEnd *int64
+	var subnetStart, subnetEnd []byte
 	if filters.Subnet != "" {
 		prefix, err := netip.ParsePrefix(filters.Subnet)
 		if err != nil {
 			s.badRequest(w, fmt.Errorf("invalid subnet"))
 			return
 		}
-		if prefix.Addr().Is6() {
-			s.badRequest(w, fmt.Errorf("ipv6 subnets are not supported"))
-			return
-		}
-		start, end, err := ipv4PrefixRange(prefix)
-		if err != nil {
-			s.badRequest(w, fmt.Errorf("invalid subnet"))
-			return
-		}
-		subnetStart = &start
-		subnetEnd = &end
+		subnetStart, subnetEnd = db.PrefixKeyRange(prefix)
 	}
 
 	items, total, err := s.DB.ListHostsWithSummaryPaged(projectID, inScope, statusFilters, sortBy, dir, subnetStart, subnetEnd, pageSize, offset)
@@ -225,7 +362,7 @@ func (s *Server) apiDeleteHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.DeleteHost(hostID); err != nil {
+	if err := s.actorDB(r).DeleteHost(hostID); err != nil {
 		s.serverError(w, err)
 		return
 	}
@@ -334,7 +471,7 @@ func (s *Server) apiUpdateHostNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.UpdateHostNotes(hostID, req.Notes); err != nil {
+	if err := s.actorDB(r).UpdateHostNotes(hostID, req.Notes); err != nil {
 		s.serverError(w, err)
 		return
 	}
@@ -367,7 +504,7 @@ func (s *Server) apiUpdateHostLatestScan(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.DB.UpdateHostLatestScan(hostID, latestScan); err != nil {
+	if err := s.actorDB(r).UpdateHostLatestScan(hostID, latestScan); err != nil {
 		s.serverError(w, err)
 		return
 	}
@@ -412,10 +549,13 @@ func (s *Server) apiUpdatePortStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.UpdateWorkStatus(portID, req.Status); err != nil {
+	if err := s.actorDB(r).UpdateWorkStatus(portID, req.Status); err != nil {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventPortStatus, map[string]interface{}{
+		"host_id": hostID, "port_ids": []int64{portID}, "status": req.Status,
+	})
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
@@ -449,10 +589,13 @@ func (s *Server) apiUpdatePortNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.UpdatePortNotes(portID, req.Notes); err != nil {
+	if err := s.actorDB(r).UpdatePortNotes(portID, req.Notes); err != nil {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventPortNotes, map[string]interface{}{
+		"host_id": hostID, "port_id": portID,
+	})
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
@@ -480,10 +623,13 @@ func (s *Server) apiHostBulkStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.BulkUpdateOpenByHost(hostID, req.Status); err != nil {
+	if err := s.actorDB(r).BulkUpdateOpenByHost(hostID, req.Status); err != nil {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventPortStatus, map[string]interface{}{
+		"host_id": hostID, "status": req.Status,
+	})
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
@@ -514,10 +660,13 @@ func (s *Server) apiProjectBulkPortStatus(w http.ResponseWriter, r *http.Request
 	// or we rely on the fact that an ID collision is unlikely to affect another project maliciously in this single user context.
 	// For strict correctness, the DB query could join host/project, but the generic ID update is sufficient for now.
 
-	if err := s.DB.BulkUpdatePortStatusesForProject(projectID, req.IDs, req.Status); err != nil {
+	if err := s.actorDB(r).BulkUpdatePortStatusesForProject(projectID, req.IDs, req.Status); err != nil {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventPortStatus, map[string]interface{}{
+		"port_ids": req.IDs, "status": req.Status,
+	})
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
@@ -629,6 +778,25 @@ func parseProjectID(r *http.Request) (int64, error) {
 	return strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 }
 
+// actorDB returns the database handle for a mutating request, with changes
+// attributed to the caller in the audit log.
+func (s *Server) actorDB(r *http.Request) *db.DB {
+	return s.DB.WithActor(requestActor(r))
+}
+
+// requestActor names who made a change: the authenticated username, or the
+// client address in single-user mode.
+func requestActor(r *http.Request) string {
+	if user, ok := requestUser(r); ok {
+		return user.Username
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func isValidWorkStatus(status string) bool {
 	switch status {
 	case "scanned", "flagged", "in_progress", "done":
@@ -709,6 +877,7 @@ func parsePortStates(values []string) (map[string]bool, error) {
 		"open|filtered":   true,
 		"closed|filtered": true,
 		"unfiltered":      true,
+		"not_observed":    true,
 	}
 	out := make(map[string]bool)
 	for _, val := range values {
@@ -774,22 +943,6 @@ func parseWorkStatusFilters(raw string) ([]string, error) {
 	return out, nil
 }
 
-func ipv4PrefixRange(prefix netip.Prefix) (int64, int64, error) {
-	if !prefix.Addr().Is4() {
-		return 0, 0, fmt.Errorf("ipv4 only")
-	}
-	masked := prefix.Masked().Addr()
-	octets := masked.As4()
-	start := uint64(octets[0])<<24 | uint64(octets[1])<<16 | uint64(octets[2])<<8 | uint64(octets[3])
-	hostBits := 32 - prefix.Bits()
-	if hostBits < 0 || hostBits > 32 {
-		return 0, 0, fmt.Errorf("invalid prefix length")
-	}
-	size := uint64(1) << uint(hostBits)
-	end := start + size - 1
-	return int64(start), int64(end), nil
-}
-
 func parsePagination(pageRaw, sizeRaw string) (int, int) {
 	page := 1
 	size := 50
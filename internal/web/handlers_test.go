@@ -1,16 +1,23 @@
 package web
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
 	"github.com/sloppy/nmaptracker/internal/testutil"
 )
 
@@ -21,7 +28,9 @@ func newTestServer(t *testing.T) (*db.DB, *Server) {
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
-	return database, NewServer(database)
+	server := NewServer(database)
+	t.Cleanup(func() { server.Close(context.Background()) })
+	return database, server
 }
 
 func TestCSRFGuard(t *testing.T) {
@@ -179,6 +188,275 @@ func TestScopeDeleteScoped(t *testing.T) {
 	}
 }
 
+func TestAddScopeValidatesAndEvaluatesExcludes(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Scoped")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	for _, host := range []db.Host{
+		{ProjectID: project.ID, IPAddress: "10.0.0.5"},
+		{ProjectID: project.ID, IPAddress: "10.0.5.5"},
+		{ProjectID: project.ID, IPAddress: "203.0.113.7", Hostname: "vpn.corp.example.com"},
+	} {
+		if _, err := database.UpsertHost(host); err != nil {
+			t.Fatalf("upsert host: %v", err)
+		}
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, projectPath+"/scope", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post(`{"definitions":["10.0.0.0/16","not a rule"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid definition, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if defs, err := database.ListScopeDefinitions(project.ID); err != nil || len(defs) != 0 {
+		t.Fatalf("expected no rules after rejected batch, got %d (%v)", len(defs), err)
+	}
+	if rec := post(`{"definitions":["10.0.0.0/16","*.corp.example.com"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for includes, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(`{"definitions":["10.0.5.0/24"],"type":"exclude"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for exclude, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, projectPath+"/scope/evaluate", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from evaluate, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for ip, want := range map[string]bool{"10.0.0.5": true, "10.0.5.5": false, "203.0.113.7": true} {
+		host, _, err := database.GetHostByIP(project.ID, ip)
+		if err != nil {
+			t.Fatalf("get host: %v", err)
+		}
+		if host.InScope != want {
+			t.Fatalf("%s: expected in_scope=%v, got %v", ip, want, host.InScope)
+		}
+	}
+}
+
+func TestScopeHistoryEndpoints(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("ScopeHistory")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.1.5", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, projectPath+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/scope", `{"definitions":["10.0.0.0/24"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var added struct {
+		Version int `json:"version"`
+		Updated int `json:"updated"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &added); err != nil {
+		t.Fatalf("decode add: %v", err)
+	}
+	if added.Version != 1 || added.Updated != 1 {
+		t.Fatalf("expected version 1 updating one host, got %+v", added)
+	}
+	if got, _, _ := database.GetHostByID(host.ID); got.InScope {
+		t.Fatalf("expected host re-evaluated out of scope without /scope/evaluate")
+	}
+
+	rec = serve(http.MethodGet, "/scope/history", "")
+	var history []db.ScopeVersion
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(history) != 1 || history[0].Actor == "" || len(history[0].Rules) != 1 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	var asOf struct {
+		Version *db.ScopeVersion `json:"version"`
+		InScope bool             `json:"in_scope"`
+	}
+	rec = serve(http.MethodGet, "/scope/as-of?at="+time.Now().UTC().Format("2006-01-02")+"&ip=10.0.1.5", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &asOf); err != nil {
+		t.Fatalf("decode as-of: %v", err)
+	}
+	if asOf.Version == nil || asOf.Version.Version != 1 || asOf.InScope {
+		t.Fatalf("unexpected current scope: %s", rec.Body.String())
+	}
+	rec = serve(http.MethodGet, "/scope/as-of?at=2000-01-01&ip=10.0.1.5", "")
+	asOf.Version = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &asOf); err != nil {
+		t.Fatalf("decode as-of: %v", err)
+	}
+	if asOf.Version != nil || !asOf.InScope {
+		t.Fatalf("expected no scope and host in scope in 2000: %s", rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/scope/as-of?at=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid at, got %d", rec.Code)
+	}
+
+	rec = serve(http.MethodGet, "/hosts/"+strconv.FormatInt(host.ID, 10)+"/scope-transitions", "")
+	var transitions []db.HostScopeTransition
+	if err := json.Unmarshal(rec.Body.Bytes(), &transitions); err != nil {
+		t.Fatalf("decode transitions: %v", err)
+	}
+	if len(transitions) != 1 || !transitions[0].FromInScope || transitions[0].ToInScope || transitions[0].Reason != db.ScopeTransitionScopeChange {
+		t.Fatalf("unexpected transitions: %+v", transitions)
+	}
+}
+
+func TestHostTimelineIncludesAuditAndObservations(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Timeline")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "timeline.xml")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if _, err := part.Write([]byte(`<?xml version="1.0"?>
+<nmaprun args="nmap -p 80 192.0.2.20" start="1709546400">
+  <host><status state="up"/><address addr="192.0.2.20" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="80"><state state="open"/><service name="http"/></port></ports>
+  </host>
+</nmaprun>`)); err != nil {
+		t.Fatalf("write xml: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, projectPath+"/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", rec.Code, rec.Body.String())
+	}
+
+	host, _, err := database.GetHostByIP(project.ID, "192.0.2.20")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	ports, err := database.ListPorts(host.ID)
+	if err != nil || len(ports) != 1 {
+		t.Fatalf("list ports: %v (%d)", err, len(ports))
+	}
+	hostPath := projectPath + "/hosts/" + strconv.FormatInt(host.ID, 10)
+	req = httptest.NewRequest(http.MethodPut, hostPath+"/ports/"+strconv.FormatInt(ports[0].ID, 10)+"/status", bytes.NewBufferString(`{"status":"flagged"}`))
+	req.RemoteAddr = "203.0.113.9:5555"
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, hostPath+"/timeline", nil))
+	var timeline []db.TimelineEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &timeline); err != nil {
+		t.Fatalf("decode timeline: %v (%s)", err, rec.Body.String())
+	}
+	kinds := map[string]int{}
+	for _, entry := range timeline {
+		kinds[entry.Kind]++
+		if entry.Kind == db.TimelineAudit && (entry.Audit.Action != db.AuditPortWorkStatus || entry.Audit.Actor != "203.0.113.9") {
+			t.Fatalf("unexpected audit entry: %+v", entry.Audit)
+		}
+		if entry.Kind == db.TimelineObservation && (entry.Observation.Filename != "timeline.xml" || entry.Observation.OpenPorts != 1) {
+			t.Fatalf("unexpected observation entry: %+v", entry.Observation)
+		}
+	}
+	if kinds[db.TimelineAudit] != 1 || kinds[db.TimelineObservation] != 1 {
+		t.Fatalf("unexpected timeline: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, projectPath+"/audit?limit=10", nil))
+	var events []db.AuditEvent
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+		t.Fatalf("decode audit: %v", err)
+	}
+	if len(events) != 1 || events[0].PortID == nil || *events[0].PortID != ports[0].ID {
+		t.Fatalf("unexpected project audit: %s", rec.Body.String())
+	}
+}
+
+func TestWorkStatusMetricsEndpoints(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Metrics")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.0.1", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+	port, err := database.UpsertPort(db.Port{HostID: host.ID, PortNumber: 80, Protocol: "tcp", State: "open", Service: "http", WorkStatus: "scanned"})
+	if err != nil {
+		t.Fatalf("upsert port: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	portPath := projectPath + "/hosts/" + strconv.FormatInt(host.ID, 10) + "/ports/" + strconv.FormatInt(port.ID, 10)
+
+	req := httptest.NewRequest(http.MethodPut, portPath+"/status", bytes.NewBufferString(`{"status":"done"}`))
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, portPath+"/status-history", nil))
+	var transitions []db.PortStatusTransition
+	if err := json.Unmarshal(rec.Body.Bytes(), &transitions); err != nil {
+		t.Fatalf("decode history: %v (%s)", err, rec.Body.String())
+	}
+	if len(transitions) != 1 || transitions[0].FromStatus != "scanned" || transitions[0].ToStatus != "done" || transitions[0].Actor != "192.0.2.1" {
+		t.Fatalf("unexpected history: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, projectPath+"/metrics/work-status", nil))
+	var metrics db.WorkStatusMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("decode metrics: %v (%s)", err, rec.Body.String())
+	}
+	if metrics.ScannedToDone.Count != 1 || metrics.ByAnalyst["192.0.2.1"].Count != 1 || metrics.ByCampaign["http"].Count != 1 || metrics.TimeInStatus["done"].Count != 1 {
+		t.Fatalf("unexpected metrics: %s", rec.Body.String())
+	}
+}
+
 func TestHostSubnetPagination(t *testing.T) {
 	database, server := newTestServer(t)
 	defer database.Close()
@@ -240,6 +518,25 @@ func TestHostSubnetPagination(t *testing.T) {
 	if len(resp.Items) != 1 {
 		t.Fatalf("expected 1 item on page 2, got %d", len(resp.Items))
 	}
+
+	if _, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "2001:db8::1", InScope: true}); err != nil {
+		t.Fatalf("upsert ipv6 host: %v", err)
+	}
+	if _, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "2001:db8:1::1", InScope: true}); err != nil {
+		t.Fatalf("upsert ipv6 host: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/api/projects/"+strconv.FormatInt(project.ID, 10)+"/hosts?subnet=2001:db8::/64", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for ipv6 subnet, got %d", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal ipv6 subnet: %v", err)
+	}
+	if resp.Total != 1 || len(resp.Items) != 1 || resp.Items[0].IPAddress != "2001:db8::1" {
+		t.Fatalf("unexpected ipv6 subnet result: %+v", resp)
+	}
 }
 
 func TestUpdateHostLatestScanValidationAndScoping(t *testing.T) {
@@ -575,6 +872,98 @@ func TestImportStoresManualSourceMetadata(t *testing.T) {
 	}
 }
 
+func TestImportDetectsGNMAPUpload(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Foxtrot-GNMAP")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	gnmapPayload := "# Nmap 7.94 scan initiated Mon Mar  4 10:00:00 2024 as: nmap -p- -oG - 192.0.2.30\n" +
+		"Host: 192.0.2.30 ()\tStatus: Up\n" +
+		"Host: 192.0.2.30 ()\tPorts: 22/open/tcp//ssh///, 443/open/tcp//https///\n"
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "sweep.gnmap")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if _, err := part.Write([]byte(gnmapPayload)); err != nil {
+		t.Fatalf("write gnmap: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/projects/"+strconv.FormatInt(project.ID, 10)+"/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp["hosts_imported"].(float64) != 1 || resp["ports_imported"].(float64) != 2 {
+		t.Fatalf("unexpected import response: %v", resp)
+	}
+
+	imports, err := database.ListScanImportsWithIntents(project.ID)
+	if err != nil {
+		t.Fatalf("list imports: %v", err)
+	}
+	if len(imports) != 1 || imports[0].NmapArgs != "nmap -p- -oG - 192.0.2.30" {
+		t.Fatalf("unexpected imports: %#v", imports)
+	}
+	foundAllTCP := false
+	for _, intent := range imports[0].Intents {
+		if intent.Intent == db.IntentAllTCP {
+			foundAllTCP = true
+		}
+	}
+	if !foundAllTCP {
+		t.Fatalf("expected all_tcp intent inferred from gnmap header, got %#v", imports[0].Intents)
+	}
+}
+
+func TestImportRejectsUnrecognizedFormat(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Foxtrot-Unknown")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if _, err := part.Write([]byte("not a scan")); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/projects/"+strconv.FormatInt(project.ID, 10)+"/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
 func TestListImportsIncludesIntents(t *testing.T) {
 	database, server := newTestServer(t)
 	defer database.Close()
@@ -1210,7 +1599,7 @@ func TestBaselineEndpointsValidationAndScoping(t *testing.T) {
 	invalidBodies := []string{
 		`{"definitions":["not-an-ip"]}`,
 		`{"definitions":["10.0.0.0/15"]}`,
-		`{"definitions":["2001:db8::1"]}`,
+		`{"definitions":["2001:db8::/64"]}`,
 	}
 	for _, payload := range invalidBodies {
 		req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/projects/"+strconv.FormatInt(projectA.ID, 10)+"/baseline", bytes.NewBufferString(payload))
@@ -1471,6 +1860,85 @@ func TestServiceQueueEndpointResponseAndPagination(t *testing.T) {
 	}
 }
 
+func TestScriptResultEndpoints(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Scripts")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.0.5", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	record, err := tx.InsertScanImport(db.ScanImport{ProjectID: project.ID, Filename: "scripts.xml"})
+	if err != nil {
+		t.Fatalf("insert import: %v", err)
+	}
+	for _, result := range []db.ScriptResult{
+		{IPAddress: "10.0.0.5", ScriptID: "smb-os-discovery", Output: "OS: Windows Server 2019", Elements: json.RawMessage(`{"os":"Windows Server 2019"}`)},
+		{IPAddress: "10.0.0.5", PortNumber: 443, Protocol: "tcp", ScriptID: "ssl-cert", Output: "Subject: commonName=a.example", Elements: json.RawMessage(`{"subject":{"commonName":"a.example"}}`)},
+		{IPAddress: "10.0.0.6", PortNumber: 443, Protocol: "tcp", ScriptID: "ssl-cert", Output: "Subject: commonName=b.example", Elements: json.RawMessage(`{"subject":{"commonName":"b.example"}}`)},
+	} {
+		result.ScanImportID = record.ID
+		result.ProjectID = project.ID
+		if err := tx.InsertScriptResult(result); err != nil {
+			t.Fatalf("insert script result: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	base := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/scripts", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without script_id, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/scripts?script_id=ssl-cert&key=subject.commonName&value=B.EXAMPLE", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var matches []struct {
+		IPAddress string
+		ScriptID  string
+		Value     string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &matches); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(matches) != 1 || matches[0].IPAddress != "10.0.0.6" || matches[0].Value != "b.example" {
+		t.Fatalf("unexpected script matches: %+v", matches)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/hosts/"+strconv.FormatInt(host.ID, 10)+"/scripts", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var hostResults []struct {
+		PortNumber int
+		ScriptID   string
+		Elements   map[string]interface{}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &hostResults); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(hostResults) != 2 || hostResults[0].ScriptID != "smb-os-discovery" || hostResults[0].PortNumber != 0 || hostResults[0].Elements["os"] != "Windows Server 2019" {
+		t.Fatalf("unexpected host script results: %+v", hostResults)
+	}
+}
+
 func insertServiceQueueImportForWebTest(database *db.DB, projectID int64, ips []string) (int64, error) {
 	tx, err := database.Begin()
 	if err != nil {
@@ -1535,3 +2003,887 @@ func insertDeltaImportForWebTest(database *db.DB, projectID int64, filename stri
 	}
 	return record.ID, nil
 }
+
+func TestFirstAccountCannotBeCreatedThroughAPI(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/users", bytes.NewBufferString(`{"username":"mallory","password":"mallory-password","is_admin":true}`))
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for the first account, got %d %s", rec.Code, rec.Body.String())
+	}
+	if enabled, err := database.HasUsers(); err != nil || enabled {
+		t.Fatalf("expected no account to be created: %v %v", enabled, err)
+	}
+}
+
+func TestAuthenticationAndProjectRoles(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("Auth")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.0.1", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+	port, err := database.UpsertPort(db.Port{HostID: host.ID, PortNumber: 22, Protocol: "tcp", State: "open", WorkStatus: "scanned"})
+	if err != nil {
+		t.Fatalf("upsert port: %v", err)
+	}
+	if _, err := database.CreateUser("root", "root-password", true); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	bob, err := database.CreateUser("bob", "bob-password", false)
+	if err != nil {
+		t.Fatalf("create bob: %v", err)
+	}
+	if _, err := database.CreateUser("carol", "carol-password", false); err != nil {
+		t.Fatalf("create carol: %v", err)
+	}
+	if err := database.SetProjectMember(project.ID, bob.ID, db.RoleViewer); err != nil {
+		t.Fatalf("grant bob: %v", err)
+	}
+
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	statusPath := projectPath + "/hosts/" + strconv.FormatInt(host.ID, 10) + "/ports/" + strconv.FormatInt(port.ID, 10) + "/status"
+	do := func(method, path, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if auth != nil {
+			auth(req)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(username, password string) func(*http.Request) {
+		t.Helper()
+		rec := do(http.MethodPost, "http://localhost:8080/api/auth/login", `{"username":"`+username+`","password":"`+password+`"}`, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login %s: %d %s", username, rec.Code, rec.Body.String())
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != SessionCookieName || !cookies[0].HttpOnly {
+			t.Fatalf("unexpected session cookies: %+v", cookies)
+		}
+		return func(req *http.Request) { req.AddCookie(cookies[0]) }
+	}
+
+	if rec := do(http.MethodGet, "http://localhost:8080/api/projects", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "http://localhost:8080/api/auth/login", `{"username":"bob","password":"nope"}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad password, got %d", rec.Code)
+	}
+
+	asBob := login("bob", "bob-password")
+	rec := do(http.MethodGet, "http://localhost:8080/api/projects", "", asBob)
+	var projects []db.Project
+	if err := json.Unmarshal(rec.Body.Bytes(), &projects); err != nil || len(projects) != 1 {
+		t.Fatalf("bob projects: %v %s", err, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, projectPath+"/stats", "", asBob); rec.Code != http.StatusOK {
+		t.Fatalf("viewer read: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, statusPath, `{"status":"done"}`, asBob); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected viewer write to be forbidden, got %d", rec.Code)
+	}
+	if err := database.SetProjectMember(project.ID, bob.ID, db.RoleAnalyst); err != nil {
+		t.Fatalf("promote bob: %v", err)
+	}
+	if rec := do(http.MethodPut, statusPath, `{"status":"done"}`, asBob); rec.Code != http.StatusOK {
+		t.Fatalf("analyst write: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, projectPath, `{"name":"Renamed"}`, asBob); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected analyst project update to be forbidden, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "http://localhost:8080/api/users", "", asBob); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected user listing to need a site admin, got %d", rec.Code)
+	}
+	events, err := database.ListAuditEvents(project.ID, db.AuditQuery{Limit: 1})
+	if err != nil || len(events) != 1 || events[0].Action != db.AuditPortWorkStatus || events[0].Actor != "bob" {
+		t.Fatalf("expected the change attributed to bob: %+v %v", events, err)
+	}
+
+	asCarol := login("carol", "carol-password")
+	if rec := do(http.MethodGet, projectPath, "", asCarol); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected non-member to get 404, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, "http://localhost:8080/api/auth/tokens", `{"name":"ci"}`, asBob)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create token: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Secret == "" {
+		t.Fatalf("decode token: %v %s", err, rec.Body.String())
+	}
+	bearer := func(secret string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+secret) }
+	}
+	if rec := do(http.MethodPut, statusPath, `{"status":"flagged"}`, bearer(created.Secret)); rec.Code != http.StatusOK {
+		t.Fatalf("token write: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, projectPath+"/stats", "", bearer("nmt_bogus")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown token to be rejected, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "http://localhost:8080/api/auth/logout", "", asBob); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, projectPath+"/stats", "", asBob); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected session to end at logout, got %d", rec.Code)
+	}
+}
+
+func TestTrustedOriginsAndProxies(t *testing.T) {
+	dir := testutil.TempDir(t)
+	database, err := db.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	if _, err := NewServerWithOptions(database, Options{TrustedOrigins: []string{"jumpbox:8443"}}); err == nil {
+		t.Fatalf("expected an origin without a scheme to be rejected")
+	}
+	if _, err := NewServerWithOptions(database, Options{TrustedProxies: []string{"not-an-ip"}}); err == nil {
+		t.Fatalf("expected a malformed proxy to be rejected")
+	}
+	server, err := NewServerWithOptions(database, Options{
+		TrustedOrigins: []string{"https://JumpBox.corp:443"},
+		TrustedProxies: []string{"10.0.0.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	defer server.Close(context.Background())
+
+	for origin, want := range map[string]int{
+		"https://jumpbox.corp":      http.StatusCreated,
+		"https://jumpbox.corp:8443": http.StatusForbidden,
+		"http://jumpbox.corp":       http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "https://jumpbox.corp/api/projects", bytes.NewBufferString(`{"name":"`+origin+`"}`))
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("origin %s: expected %d, got %d", origin, want, rec.Code)
+		}
+	}
+
+	project, err := database.CreateProject("Proxied")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.1.0.1", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+	notesPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10) + "/hosts/" + strconv.FormatInt(host.ID, 10) + "/notes"
+	for remote, wantActor := range map[string]string{
+		"10.0.0.5:4000":    "198.51.100.7",
+		"203.0.113.1:4000": "203.0.113.1",
+	} {
+		req := httptest.NewRequest(http.MethodPut, notesPath, bytes.NewBufferString(`{"notes":"via `+remote+`"}`))
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.9")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("update notes via %s: %d %s", remote, rec.Code, rec.Body.String())
+		}
+		events, err := database.ListAuditEvents(project.ID, db.AuditQuery{Limit: 1})
+		if err != nil || len(events) != 1 || events[0].Actor != wantActor {
+			t.Fatalf("via %s expected actor %s: %+v %v", remote, wantActor, events, err)
+		}
+	}
+
+	if _, err := database.CreateUser("root", "root-password", true); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/auth/login", bytes.NewBufferString(`{"username":"root","password":"root-password"}`))
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || !cookies[0].Secure {
+		t.Fatalf("expected a secure session cookie behind a TLS proxy: %d %+v", rec.Code, cookies)
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate([]string{"jumpbox.corp", "192.0.2.10", "0.0.0.0"}, time.Now())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("jumpbox.corp"); err != nil {
+		t.Fatalf("verify hostname: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("192.0.2.10"); err != nil {
+		t.Fatalf("verify ip: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Fatalf("verify localhost: %v", err)
+	}
+	if fp := CertificateFingerprint(cert); len(fp) != 95 {
+		t.Fatalf("unexpected fingerprint %q", fp)
+	}
+}
+
+func TestEventHub(t *testing.T) {
+	hub := NewHub()
+	events, unsubscribe := hub.Subscribe(1)
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeOther()
+
+	hub.Publish(Event{Type: EventPortStatus, ProjectID: 1})
+	select {
+	case event := <-events:
+		if event.Type != EventPortStatus || event.Time.IsZero() {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	default:
+		t.Fatalf("expected event for project 1")
+	}
+	select {
+	case event := <-other:
+		t.Fatalf("project 2 received %+v", event)
+	default:
+	}
+
+	// A subscriber that is not reading must not block publishers.
+	for i := 0; i < eventBuffer*2; i++ {
+		hub.Publish(Event{Type: EventPortNotes, ProjectID: 1})
+	}
+	unsubscribe()
+	unsubscribe()
+
+	hub.Close()
+	if _, ok := <-other; ok {
+		t.Fatalf("expected close to end subscriptions")
+	}
+	late, _ := hub.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Fatalf("expected subscriptions after close to be closed")
+	}
+}
+
+func TestProjectEventStream(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("live")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	host, err := database.UpsertHost(db.Host{ProjectID: project.ID, IPAddress: "10.0.0.1", InScope: true})
+	if err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+	port, err := database.UpsertPort(db.Port{HostID: host.ID, PortNumber: 80, Protocol: "tcp", State: "open", WorkStatus: "scanned"})
+	if err != nil {
+		t.Fatalf("upsert port: %v", err)
+	}
+
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	projectURL := ts.URL + "/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	resp, err := http.Get(projectURL + "/events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	reader := bufio.NewReader(resp.Body)
+	// The stream opens with a retry hint and comment before any events.
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read preamble: %v", err)
+		}
+		if line == "\n" {
+			break
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, projectURL+"/hosts/"+strconv.FormatInt(host.ID, 10)+"/ports/"+strconv.FormatInt(port.ID, 10)+"/status", strings.NewReader(`{"status":"flagged"}`))
+	update, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	update.Body.Close()
+	if update.StatusCode != http.StatusOK {
+		t.Fatalf("update status code %d", update.StatusCode)
+	}
+
+	var eventType string
+	var event Event
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if strings.HasPrefix(line, "event: ") {
+			eventType = strings.TrimPrefix(line, "event: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("decode event: %v", err)
+			}
+			break
+		}
+	}
+	if eventType != EventPortStatus || event.ProjectID != project.ID || event.Actor != "127.0.0.1" {
+		t.Fatalf("unexpected event %q: %+v", eventType, event)
+	}
+	data, _ := event.Data.(map[string]interface{})
+	if data["status"] != "flagged" || data["host_id"] != float64(host.ID) {
+		t.Fatalf("unexpected event data: %+v", event.Data)
+	}
+
+	// Closing the hub ends the stream so graceful shutdown is not held up.
+	server.Events.Close()
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("expected stream to end cleanly: %v", err)
+	}
+}
+
+func TestDefaultSpoolDirIsPerServer(t *testing.T) {
+	database, first := newTestServer(t)
+	defer database.Close()
+	second := NewServer(database)
+
+	if first.imports.spoolDir == second.imports.spoolDir {
+		t.Fatalf("expected separate spool dirs, both use %s", first.imports.spoolDir)
+	}
+	if err := second.Close(context.Background()); err != nil {
+		t.Fatalf("close server: %v", err)
+	}
+	if _, err := os.Stat(second.imports.spoolDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary spool dir to be removed: %v", err)
+	}
+	if _, err := os.Stat(first.imports.spoolDir); err != nil {
+		t.Fatalf("expected the other server's spool dir to remain: %v", err)
+	}
+}
+
+func TestImportJobs(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("jobs")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	events, unsubscribe := server.Events.Subscribe(project.ID)
+	defer unsubscribe()
+
+	submit := func(fields map[string]string, xml string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			if err := writer.WriteField(name, value); err != nil {
+				t.Fatalf("write field: %v", err)
+			}
+		}
+		if xml != "" {
+			part, err := writer.CreateFormFile("file", "job.xml")
+			if err != nil {
+				t.Fatalf("create form file: %v", err)
+			}
+			part.Write([]byte(xml))
+		}
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, projectPath+"/imports/jobs", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := submit(nil, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected missing file to be rejected, got %d", rec.Code)
+	}
+	if rec := submit(map[string]string{"source_ip": "not-an-ip"}, "<nmaprun/>"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid options to be rejected, got %d", rec.Code)
+	}
+
+	rec := submit(map[string]string{"scanner_label": "edge"}, `<?xml version="1.0"?>
+<nmaprun args="nmap -p 22,80 192.0.2.30" start="1709546400">
+  <host><status state="up"/><address addr="192.0.2.30" addrtype="ipv4"/>
+    <ports>
+      <port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port>
+      <port protocol="tcp" portid="80"><state state="open"/><service name="http"/></port>
+    </ports>
+  </host>
+</nmaprun>`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body.String())
+	}
+	var job db.ImportJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if rec.Header().Get("Location") == "" {
+		t.Fatalf("expected Location header")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != db.ImportJobDone && job.Status != db.ImportJobFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", job)
+		}
+		time.Sleep(20 * time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, projectPath+"/imports/jobs/"+strconv.FormatInt(job.ID, 10), nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get job: %d %s", rec.Code, rec.Body.String())
+		}
+		job = db.ImportJob{}
+		json.Unmarshal(rec.Body.Bytes(), &job)
+	}
+	if job.Status != db.ImportJobDone || job.HostsProcessed != 1 || job.PortsProcessed != 2 || job.ScanImportID == nil {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	if job.Actor != "192.0.2.1" {
+		t.Fatalf("expected job to record the submitter, got %q", job.Actor)
+	}
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil || len(imports) != 1 || imports[0].ScannerLabel != "edge" {
+		t.Fatalf("expected one labelled import: %+v %v", imports, err)
+	}
+
+	// The completion event follows the final job update.
+	seen := map[string]bool{}
+	for !seen[EventImportJob] || !seen[EventImportCompleted] {
+		select {
+		case event := <-events:
+			seen[event.Type] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected job and completion events, got %v", seen)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, projectPath+"/imports/jobs", nil)
+	listRec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(listRec, req)
+	var jobs []db.ImportJob
+	if err := json.Unmarshal(listRec.Body.Bytes(), &jobs); err != nil || len(jobs) != 1 {
+		t.Fatalf("list jobs: %s %v", listRec.Body.String(), err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, projectPath+"/imports/jobs/999", nil)
+	missing := httptest.NewRecorder()
+	server.Handler().ServeHTTP(missing, req)
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown job, got %d", missing.Code)
+	}
+}
+
+func TestImportRejectsDuplicates(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("dupes")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	post := func(path string, fields map[string]string, xml string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		part, err := writer.CreateFormFile("file", "scan.xml")
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write([]byte(xml))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, projectPath+path, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	scan := func(ip string) string {
+		return `<?xml version="1.0"?>
+<nmaprun args="nmap -p 22 192.0.2.0/24" start="1709546400">
+  <host><status state="up"/><address addr="` + ip + `" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+  </host>
+</nmaprun>`
+	}
+
+	if rec := post("/import", nil, scan("192.0.2.40")); rec.Code != http.StatusOK {
+		t.Fatalf("first import: %d %s", rec.Code, rec.Body.String())
+	}
+	rec := post("/import", nil, scan("192.0.2.40")+"\n")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for re-import, got %d %s", rec.Code, rec.Body.String())
+	}
+	var conflict struct {
+		Reason   string             `json:"reason"`
+		Existing db.DuplicateImport `json:"existing_import"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &conflict); err != nil || conflict.Reason != db.DuplicateContent || conflict.Existing.ID == 0 {
+		t.Fatalf("unexpected conflict body: %s %v", rec.Body.String(), err)
+	}
+	if rec := post("/imports/jobs", nil, scan("192.0.2.40")); rec.Code != http.StatusConflict {
+		t.Fatalf("expected job submission of a known file to be refused, got %d", rec.Code)
+	}
+	if rec := post("/import", map[string]string{"force": "true"}, scan("192.0.2.40")); rec.Code != http.StatusOK {
+		t.Fatalf("forced import: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Different content from the same run is only caught by the worker.
+	rec = post("/imports/jobs", nil, scan("192.0.2.41"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit near-duplicate: %d %s", rec.Code, rec.Body.String())
+	}
+	var job db.ImportJob
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != db.ImportJobDone && job.Status != db.ImportJobFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", job)
+		}
+		time.Sleep(20 * time.Millisecond)
+		job, _, err = database.GetImportJob(project.ID, job.ID)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+	}
+	if job.Status != db.ImportJobFailed || job.DuplicateOf == nil || *job.DuplicateOf != conflict.Existing.ID {
+		t.Fatalf("expected job to fail as a duplicate of %d: %+v", conflict.Existing.ID, job)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, projectPath+"/imports/duplicates", nil)
+	listRec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(listRec, req)
+	var groups []db.DuplicateImportGroup
+	if err := json.Unmarshal(listRec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("decode duplicates: %s %v", listRec.Body.String(), err)
+	}
+	if len(groups) != 1 || groups[0].Reason != db.DuplicateContent || len(groups[0].Imports) != 2 {
+		t.Fatalf("unexpected duplicate groups: %+v", groups)
+	}
+}
+
+func TestDeleteScanImportRebuildsHosts(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("undo")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	upload := func(xml string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "scan.xml")
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write([]byte(xml))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, projectPath+"/import", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	upload(`<?xml version="1.0"?>
+<nmaprun args="nmap -p 22 192.0.2.50" start="1709546400">
+  <host><status state="up"/><address addr="192.0.2.50" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh" product="OpenSSH"/></port></ports>
+  </host>
+</nmaprun>`)
+	upload(`<?xml version="1.0"?>
+<nmaprun args="nmap -p 22,80 192.0.2.50-51" start="1709632800">
+  <host><status state="up"/><address addr="192.0.2.50" addrtype="ipv4"/>
+    <ports>
+      <port protocol="tcp" portid="22"><state state="closed"/><service name="ssh"/></port>
+      <port protocol="tcp" portid="80"><state state="open"/><service name="http"/></port>
+    </ports>
+  </host>
+  <host><status state="up"/><address addr="192.0.2.51" addrtype="ipv4"/>
+    <ports><port protocol="tcp" portid="80"><state state="open"/><service name="http"/></port></ports>
+  </host>
+</nmaprun>`)
+	imports, err := database.ListScanImports(project.ID)
+	if err != nil || len(imports) != 2 {
+		t.Fatalf("expected two imports: %+v %v", imports, err)
+	}
+	bad := imports[0]
+	if bad.NmapArgs != "nmap -p 22,80 192.0.2.50-51" {
+		bad = imports[1]
+	}
+
+	del := func(id int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, projectPath+"/imports/"+strconv.FormatInt(id, 10), nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	rec := del(bad.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete import: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		ImportID     int64 `json:"import_id"`
+		HostsRebuilt int   `json:"hosts_rebuilt"`
+		HostsRemoved int   `json:"hosts_removed"`
+		PortsRemoved int   `json:"ports_removed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode delete: %v", err)
+	}
+	if resp.ImportID != bad.ID || resp.HostsRebuilt != 1 || resp.HostsRemoved != 1 || resp.PortsRemoved != 2 {
+		t.Fatalf("unexpected delete response: %s", rec.Body.String())
+	}
+
+	host, _, err := database.GetHostByIP(project.ID, "192.0.2.50")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	ssh, found, err := database.GetPortByKey(host.ID, 22, "tcp")
+	if err != nil || !found || ssh.State != "open" || ssh.Product != "OpenSSH" {
+		t.Fatalf("expected ssh to be rebuilt from the first import: %+v %v", ssh, err)
+	}
+	if _, found, _ := database.GetHostByIP(project.ID, "192.0.2.51"); found {
+		t.Fatalf("expected host only in the deleted import to be removed")
+	}
+
+	if rec := del(bad.ID); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted import, got %d", rec.Code)
+	}
+}
+
+func TestProjectLifecycleEndpoints(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	target, err := database.CreateProject("Lifecycle A")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	source, err := database.CreateProject("Lifecycle B")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, err := database.BulkAddScopeDefinitions(target.ID, []string{"10.0.0.0/24"}, "include"); err != nil {
+		t.Fatalf("add scope: %v", err)
+	}
+	for _, p := range []db.Project{target, source} {
+		host, err := database.UpsertHost(db.Host{ProjectID: p.ID, IPAddress: "10.0.0.1", InScope: true})
+		if err != nil {
+			t.Fatalf("upsert host: %v", err)
+		}
+		if _, err := database.UpsertPort(db.Port{HostID: host.ID, PortNumber: 22, Protocol: "tcp", State: "open", WorkStatus: "scanned"}); err != nil {
+			t.Fatalf("upsert port: %v", err)
+		}
+	}
+	if _, err := database.UpsertHost(db.Host{ProjectID: source.ID, IPAddress: "10.0.0.2", InScope: true}); err != nil {
+		t.Fatalf("upsert host: %v", err)
+	}
+
+	pathOf := func(id int64) string {
+		return "http://localhost:8080/api/projects/" + strconv.FormatInt(id, 10)
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Archived projects stay readable but reject changes.
+	rec := do(http.MethodPost, pathOf(target.ID)+"/archive", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("archive: %d %s", rec.Code, rec.Body.String())
+	}
+	var archived db.Project
+	if err := json.Unmarshal(rec.Body.Bytes(), &archived); err != nil || archived.ArchivedAt == nil {
+		t.Fatalf("expected archived project in response: %s (%v)", rec.Body.String(), err)
+	}
+	if rec := do(http.MethodGet, pathOf(target.ID)+"/hosts", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected archived project to be readable, got %d", rec.Code)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPut, pathOf(target.ID), `{"name":"renamed"}`},
+		{http.MethodPost, pathOf(target.ID) + "/scope", `{"definitions":["10.0.1.0/24"],"type":"include"}`},
+		{http.MethodPost, pathOf(target.ID) + "/scope/evaluate", ""},
+		{http.MethodPost, pathOf(target.ID) + "/baseline", `{"definitions":["10.0.0.1"]}`},
+		{http.MethodPost, pathOf(target.ID) + "/merge", `{"source_project_id":` + strconv.FormatInt(source.ID, 10) + `}`},
+	} {
+		if rec := do(req.method, req.path, req.body); rec.Code != http.StatusConflict {
+			t.Fatalf("%s %s on archived project: expected 409, got %d %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodDelete, pathOf(target.ID)+"/archive", ""); rec.Code != http.StatusOK {
+		t.Fatalf("unarchive: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, pathOf(target.ID), `{"name":"Lifecycle A2"}`); rec.Code != http.StatusOK {
+		t.Fatalf("rename after unarchive: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodPost, pathOf(target.ID)+"/clone", `{"name":"Lifecycle retest"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("clone: %d %s", rec.Code, rec.Body.String())
+	}
+	var clone db.Project
+	if err := json.Unmarshal(rec.Body.Bytes(), &clone); err != nil {
+		t.Fatalf("decode clone: %v", err)
+	}
+	if rules, err := database.ListScopeDefinitions(clone.ID); err != nil || len(rules) != 1 {
+		t.Fatalf("expected the clone to copy scope: %+v %v", rules, err)
+	}
+	if hosts, err := database.ListHosts(clone.ID); err != nil || len(hosts) != 0 {
+		t.Fatalf("expected the clone to have no hosts: %+v %v", hosts, err)
+	}
+	if rec := do(http.MethodPost, pathOf(target.ID)+"/clone", `{"name":" "}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a blank clone name, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, pathOf(target.ID)+"/merge", `{"source_project_id":`+strconv.FormatInt(target.ID, 10)+`}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 merging a project into itself, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, pathOf(target.ID)+"/merge", `{"source_project_id":9999}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing source, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, pathOf(target.ID)+"/merge", `{"source_project_id":`+strconv.FormatInt(source.ID, 10)+`}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge: %d %s", rec.Code, rec.Body.String())
+	}
+	var merged struct {
+		HostsMoved  int      `json:"hosts_moved"`
+		HostsMerged int      `json:"hosts_merged"`
+		PortsMerged int      `json:"ports_merged"`
+		MergedIPs   []string `json:"merged_ips"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &merged); err != nil {
+		t.Fatalf("decode merge: %v", err)
+	}
+	if merged.HostsMoved != 1 || merged.HostsMerged != 1 || merged.PortsMerged != 1 || len(merged.MergedIPs) != 1 || merged.MergedIPs[0] != "10.0.0.1" {
+		t.Fatalf("unexpected merge response: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, pathOf(source.ID), ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected merged source project to be gone, got %d", rec.Code)
+	}
+	if hosts, err := database.ListHosts(target.ID); err != nil || len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts after merge: %+v %v", hosts, err)
+	}
+}
+
+func TestImportRawDownloadAndReparse(t *testing.T) {
+	database, server := newTestServer(t)
+	defer database.Close()
+
+	project, err := database.CreateProject("evidence")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	projectPath := "http://localhost:8080/api/projects/" + strconv.FormatInt(project.ID, 10)
+	payload := "# Nmap 7.94 scan initiated Mon Mar  4 10:00:00 2024 as: nmap -p 22,443 -oG - 192.0.2.60\n" +
+		"Host: 192.0.2.60 ()\tStatus: Up\n" +
+		"Host: 192.0.2.60 ()\tPorts: 22/open/tcp//ssh///, 443/open/tcp//https///\n"
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "sweep.gnmap")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write([]byte(payload))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, projectPath+"/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", rec.Code, rec.Body.String())
+	}
+	imports, err := database.ListScanImportsWithIntents(project.ID)
+	if err != nil || len(imports) != 1 || imports[0].ArtifactSHA256 == "" {
+		t.Fatalf("expected one import with a stored file: %+v %v", imports, err)
+	}
+	importPath := projectPath + "/imports/" + strconv.FormatInt(imports[0].ID, 10)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	rec = serve(http.MethodGet, importPath+"/raw")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download raw: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != payload {
+		t.Fatalf("raw file differs from the upload: %q", rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="sweep.gnmap"` {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	rec = serve(http.MethodGet, projectPath+"/imports")
+	if !strings.Contains(rec.Body.String(), `"raw_available":true`) {
+		t.Fatalf("expected raw_available in import list: %s", rec.Body.String())
+	}
+
+	rec = serve(http.MethodPost, importPath+"/reparse")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reparse: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		ImportID     int64 `json:"import_id"`
+		HostsFound   int   `json:"hosts_found"`
+		PortsFound   int   `json:"ports_found"`
+		HostsRebuilt int   `json:"hosts_rebuilt"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode reparse: %v", err)
+	}
+	if resp.ImportID != imports[0].ID || resp.HostsFound != 1 || resp.PortsFound != 2 || resp.HostsRebuilt != 1 {
+		t.Fatalf("unexpected reparse response: %s", rec.Body.String())
+	}
+
+	// Observations imported without a file have nothing to download or reparse.
+	direct, err := importer.ImportObservations(database, nil, project.ID, "direct", importer.Observations{
+		Hosts: []importer.HostObservation{{IPAddress: "192.0.2.61", Ports: []importer.PortObservation{{PortNumber: 80, Protocol: "tcp", State: "open"}}}},
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("import observations: %v", err)
+	}
+	directPath := projectPath + "/imports/" + strconv.FormatInt(direct.ID, 10)
+	if rec := serve(http.MethodGet, directPath+"/raw"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an import without a file, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, directPath+"/reparse"); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 reparsing an import without a file, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, projectPath+"/imports/99999/raw"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing import, got %d", rec.Code)
+	}
+}
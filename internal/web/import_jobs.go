@@ -0,0 +1,394 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
+)
+
+// DefaultImportWorkers is the number of background imports run at once when
+// Options.ImportWorkers is unset. SQLite serialises the writes, so more
+// workers mostly overlap parsing.
+const DefaultImportWorkers = 2
+
+// maxSpooledUpload caps a single upload accepted by the job endpoint.
+const maxSpooledUpload = 2 << 30
+
+// importQueue runs spooled uploads through the importer on a bounded pool of
+// workers. Jobs are persisted in import_job, so the queue survives restarts:
+// the workers pick up whatever is still queued when they start.
+type importQueue struct {
+	db       *db.DB
+	events   *Hub
+	spoolDir string
+	// tempSpool marks a spool dir created for this queue alone, removed on
+	// Stop.
+	tempSpool bool
+	wake      chan struct{}
+	stop      chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+func newImportQueue(database *db.DB, events *Hub, spoolDir string, workers int) (*importQueue, error) {
+	if workers <= 0 {
+		workers = DefaultImportWorkers
+	}
+	tempSpool := spoolDir == ""
+	if tempSpool {
+		dir, err := os.MkdirTemp("", "nmaptracker-spool-")
+		if err != nil {
+			return nil, fmt.Errorf("create spool dir: %w", err)
+		}
+		spoolDir = dir
+	} else if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	if _, err := database.RequeueInterruptedImportJobs(); err != nil {
+		if tempSpool {
+			os.RemoveAll(spoolDir)
+		}
+		return nil, err
+	}
+	q := &importQueue{
+		db:        database,
+		events:    events,
+		spoolDir:  spoolDir,
+		tempSpool: tempSpool,
+		wake:      make(chan struct{}, workers),
+		stop:      make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.notify()
+	return q, nil
+}
+
+// notify wakes an idle worker, if any, to look for queued jobs.
+func (q *importQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *importQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		job, found, err := q.db.ClaimNextImportJob()
+		if err != nil {
+			log.Printf("import worker: %v", err)
+		}
+		if !found {
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		// Another job may be waiting behind this one.
+		q.notify()
+		q.run(job)
+	}
+}
+
+// run imports one claimed job and records the outcome.
+func (q *importQueue) run(job db.ImportJob) {
+	q.publishJob(job.ProjectID, job.ID, job.Actor)
+	defer os.Remove(job.SpoolPath)
+
+	var options importer.ImportOptions
+	if err := json.Unmarshal([]byte(job.Options), &options); err != nil {
+		q.fail(job, fmt.Errorf("decode job options: %w", err))
+		return
+	}
+	options.Progress = func(p importer.ImportProgress) {
+		if err := q.db.UpdateImportJobProgress(job.ID, p.Phase, p.Hosts, p.Ports); err != nil {
+			log.Printf("import job %d: %v", job.ID, err)
+			return
+		}
+		q.publishJob(job.ProjectID, job.ID, job.Actor)
+	}
+
+	// The project may have been archived while the job waited.
+	project, found, err := q.db.GetProjectByID(job.ProjectID)
+	if err != nil {
+		q.fail(job, err)
+		return
+	}
+	if found && project.Archived() {
+		q.fail(job, db.ErrProjectArchived)
+		return
+	}
+
+	f, err := os.Open(job.SpoolPath)
+	if err != nil {
+		q.fail(job, fmt.Errorf("open spooled upload: %w", err))
+		return
+	}
+	defer f.Close()
+
+	matcher, err := importer.ProjectScopeMatcher(q.db, job.ProjectID)
+	if err != nil {
+		q.fail(job, err)
+		return
+	}
+	stats, err := importer.ImportWithOptions(q.db.WithActor(job.Actor), matcher, job.ProjectID, job.Filename, f, options, time.Now().UTC())
+	var duplicate *importer.DuplicateImportError
+	if errors.As(err, &duplicate) {
+		if err := q.db.FailDuplicateImportJob(job.ID, duplicate.Existing.ID, err); err != nil {
+			log.Printf("import job %d: %v", job.ID, err)
+			return
+		}
+		q.publishJob(job.ProjectID, job.ID, job.Actor)
+		return
+	}
+	if err != nil {
+		q.fail(job, err)
+		return
+	}
+
+	macChanges, err := json.Marshal(macChangesResponse(stats.MACChanges))
+	if err != nil {
+		q.fail(job, err)
+		return
+	}
+	if err := q.db.FinishImportJob(job.ID, db.ImportJobResult{
+		ScanImportID:  stats.ID,
+		Hosts:         stats.HostsFound,
+		Ports:         stats.PortsFound,
+		HostsInScope:  stats.InScope,
+		HostsOutScope: stats.OutScope,
+		HostsSkipped:  stats.Skipped,
+		MACChanges:    string(macChanges),
+	}); err != nil {
+		log.Printf("import job %d: %v", job.ID, err)
+		return
+	}
+	q.publishJob(job.ProjectID, job.ID, job.Actor)
+	q.events.Publish(Event{
+		Type:      EventImportCompleted,
+		ProjectID: job.ProjectID,
+		Actor:     job.Actor,
+		Data: map[string]interface{}{
+			"import_id": stats.ID, "filename": job.Filename,
+			"hosts": stats.HostsFound, "ports": stats.PortsFound,
+		},
+	})
+}
+
+func (q *importQueue) fail(job db.ImportJob, cause error) {
+	if err := q.db.FailImportJob(job.ID, cause); err != nil {
+		log.Printf("import job %d: %v", job.ID, err)
+		return
+	}
+	q.publishJob(job.ProjectID, job.ID, job.Actor)
+}
+
+// publishJob sends the job's current state to live subscribers.
+func (q *importQueue) publishJob(projectID, jobID int64, actor string) {
+	job, found, err := q.db.GetImportJob(projectID, jobID)
+	if err != nil || !found {
+		return
+	}
+	q.events.Publish(Event{Type: EventImportJob, ProjectID: projectID, Actor: actor, Data: job})
+}
+
+// Stop tells the workers to exit once their current job is done and waits
+// for them, or for ctx to end. Jobs still running when the process exits are
+// re-queued on the next start.
+func (q *importQueue) Stop(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		if q.tempSpool {
+			os.RemoveAll(q.spoolDir)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// apiSubmitImportJob spools an uploaded scan file to disk and queues it for a
+// background import. It accepts the same form fields as the synchronous
+// import endpoint and answers 202 with the queued job. A file whose content
+// the project already holds is refused with 409 unless force is set; a
+// near-duplicate is only found once the job parses it, and fails the job.
+func (s *Server) apiSubmitImportJob(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSpooledUpload)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.badRequest(w, fmt.Errorf("parse form: %w", err))
+		return
+	}
+
+	values := make(map[string][]string)
+	var filename, spoolPath, contentHash string
+	defer func() {
+		// Cleared once the job owns the file.
+		if spoolPath != "" {
+			os.Remove(spoolPath)
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.badRequest(w, fmt.Errorf("parse form: %w", err))
+			return
+		}
+		if part.FormName() == "file" && spoolPath == "" {
+			filename = filepath.Base(part.FileName())
+			spoolPath, contentHash, err = s.spoolUpload(part)
+			if err != nil {
+				s.badRequest(w, err)
+				return
+			}
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, 1<<20))
+		if err != nil {
+			s.badRequest(w, fmt.Errorf("parse form: %w", err))
+			return
+		}
+		values[part.FormName()] = append(values[part.FormName()], string(value))
+	}
+	if spoolPath == "" {
+		s.badRequest(w, fmt.Errorf("missing file"))
+		return
+	}
+
+	options := importOptionsFromForm(values)
+	if err := importer.ValidateImportOptions(options); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if !options.Force {
+		existing, found, err := s.DB.FindScanImportByHash(projectID, contentHash)
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		if found {
+			s.duplicateImportResponse(w, &importer.DuplicateImportError{Existing: existing, Reason: db.DuplicateContent})
+			return
+		}
+	}
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	job, err := s.actorDB(r).CreateImportJob(projectID, filename, spoolPath, string(encoded))
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	spoolPath = ""
+	s.publish(r, projectID, EventImportJob, job)
+	s.imports.notify()
+
+	w.Header().Set("Location", fmt.Sprintf("/api/projects/%d/imports/jobs/%d", projectID, job.ID))
+	s.jsonResponse(w, job, http.StatusAccepted)
+}
+
+// spoolUpload copies an uploaded file into the spool directory and returns
+// its path and content hash.
+func (s *Server) spoolUpload(r io.Reader) (string, string, error) {
+	f, err := os.CreateTemp(s.imports.spoolDir, "upload-*")
+	if err != nil {
+		return "", "", fmt.Errorf("spool upload: %w", err)
+	}
+	hasher := importer.NewContentHasher()
+	if _, err := io.Copy(io.MultiWriter(f, hasher), r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", "", fmt.Errorf("spool upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", "", fmt.Errorf("spool upload: %w", err)
+	}
+	return f.Name(), hasher.Sum(), nil
+}
+
+func (s *Server) apiListImportJobs(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+			s.badRequest(w, fmt.Errorf("invalid limit"))
+			return
+		}
+	}
+	jobs, err := s.DB.ListImportJobs(projectID, limit)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []db.ImportJob{}
+	}
+	s.jsonResponse(w, jobs, http.StatusOK)
+}
+
+func (s *Server) apiGetImportJob(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil {
+		s.badRequest(w, fmt.Errorf("invalid job id"))
+		return
+	}
+	job, found, err := s.DB.GetImportJob(projectID, jobID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !found {
+		s.errorResponse(w, fmt.Errorf("import job not found"), http.StatusNotFound)
+		return
+	}
+	s.jsonResponse(w, job, http.StatusOK)
+}
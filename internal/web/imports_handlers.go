@@ -3,13 +3,17 @@ package web
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/sloppy/nmaptracker/internal/db"
+	"github.com/sloppy/nmaptracker/internal/importer"
 )
 
 func (s *Server) apiListImports(w http.ResponseWriter, r *http.Request) {
@@ -31,18 +35,23 @@ func (s *Server) apiListImports(w http.ResponseWriter, r *http.Request) {
 		Confidence float64 `json:"confidence"`
 	}
 	type importResponse struct {
-		ID            int64            `json:"id"`
-		ProjectID     int64            `json:"project_id"`
-		Filename      string           `json:"filename"`
-		ImportTime    string           `json:"import_time"`
-		HostsFound    int              `json:"hosts_found"`
-		PortsFound    int              `json:"ports_found"`
-		NmapArgs      string           `json:"nmap_args"`
-		ScannerLabel  string           `json:"scanner_label"`
-		SourceIP      *string          `json:"source_ip"`
-		SourcePort    *int             `json:"source_port"`
-		SourcePortRaw *string          `json:"source_port_raw"`
-		Intents       []intentResponse `json:"intents"`
+		ID             int64            `json:"id"`
+		ProjectID      int64            `json:"project_id"`
+		Filename       string           `json:"filename"`
+		ImportTime     string           `json:"import_time"`
+		HostsFound     int              `json:"hosts_found"`
+		PortsFound     int              `json:"ports_found"`
+		NmapArgs       string           `json:"nmap_args"`
+		ScannerType    string           `json:"scanner_type"`
+		ScannerLabel   string           `json:"scanner_label"`
+		SourceIP       *string          `json:"source_ip"`
+		SourcePort     *int             `json:"source_port"`
+		SourcePortRaw  *string          `json:"source_port_raw"`
+		ScanStartedAt  *string          `json:"scan_started_at"`
+		ScanFinishedAt *string          `json:"scan_finished_at"`
+		ScanTime       string           `json:"scan_time"`
+		RawAvailable   bool             `json:"raw_available"`
+		Intents        []intentResponse `json:"intents"`
 	}
 
 	resp := struct {
@@ -55,18 +64,23 @@ func (s *Server) apiListImports(w http.ResponseWriter, r *http.Request) {
 
 	for _, item := range items {
 		mapped := importResponse{
-			ID:            item.ID,
-			ProjectID:     item.ProjectID,
-			Filename:      item.Filename,
-			ImportTime:    item.ImportTime.UTC().Format("2006-01-02T15:04:05Z"),
-			HostsFound:    item.HostsFound,
-			PortsFound:    item.PortsFound,
-			NmapArgs:      item.NmapArgs,
-			ScannerLabel:  item.ScannerLabel,
-			SourceIP:      item.SourceIP,
-			SourcePort:    item.SourcePort,
-			SourcePortRaw: item.SourcePortRaw,
-			Intents:       make([]intentResponse, 0, len(item.Intents)),
+			ID:             item.ID,
+			ProjectID:      item.ProjectID,
+			Filename:       item.Filename,
+			ImportTime:     item.ImportTime.UTC().Format("2006-01-02T15:04:05Z"),
+			HostsFound:     item.HostsFound,
+			PortsFound:     item.PortsFound,
+			NmapArgs:       item.NmapArgs,
+			ScannerType:    item.ScannerType,
+			ScannerLabel:   item.ScannerLabel,
+			SourceIP:       item.SourceIP,
+			SourcePort:     item.SourcePort,
+			SourcePortRaw:  item.SourcePortRaw,
+			ScanStartedAt:  formatOptionalTime(item.ScanStartedAt),
+			ScanFinishedAt: formatOptionalTime(item.ScanFinishedAt),
+			ScanTime:       item.ScanTime().UTC().Format("2006-01-02T15:04:05Z"),
+			RawAvailable:   item.ArtifactSHA256 != "",
+			Intents:        make([]intentResponse, 0, len(item.Intents)),
 		}
 		for _, intent := range item.Intents {
 			mapped.Intents = append(mapped.Intents, intentResponse{
@@ -116,7 +130,7 @@ func (s *Server) apiSetImportIntents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := s.DB.SetScanImportIntents(projectID, importID, req.Intents); err != nil {
+	if err := s.actorDB(r).SetScanImportIntents(projectID, importID, req.Intents); err != nil {
 		if err == sql.ErrNoRows || strings.Contains(err.Error(), "no rows") {
 			s.errorResponse(w, fmt.Errorf("import not found"), http.StatusNotFound)
 			return
@@ -124,6 +138,157 @@ func (s *Server) apiSetImportIntents(w http.ResponseWriter, r *http.Request) {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventImportIntents, map[string]interface{}{
+		"import_id": importID,
+	})
 
 	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
+
+// apiDeleteScanImport removes an import and rebuilds the hosts and ports it
+// touched from the remaining scan history.
+func (s *Server) apiDeleteScanImport(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	importID, err := strconv.ParseInt(chi.URLParam(r, "importID"), 10, 64)
+	if err != nil {
+		s.badRequest(w, fmt.Errorf("invalid import id"))
+		return
+	}
+
+	stats, err := importer.DeleteScanImport(s.actorDB(r), projectID, importID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, fmt.Errorf("import not found"), http.StatusNotFound)
+			return
+		}
+		s.serverError(w, err)
+		return
+	}
+	result := map[string]interface{}{
+		"import_id":     importID,
+		"filename":      stats.Import.Filename,
+		"hosts_rebuilt": stats.HostsRebuilt,
+		"hosts_removed": stats.HostsRemoved,
+		"ports_removed": stats.PortsRemoved,
+	}
+	s.publish(r, projectID, EventImportDeleted, result)
+	s.jsonResponse(w, result, http.StatusOK)
+}
+
+// apiDownloadImportRaw streams the original file an import was made from.
+func (s *Server) apiDownloadImportRaw(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	importID, err := strconv.ParseInt(chi.URLParam(r, "importID"), 10, 64)
+	if err != nil {
+		s.badRequest(w, fmt.Errorf("invalid import id"))
+		return
+	}
+
+	record, artifact, err := s.DB.GetScanImportArtifact(projectID, importID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			s.errorResponse(w, fmt.Errorf("import not found"), http.StatusNotFound)
+		case errors.Is(err, db.ErrNoScanArtifact):
+			s.errorResponse(w, err, http.StatusNotFound)
+		default:
+			s.serverError(w, err)
+		}
+		return
+	}
+	raw, err := s.DB.ReadScanArtifact(artifact)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	defer raw.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", record.Filename))
+	w.Header().Set("X-Content-SHA256", artifact.SHA256)
+	io.Copy(w, raw)
+}
+
+// apiReparseScanImport parses an import's stored file again and rebuilds the
+// hosts it touches.
+func (s *Server) apiReparseScanImport(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	importID, err := strconv.ParseInt(chi.URLParam(r, "importID"), 10, 64)
+	if err != nil {
+		s.badRequest(w, fmt.Errorf("invalid import id"))
+		return
+	}
+
+	stats, err := importer.ReparseScanImport(s.actorDB(r), projectID, importID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			s.errorResponse(w, fmt.Errorf("import not found"), http.StatusNotFound)
+		case errors.Is(err, db.ErrNoScanArtifact):
+			s.errorResponse(w, err, http.StatusConflict)
+		case errors.Is(err, importer.ErrUnrecognizedFormat):
+			s.errorResponse(w, err, http.StatusUnprocessableEntity)
+		default:
+			s.serverError(w, err)
+		}
+		return
+	}
+	result := map[string]interface{}{
+		"import_id":     importID,
+		"filename":      stats.Import.Filename,
+		"format":        stats.Format,
+		"hosts_before":  stats.Before.HostsFound,
+		"ports_before":  stats.Before.PortsFound,
+		"hosts_found":   stats.Import.HostsFound,
+		"ports_found":   stats.Import.PortsFound,
+		"in_scope":      stats.InScope,
+		"out_scope":     stats.OutScope,
+		"skipped":       stats.Skipped,
+		"hosts_rebuilt": stats.HostsRebuilt,
+		"hosts_removed": stats.HostsRemoved,
+		"ports_removed": stats.PortsRemoved,
+	}
+	s.publish(r, projectID, EventImportReparsed, result)
+	s.jsonResponse(w, result, http.StatusOK)
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.UTC().Format("2006-01-02T15:04:05Z")
+	return &formatted
+}
+
+// apiListDuplicateImports reports groups of completed imports that look like
+// the same scan: identical content, or the same nmap arguments and start
+// time. Imports forced past duplicate detection show up here.
+func (s *Server) apiListDuplicateImports(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	groups, err := s.DB.ListDuplicateImportGroups(projectID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if groups == nil {
+		groups = []db.DuplicateImportGroup{}
+	}
+	s.jsonResponse(w, groups, http.StatusOK)
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// apiGetWorkStatusMetrics reports time from scanned to done per service
+// campaign and per analyst, plus how long ports have sat in their current
+// status.
+func (s *Server) apiGetWorkStatusMetrics(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	metrics, err := s.DB.WorkStatusMetrics(projectID, time.Now().UTC())
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.jsonResponse(w, metrics, http.StatusOK)
+}
+
+// apiListPortStatusHistory returns a port's work status transitions, oldest
+// first.
+func (s *Server) apiListPortStatusHistory(w http.ResponseWriter, r *http.Request) {
+	projectID, hostID, portID, err := projectHostPortIDs(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	port, found, err := s.DB.GetPortByID(portID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !found || port.HostID != hostID {
+		s.errorResponse(w, fmt.Errorf("port not found"), http.StatusNotFound)
+		return
+	}
+	host, found, err := s.DB.GetHostByID(hostID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !found || host.ProjectID != projectID {
+		s.errorResponse(w, fmt.Errorf("host not found"), http.StatusNotFound)
+		return
+	}
+
+	transitions, err := s.DB.ListPortStatusTransitions(portID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if transitions == nil {
+		transitions = []db.PortStatusTransition{}
+	}
+	s.jsonResponse(w, transitions, http.StatusOK)
+}
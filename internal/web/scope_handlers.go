@@ -3,6 +3,7 @@ package web
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -36,20 +37,28 @@ func (s *Server) apiAddScope(w http.ResponseWriter, r *http.Request) {
 	}
 	var req struct {
 		Definitions []string `json:"definitions"`
+		// Type is "include" (default) or "exclude".
+		Type string `json:"type"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.badRequest(w, err)
 		return
 	}
 
-	count, err := s.DB.BulkAddScopeDefinitions(id, req.Definitions)
+	version, err := s.actorDB(r).BulkAddScopeDefinitions(id, req.Definitions, req.Type)
 	if err != nil {
+		if errors.Is(err, scope.ErrInvalidRule) {
+			s.badRequest(w, err)
+			return
+		}
 		s.serverError(w, err)
 		return
 	}
 
-	// Return updated list
-	// Actually plan said: Response: { "added": 3, "rules": [...] }
+	s.publish(r, id, EventScopeEvaluated, map[string]interface{}{
+		"version": version.Version, "updated": version.HostsUpdated,
+	})
+
 	rules, err := s.DB.ListScopeDefinitions(id)
 	if err != nil {
 		s.serverError(w, err)
@@ -57,8 +66,10 @@ func (s *Server) apiAddScope(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.jsonResponse(w, map[string]interface{}{
-		"added": count,
-		"rules": rules,
+		"added":   len(version.Changes),
+		"rules":   rules,
+		"version": version.Version,
+		"updated": version.HostsUpdated,
 	}, http.StatusCreated)
 }
 
@@ -74,7 +85,8 @@ func (s *Server) apiDeleteScope(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.DB.DeleteScopeDefinitionForProject(projectID, scopeID); err != nil {
+	version, err := s.actorDB(r).DeleteScopeDefinitionForProject(projectID, scopeID)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			s.errorResponse(w, fmt.Errorf("scope not found"), http.StatusNotFound)
 			return
@@ -82,6 +94,9 @@ func (s *Server) apiDeleteScope(w http.ResponseWriter, r *http.Request) {
 		s.serverError(w, err)
 		return
 	}
+	s.publish(r, projectID, EventScopeEvaluated, map[string]interface{}{
+		"version": version.Version, "updated": version.HostsUpdated,
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -92,81 +107,24 @@ func (s *Server) apiEvaluateScope(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch all rules
-	rules, err := s.DB.ListScopeDefinitions(id)
-	if err != nil {
-		s.serverError(w, err)
-		return
-	}
-
-	// Build Matcher
-	var defs []string
-	for _, r := range rules {
-		defs = append(defs, r.Definition)
-	}
-	matcher, err := scope.NewMatcher(defs)
-	if err != nil {
-		s.serverError(w, fmt.Errorf("build matcher: %w", err))
-		return
-	}
-
-	// Fetch all hosts
-	// We need a method to iterate all hosts and update them.
-	// Listing all might be heavy. Is there a better way?
-	// Maybe an IterateHosts method? Or just ListHosts (MVP).
-	// Let's use ListHosts. But existing ListHosts is paged.
-	// We need a raw ListAllHosts logic or direct DB update query logic?
-	// Doing it in app logic:
-	// 1. Get all hosts
-	// 2. Check scope
-	// 3. Update if changed
-
-	// But ListHostsWithSummaryPaged is complex.
-	// We might need a simpler ListHostsForProject db method.
-	// Let's assume we can add one or use an existing one?
-	// Checking db/host_list.go might reveal it.
-	// For now, let's implement a loop over paged results or just add a simple ListAllHosts method to DB?
-	// Adding ListAllHosts to DB is cleaner.
-
-	// But wait, there is no ListAllHosts in DB yet.
-	// I will write this handler assuming I add ListAllHosts to DB or similar.
-	// Or I can just check db directly here? No, Separation of Concerns.
-	// I'll add `ListAllHosts(projectID)` to `db` later.
-
-	hosts, err := s.DB.ListHosts(id)
+	eval, err := s.DB.EvaluateScope(id)
 	if err != nil {
+		if errors.Is(err, scope.ErrInvalidRule) {
+			s.badRequest(w, err)
+			return
+		}
 		s.serverError(w, err)
 		return
 	}
 
-	updated := 0
-	inScopeCount := 0
-	outScopeCount := 0
-
-	for _, h := range hosts {
-		inScope := matcher.InScope(h.IPAddress)
-		if inScope {
-			inScopeCount++
-		} else {
-			outScopeCount++
-		}
-
-		if h.InScope != inScope {
-			// Update
-			// We need a simple UpdateHostScope method or use UpsertHost (heavy).
-			// Let's use UpdateHostScope (to be implemented).
-			if err := s.DB.UpdateHostScope(h.ID, inScope); err != nil {
-				s.serverError(w, err)
-				return
-			}
-			updated++
-		}
-	}
+	s.publish(r, id, EventScopeEvaluated, map[string]interface{}{
+		"updated": eval.Updated,
+	})
 
 	s.jsonResponse(w, map[string]interface{}{
-		"updated":      updated,
-		"in_scope":     inScopeCount,
-		"out_of_scope": outScopeCount,
+		"updated":      eval.Updated,
+		"in_scope":     eval.InScope,
+		"out_of_scope": eval.OutOfScope,
 	}, http.StatusOK)
 }
 
@@ -192,34 +150,19 @@ func (s *Server) apiImportXML(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Scope
-	rules, err := s.DB.ListScopeDefinitions(projectID)
-	if err != nil {
-		s.serverError(w, err)
-		return
-	}
-	var defs []string
-	for _, r := range rules {
-		defs = append(defs, r.Definition)
-	}
-	matcher, err := scope.NewMatcher(defs)
+	matcher, err := importer.ProjectScopeMatcher(s.DB, projectID)
 	if err != nil {
 		s.serverError(w, err)
 		return
 	}
 
 	// Import
-	manualIntents := collectManualImportIntents(r.MultipartForm.Value["intent"], r.MultipartForm.Value["intents"])
-	options := importer.ImportOptions{
-		ManualIntents:    manualIntents,
-		ScannerLabel:     firstMultipartValue(r.MultipartForm.Value["scanner_label"]),
-		ManualSourceIP:   firstMultipartValue(r.MultipartForm.Value["source_ip"]),
-		ManualSourcePort: firstMultipartValue(r.MultipartForm.Value["source_port"]),
-	}
+	options := importOptionsFromForm(r.MultipartForm.Value)
 	if err := importer.ValidateImportOptions(options); err != nil {
 		s.badRequest(w, err)
 		return
 	}
-	stats, err := importer.ImportXMLWithOptions(
+	stats, err := importer.ImportWithOptions(
 		s.DB,
 		matcher,
 		projectID,
@@ -229,21 +172,75 @@ func (s *Server) apiImportXML(w http.ResponseWriter, r *http.Request) {
 		time.Now().UTC(),
 	)
 	if err != nil {
+		if errors.Is(err, importer.ErrUnrecognizedFormat) {
+			s.badRequest(w, err)
+			return
+		}
+		var duplicate *importer.DuplicateImportError
+		if errors.As(err, &duplicate) {
+			s.duplicateImportResponse(w, duplicate)
+			return
+		}
 		s.serverError(w, err)
 		return
 	}
 
+	s.publish(r, projectID, EventImportCompleted, map[string]interface{}{
+		"import_id": stats.ID, "filename": header.Filename,
+		"hosts": stats.HostsFound, "ports": stats.PortsFound,
+	})
+
 	s.jsonResponse(w, map[string]interface{}{
-		"success":         true,
-		"filename":        header.Filename,
-		"hosts_imported":  stats.HostsFound,
-		"hosts_skipped":   stats.Skipped,
-		"ports_imported":  stats.PortsFound,
-		"hosts_in_scope":  stats.InScope,
-		"hosts_out_scope": stats.OutScope,
+		"success":            true,
+		"filename":           header.Filename,
+		"hosts_imported":     stats.HostsFound,
+		"hosts_skipped":      stats.Skipped,
+		"ports_imported":     stats.PortsFound,
+		"hosts_in_scope":     stats.InScope,
+		"hosts_out_scope":    stats.OutScope,
+		"mac_changes":        macChangesResponse(stats.MACChanges),
+		"content_sha256":     stats.ContentSHA256,
+		"ports_not_observed": stats.PortsNotObserved,
 	}, http.StatusOK)
 }
 
+// duplicateImportResponse answers 409 with the import an upload repeats, so
+// the client can offer to resend it with force set.
+func (s *Server) duplicateImportResponse(w http.ResponseWriter, duplicate *importer.DuplicateImportError) {
+	s.jsonResponse(w, map[string]interface{}{
+		"error":           duplicate.Error(),
+		"reason":          duplicate.Reason,
+		"existing_import": duplicate.Existing,
+	}, http.StatusConflict)
+}
+
+// importOptionsFromForm reads the optional import fields of an upload form.
+func importOptionsFromForm(values map[string][]string) importer.ImportOptions {
+	force, _ := strconv.ParseBool(firstMultipartValue(values["force"]))
+	return importer.ImportOptions{
+		ManualIntents:    collectManualImportIntents(values["intent"], values["intents"]),
+		ScanArgs:         firstMultipartValue(values["scan_args"]),
+		ScannerLabel:     firstMultipartValue(values["scanner_label"]),
+		ManualSourceIP:   firstMultipartValue(values["source_ip"]),
+		ManualSourcePort: firstMultipartValue(values["source_port"]),
+		Force:            force,
+	}
+}
+
+func macChangesResponse(changes []importer.MACChange) []map[string]string {
+	out := make([]map[string]string, 0, len(changes))
+	for _, change := range changes {
+		out = append(out, map[string]string{
+			"ip_address":      change.IPAddress,
+			"previous_mac":    change.PreviousMAC,
+			"previous_vendor": change.PreviousVendor,
+			"mac_address":     change.MACAddress,
+			"mac_vendor":      change.MACVendor,
+		})
+	}
+	return out
+}
+
 func collectManualImportIntents(values ...[]string) []string {
 	var intents []string
 	for _, group := range values {
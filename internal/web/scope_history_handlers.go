@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// apiListScopeHistory returns every recorded scope version, newest first.
+func (s *Server) apiListScopeHistory(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	versions, err := s.DB.ListScopeVersions(projectID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if versions == nil {
+		versions = []db.ScopeVersion{}
+	}
+	s.jsonResponse(w, versions, http.StatusOK)
+}
+
+// apiGetScopeAsOf returns the scope rules in effect at a point in time and,
+// when ip is given, whether that host was in scope then:
+//
+//	GET /projects/{id}/scope/as-of?at=2024-03-01&ip=10.0.0.5
+//
+// A bare date covers the whole day; an RFC 3339 timestamp is exact.
+func (s *Server) apiGetScopeAsOf(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	at, err := parseAsOf(r.URL.Query().Get("at"))
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+
+	version, found, err := s.DB.GetScopeVersionAt(projectID, at)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	resp := map[string]interface{}{
+		"at":      at.UTC().Format(time.RFC3339),
+		"version": nil,
+		"rules":   []db.ScopeRuleSnapshot{},
+	}
+	if found {
+		resp["version"] = version
+		resp["rules"] = version.Rules
+	}
+
+	if ip := strings.TrimSpace(r.URL.Query().Get("ip")); ip != "" {
+		matcher, err := version.Matcher()
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		hostname := ""
+		host, hostFound, err := s.DB.GetHostByIP(projectID, ip)
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		if hostFound {
+			hostname = host.Hostname
+		}
+		resp["ip_address"] = ip
+		resp["in_scope"] = matcher.Match(ip, hostname)
+	}
+	s.jsonResponse(w, resp, http.StatusOK)
+}
+
+// apiListHostScopeTransitions returns the recorded in/out-of-scope changes of
+// one host.
+func (s *Server) apiListHostScopeTransitions(w http.ResponseWriter, r *http.Request) {
+	projectID, hostID, err := projectHostIDs(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	host, found, err := s.DB.GetHostByID(hostID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !found || host.ProjectID != projectID {
+		s.errorResponse(w, fmt.Errorf("host not found"), http.StatusNotFound)
+		return
+	}
+
+	transitions, err := s.DB.ListHostScopeTransitions(projectID, hostID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if transitions == nil {
+		transitions = []db.HostScopeTransition{}
+	}
+	s.jsonResponse(w, transitions, http.StatusOK)
+}
+
+// parseAsOf accepts an RFC 3339 timestamp or a YYYY-MM-DD date. A date is
+// taken to mean the end of that day (UTC).
+func parseAsOf(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("at is required")
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	if d, err := time.Parse("2006-01-02", raw); err == nil {
+		return d.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid at %q: use YYYY-MM-DD or RFC 3339", raw)
+}
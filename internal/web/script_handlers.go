@@ -0,0 +1,72 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sloppy/nmaptracker/internal/db"
+)
+
+// apiListScriptResults returns the latest result of a script per host/port,
+// optionally narrowed to one element of its parsed output:
+//
+//	GET /projects/{id}/scripts?script_id=ssl-cert&key=subject.commonName&value=example
+func (s *Server) apiListScriptResults(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	q := db.ScriptResultQuery{
+		ScriptID:   strings.TrimSpace(query.Get("script_id")),
+		IPAddress:  strings.TrimSpace(query.Get("ip")),
+		ElementKey: strings.TrimSpace(query.Get("key")),
+		Value:      strings.TrimSpace(query.Get("value")),
+	}
+	if q.ScriptID == "" {
+		s.badRequest(w, fmt.Errorf("script_id is required"))
+		return
+	}
+
+	results, err := s.DB.ListScriptResults(projectID, q)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if results == nil {
+		results = []db.ScriptResultMatch{}
+	}
+	s.jsonResponse(w, results, http.StatusOK)
+}
+
+// apiListHostScriptResults returns the latest host- and port-level script
+// results recorded for one host.
+func (s *Server) apiListHostScriptResults(w http.ResponseWriter, r *http.Request) {
+	projectID, hostID, err := projectHostIDs(r)
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	host, found, err := s.DB.GetHostByID(hostID)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if !found || host.ProjectID != projectID {
+		s.errorResponse(w, fmt.Errorf("host not found"), http.StatusNotFound)
+		return
+	}
+
+	results, err := s.DB.ListScriptResults(projectID, db.ScriptResultQuery{IPAddress: host.IPAddress})
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if results == nil {
+		results = []db.ScriptResultMatch{}
+	}
+	s.jsonResponse(w, results, http.StatusOK)
+}
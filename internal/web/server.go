@@ -1,10 +1,13 @@
 package web
 
 import (
+	"context"
 	"embed"
+	"fmt"
 	"io/fs"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 
@@ -19,57 +22,178 @@ var frontendFS embed.FS
 type Server struct {
 	DB     *db.DB
 	Router chi.Router
+	// Events carries live project updates to Server-Sent Event streams.
+	Events *Hub
+
+	trustedOrigins map[string]bool
+	trustedProxies []netip.Prefix
+	imports        *importQueue
+}
+
+// Options configures how the server is reached when it is not only used from
+// localhost.
+type Options struct {
+	// TrustedOrigins are browser origins (scheme://host[:port]) allowed to
+	// make mutating API requests in addition to localhost.
+	TrustedOrigins []string
+	// TrustedProxies are addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host are believed.
+	TrustedProxies []string
+	// SpoolDir holds uploads waiting for a background import. It should
+	// persist across restarts so queued jobs can resume; empty uses a new
+	// temporary directory that Close removes.
+	SpoolDir string
+	// ImportWorkers bounds concurrent background imports; zero uses
+	// DefaultImportWorkers.
+	ImportWorkers int
 }
 
-// NewServer constructs the router and registers routes.
+// NewServer constructs the router for a localhost-only server. It panics if
+// the import queue cannot start.
 func NewServer(database *db.DB) *Server {
-	server := &Server{DB: database}
+	server, err := NewServerWithOptions(database, Options{})
+	if err != nil {
+		panic(err)
+	}
+	return server
+}
+
+// NewServerWithOptions constructs the router and registers routes, rejecting
+// malformed trusted origins or proxies.
+func NewServerWithOptions(database *db.DB, opts Options) (*Server, error) {
+	server := &Server{DB: database, Events: NewHub(), trustedOrigins: make(map[string]bool)}
+	for _, raw := range opts.TrustedOrigins {
+		origin, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (origin.Scheme != "http" && origin.Scheme != "https") || origin.Host == "" || strings.Trim(origin.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid trusted origin %q: use scheme://host[:port]", raw)
+		}
+		server.trustedOrigins[originKey(origin)] = true
+	}
+	for _, raw := range opts.TrustedProxies {
+		prefix, err := parseProxyPrefix(raw)
+		if err != nil {
+			return nil, err
+		}
+		server.trustedProxies = append(server.trustedProxies, prefix)
+	}
+
+	imports, err := newImportQueue(database, server.Events, opts.SpoolDir, opts.ImportWorkers)
+	if err != nil {
+		return nil, err
+	}
+	server.imports = imports
 
 	r := chi.NewRouter()
+	r.Use(server.forwardedHeaders)
 
 	// API Routes
 	r.Route("/api", func(r chi.Router) {
-		r.Use(csrfGuard)
+		r.Use(server.csrfGuard)
+		r.Use(server.authenticate)
+
+		// Accounts
+		r.Post("/auth/login", server.apiLogin)
+		r.Post("/auth/logout", server.apiLogout)
+		r.Get("/auth/me", server.apiCurrentUser)
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireUser)
+			r.Get("/auth/tokens", server.apiListTokens)
+			r.Post("/auth/tokens", server.apiCreateToken)
+			r.Delete("/auth/tokens/{tokenID}", server.apiDeleteToken)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireSiteAdmin)
+			r.Get("/users", server.apiListUsers)
+			r.Post("/users", server.apiCreateUser)
+			r.Put("/users/{userID}/password", server.apiSetUserPassword)
+			r.Delete("/users/{userID}", server.apiDeleteUser)
+		})
+
 		r.Get("/projects", server.apiListProjects)
 		r.Post("/projects", server.apiCreateProject)
-		r.Get("/projects/{id}", server.apiGetProject)
-		r.Delete("/projects/{id}", server.apiDeleteProject)
-		r.Put("/projects/{id}", server.apiUpdateProject)
-		r.Get("/projects/{id}/stats", server.apiGetProjectStats)
-		r.Get("/projects/{id}/hosts", server.apiListHosts)
-		r.Get("/projects/{id}/ports/all", server.apiListProjectPorts)
-		r.Post("/projects/{id}/ports/bulk-status", server.apiProjectBulkPortStatus)
-		r.Get("/projects/{id}/hosts/{hostID}", server.apiGetHost)
-		r.Get("/projects/{id}/hosts/{hostID}/ports", server.apiListPorts)
-		r.Delete("/projects/{id}/hosts/{hostID}", server.apiDeleteHost)
-		r.Put("/projects/{id}/hosts/{hostID}/notes", server.apiUpdateHostNotes)
-		r.Put("/projects/{id}/hosts/{hostID}/latest-scan", server.apiUpdateHostLatestScan)
-		r.Put("/projects/{id}/hosts/{hostID}/ports/{portID}/status", server.apiUpdatePortStatus)
-		r.Put("/projects/{id}/hosts/{hostID}/ports/{portID}/notes", server.apiUpdatePortNotes)
-		r.Post("/projects/{id}/hosts/{hostID}/bulk-status", server.apiHostBulkStatus)
-
-		// Scope
-		r.Get("/projects/{id}/scope", server.apiListScope)
-		r.Post("/projects/{id}/scope", server.apiAddScope)
-		r.Delete("/projects/{id}/scope/{scopeID}", server.apiDeleteScope)
-		r.Post("/projects/{id}/scope/evaluate", server.apiEvaluateScope)
-
-		// Import
-		r.Post("/projects/{id}/import", server.apiImportXML)
-		r.Get("/projects/{id}/imports", server.apiListImports)
-		r.Put("/projects/{id}/imports/{importID}/intents", server.apiSetImportIntents)
-		r.Get("/projects/{id}/coverage-matrix", server.apiGetCoverageMatrix)
-		r.Get("/projects/{id}/coverage-matrix/missing", server.apiGetCoverageMatrixMissing)
-		r.Get("/projects/{id}/queues/services", server.apiListServiceQueue)
-		r.Get("/projects/{id}/delta", server.apiGetImportDelta)
-		r.Get("/projects/{id}/baseline", server.apiListBaseline)
-		r.Post("/projects/{id}/baseline", server.apiAddBaseline)
-		r.Delete("/projects/{id}/baseline/{baselineID}", server.apiDeleteBaseline)
-		r.Get("/projects/{id}/baseline/evaluate", server.apiEvaluateBaseline)
-
-		// Exports (files)
-		r.Get("/projects/{id}/export", server.handleProjectExport)
-		r.Get("/projects/{id}/hosts/{hostID}/export", server.handleHostExport)
+
+		// Read access: viewer and above.
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireProjectRole(db.RoleViewer))
+			r.Get("/projects/{id}", server.apiGetProject)
+			r.Get("/projects/{id}/stats", server.apiGetProjectStats)
+			r.Get("/projects/{id}/events", server.apiProjectEvents)
+			r.Get("/projects/{id}/members", server.apiListMembers)
+			r.Get("/projects/{id}/hosts", server.apiListHosts)
+			r.Get("/projects/{id}/ports/all", server.apiListProjectPorts)
+			r.Get("/projects/{id}/hosts/{hostID}", server.apiGetHost)
+			r.Get("/projects/{id}/hosts/{hostID}/ports", server.apiListPorts)
+			r.Get("/projects/{id}/hosts/{hostID}/ports/{portID}/status-history", server.apiListPortStatusHistory)
+			r.Get("/projects/{id}/hosts/{hostID}/scripts", server.apiListHostScriptResults)
+			r.Get("/projects/{id}/hosts/{hostID}/scope-transitions", server.apiListHostScopeTransitions)
+			r.Get("/projects/{id}/hosts/{hostID}/timeline", server.apiGetHostTimeline)
+			r.Get("/projects/{id}/audit", server.apiListAuditEvents)
+			r.Get("/projects/{id}/metrics/work-status", server.apiGetWorkStatusMetrics)
+			r.Get("/projects/{id}/scripts", server.apiListScriptResults)
+
+			// Scope
+			r.Get("/projects/{id}/scope", server.apiListScope)
+			r.Get("/projects/{id}/scope/history", server.apiListScopeHistory)
+			r.Get("/projects/{id}/scope/as-of", server.apiGetScopeAsOf)
+
+			// Import
+			r.Get("/projects/{id}/imports", server.apiListImports)
+			r.Get("/projects/{id}/imports/duplicates", server.apiListDuplicateImports)
+			r.Get("/projects/{id}/imports/jobs", server.apiListImportJobs)
+			r.Get("/projects/{id}/imports/jobs/{jobID}", server.apiGetImportJob)
+			r.Get("/projects/{id}/imports/{importID}/raw", server.apiDownloadImportRaw)
+			r.Get("/projects/{id}/coverage-matrix", server.apiGetCoverageMatrix)
+			r.Get("/projects/{id}/coverage-matrix/missing", server.apiGetCoverageMatrixMissing)
+			r.Get("/projects/{id}/queues/services", server.apiListServiceQueue)
+			r.Get("/projects/{id}/delta", server.apiGetImportDelta)
+			r.Get("/projects/{id}/baseline", server.apiListBaseline)
+			r.Get("/projects/{id}/baseline/evaluate", server.apiEvaluateBaseline)
+
+			// Exports (files)
+			r.Get("/projects/{id}/export", server.handleProjectExport)
+			r.Get("/projects/{id}/hosts/{hostID}/export", server.handleHostExport)
+		})
+
+		// Workflow changes: analyst and above, on projects that are not
+		// archived.
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireProjectRole(db.RoleAnalyst))
+			r.Use(server.requireWritableProject)
+			r.Post("/projects/{id}/ports/bulk-status", server.apiProjectBulkPortStatus)
+			r.Delete("/projects/{id}/hosts/{hostID}", server.apiDeleteHost)
+			r.Put("/projects/{id}/hosts/{hostID}/notes", server.apiUpdateHostNotes)
+			r.Put("/projects/{id}/hosts/{hostID}/latest-scan", server.apiUpdateHostLatestScan)
+			r.Put("/projects/{id}/hosts/{hostID}/ports/{portID}/status", server.apiUpdatePortStatus)
+			r.Put("/projects/{id}/hosts/{hostID}/ports/{portID}/notes", server.apiUpdatePortNotes)
+			r.Post("/projects/{id}/hosts/{hostID}/bulk-status", server.apiHostBulkStatus)
+			r.Post("/projects/{id}/scope/evaluate", server.apiEvaluateScope)
+			r.Post("/projects/{id}/import", server.apiImportXML)
+			r.Post("/projects/{id}/imports/jobs", server.apiSubmitImportJob)
+			r.Put("/projects/{id}/imports/{importID}/intents", server.apiSetImportIntents)
+			r.Delete("/projects/{id}/imports/{importID}", server.apiDeleteScanImport)
+			r.Post("/projects/{id}/imports/{importID}/reparse", server.apiReparseScanImport)
+			r.Post("/projects/{id}/baseline", server.apiAddBaseline)
+			r.Delete("/projects/{id}/baseline/{baselineID}", server.apiDeleteBaseline)
+		})
+
+		// Project configuration: admin.
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireProjectRole(db.RoleAdmin))
+			r.Delete("/projects/{id}", server.apiDeleteProject)
+			r.Post("/projects/{id}/archive", server.apiArchiveProject)
+			r.Delete("/projects/{id}/archive", server.apiArchiveProject)
+			r.Post("/projects/{id}/clone", server.apiCloneProject)
+			r.Put("/projects/{id}/members/{userID}", server.apiSetMember)
+			r.Delete("/projects/{id}/members/{userID}", server.apiDeleteMember)
+
+			r.Group(func(r chi.Router) {
+				r.Use(server.requireWritableProject)
+				r.Put("/projects/{id}", server.apiUpdateProject)
+				r.Post("/projects/{id}/merge", server.apiMergeProject)
+				r.Post("/projects/{id}/scope", server.apiAddScope)
+				r.Delete("/projects/{id}/scope/{scopeID}", server.apiDeleteScope)
+			})
+		})
 	})
 
 	// Static Files
@@ -78,7 +202,7 @@ func NewServer(database *db.DB) *Server {
 	r.Handle("/*", fileServer)
 
 	server.Router = r
-	return server
+	return server, nil
 }
 
 // Handler exposes the configured router.
@@ -86,7 +210,16 @@ func (s *Server) Handler() http.Handler {
 	return s.Router
 }
 
-func csrfGuard(next http.Handler) http.Handler {
+// Close ends live event streams and stops the import workers, waiting for
+// running imports to finish until ctx is done.
+func (s *Server) Close(ctx context.Context) error {
+	s.Events.Close()
+	return s.imports.Stop(ctx)
+}
+
+// csrfGuard rejects mutating browser requests from foreign origins. Requests
+// without an Origin header (CLI, curl, scripts) pass.
+func (s *Server) csrfGuard(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
@@ -109,6 +242,11 @@ func csrfGuard(next http.Handler) http.Handler {
 			return
 		}
 
+		if s.trustedOrigins[originKey(originURL)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		originHost := originURL.Hostname()
 		if !isLocalHost(originHost) {
 			http.Error(w, "invalid origin", http.StatusForbidden)
@@ -147,3 +285,20 @@ func isLocalHost(host string) bool {
 		return false
 	}
 }
+
+// originKey normalises an origin for comparison, dropping default ports the
+// way browsers do in the Origin header.
+func originKey(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host
+}